@@ -0,0 +1,81 @@
+package k8s
+
+import (
+	"context"
+	"time"
+
+	"github.com/hashicorp/vault/api"
+	"github.com/pkg/errors"
+)
+
+// agentAuthenticator uses the auto-auth token of a Vault Agent instead of a login, the token is
+// looked up through a listener of the agent with use_auto_auth_token
+// If the agent cannot be reached, the login of the auth method is used.
+type agentAuthenticator struct {
+	v        *Vault
+	fallback Authenticator
+}
+
+// Login returns the auto-auth token of the agent as the auth of a login
+func (a agentAuthenticator) Login(ctx context.Context, c *api.Client) (*api.Secret, error) {
+	v := a.v
+	s, err := v.agentToken(ctx)
+	if err != nil {
+		if failureReason(err) != reasonConnection {
+			return nil, err
+		}
+		v.log().Info("vault agent not reachable, logging in", "agent", v.AgentAddress, "error", err)
+		return a.fallback.Login(ctx, c)
+	}
+	v.log().Debug("using auto-auth token of vault agent", "agent", v.AgentAddress)
+	return s, nil
+}
+
+// agentToken looks up the auto-auth token through the agent
+func (v *Vault) agentToken(ctx context.Context) (*api.Secret, error) {
+	cfg := api.DefaultConfig()
+	cfg.Address = v.AgentAddress
+	c, err := api.NewClient(cfg)
+	if err != nil {
+		return nil, errors.Wrap(err, "failed to create vault agent client")
+	}
+	// the agent adds its auto-auth token to requests without a token
+	c.ClearToken()
+	s, err := vaultLookupSelf(ctx, c)
+	if err != nil {
+		return nil, errors.Wrap(err, "failed to lookup the auto-auth token of vault agent")
+	}
+	if s == nil || s.Data == nil {
+		return nil, errors.New("vault agent returned no token")
+	}
+	token, _ := s.Data["id"].(string)
+	if token == "" {
+		return nil, errors.New("vault agent returned no token, use_auto_auth_token is required")
+	}
+	info, err := parseTokenInfo(s)
+	if err != nil {
+		return nil, err
+	}
+	accessor, _ := s.Data["accessor"].(string)
+	return &api.Secret{
+		Auth: &api.SecretAuth{
+			ClientToken:   token,
+			Accessor:      accessor,
+			Policies:      stringList(s.Data["policies"]),
+			LeaseDuration: int(info.ttl / time.Second),
+			Renewable:     info.renewable,
+		},
+	}, nil
+}
+
+// stringList returns the strings of a list of a Vault response
+func stringList(v interface{}) []string {
+	l, _ := v.([]interface{})
+	var s []string
+	for _, e := range l {
+		if str, ok := e.(string); ok {
+			s = append(s, str)
+		}
+	}
+	return s
+}
@@ -0,0 +1,50 @@
+package k8s
+
+import (
+	"context"
+
+	"github.com/pkg/errors"
+)
+
+// SoftFailure is the result of a failed login which is not fatal because AllowFail is true, the
+// caller continues without a token, e.g. an application which works with reduced functionality
+type SoftFailure struct {
+	// Err is the cause of the failure, an *AuthError for a failed login
+	Err error
+}
+
+// Kind returns the AuthErrorKind of the cause
+func (f *SoftFailure) Kind() error {
+	return AuthErrorKind(f.Err)
+}
+
+// TryAuthenticate is AuthenticateWithContext honoring AllowFail
+// With AllowFail a failed login returns an empty token and a *SoftFailure instead of an error,
+// without AllowFail or if ctx is done the error is returned. Exactly one of the token, the
+// *SoftFailure and the error is set.
+func (v *Vault) TryAuthenticate(ctx context.Context) (string, *SoftFailure, error) {
+	token, err := v.AuthenticateWithContext(ctx)
+	return v.allowFail(ctx, token, err)
+}
+
+// TryGetToken is GetTokenWithContext honoring AllowFail like TryAuthenticate
+func (v *Vault) TryGetToken(ctx context.Context) (string, *SoftFailure, error) {
+	token, err := v.GetTokenWithContext(ctx)
+	return v.allowFail(ctx, token, err)
+}
+
+// allowFail turns err into a *SoftFailure if AllowFail is true
+func (v *Vault) allowFail(ctx context.Context, token string, err error) (string, *SoftFailure, error) {
+	if err == nil {
+		return token, nil, nil
+	}
+	if !v.AllowFail || ctx.Err() != nil {
+		return "", nil, err
+	}
+	switch errors.Cause(err) {
+	case context.Canceled, context.DeadlineExceeded:
+		return "", nil, err
+	}
+	v.log().Info("login failed, continuing without token", "error", err)
+	return "", &SoftFailure{Err: err}, nil
+}
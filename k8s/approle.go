@@ -0,0 +1,119 @@
+package k8s
+
+import (
+	"bytes"
+	"io/ioutil"
+	"os"
+	"strconv"
+
+	"github.com/hashicorp/vault/api"
+	"github.com/pkg/errors"
+)
+
+// Auth methods of Vault
+const (
+	AuthMethodKubernetes = "kubernetes"
+	AuthMethodAppRole    = "approle"
+)
+
+// vaultUnwrap will be overwritten by tests
+var vaultUnwrap = func(c *api.Client, token string) (*api.Secret, error) {
+	return c.Logical().Unwrap(token)
+}
+
+// AppRole contains the credentials of the AppRole auth method, the ID and the path of a file
+// containing the ID are alternatives
+type AppRole struct {
+	RoleID       string `yaml:"roleID"`
+	RoleIDPath   string `yaml:"roleIDPath"`
+	SecretID     string `yaml:"secretID"`
+	SecretIDPath string `yaml:"secretIDPath"`
+	// SecretIDWrapped is true if the secret ID is a response-wrapping token of the secret ID
+	SecretIDWrapped bool `yaml:"secretIDWrapped"`
+
+	// unwrapped secret ID, a wrapping token can only be used once
+	unwrapped string
+}
+
+// appRoleFromEnvironment reads the AppRole credentials from the environment
+func appRoleFromEnvironment() (*AppRole, error) {
+	a := &AppRole{
+		RoleID:       os.Getenv("VAULT_APPROLE_ROLE_ID"),
+		RoleIDPath:   os.Getenv("VAULT_APPROLE_ROLE_ID_PATH"),
+		SecretID:     os.Getenv("VAULT_APPROLE_SECRET_ID"),
+		SecretIDPath: os.Getenv("VAULT_APPROLE_SECRET_ID_PATH"),
+	}
+	if s := os.Getenv("VAULT_APPROLE_SECRET_ID_WRAPPED"); s != "" {
+		b, err := strconv.ParseBool(s)
+		if err != nil {
+			return nil, errors.Wrap(err, "1, t, T, TRUE, true, True, 0, f, F, FALSE, false, False are valid values for VAULT_APPROLE_SECRET_ID_WRAPPED")
+		}
+		a.SecretIDWrapped = b
+	}
+	if err := a.validate(); err != nil {
+		return nil, err
+	}
+	return a, nil
+}
+
+// validate checks that exactly one source is set for the role ID and at most one for the secret ID
+func (a *AppRole) validate() error {
+	if (a.RoleID == "") == (a.RoleIDPath == "") {
+		return errors.New("either approle role id or role id path is required")
+	}
+	if a.SecretID != "" && a.SecretIDPath != "" {
+		return errors.New("approle secret id and secret id path are mutually exclusive")
+	}
+	if a.SecretIDWrapped && a.SecretID == "" && a.SecretIDPath == "" {
+		return errors.New("missing wrapped approle secret id")
+	}
+	return nil
+}
+
+// loginData returns the data of the AppRole login
+func (a *AppRole) loginData(c *api.Client) (map[string]interface{}, error) {
+	roleID, err := valueOrFile(a.RoleID, a.RoleIDPath)
+	if err != nil {
+		return nil, errors.Wrap(err, "failed to read approle role id")
+	}
+	data := map[string]interface{}{
+		"role_id": roleID,
+	}
+	secretID := a.unwrapped
+	if secretID == "" {
+		secretID, err = valueOrFile(a.SecretID, a.SecretIDPath)
+		if err != nil {
+			return nil, errors.Wrap(err, "failed to read approle secret id")
+		}
+		if a.SecretIDWrapped {
+			s, err := vaultUnwrap(c, secretID)
+			if err != nil {
+				return nil, errors.Wrap(err, "failed to unwrap approle secret id")
+			}
+			if s == nil {
+				return nil, errors.New("unwrapping approle secret id returned no data")
+			}
+			secretID, _ = s.Data["secret_id"].(string)
+			if secretID == "" {
+				return nil, errors.New("unwrapped data contains no approle secret id")
+			}
+			a.unwrapped = secretID
+		}
+	}
+	if secretID != "" {
+		data["secret_id"] = secretID
+	}
+	return data, nil
+}
+
+// valueOrFile returns value or the trimmed content of the file p if value is empty
+func valueOrFile(value, p string) (string, error) {
+	if value != "" || p == "" {
+		return value, nil
+	}
+	content, err := ioutil.ReadFile(p)
+	if err != nil {
+		return "", err
+	}
+	return string(bytes.TrimSpace(content)), nil
+}
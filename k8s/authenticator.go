@@ -0,0 +1,53 @@
+package k8s
+
+import (
+	"context"
+	"strings"
+
+	"github.com/hashicorp/vault/api"
+	"github.com/pkg/errors"
+)
+
+// Authenticator logs in to Vault with the Vault client c and returns the secret of the login
+// containing the token
+type Authenticator interface {
+	Login(ctx context.Context, c *api.Client) (*api.Secret, error)
+}
+
+// AuthenticatorFunc is a function implementing Authenticator
+type AuthenticatorFunc func(ctx context.Context, c *api.Client) (*api.Secret, error)
+
+// Login calls f
+func (f AuthenticatorFunc) Login(ctx context.Context, c *api.Client) (*api.Secret, error) {
+	return f(ctx, c)
+}
+
+// Chain returns an Authenticator trying the authenticators in order until a login succeeds
+func Chain(authenticators ...Authenticator) Authenticator {
+	return AuthenticatorFunc(func(ctx context.Context, c *api.Client) (*api.Secret, error) {
+		if len(authenticators) == 0 {
+			return nil, errors.New("no authenticator in chain")
+		}
+		msgs := make([]string, 0, len(authenticators))
+		for _, a := range authenticators {
+			if err := ctx.Err(); err != nil {
+				return nil, err
+			}
+			s, err := a.Login(ctx, c)
+			if err == nil {
+				return s, nil
+			}
+			msgs = append(msgs, err.Error())
+		}
+		return nil, errors.Errorf("all logins failed: %s", strings.Join(msgs, " - "))
+	})
+}
+
+// KubernetesAuthenticator returns an Authenticator logging in with the Kubernetes auth method of
+// v, with its Role, AuthMountPath and service account token settings, regardless of AuthMethod and
+// Authenticator, e.g. to try a custom login if the Kubernetes login fails:
+//
+//	v.Authenticator = k8s.Chain(v.KubernetesAuthenticator(), custom)
+func (v *Vault) KubernetesAuthenticator() Authenticator {
+	return AuthenticatorFunc(v.kubernetesLogin)
+}
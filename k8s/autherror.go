@@ -0,0 +1,76 @@
+package k8s
+
+import (
+	"context"
+	"net"
+	"strings"
+
+	"github.com/pkg/errors"
+)
+
+// Kinds of an AuthError, besides ErrVaultSealed
+var (
+	// ErrNetwork means Vault could not be reached
+	ErrNetwork = errors.New("vault is not reachable")
+	// ErrPermissionDenied means Vault rejected the login, e.g. an unknown role or a service account
+	// not bound to the role
+	ErrPermissionDenied = errors.New("permission denied")
+	// ErrInvalidJWT means the JWT of the login could not be read or was rejected by Vault
+	ErrInvalidJWT = errors.New("invalid jwt")
+)
+
+// AuthError is the error of a failed login, Kind is ErrNetwork, ErrPermissionDenied,
+// ErrVaultSealed, ErrInvalidJWT or nil if the failure is not classified
+// Callers with AllowFail can decide which kinds are acceptable, e.g.
+//
+//	if AuthErrorKind(err) == k8s.ErrNetwork { ... }
+type AuthError struct {
+	Kind error
+	Err  error
+}
+
+func (e *AuthError) Error() string {
+	return e.Err.Error()
+}
+
+// AuthErrorKind returns the Kind of the AuthError of err, nil if err is no AuthError or not
+// classified
+func AuthErrorKind(err error) error {
+	if e, ok := errors.Cause(err).(*AuthError); ok {
+		return e.Kind
+	}
+	return nil
+}
+
+// authError returns err of a login as *AuthError, errors of a done context are returned unchanged
+func authError(err error) error {
+	if err == nil {
+		return nil
+	}
+	cause := errors.Cause(err)
+	if cause == context.Canceled || cause == context.DeadlineExceeded || cause == ErrCircuitOpen || cause == ErrRetryBudgetExhausted {
+		return err
+	}
+	if _, ok := cause.(*AuthError); ok {
+		return err
+	}
+	return &AuthError{Kind: authErrorKind(err), Err: err}
+}
+
+// authErrorKind classifies the error of a login by its cause or by the response of Vault
+func authErrorKind(err error) error {
+	if _, ok := errors.Cause(err).(net.Error); ok {
+		return ErrNetwork
+	}
+	msg := err.Error()
+	lower := strings.ToLower(msg)
+	switch {
+	case strings.Contains(msg, "Code: 503") || strings.Contains(lower, "vault is sealed"):
+		return ErrVaultSealed
+	case (strings.Contains(msg, "Code: 400") || strings.Contains(msg, "Code: 403")) && strings.Contains(lower, "jwt"):
+		return ErrInvalidJWT
+	case strings.Contains(msg, "Code: 400") || strings.Contains(msg, "Code: 403"):
+		return ErrPermissionDenied
+	}
+	return nil
+}
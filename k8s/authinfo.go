@@ -0,0 +1,84 @@
+package k8s
+
+import (
+	"context"
+	"net/http"
+	"sync"
+	"time"
+
+	"github.com/hashicorp/vault/api"
+	"github.com/pkg/errors"
+)
+
+// vaultLookupSelf will be overwritten by tests
+var vaultLookupSelf = func(ctx context.Context, c *api.Client) (*api.Secret, error) {
+	return contextLogical{ctx: ctx, c: c}.send(c.NewRequest(http.MethodGet, "/v1/auth/token/lookup-self"))
+}
+
+// AuthInfo is the information of the token of a login
+type AuthInfo struct {
+	Token    string
+	Accessor string
+	// Policies of the token including the identity policies
+	Policies      []string
+	TokenPolicies []string
+	LeaseDuration time.Duration
+	Renewable     bool
+	EntityID      string
+	// ServiceAccountTokenPath is the service account token file used by the Kubernetes login
+	ServiceAccountTokenPath string
+}
+
+// lastAuth is the AuthInfo of the last login of a Vault
+type lastAuth struct {
+	mu   sync.Mutex
+	info *AuthInfo
+}
+
+// newAuthInfo returns the AuthInfo of the auth information of a login
+func newAuthInfo(auth *api.SecretAuth) *AuthInfo {
+	return &AuthInfo{
+		Token:         auth.ClientToken,
+		Accessor:      auth.Accessor,
+		Policies:      auth.Policies,
+		TokenPolicies: auth.TokenPolicies,
+		LeaseDuration: time.Duration(auth.LeaseDuration) * time.Second,
+		Renewable:     auth.Renewable,
+		EntityID:      auth.EntityID,
+	}
+}
+
+// setLastAuth records the AuthInfo of a login, without the token if LockedToken is set
+func (v *Vault) setLastAuth(info *AuthInfo) {
+	if info != nil && v.LockedToken {
+		info.Token = ""
+	}
+	v.lastAuth.mu.Lock()
+	defer v.lastAuth.mu.Unlock()
+	v.lastAuth.info = info
+}
+
+// LastAuth returns the AuthInfo of the last successful login, nil if there was none or the login
+// was response-wrapped
+// With LockedToken the Token of the AuthInfo is empty.
+func (v *Vault) LastAuth() *AuthInfo {
+	v.lastAuth.mu.Lock()
+	defer v.lastAuth.mu.Unlock()
+	return v.lastAuth.info
+}
+
+// AuthenticateFull is AuthenticateWithContext returning the AuthInfo of the token
+// AuthenticateFull does not support WrapTTL because a wrapped login has no auth information.
+func (v *Vault) AuthenticateFull(ctx context.Context) (*AuthInfo, error) {
+	if v.WrapTTL > 0 {
+		return nil, errors.New("authenticate full does not support a response-wrapped login")
+	}
+	if _, err := v.AuthenticateWithContext(ctx); err != nil {
+		return nil, err
+	}
+	info := v.LastAuth()
+	if info == nil {
+		return nil, errors.New("login returned no token")
+	}
+	return info, nil
+}
@@ -0,0 +1,315 @@
+package k8s
+
+import (
+	"bytes"
+	"context"
+	"crypto/hmac"
+	"crypto/sha256"
+	"encoding/base64"
+	"encoding/hex"
+	"encoding/json"
+	"encoding/xml"
+	"fmt"
+	"io/ioutil"
+	"net/http"
+	"net/url"
+	"os"
+	"sort"
+	"strings"
+	"time"
+
+	"github.com/pkg/errors"
+)
+
+// AuthMethodAWS is the AWS auth method of Vault with the iam type
+const AuthMethodAWS = "aws"
+
+// AWS endpoints
+const (
+	awsMetadataEndpoint = "http://169.254.169.254"
+	awsSTSEndpoint      = "https://sts.amazonaws.com"
+	awsDefaultRegion    = "us-east-1"
+)
+
+const stsGetCallerIdentity = "Action=GetCallerIdentity&Version=2011-06-15"
+
+// AWS configures the login with the iam type of the AWS auth method
+// The login request to STS is signed with the credentials of the environment (AWS_ACCESS_KEY_ID,
+// AWS_SECRET_ACCESS_KEY and AWS_SESSION_TOKEN), of IRSA (AWS_ROLE_ARN and AWS_WEB_IDENTITY_TOKEN_FILE)
+// or of the instance profile from the instance metadata, in this order.
+type AWS struct {
+	// Region of the STS endpoint, empty uses the global endpoint
+	// It has to match the sts_endpoint and sts_region configured in Vault.
+	Region string `yaml:"region"`
+	// ServerIDHeader is the value of the X-Vault-AWS-IAM-Server-ID header if Vault requires it
+	ServerIDHeader string `yaml:"serverIDHeader"`
+
+	// endpoints and client, set by tests
+	stsEndpoint      string
+	metadataEndpoint string
+	client           *http.Client
+}
+
+// awsFromEnvironment reads the AWS configuration from the environment
+func awsFromEnvironment() *AWS {
+	return &AWS{
+		Region:         os.Getenv("VAULT_AWS_REGION"),
+		ServerIDHeader: os.Getenv("VAULT_AWS_HEADER_VALUE"),
+	}
+}
+
+// awsCredentials are temporary or long-term AWS credentials
+type awsCredentials struct {
+	AccessKeyID     string
+	SecretAccessKey string
+	SessionToken    string
+}
+
+// loginData returns the data of the login with the signed GetCallerIdentity request of STS
+func (a *AWS) loginData(ctx context.Context, role string) (map[string]interface{}, error) {
+	a.defaults()
+	creds, err := a.credentials(ctx)
+	if err != nil {
+		return nil, errors.Wrap(err, "failed to get aws credentials")
+	}
+	endpoint, region := a.stsEndpoint, a.Region
+	if region == "" {
+		region = awsDefaultRegion
+	} else if endpoint == awsSTSEndpoint {
+		endpoint = fmt.Sprintf("https://sts.%s.amazonaws.com", region)
+	}
+	body := []byte(stsGetCallerIdentity)
+	req, err := http.NewRequest(http.MethodPost, endpoint+"/", bytes.NewReader(body))
+	if err != nil {
+		return nil, err
+	}
+	req.Header.Set("Content-Type", "application/x-www-form-urlencoded; charset=utf-8")
+	if a.ServerIDHeader != "" {
+		req.Header.Set("X-Vault-AWS-IAM-Server-ID", a.ServerIDHeader)
+	}
+	signV4(req, body, creds, region, "sts", time.Now())
+	headers, err := json.Marshal(req.Header)
+	if err != nil {
+		return nil, err
+	}
+	return map[string]interface{}{
+		"role":                    role,
+		"iam_http_request_method": req.Method,
+		"iam_request_url":         base64.StdEncoding.EncodeToString([]byte(req.URL.String())),
+		"iam_request_body":        base64.StdEncoding.EncodeToString(body),
+		"iam_request_headers":     base64.StdEncoding.EncodeToString(headers),
+	}, nil
+}
+
+// defaults sets the endpoints and the client if they are not set
+func (a *AWS) defaults() {
+	if a.stsEndpoint == "" {
+		a.stsEndpoint = awsSTSEndpoint
+	}
+	if a.metadataEndpoint == "" {
+		a.metadataEndpoint = awsMetadataEndpoint
+	}
+	if a.client == nil {
+		a.client = &http.Client{Timeout: 10 * time.Second}
+	}
+}
+
+// credentials returns the credentials of the environment, IRSA or the instance profile
+func (a *AWS) credentials(ctx context.Context) (awsCredentials, error) {
+	if id := os.Getenv("AWS_ACCESS_KEY_ID"); id != "" {
+		return awsCredentials{
+			AccessKeyID:     id,
+			SecretAccessKey: os.Getenv("AWS_SECRET_ACCESS_KEY"),
+			SessionToken:    os.Getenv("AWS_SESSION_TOKEN"),
+		}, nil
+	}
+	if tokenFile := os.Getenv("AWS_WEB_IDENTITY_TOKEN_FILE"); tokenFile != "" {
+		return a.webIdentityCredentials(ctx, tokenFile, os.Getenv("AWS_ROLE_ARN"))
+	}
+	return a.instanceCredentials(ctx)
+}
+
+// webIdentityCredentials assumes the role roleARN with the web identity token of tokenFile (IRSA)
+func (a *AWS) webIdentityCredentials(ctx context.Context, tokenFile, roleARN string) (awsCredentials, error) {
+	var creds awsCredentials
+	if roleARN == "" {
+		return creds, errors.New("missing AWS_ROLE_ARN")
+	}
+	token, err := ioutil.ReadFile(tokenFile)
+	if err != nil {
+		return creds, errors.Wrap(err, "failed to read web identity token")
+	}
+	session := os.Getenv("AWS_ROLE_SESSION_NAME")
+	if session == "" {
+		session = fmt.Sprintf("vault-%d", time.Now().Unix())
+	}
+	params := url.Values{
+		"Action":           {"AssumeRoleWithWebIdentity"},
+		"Version":          {"2011-06-15"},
+		"RoleArn":          {roleARN},
+		"RoleSessionName":  {session},
+		"WebIdentityToken": {string(bytes.TrimSpace(token))},
+	}
+	req, err := http.NewRequest(http.MethodGet, a.stsEndpoint+"/?"+params.Encode(), nil)
+	if err != nil {
+		return creds, err
+	}
+	resp, err := a.client.Do(req.WithContext(ctx))
+	if err != nil {
+		return creds, errors.Wrap(err, "failed to assume role with web identity")
+	}
+	defer resp.Body.Close()
+	if resp.StatusCode != http.StatusOK {
+		return creds, errors.Errorf("failed to assume role with web identity: status %d", resp.StatusCode)
+	}
+	result := struct {
+		Credentials struct {
+			AccessKeyID     string `xml:"AccessKeyId"`
+			SecretAccessKey string `xml:"SecretAccessKey"`
+			SessionToken    string `xml:"SessionToken"`
+		} `xml:"AssumeRoleWithWebIdentityResult>Credentials"`
+	}{}
+	if err := xml.NewDecoder(resp.Body).Decode(&result); err != nil {
+		return creds, errors.Wrap(err, "failed to decode web identity credentials")
+	}
+	return awsCredentials{
+		AccessKeyID:     result.Credentials.AccessKeyID,
+		SecretAccessKey: result.Credentials.SecretAccessKey,
+		SessionToken:    result.Credentials.SessionToken,
+	}, nil
+}
+
+// instanceCredentials returns the credentials of the instance profile with IMDSv2
+func (a *AWS) instanceCredentials(ctx context.Context) (awsCredentials, error) {
+	var creds awsCredentials
+	req, err := http.NewRequest(http.MethodPut, a.metadataEndpoint+"/latest/api/token", nil)
+	if err != nil {
+		return creds, err
+	}
+	req.Header.Set("X-aws-ec2-metadata-token-ttl-seconds", "60")
+	token, err := a.metadata(ctx, req)
+	if err != nil {
+		return creds, errors.Wrap(err, "failed to get instance metadata token")
+	}
+	get := func(p string) (string, error) {
+		req, err := http.NewRequest(http.MethodGet, a.metadataEndpoint+"/latest/meta-data/iam/security-credentials/"+p, nil)
+		if err != nil {
+			return "", err
+		}
+		req.Header.Set("X-aws-ec2-metadata-token", token)
+		return a.metadata(ctx, req)
+	}
+	role, err := get("")
+	if err != nil {
+		return creds, errors.Wrap(err, "failed to get instance profile")
+	}
+	role = strings.TrimSpace(strings.SplitN(role, "\n", 2)[0])
+	content, err := get(role)
+	if err != nil {
+		return creds, errors.Wrap(err, "failed to get instance profile credentials")
+	}
+	result := struct {
+		AccessKeyID     string `json:"AccessKeyId"`
+		SecretAccessKey string `json:"SecretAccessKey"`
+		Token           string `json:"Token"`
+	}{}
+	if err := json.Unmarshal([]byte(content), &result); err != nil {
+		return creds, errors.Wrap(err, "failed to decode instance profile credentials")
+	}
+	return awsCredentials{
+		AccessKeyID:     result.AccessKeyID,
+		SecretAccessKey: result.SecretAccessKey,
+		SessionToken:    result.Token,
+	}, nil
+}
+
+// metadata sends a request to the instance metadata service and returns the body
+func (a *AWS) metadata(ctx context.Context, req *http.Request) (string, error) {
+	resp, err := a.client.Do(req.WithContext(ctx))
+	if err != nil {
+		return "", err
+	}
+	defer resp.Body.Close()
+	if resp.StatusCode != http.StatusOK {
+		return "", errors.Errorf("status %d", resp.StatusCode)
+	}
+	b, err := ioutil.ReadAll(resp.Body)
+	return string(b), err
+}
+
+// signV4 signs req with body with the AWS Signature Version 4
+func signV4(req *http.Request, body []byte, creds awsCredentials, region, service string, t time.Time) {
+	amzDate := t.UTC().Format("20060102T150405Z")
+	date := amzDate[:8]
+	req.Header.Set("X-Amz-Date", amzDate)
+	if creds.SessionToken != "" {
+		req.Header.Set("X-Amz-Security-Token", creds.SessionToken)
+	}
+	names := []string{"host"}
+	values := map[string]string{"host": req.URL.Host}
+	for k, v := range req.Header {
+		k = strings.ToLower(k)
+		names = append(names, k)
+		values[k] = strings.TrimSpace(strings.Join(v, ","))
+	}
+	sort.Strings(names)
+	var canonicalHeaders strings.Builder
+	for _, k := range names {
+		canonicalHeaders.WriteString(k + ":" + values[k] + "\n")
+	}
+	signedHeaders := strings.Join(names, ";")
+	uri := req.URL.EscapedPath()
+	if uri == "" {
+		uri = "/"
+	}
+	canonicalRequest := strings.Join([]string{
+		req.Method,
+		uri,
+		canonicalQuery(req.URL.Query()),
+		canonicalHeaders.String(),
+		signedHeaders,
+		hashHex(body),
+	}, "\n")
+	scope := strings.Join([]string{date, region, service, "aws4_request"}, "/")
+	stringToSign := strings.Join([]string{
+		"AWS4-HMAC-SHA256",
+		amzDate,
+		scope,
+		hashHex([]byte(canonicalRequest)),
+	}, "\n")
+	key := []byte("AWS4" + creds.SecretAccessKey)
+	for _, s := range []string{date, region, service, "aws4_request"} {
+		key = hmacSHA256(key, s)
+	}
+	signature := hex.EncodeToString(hmacSHA256(key, stringToSign))
+	req.Header.Set("Authorization", fmt.Sprintf("AWS4-HMAC-SHA256 Credential=%s/%s, SignedHeaders=%s, Signature=%s",
+		creds.AccessKeyID, scope, signedHeaders, signature))
+}
+
+// canonicalQuery returns the sorted and encoded query parameters
+func canonicalQuery(q url.Values) string {
+	params := make([]string, 0, len(q))
+	for k, vs := range q {
+		for _, v := range vs {
+			params = append(params, awsEscape(k)+"="+awsEscape(v))
+		}
+	}
+	sort.Strings(params)
+	return strings.Join(params, "&")
+}
+
+// awsEscape encodes s according to RFC 3986
+func awsEscape(s string) string {
+	return strings.Replace(url.QueryEscape(s), "+", "%20", -1)
+}
+
+func hashHex(b []byte) string {
+	h := sha256.Sum256(b)
+	return hex.EncodeToString(h[:])
+}
+
+func hmacSHA256(key []byte, data string) []byte {
+	h := hmac.New(sha256.New, key)
+	h.Write([]byte(data))
+	return h.Sum(nil)
+}
@@ -0,0 +1,131 @@
+package k8s
+
+import (
+	"context"
+	"encoding/json"
+	"net/http"
+	"net/url"
+	"os"
+	"time"
+
+	"github.com/pkg/errors"
+)
+
+// AuthMethodAzure is the Azure auth method of Vault
+const AuthMethodAzure = "azure"
+
+const (
+	azureMetadataEndpoint = "http://169.254.169.254"
+	azureDefaultResource  = "https://management.azure.com/"
+)
+
+// Azure configures the login with the Azure auth method
+// The access token of the managed identity is requested from the instance metadata service (IMDS),
+// the subscription, resource group and VM that are not set are read from the instance metadata.
+type Azure struct {
+	// Resource of the access token, it has to match the resource configured in Vault, empty uses
+	// https://management.azure.com/
+	Resource string `yaml:"resource"`
+	// ClientID of a user-assigned managed identity, empty uses the system-assigned identity
+	ClientID          string `yaml:"clientID"`
+	SubscriptionID    string `yaml:"subscriptionID"`
+	ResourceGroupName string `yaml:"resourceGroupName"`
+	VMName            string `yaml:"vmName"`
+	VMSSName          string `yaml:"vmssName"`
+
+	// endpoint and client, set by tests
+	metadataEndpoint string
+	client           *http.Client
+}
+
+// azureFromEnvironment reads the Azure configuration from the environment
+func azureFromEnvironment() *Azure {
+	return &Azure{
+		Resource:          os.Getenv("VAULT_AZURE_RESOURCE"),
+		ClientID:          os.Getenv("VAULT_AZURE_CLIENT_ID"),
+		SubscriptionID:    os.Getenv("VAULT_AZURE_SUBSCRIPTION_ID"),
+		ResourceGroupName: os.Getenv("VAULT_AZURE_RESOURCE_GROUP_NAME"),
+		VMName:            os.Getenv("VAULT_AZURE_VM_NAME"),
+		VMSSName:          os.Getenv("VAULT_AZURE_VMSS_NAME"),
+	}
+}
+
+// loginData returns the data of the login with the access token of the managed identity
+func (a *Azure) loginData(ctx context.Context, role string) (map[string]interface{}, error) {
+	if a.metadataEndpoint == "" {
+		a.metadataEndpoint = azureMetadataEndpoint
+	}
+	if a.client == nil {
+		a.client = &http.Client{Timeout: 10 * time.Second}
+	}
+	resource := a.Resource
+	if resource == "" {
+		resource = azureDefaultResource
+	}
+	params := url.Values{
+		"api-version": {"2018-02-01"},
+		"resource":    {resource},
+	}
+	if a.ClientID != "" {
+		params.Set("client_id", a.ClientID)
+	}
+	token := struct {
+		AccessToken string `json:"access_token"`
+	}{}
+	if err := a.metadata(ctx, "/metadata/identity/oauth2/token", params, &token); err != nil {
+		return nil, errors.Wrap(err, "failed to get azure access token")
+	}
+	data := map[string]interface{}{
+		"role":                role,
+		"jwt":                 token.AccessToken,
+		"subscription_id":     a.SubscriptionID,
+		"resource_group_name": a.ResourceGroupName,
+		"vm_name":             a.VMName,
+		"vmss_name":           a.VMSSName,
+	}
+	if a.SubscriptionID == "" || a.ResourceGroupName == "" || (a.VMName == "" && a.VMSSName == "") {
+		instance := struct {
+			Compute struct {
+				SubscriptionID    string `json:"subscriptionId"`
+				ResourceGroupName string `json:"resourceGroupName"`
+				Name              string `json:"name"`
+				VMScaleSetName    string `json:"vmScaleSetName"`
+			} `json:"compute"`
+		}{}
+		if err := a.metadata(ctx, "/metadata/instance", url.Values{"api-version": {"2017-08-01"}}, &instance); err != nil {
+			return nil, errors.Wrap(err, "failed to get azure instance metadata")
+		}
+		if a.SubscriptionID == "" {
+			data["subscription_id"] = instance.Compute.SubscriptionID
+		}
+		if a.ResourceGroupName == "" {
+			data["resource_group_name"] = instance.Compute.ResourceGroupName
+		}
+		if a.VMName == "" && a.VMSSName == "" {
+			if instance.Compute.VMScaleSetName != "" {
+				data["vmss_name"] = instance.Compute.VMScaleSetName
+			} else {
+				data["vm_name"] = instance.Compute.Name
+			}
+		}
+	}
+	return data, nil
+}
+
+// metadata decodes the response of the instance metadata service for path p into v
+func (a *Azure) metadata(ctx context.Context, p string, params url.Values, v interface{}) error {
+	req, err := http.NewRequest(http.MethodGet, a.metadataEndpoint+p+"?"+params.Encode(), nil)
+	if err != nil {
+		return err
+	}
+	req.Header.Set("Metadata", "true")
+	resp, err := a.client.Do(req.WithContext(ctx))
+	if err != nil {
+		return err
+	}
+	defer resp.Body.Close()
+	if resp.StatusCode != http.StatusOK {
+		return errors.Errorf("status %d", resp.StatusCode)
+	}
+	return json.NewDecoder(resp.Body).Decode(v)
+}
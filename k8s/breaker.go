@@ -0,0 +1,218 @@
+package k8s
+
+import (
+	"context"
+	"os"
+	"strconv"
+	"sync"
+	"time"
+
+	"github.com/pkg/errors"
+)
+
+// Defaults of CircuitBreaker
+const (
+	DefaultBreakerFailures     = 5
+	DefaultBreakerOpenDuration = 30 * time.Second
+	DefaultRetryBudgetWindow   = time.Minute
+)
+
+// Errors of a CircuitBreaker, the login is not attempted
+var (
+	ErrCircuitOpen          = errors.New("login circuit breaker is open")
+	ErrRetryBudgetExhausted = errors.New("login retry budget is exhausted")
+)
+
+// CircuitBreaker limits the logins during an outage of Vault, it opens after Failures consecutive
+// failed logins and rejects logins for OpenDuration, then a single login probes Vault and closes
+// the breaker on success or opens it again
+// Budget additionally limits the logins per BudgetWindow. A CircuitBreaker can be shared by several
+// Vaults, e.g. of Clusters, for a global budget.
+type CircuitBreaker struct {
+	// Failures opening the breaker, 0 uses DefaultBreakerFailures
+	Failures int `yaml:"failures"`
+	// OpenDuration before a probe, 0 uses DefaultBreakerOpenDuration
+	OpenDuration time.Duration `yaml:"openDuration"`
+	// Budget is the maximal number of logins per BudgetWindow, 0 is unlimited
+	Budget int `yaml:"budget"`
+	// BudgetWindow of Budget, 0 uses DefaultRetryBudgetWindow
+	BudgetWindow time.Duration `yaml:"budgetWindow"`
+
+	mu       sync.Mutex
+	failures int
+	openedAt time.Time
+	probing  bool
+	attempts []time.Time
+}
+
+// breakerFromEnvironment reads the circuit breaker configuration from the environment, it returns
+// nil if neither VAULT_BREAKER_FAILURES nor VAULT_RETRY_BUDGET is set
+func breakerFromEnvironment() (*CircuitBreaker, error) {
+	failures, budget := os.Getenv("VAULT_BREAKER_FAILURES"), os.Getenv("VAULT_RETRY_BUDGET")
+	if failures == "" && budget == "" {
+		return nil, nil
+	}
+	b := &CircuitBreaker{}
+	if failures != "" {
+		n, err := strconv.Atoi(failures)
+		if err != nil {
+			return nil, errors.Wrapf(err, "%s is not a valid number for VAULT_BREAKER_FAILURES", failures)
+		}
+		b.Failures = n
+	}
+	if s := os.Getenv("VAULT_BREAKER_OPEN_DURATION"); s != "" {
+		d, err := time.ParseDuration(s)
+		if err != nil {
+			return nil, errors.Wrapf(err, "%s is not a valid duration for VAULT_BREAKER_OPEN_DURATION", s)
+		}
+		b.OpenDuration = d
+	}
+	if budget != "" {
+		n, err := strconv.Atoi(budget)
+		if err != nil {
+			return nil, errors.Wrapf(err, "%s is not a valid number for VAULT_RETRY_BUDGET", budget)
+		}
+		b.Budget = n
+	}
+	if s := os.Getenv("VAULT_RETRY_BUDGET_WINDOW"); s != "" {
+		d, err := time.ParseDuration(s)
+		if err != nil {
+			return nil, errors.Wrapf(err, "%s is not a valid duration for VAULT_RETRY_BUDGET_WINDOW", s)
+		}
+		b.BudgetWindow = d
+	}
+	if err := b.validate(); err != nil {
+		return nil, err
+	}
+	return b, nil
+}
+
+// validate checks the limits of the breaker
+func (b *CircuitBreaker) validate() error {
+	if b.Failures < 0 || b.Budget < 0 {
+		return errors.New("negative circuit breaker failures or retry budget")
+	}
+	if b.OpenDuration < 0 || b.BudgetWindow < 0 {
+		return errors.New("negative circuit breaker duration")
+	}
+	return nil
+}
+
+func (b *CircuitBreaker) failureLimit() int {
+	if b.Failures > 0 {
+		return b.Failures
+	}
+	return DefaultBreakerFailures
+}
+
+func (b *CircuitBreaker) openDuration() time.Duration {
+	if b.OpenDuration > 0 {
+		return b.OpenDuration
+	}
+	return DefaultBreakerOpenDuration
+}
+
+func (b *CircuitBreaker) budgetWindow() time.Duration {
+	if b.BudgetWindow > 0 {
+		return b.BudgetWindow
+	}
+	return DefaultRetryBudgetWindow
+}
+
+// allow returns ErrCircuitOpen or ErrRetryBudgetExhausted if a login must not be attempted, b may
+// be nil
+func (b *CircuitBreaker) allow() error {
+	if b == nil {
+		return nil
+	}
+	b.mu.Lock()
+	defer b.mu.Unlock()
+	now := time.Now()
+	if !b.openedAt.IsZero() {
+		if b.probing || now.Before(b.openedAt.Add(b.openDuration())) {
+			return ErrCircuitOpen
+		}
+		// half-open, this login probes Vault
+		b.probing = true
+	}
+	if b.Budget > 0 {
+		window := now.Add(-b.budgetWindow())
+		i := 0
+		for i < len(b.attempts) && !b.attempts[i].After(window) {
+			i++
+		}
+		b.attempts = b.attempts[i:]
+		if len(b.attempts) >= b.Budget {
+			b.probing = false
+			return ErrRetryBudgetExhausted
+		}
+		b.attempts = append(b.attempts, now)
+	}
+	return nil
+}
+
+// record records the result of an allowed login, b may be nil
+func (b *CircuitBreaker) record(err error) {
+	if b == nil {
+		return
+	}
+	b.mu.Lock()
+	defer b.mu.Unlock()
+	if err == nil {
+		b.failures, b.openedAt, b.probing = 0, time.Time{}, false
+		return
+	}
+	if failureReason(err) == reasonCanceled {
+		b.probing = false
+		return
+	}
+	b.failures++
+	if b.probing || b.failures >= b.failureLimit() {
+		b.openedAt, b.probing = time.Now(), false
+	}
+}
+
+// retryAfter returns the time until the breaker allows a login again, 0 if it allows one now, b
+// may be nil
+func (b *CircuitBreaker) retryAfter() time.Duration {
+	if b == nil {
+		return 0
+	}
+	b.mu.Lock()
+	defer b.mu.Unlock()
+	var d time.Duration
+	if !b.openedAt.IsZero() {
+		d = time.Until(b.openedAt.Add(b.openDuration()))
+	}
+	if b.Budget > 0 && len(b.attempts) >= b.Budget {
+		if w := time.Until(b.attempts[0].Add(b.budgetWindow())); w > d {
+			d = w
+		}
+	}
+	if d < 0 {
+		return 0
+	}
+	return d
+}
+
+// reauthenticate logs in again, while Breaker rejects the login it waits until a login is allowed
+func (v *Vault) reauthenticate(ctx context.Context) (string, error) {
+	for {
+		token, err := v.AuthenticateWithContext(ctx)
+		if cause := errors.Cause(err); cause != ErrCircuitOpen && cause != ErrRetryBudgetExhausted {
+			return token, err
+		}
+		d := v.Breaker.retryAfter()
+		if d < waitInterval {
+			// another login probes Vault
+			d = waitInterval
+		}
+		t := time.NewTimer(d)
+		select {
+		case <-ctx.Done():
+			t.Stop()
+			return "", err
+		case <-t.C:
+		}
+	}
+}
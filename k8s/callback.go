@@ -0,0 +1,36 @@
+package k8s
+
+import (
+	"sync"
+
+	"github.com/hashicorp/vault/api"
+)
+
+// TokenCallback is called with the token and its auth information after a successful login
+// The auth information is nil for a response-wrapped login.
+type TokenCallback func(token string, auth *api.SecretAuth)
+
+// tokenCallbacks are the registered callbacks of a Vault
+type tokenCallbacks struct {
+	mu sync.Mutex
+	fs []TokenCallback
+}
+
+// RegisterTokenCallback registers f to be called after every successful login, including the
+// re-authentication of Run, so clients using the token can be updated without reading TokenPath
+// The callbacks are called in the order of their registration by the goroutine of the login.
+func (v *Vault) RegisterTokenCallback(f TokenCallback) {
+	v.callbacks.mu.Lock()
+	defer v.callbacks.mu.Unlock()
+	v.callbacks.fs = append(v.callbacks.fs, f)
+}
+
+// newToken calls the registered callbacks
+func (v *Vault) newToken(token string, auth *api.SecretAuth) {
+	v.callbacks.mu.Lock()
+	fs := v.callbacks.fs
+	v.callbacks.mu.Unlock()
+	for _, f := range fs {
+		f(token, auth)
+	}
+}
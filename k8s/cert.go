@@ -0,0 +1,80 @@
+package k8s
+
+import (
+	"os"
+	"time"
+
+	"github.com/hashicorp/vault/api"
+	"github.com/pkg/errors"
+)
+
+// AuthMethodCert is the TLS certificate auth method of Vault
+const AuthMethodCert = "cert"
+
+// Cert configures the login with the TLS certificate auth method
+// The files are read on every login, so a renewed certificate is used by the next login.
+type Cert struct {
+	CertPath string `yaml:"certPath"`
+	KeyPath  string `yaml:"keyPath"`
+	// CACert is the CA certificate to verify Vault, empty uses VAULT_CACERT
+	CACert string `yaml:"caCert"`
+	// WatchInterval enables the re-authentication of Run if the certificate file changes, 0 disables
+	// the check
+	WatchInterval time.Duration `yaml:"watchInterval"`
+}
+
+// certFromEnvironment reads the certificate configuration from the environment
+func certFromEnvironment() (*Cert, error) {
+	c := &Cert{
+		CertPath: os.Getenv("VAULT_CLIENT_CERT"),
+		KeyPath:  os.Getenv("VAULT_CLIENT_KEY"),
+		CACert:   os.Getenv("VAULT_CACERT"),
+	}
+	if s := os.Getenv("VAULT_CLIENT_CERT_WATCH_INTERVAL"); s != "" {
+		d, err := time.ParseDuration(s)
+		if err != nil {
+			return nil, errors.Wrapf(err, "%s is not a valid duration for VAULT_CLIENT_CERT_WATCH_INTERVAL", s)
+		}
+		c.WatchInterval = d
+	}
+	if err := c.validate(); err != nil {
+		return nil, err
+	}
+	return c, nil
+}
+
+// validate checks that the certificate and the key are set
+func (c *Cert) validate() error {
+	if c.CertPath == "" || c.KeyPath == "" {
+		return errors.New("missing client certificate or key path")
+	}
+	if c.WatchInterval < 0 {
+		return errors.Errorf("negative client certificate watch interval %s", c.WatchInterval)
+	}
+	return nil
+}
+
+// client returns a Vault client for address with the client certificate
+func (c *Cert) client(address string) (*api.Client, error) {
+	config := api.DefaultConfig()
+	if config.Error != nil {
+		return nil, errors.Wrap(config.Error, "failed to create vault config")
+	}
+	config.Address = address
+	caCert := c.CACert
+	if caCert == "" {
+		caCert = os.Getenv("VAULT_CACERT")
+	}
+	if err := config.ConfigureTLS(&api.TLSConfig{
+		CACert:     caCert,
+		ClientCert: c.CertPath,
+		ClientKey:  c.KeyPath,
+	}); err != nil {
+		return nil, errors.Wrap(err, "failed to configure client certificate")
+	}
+	clnt, err := api.NewClient(config)
+	if err != nil {
+		return nil, errors.Wrap(err, "failed to create vault client")
+	}
+	return clnt, nil
+}
@@ -0,0 +1,111 @@
+package k8s
+
+import (
+	"context"
+	"strconv"
+	"sync"
+	"time"
+
+	"github.com/hashicorp/vault/api"
+	"github.com/pkg/errors"
+)
+
+// ChildTokenOptions configures a child token of CreateChildToken
+type ChildTokenOptions struct {
+	// Policies of the child token, they have to be a subset of the policies of the Vault token,
+	// empty inherits them
+	Policies []string
+	// TTL of the child token, 0 uses the default TTL of Vault
+	TTL time.Duration
+	// NumUses limits the uses of the child token, 0 means unlimited
+	NumUses int
+	// Renewable child tokens can be renewed by their holder
+	Renewable bool
+	// DisplayName and Metadata are shown in the audit log
+	DisplayName string
+	Metadata    map[string]string
+}
+
+// childTokens are the tokens created by CreateChildToken which are revoked by Close
+type childTokens struct {
+	mu     sync.Mutex
+	tokens []string
+}
+
+// CreateChildToken creates a child token of the stored token with reduced policies or TTL, e.g.
+// for a subprocess which should not get the token of the Vault
+// Close revokes the child tokens, they are also revoked by Vault with the stored token.
+func (v *Vault) CreateChildToken(ctx context.Context, opts ChildTokenOptions) (*AuthInfo, error) {
+	if opts.TTL < 0 || opts.NumUses < 0 {
+		return nil, errors.New("negative child token ttl or uses")
+	}
+	token, err := v.LoadToken()
+	if err != nil {
+		return nil, errors.Wrap(err, "failed to load the parent token")
+	}
+	c, err := v.tokenClient(token)
+	if err != nil {
+		return nil, err
+	}
+	data := map[string]interface{}{
+		"renewable": strconv.FormatBool(opts.Renewable),
+	}
+	if len(opts.Policies) > 0 {
+		data["policies"] = opts.Policies
+	}
+	if opts.TTL > 0 {
+		data["ttl"] = strconv.Itoa(int(opts.TTL.Seconds())) + "s"
+	}
+	if opts.NumUses > 0 {
+		data["num_uses"] = opts.NumUses
+	}
+	if opts.DisplayName != "" {
+		data["display_name"] = opts.DisplayName
+	}
+	if len(opts.Metadata) > 0 {
+		data["meta"] = opts.Metadata
+	}
+	s, err := vaultLogical(ctx, c).Write("auth/token/create", data)
+	if err != nil {
+		return nil, errors.Wrap(err, "failed to create child token")
+	}
+	if s == nil || s.Auth == nil || s.Auth.ClientToken == "" {
+		return nil, errors.New("child token creation returned no token")
+	}
+	v.children.mu.Lock()
+	v.children.tokens = append(v.children.tokens, s.Auth.ClientToken)
+	v.children.mu.Unlock()
+	v.log().Debug("child token created", "accessor", s.Auth.Accessor, "policies", s.Auth.Policies)
+	return newAuthInfo(s.Auth), nil
+}
+
+// revokeChildren revokes the child tokens created by CreateChildToken, each with revoke-self so no
+// policy for other tokens is required, tokens which are already revoked or expired are ignored
+func (v *Vault) revokeChildren(ctx context.Context) error {
+	v.children.mu.Lock()
+	tokens := v.children.tokens
+	v.children.tokens = nil
+	v.children.mu.Unlock()
+	var first error
+	for _, token := range tokens {
+		c, err := v.tokenClient(token)
+		if err == nil {
+			_, err = vaultLogical(ctx, c).Write("auth/token/revoke-self", nil)
+		}
+		if err != nil && failureReason(err) != reasonPermissionDenied && first == nil {
+			first = errors.Wrap(err, "failed to revoke child token")
+		}
+	}
+	return first
+}
+
+// tokenClient returns a clone of the Vault client with the token
+func (v *Vault) tokenClient(token string) (*api.Client, error) {
+	c, err := v.client.Clone()
+	if err != nil {
+		return nil, errors.Wrap(err, "failed to clone vault client")
+	}
+	c.SetToken(token)
+	c.SetHeaders(v.client.Headers())
+	return c, nil
+}
@@ -0,0 +1,109 @@
+package k8s
+
+import (
+	"context"
+	"io"
+	"sync"
+
+	"github.com/pkg/errors"
+)
+
+// ErrClosed is returned by the loops of a Vault started after Close
+var ErrClosed = errors.New("vault is closed")
+
+// loops are the running loops of a Vault, i.e. Run and the Run methods of Watcher, Fetcher and
+// Exec, which are stopped by Close
+type loops struct {
+	mu      sync.Mutex
+	closed  bool
+	next    int
+	cancels map[int]context.CancelFunc
+	wg      sync.WaitGroup
+}
+
+// start returns a context derived from ctx which is canceled by Close, done has to be called when
+// the loop returns
+func (v *Vault) start(ctx context.Context) (context.Context, func(), error) {
+	l := &v.loops
+	l.mu.Lock()
+	defer l.mu.Unlock()
+	if l.closed {
+		return nil, nil, ErrClosed
+	}
+	ctx, cancel := context.WithCancel(ctx)
+	if l.cancels == nil {
+		l.cancels = map[int]context.CancelFunc{}
+	}
+	id := l.next
+	l.next++
+	l.cancels[id] = cancel
+	l.wg.Add(1)
+	done := func() {
+		l.mu.Lock()
+		delete(l.cancels, id)
+		l.mu.Unlock()
+		cancel()
+		l.wg.Done()
+	}
+	return ctx, done, nil
+}
+
+// Close stops the running loops of the Vault and waits until they returned, revokes the child
+// tokens of CreateChildToken and the stored token if RevokeOnClose is true and closes the
+// TokenStore if it implements io.Closer and stops the EventRecorder, then the channel of Events is
+// closed
+// ctx bounds the wait and the revocation, e.g. the grace period of a preStop hook. Loops started
+// after Close return ErrClosed.
+func (v *Vault) Close(ctx context.Context) error {
+	l := &v.loops
+	l.mu.Lock()
+	l.closed = true
+	for _, cancel := range l.cancels {
+		cancel()
+	}
+	l.mu.Unlock()
+	stopped := make(chan struct{})
+	go func() {
+		l.wg.Wait()
+		close(stopped)
+	}()
+	select {
+	case <-ctx.Done():
+		return errors.Wrap(ctx.Err(), "failed to wait for the loops to stop")
+	case <-stopped:
+	}
+	v.log().Debug("loops stopped")
+	if err := v.revokeChildren(ctx); err != nil {
+		return err
+	}
+	if v.RevokeOnClose {
+		if err := v.revoke(ctx); err != nil {
+			return err
+		}
+	}
+	if c, ok := v.TokenStore.(io.Closer); ok {
+		if err := c.Close(); err != nil {
+			return errors.Wrap(err, "failed to close token store")
+		}
+	}
+	v.EventRecorder.close()
+	v.events.close()
+	return nil
+}
+
+// revoke revokes the stored token with auth/token/revoke-self
+func (v *Vault) revoke(ctx context.Context) error {
+	token, err := v.LoadToken()
+	if err != nil {
+		return errors.Wrap(err, "failed to load the token to revoke")
+	}
+	v.client.SetToken(token)
+	defer v.clearToken()
+	if _, err := vaultLogical(ctx, v.client).Write("auth/token/revoke-self", nil); err != nil {
+		return errors.Wrap(err, "failed to revoke token")
+	}
+	v.tokenDropped()
+	v.log().Info("token revoked")
+	v.emit(nil, Event{Type: EventRevoked, Token: token})
+	return nil
+}
@@ -0,0 +1,82 @@
+package k8s
+
+import (
+	"context"
+	"sync"
+
+	"github.com/pkg/errors"
+)
+
+// Clusters gets and renews tokens of several independent Vault clusters concurrently, e.g. of a
+// regional and a global Vault, each Vault has its own client, role, auth mount and token path
+type Clusters []*Vault
+
+// NewClusters returns the Clusters of the configs cfgs, each config requires the address of its
+// cluster and a distinct token path
+func NewClusters(cfgs ...Config) (Clusters, error) {
+	if len(cfgs) == 0 {
+		return nil, errors.New("missing cluster config")
+	}
+	tokenPaths := map[string]bool{}
+	c := make(Clusters, 0, len(cfgs))
+	for i, cfg := range cfgs {
+		if len(cfg.Addresses) == 0 {
+			return nil, errors.Errorf("missing address of cluster %d", i)
+		}
+		if tokenPaths[cfg.TokenPath] {
+			return nil, errors.Errorf("token path %s of cluster %d is already used", cfg.TokenPath, i)
+		}
+		tokenPaths[cfg.TokenPath] = true
+		v, err := NewFromConfig(cfg)
+		if err != nil {
+			return nil, errors.Wrapf(err, "invalid config of cluster %d", i)
+		}
+		c = append(c, v)
+	}
+	return c, nil
+}
+
+// Run runs the Run of every Vault until ctx is done, if one of them fails the others are stopped
+// and its error is returned
+func (c Clusters) Run(ctx context.Context) error {
+	ctx, cancel := context.WithCancel(ctx)
+	defer cancel()
+	var once sync.Once
+	var first error
+	var wg sync.WaitGroup
+	for _, v := range c {
+		wg.Add(1)
+		go func(v *Vault) {
+			defer wg.Done()
+			if err := v.Run(ctx); err != nil {
+				once.Do(func() {
+					first = errors.Wrapf(err, "vault %s", v.client.Address())
+					cancel()
+				})
+			}
+		}(v)
+	}
+	wg.Wait()
+	return first
+}
+
+// Close closes every Vault, it returns the first error
+func (c Clusters) Close(ctx context.Context) error {
+	var first error
+	for _, v := range c {
+		if err := v.Close(ctx); err != nil && first == nil {
+			first = errors.Wrapf(err, "vault %s", v.client.Address())
+		}
+	}
+	return first
+}
+
+// Healthy returns an error if one of the Vaults is not healthy
+func (c Clusters) Healthy() error {
+	for _, v := range c {
+		if err := v.Healthy(); err != nil {
+			return errors.Wrapf(err, "vault %s", v.client.Address())
+		}
+	}
+	return nil
+}
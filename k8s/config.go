@@ -0,0 +1,286 @@
+package k8s
+
+import (
+	"fmt"
+	"strings"
+	"time"
+
+	"github.com/hashicorp/vault/api"
+	"github.com/pkg/errors"
+)
+
+// minTokenExpiration is the minimal expiration of the TokenRequest API
+const minTokenExpiration = 10 * time.Minute
+
+// Config of a Vault, the fields correspond to the environment variables of NewFromEnvironment
+type Config struct {
+	Role                             string          `yaml:"role"`
+	TokenPath                        string          `yaml:"tokenPath"`
+	ReAuth                           bool            `yaml:"reAuth"`
+	TTL                              time.Duration   `yaml:"ttl"`
+	AuthMountPath                    string          `yaml:"authMountPath"`
+	DiscoverAuthMount                bool            `yaml:"discoverAuthMount"`
+	AuthMountCandidates              []string        `yaml:"authMountCandidates"`
+	ServiceAccountTokenPath          string          `yaml:"serviceAccountTokenPath"`
+	ServiceAccountTokenPaths         []string        `yaml:"serviceAccountTokenPaths"`
+	ServiceAccountTokenWatchInterval time.Duration   `yaml:"serviceAccountTokenWatchInterval"`
+	ServiceAccountTokenAudiences     []string        `yaml:"serviceAccountTokenAudiences"`
+	ServiceAccountTokenExpiration    time.Duration   `yaml:"serviceAccountTokenExpiration"`
+	AllowFail                        bool            `yaml:"allowFail"`
+	WrapTTL                          time.Duration   `yaml:"wrapTTL"`
+	AuthMethod                       string          `yaml:"authMethod"`
+	AppRole                          *AppRole        `yaml:"approle"`
+	AWS                              *AWS            `yaml:"aws"`
+	GCP                              *GCP            `yaml:"gcp"`
+	Azure                            *Azure          `yaml:"azure"`
+	JWT                              *JWT            `yaml:"jwt"`
+	Cert                             *Cert           `yaml:"cert"`
+	Retry                            *Retry          `yaml:"retry"`
+	Breaker                          *CircuitBreaker `yaml:"breaker"`
+	Addresses                        []string        `yaml:"addresses"`
+	Namespace                        string          `yaml:"namespace"`
+	TokenKeyFile                     string          `yaml:"tokenKeyFile"`
+	LoginTimeout                     time.Duration   `yaml:"loginTimeout"`
+	RenewThreshold                   time.Duration   `yaml:"renewThreshold"`
+	RenewBefore                      string          `yaml:"renewBefore"`
+	RevokeOnClose                    bool            `yaml:"revokeOnClose"`
+	LeaderElection                   *LeaderElection `yaml:"leaderElection"`
+	Events                           *EventRecorder  `yaml:"events"`
+	MinTokenUses                     int             `yaml:"minTokenUses"`
+	TokenUsesInterval                time.Duration   `yaml:"tokenUsesInterval"`
+	TokenCheckInterval               time.Duration   `yaml:"tokenCheckInterval"`
+	AgentAddress                     string          `yaml:"agentAddress"`
+}
+
+// ValidationError contains all problems found by Config.Validate
+type ValidationError struct {
+	Errors []error
+}
+
+func (e *ValidationError) Error() string {
+	msgs := make([]string, 0, len(e.Errors))
+	for _, err := range e.Errors {
+		msgs = append(msgs, err.Error())
+	}
+	return fmt.Sprintf("invalid config: %s", strings.Join(msgs, " - "))
+}
+
+// Validate returns a *ValidationError with all problems of the config
+func (cfg Config) Validate() error {
+	var errs []error
+	if cfg.TokenPath == "" {
+		errs = append(errs, errors.New("missing token path"))
+	}
+	if cfg.TTL < 0 {
+		errs = append(errs, errors.Errorf("negative ttl %s", cfg.TTL))
+	}
+	if cfg.LoginTimeout < 0 {
+		errs = append(errs, errors.Errorf("negative login timeout %s", cfg.LoginTimeout))
+	}
+	if cfg.RenewThreshold < 0 {
+		errs = append(errs, errors.Errorf("negative renew threshold %s", cfg.RenewThreshold))
+	}
+	if cfg.LeaderElection != nil {
+		if err := cfg.LeaderElection.validate(); err != nil {
+			errs = append(errs, err)
+		}
+	}
+	if cfg.Events != nil {
+		if err := cfg.Events.validate(); err != nil {
+			errs = append(errs, err)
+		}
+	}
+	if cfg.Breaker != nil {
+		if err := cfg.Breaker.validate(); err != nil {
+			errs = append(errs, err)
+		}
+	}
+	if cfg.TokenCheckInterval < 0 {
+		errs = append(errs, errors.Errorf("negative token check interval %s", cfg.TokenCheckInterval))
+	}
+	if cfg.MinTokenUses < 0 {
+		errs = append(errs, errors.Errorf("negative min token uses %d", cfg.MinTokenUses))
+	}
+	if cfg.TokenUsesInterval < 0 {
+		errs = append(errs, errors.Errorf("negative token uses interval %s", cfg.TokenUsesInterval))
+	}
+	if cfg.RenewBefore != "" {
+		if _, err := ParseRenewBefore(cfg.RenewBefore); err != nil {
+			errs = append(errs, err)
+		}
+	}
+	if cfg.WrapTTL < 0 {
+		errs = append(errs, errors.Errorf("negative wrap ttl %s", cfg.WrapTTL))
+	}
+	if cfg.ServiceAccountTokenWatchInterval < 0 {
+		errs = append(errs, errors.Errorf("negative service account token watch interval %s", cfg.ServiceAccountTokenWatchInterval))
+	}
+	if cfg.ServiceAccountTokenExpiration != 0 {
+		if len(cfg.ServiceAccountTokenAudiences) == 0 {
+			errs = append(errs, errors.New("service account token expiration requires service account token audiences"))
+		}
+		if cfg.ServiceAccountTokenExpiration < minTokenExpiration {
+			errs = append(errs, errors.Errorf("service account token expiration %s is less than %s", cfg.ServiceAccountTokenExpiration, minTokenExpiration))
+		}
+	}
+	for _, a := range cfg.ServiceAccountTokenAudiences {
+		if a == "" {
+			errs = append(errs, errors.New("empty service account token audience"))
+			break
+		}
+	}
+	if cfg.Retry != nil {
+		if err := cfg.Retry.validate(); err != nil {
+			errs = append(errs, err)
+		}
+	}
+	if cfg.DiscoverAuthMount && cfg.AuthMountPath != "" {
+		errs = append(errs, errors.New("auth mount path and auth mount discovery are mutually exclusive"))
+	}
+	if len(cfg.AuthMountCandidates) > 0 && !cfg.DiscoverAuthMount {
+		errs = append(errs, errors.New("auth mount candidates require auth mount discovery"))
+	}
+	if ns := strings.Trim(cfg.Namespace, "/"); ns != "" && strings.HasPrefix(strings.TrimLeft(cfg.AuthMountPath, "/"), ns+"/") {
+		errs = append(errs, errors.Errorf("auth mount path %s contains namespace %s, it has to be relative to the namespace", cfg.AuthMountPath, ns))
+	}
+	for _, a := range cfg.Addresses {
+		if a == "" {
+			errs = append(errs, errors.New("empty vault address"))
+			break
+		}
+	}
+	switch cfg.AuthMethod {
+	case "", AuthMethodKubernetes:
+	case AuthMethodAppRole:
+		if cfg.AppRole == nil {
+			errs = append(errs, errors.New("missing approle credentials"))
+		} else if err := cfg.AppRole.validate(); err != nil {
+			errs = append(errs, err)
+		}
+	case AuthMethodAWS, AuthMethodGCP, AuthMethodAzure:
+		if cfg.Role == "" {
+			errs = append(errs, errors.Errorf("missing role for %s auth method", cfg.AuthMethod))
+		}
+	case AuthMethodJWT:
+		if cfg.JWT == nil {
+			errs = append(errs, errors.New("missing jwt configuration"))
+		} else if err := cfg.JWT.validate(); err != nil {
+			errs = append(errs, err)
+		}
+	case AuthMethodCert:
+		if cfg.Cert == nil {
+			errs = append(errs, errors.New("missing client certificate configuration"))
+		} else if err := cfg.Cert.validate(); err != nil {
+			errs = append(errs, err)
+		}
+	default:
+		errs = append(errs, errors.Errorf("unsupported auth method %q", cfg.AuthMethod))
+	}
+	if len(errs) > 0 {
+		return &ValidationError{Errors: errs}
+	}
+	return nil
+}
+
+// NewFromConfig returns a Vault configured with cfg and a Vault client created from the
+// VAULT_* environment variables, opts are applied after the config
+func NewFromConfig(cfg Config, opts ...Option) (*Vault, error) {
+	if err := cfg.Validate(); err != nil {
+		return nil, err
+	}
+	o := []Option{
+		WithRole(cfg.Role),
+		WithTokenPath(cfg.TokenPath),
+		WithReAuth(cfg.ReAuth),
+		WithTTL(cfg.TTL),
+		WithAllowFail(cfg.AllowFail),
+		WithRevokeOnClose(cfg.RevokeOnClose),
+	}
+	switch cfg.AuthMethod {
+	case AuthMethodAppRole:
+		o = append(o, WithAppRole(cfg.AppRole))
+	case AuthMethodAWS:
+		o = append(o, WithAWS(cfg.AWS))
+	case AuthMethodGCP:
+		o = append(o, WithGCP(cfg.GCP))
+	case AuthMethodAzure:
+		o = append(o, WithAzure(cfg.Azure))
+	case AuthMethodJWT:
+		o = append(o, WithJWT(cfg.JWT))
+	case AuthMethodCert:
+		o = append(o, WithCert(cfg.Cert))
+	}
+	if cfg.WrapTTL > 0 {
+		o = append(o, WithWrapTTL(cfg.WrapTTL))
+	}
+	if cfg.Retry != nil {
+		o = append(o, WithRetry(cfg.Retry))
+	}
+	if cfg.Breaker != nil {
+		o = append(o, WithCircuitBreaker(cfg.Breaker))
+	}
+	if cfg.LeaderElection != nil {
+		o = append(o, WithLeaderElection(cfg.LeaderElection))
+	}
+	if cfg.Events != nil {
+		o = append(o, WithEventRecorder(cfg.Events))
+	}
+	if len(cfg.Addresses) > 0 {
+		o = append(o, WithAddresses(cfg.Addresses...))
+	}
+	if cfg.Namespace != "" {
+		o = append(o, WithNamespace(cfg.Namespace))
+	}
+	if cfg.LoginTimeout > 0 {
+		o = append(o, WithLoginTimeout(cfg.LoginTimeout))
+	}
+	if cfg.RenewThreshold > 0 {
+		o = append(o, WithRenewThreshold(cfg.RenewThreshold))
+	}
+	if cfg.AgentAddress != "" {
+		o = append(o, WithAgent(cfg.AgentAddress))
+	}
+	if cfg.TokenCheckInterval > 0 {
+		o = append(o, WithTokenCheckInterval(cfg.TokenCheckInterval))
+	}
+	if cfg.MinTokenUses > 0 || cfg.TokenUsesInterval > 0 {
+		o = append(o, WithMinTokenUses(cfg.MinTokenUses, cfg.TokenUsesInterval))
+	}
+	if cfg.RenewBefore != "" {
+		r, _ := ParseRenewBefore(cfg.RenewBefore) // validated
+		o = append(o, WithRenewBefore(r))
+	}
+	if cfg.TokenKeyFile != "" {
+		o = append(o, WithTokenKey(KeyFromFile(cfg.TokenKeyFile)))
+	}
+	if cfg.AuthMountPath != "" {
+		o = append(o, WithAuthMountPath(cfg.AuthMountPath))
+	}
+	if cfg.DiscoverAuthMount {
+		o = append(o, WithAuthMountDiscovery(cfg.AuthMountCandidates...))
+	}
+	if cfg.ServiceAccountTokenPath != "" {
+		o = append(o, WithServiceAccountTokenPath(cfg.ServiceAccountTokenPath))
+	}
+	if len(cfg.ServiceAccountTokenPaths) > 0 {
+		o = append(o, WithServiceAccountTokenPaths(cfg.ServiceAccountTokenPaths...))
+	}
+	if cfg.ServiceAccountTokenWatchInterval > 0 {
+		o = append(o, WithServiceAccountTokenWatchInterval(cfg.ServiceAccountTokenWatchInterval))
+	}
+	if len(cfg.ServiceAccountTokenAudiences) > 0 {
+		o = append(o, WithTokenRequest(&TokenRequest{
+			Audiences:         cfg.ServiceAccountTokenAudiences,
+			ExpirationSeconds: int64(cfg.ServiceAccountTokenExpiration.Seconds()),
+		}))
+	}
+	return New(append(o, opts...)...)
+}
+
+// NewWithClient returns a Vault configured with cfg which uses the Vault client c instead of
+// creating one from the environment, e.g. a client with a custom TLS configuration or a client
+// shared with the application
+// The addresses and the namespace of cfg are set on c if they are configured.
+func NewWithClient(c *api.Client, cfg Config) (*Vault, error) {
+	return NewFromConfig(cfg, WithClient(c))
+}
@@ -0,0 +1,133 @@
+package k8s
+
+import (
+	"context"
+	"encoding/json"
+	"io"
+	"net/http"
+
+	"github.com/hashicorp/vault/api"
+	"github.com/pkg/errors"
+)
+
+// contextLogical writes to Vault with a context, api.Logical of this API version has no context
+type contextLogical struct {
+	ctx context.Context
+	c   *api.Client
+}
+
+// Write data to the path p like api.Logical.Write
+func (l contextLogical) Write(p string, data map[string]interface{}) (*api.Secret, error) {
+	r := l.c.NewRequest(http.MethodPut, "/v1/"+p)
+	if hasSecret(data) {
+		body, err := secretBody(data)
+		if err != nil {
+			return nil, err
+		}
+		defer zero(body)
+		r.BodyBytes = body
+		return l.send(r)
+	}
+	if err := r.SetJSONBody(data); err != nil {
+		return nil, err
+	}
+	return l.send(r)
+}
+
+// secretBytes is a string value of a request body which is never converted to a Go string, the
+// body is built in a buffer zeroed after the request
+type secretBytes []byte
+
+// hasSecret returns true if a value of data is secretBytes
+func hasSecret(data map[string]interface{}) bool {
+	for _, val := range data {
+		if _, ok := val.(secretBytes); ok {
+			return true
+		}
+	}
+	return false
+}
+
+// secretBody encodes data as a JSON object in a buffer of the exact size, secretBytes are copied
+// into it as JSON strings
+func secretBody(data map[string]interface{}) ([]byte, error) {
+	encoded := make(map[string][]byte, len(data))
+	n := len(data) + 1
+	for k, val := range data {
+		key, err := json.Marshal(k)
+		if err != nil {
+			return nil, err
+		}
+		n += len(key) + 1
+		if s, ok := val.(secretBytes); ok {
+			for _, b := range s {
+				if b < 0x20 || b == '"' || b == '\\' {
+					return nil, errors.Errorf("value of %s contains characters which need escaping", k)
+				}
+			}
+			n += len(s) + 2
+			continue
+		}
+		enc, err := json.Marshal(val)
+		if err != nil {
+			return nil, err
+		}
+		encoded[k] = enc
+		n += len(enc)
+	}
+	body := make([]byte, 0, n)
+	body = append(body, '{')
+	for k, val := range data {
+		if len(body) > 1 {
+			body = append(body, ',')
+		}
+		key, _ := json.Marshal(k)
+		body = append(body, key...)
+		body = append(body, ':')
+		if s, ok := val.(secretBytes); ok {
+			body = append(body, '"')
+			body = append(body, s...)
+			body = append(body, '"')
+			continue
+		}
+		body = append(body, encoded[k]...)
+	}
+	return append(body, '}'), nil
+}
+
+// send the request r and parse the response
+func (l contextLogical) send(r *api.Request) (*api.Secret, error) {
+	resp, err := l.c.RawRequestWithContext(l.ctx, r)
+	if resp != nil {
+		defer resp.Body.Close()
+	}
+	if resp != nil && resp.StatusCode == http.StatusNotFound {
+		s, parseErr := api.ParseSecret(resp.Body)
+		switch parseErr {
+		case nil:
+		case io.EOF:
+			return nil, nil
+		default:
+			return nil, err
+		}
+		if s != nil && (len(s.Warnings) > 0 || len(s.Data) > 0) {
+			return s, err
+		}
+	}
+	if err != nil {
+		return nil, err
+	}
+	return api.ParseSecret(resp.Body)
+}
+
+// vaultRenewSelf will be overwritten by tests
+var vaultRenewSelf = renewSelf
+
+// renewSelf renews the token of the Vault client c with the increment ttl in seconds
+func renewSelf(ctx context.Context, c *api.Client, ttl int) (*api.Secret, error) {
+	r := c.NewRequest(http.MethodPut, "/v1/auth/token/renew-self")
+	if err := r.SetJSONBody(map[string]interface{}{"increment": ttl}); err != nil {
+		return nil, err
+	}
+	return contextLogical{ctx: ctx, c: c}.send(r)
+}
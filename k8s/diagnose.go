@@ -0,0 +1,275 @@
+package k8s
+
+import (
+	"bytes"
+	"context"
+	"encoding/base64"
+	"encoding/json"
+	"fmt"
+	"io/ioutil"
+	"net/http"
+	"os"
+	"path/filepath"
+	"strings"
+	"time"
+
+	"github.com/pkg/errors"
+)
+
+// Status of a DiagnosisCheck
+const (
+	DiagnosisOK      = "ok"
+	DiagnosisFailed  = "failed"
+	DiagnosisSkipped = "skipped"
+)
+
+// DiagnosisCheck is the result of a precondition of the login checked by Diagnose
+type DiagnosisCheck struct {
+	Name   string
+	Status string
+	// Detail describes the result, e.g. the subject of the service account token
+	Detail string
+	// Err is set if the check failed
+	Err error
+}
+
+// Diagnosis is the report of Diagnose
+type Diagnosis struct {
+	Checks []DiagnosisCheck
+}
+
+// Err returns the errors of the failed checks, nil if none failed
+func (d *Diagnosis) Err() error {
+	var msgs []string
+	for _, c := range d.Checks {
+		if c.Status == DiagnosisFailed {
+			msgs = append(msgs, fmt.Sprintf("%s: %s", c.Name, c.Err))
+		}
+	}
+	if len(msgs) == 0 {
+		return nil
+	}
+	return errors.New(strings.Join(msgs, "; "))
+}
+
+// String returns the report with a line per check
+func (d *Diagnosis) String() string {
+	var b bytes.Buffer
+	for _, c := range d.Checks {
+		fmt.Fprintf(&b, "%-7s %s", c.Status, c.Name)
+		if c.Detail != "" {
+			fmt.Fprintf(&b, ": %s", c.Detail)
+		}
+		if c.Err != nil {
+			fmt.Fprintf(&b, ": %s", c.Err)
+		}
+		b.WriteString("\n")
+	}
+	return b.String()
+}
+
+// add appends the check name with the result of f, f returns the detail
+func (d *Diagnosis) add(name string, f func() (string, error)) {
+	detail, err := f()
+	c := DiagnosisCheck{Name: name, Status: DiagnosisOK, Detail: detail, Err: err}
+	switch {
+	case err == errSkipped:
+		c.Status, c.Err = DiagnosisSkipped, nil
+	case err != nil:
+		c.Status = DiagnosisFailed
+	}
+	d.Checks = append(d.Checks, c)
+}
+
+// errSkipped is returned by a check of Diagnose which does not apply
+var errSkipped = errors.New("skipped")
+
+// Diagnose checks the preconditions of the login and returns a report, e.g. to log it at startup
+// or when the login fails
+// It checks that the service account token can be read and is a JWT, Vault is reachable, the auth
+// mount exists, the login with the role succeeds and the token can be stored. The token of the
+// login is revoked, nothing is stored.
+func (v *Vault) Diagnose(ctx context.Context) *Diagnosis {
+	d := &Diagnosis{}
+	d.add("service account token", v.diagnoseServiceAccountToken)
+	reachable := true
+	d.add("vault reachable", func() (string, error) {
+		detail, err := v.diagnoseVault(ctx)
+		reachable = err == nil
+		return detail, err
+	})
+	d.add("auth mount", func() (string, error) {
+		if !reachable {
+			return "", errSkipped
+		}
+		return v.diagnoseAuthMount(ctx)
+	})
+	d.add("login", func() (string, error) {
+		if !reachable {
+			return "", errSkipped
+		}
+		return v.diagnoseLogin(ctx)
+	})
+	d.add("token store", v.diagnoseTokenStore)
+	return d
+}
+
+// diagnoseServiceAccountToken reads the service account token of the Kubernetes login and decodes
+// its claims
+func (v *Vault) diagnoseServiceAccountToken() (string, error) {
+	if v.authType() != AuthMethodKubernetes || v.Authenticator != nil {
+		return "", errSkipped
+	}
+	source, p := v.JWTSource, "jwt source"
+	if source == nil {
+		paths := v.ServiceAccountTokenPaths
+		if len(paths) == 0 {
+			paths = []string{v.ServiceAccountTokenPath}
+		}
+		p = paths[0]
+		for _, candidate := range paths {
+			if _, err := os.Stat(candidate); err == nil {
+				p = candidate
+				break
+			}
+		}
+		source = JWTFromFile(p)
+	}
+	jwt, err := source()
+	if err != nil {
+		return p, errors.Wrap(err, "failed to read service account token")
+	}
+	claims, err := jwtClaims(jwt)
+	if err != nil {
+		return p, err
+	}
+	detail := fmt.Sprintf("%s, subject %v", p, claims["sub"])
+	if aud := jwtAudiences(jwt); len(aud) > 0 {
+		detail += fmt.Sprintf(", audiences %s", strings.Join(aud, ","))
+	}
+	if exp, ok := claims["exp"].(float64); ok {
+		expiry := time.Unix(int64(exp), 0)
+		if !time.Now().Before(expiry) {
+			return detail, errors.Errorf("service account token expired at %s", expiry.Format(time.RFC3339))
+		}
+	}
+	return detail, nil
+}
+
+// diagnoseVault checks sys/health of the Vault
+func (v *Vault) diagnoseVault(ctx context.Context) (string, error) {
+	address := v.client.Address()
+	code, err := vaultHealth(ctx, v.client, address)
+	if err != nil {
+		return address, errors.Wrap(err, "vault is not reachable")
+	}
+	switch code {
+	case http.StatusOK, http.StatusTooManyRequests, 472, 473:
+		return fmt.Sprintf("%s, status %d", address, code), nil
+	case http.StatusNotImplemented:
+		return address, errors.New("vault is not initialized")
+	case http.StatusServiceUnavailable:
+		return address, ErrVaultSealed
+	}
+	return address, errors.Errorf("unexpected health status %d", code)
+}
+
+// diagnoseAuthMount checks that AuthMountPath is an auth mount of the type of AuthMethod, listing
+// sys/auth requires a token and is skipped if it is denied
+func (v *Vault) diagnoseAuthMount(ctx context.Context) (string, error) {
+	if v.Authenticator != nil {
+		return "", errSkipped
+	}
+	if v.DiscoverAuthMount && !v.mountDiscovered {
+		mounts, listed, err := v.authMounts(ctx, v.client)
+		if err != nil {
+			return "", err
+		}
+		if listed {
+			return fmt.Sprintf("listed %s", strings.Join(mounts, ", ")), nil
+		}
+		return fmt.Sprintf("candidates %s", strings.Join(mounts, ", ")), nil
+	}
+	s, err := vaultAuthMounts(ctx, v.client)
+	if err != nil {
+		if strings.Contains(err.Error(), "Code: 403") {
+			return fmt.Sprintf("%s, listing auth mounts is not permitted", v.AuthMountPath), errSkipped
+		}
+		return v.AuthMountPath, errors.Wrap(err, "failed to list auth mounts")
+	}
+	if s == nil || s.Data == nil {
+		return v.AuthMountPath, errors.New("listing auth mounts returned no data")
+	}
+	mount, ok := s.Data[strings.TrimPrefix(v.AuthMountPath, "auth/")+"/"].(map[string]interface{})
+	if !ok {
+		return v.AuthMountPath, errors.Errorf("auth mount %s does not exist", v.AuthMountPath)
+	}
+	if typ, _ := mount["type"].(string); typ != v.authType() {
+		return v.AuthMountPath, errors.Errorf("auth mount %s has type %s instead of %s", v.AuthMountPath, typ, v.authType())
+	}
+	return v.AuthMountPath, nil
+}
+
+// diagnoseLogin logs in with the role and revokes the token, the AppRole login is skipped because
+// it spends a use of a secret ID limited by secret_id_num_uses or a response-wrapped secret ID
+func (v *Vault) diagnoseLogin(ctx context.Context) (string, error) {
+	if v.Authenticator == nil && v.authType() == AuthMethodAppRole {
+		return fmt.Sprintf("role %q, the login would spend the secret ID", v.Role), errSkipped
+	}
+	s, err := v.discoverLogin(ctx, v.authenticator(), v.client)
+	if err != nil {
+		return fmt.Sprintf("role %q", v.Role), err
+	}
+	if s == nil || s.Auth == nil || s.Auth.ClientToken == "" {
+		return fmt.Sprintf("role %q", v.Role), errors.New("login returned no token")
+	}
+	detail := fmt.Sprintf("role %q, policies %s, ttl %s", v.Role, strings.Join(s.Auth.Policies, ","), time.Duration(s.Auth.LeaseDuration)*time.Second)
+	c, err := v.tokenClient(s.Auth.ClientToken)
+	if err == nil {
+		_, err = vaultLogical(ctx, c).Write("auth/token/revoke-self", nil)
+	}
+	if err != nil {
+		v.log().Info("failed to revoke the token of the diagnosis", "error", err)
+	}
+	return detail, nil
+}
+
+// diagnoseTokenStore checks that TokenPath is writable or, if it does not exist yet, its directory,
+// other token stores are not checked
+func (v *Vault) diagnoseTokenStore() (string, error) {
+	if v.TokenStore != nil || v.TokenPath == "" {
+		return "", errSkipped
+	}
+	f, err := os.OpenFile(v.TokenPath, os.O_WRONLY, 0)
+	if err == nil {
+		f.Close()
+		return v.TokenPath, nil
+	}
+	if !os.IsNotExist(err) {
+		return v.TokenPath, errors.Wrap(err, "token path is not writable")
+	}
+	f, err = ioutil.TempFile(filepath.Dir(v.TokenPath), ".diagnose")
+	if err != nil {
+		return v.TokenPath, errors.Wrap(err, "token path is not writable")
+	}
+	f.Close()
+	os.Remove(f.Name())
+	return v.TokenPath, nil
+}
+
+// jwtClaims returns the decoded claims of a JWT
+func jwtClaims(jwt string) (map[string]interface{}, error) {
+	parts := strings.Split(strings.TrimSpace(jwt), ".")
+	if len(parts) != 3 {
+		return nil, errors.New("token is not a jwt")
+	}
+	payload, err := base64.RawURLEncoding.DecodeString(strings.TrimRight(parts[1], "="))
+	if err != nil {
+		return nil, errors.Wrap(err, "failed to decode jwt claims")
+	}
+	claims := map[string]interface{}{}
+	if err := json.Unmarshal(payload, &claims); err != nil {
+		return nil, errors.Wrap(err, "failed to decode jwt claims")
+	}
+	return claims, nil
+}
@@ -0,0 +1,116 @@
+package k8s
+
+import (
+	"context"
+	"fmt"
+	"net/http"
+	"os"
+	"strings"
+
+	"github.com/hashicorp/vault/api"
+	"github.com/pkg/errors"
+)
+
+// vaultAuthMounts will be overwritten by tests
+var vaultAuthMounts = func(ctx context.Context, c *api.Client) (*api.Secret, error) {
+	return contextLogical{ctx: ctx, c: c}.send(c.NewRequest(http.MethodGet, "/v1/sys/auth"))
+}
+
+// authMountCandidatesFromEnvironment reads the comma separated VAULT_AUTH_MOUNT_CANDIDATES
+func authMountCandidatesFromEnvironment() []string {
+	var candidates []string
+	for _, p := range strings.Split(os.Getenv("VAULT_AUTH_MOUNT_CANDIDATES"), ",") {
+		if p = strings.TrimSpace(p); p != "" {
+			candidates = append(candidates, p)
+		}
+	}
+	return candidates
+}
+
+// authType returns the type of the mount of the auth method AuthMethod
+func (v *Vault) authType() string {
+	if v.AuthMethod == "" {
+		return AuthMethodKubernetes
+	}
+	return v.AuthMethod
+}
+
+// authMounts returns the mount paths to try for the login, the mounts of the type of AuthMethod
+// found in sys/auth or AuthMountCandidates if the Vault client is not allowed to list sys/auth,
+// listed is true if the mounts were found in sys/auth
+// Several mounts of the type are narrowed to the ones of AuthMountCandidates.
+func (v *Vault) authMounts(ctx context.Context, c *api.Client) (mounts []string, listed bool, err error) {
+	s, err := vaultAuthMounts(ctx, c)
+	if err == nil && (s == nil || s.Data == nil) {
+		err = errors.New("listing auth mounts returned no data")
+	}
+	if err != nil {
+		if len(v.AuthMountCandidates) == 0 {
+			return nil, false, errors.Wrap(err, "failed to list auth mounts")
+		}
+		v.log().Debug("listing auth mounts failed, trying candidates", "error", err, "candidates", v.AuthMountCandidates)
+		return v.AuthMountCandidates, false, nil
+	}
+	for p, m := range s.Data {
+		mount, _ := m.(map[string]interface{})
+		if typ, _ := mount["type"].(string); typ == v.authType() {
+			mounts = append(mounts, FixAuthMountPath(p))
+		}
+	}
+	switch {
+	case len(mounts) == 0:
+		return nil, true, errors.Errorf("no %s auth mount found", v.authType())
+	case len(mounts) == 1:
+		return mounts, true, nil
+	}
+	var found []string
+	for _, p := range v.AuthMountCandidates {
+		for _, m := range mounts {
+			if FixAuthMountPath(p) == m {
+				found = append(found, m)
+			}
+		}
+	}
+	if len(found) == 0 {
+		return nil, true, errors.Errorf("found several %s auth mounts %s, set the auth mount path or candidates", v.authType(), strings.Join(mounts, ", "))
+	}
+	return found, true, nil
+}
+
+// discoverLogin logs in with a, with DiscoverAuthMount AuthMountPath is set to the first mount of
+// authMounts
+// A mount found in sys/auth exists and its login result is returned, unlisted candidates are tried
+// until a login succeeds because Vault denies the login of a missing mount like a denied login of an
+// existing one.
+func (v *Vault) discoverLogin(ctx context.Context, a Authenticator, c *api.Client) (*api.Secret, error) {
+	if !v.DiscoverAuthMount || v.mountDiscovered || v.Authenticator != nil {
+		return a.Login(ctx, c)
+	}
+	mounts, listed, err := v.authMounts(ctx, c)
+	if err != nil {
+		return nil, err
+	}
+	if listed {
+		v.AuthMountPath = FixAuthMountPath(mounts[0])
+		v.mountDiscovered = true
+		v.log().Info("auth mount discovered", "mount", v.AuthMountPath)
+		return a.Login(ctx, c)
+	}
+	msgs := make([]string, 0, len(mounts))
+	for _, p := range mounts {
+		v.AuthMountPath = FixAuthMountPath(p)
+		s, err := a.Login(ctx, c)
+		if err != nil {
+			if ctx.Err() != nil {
+				return nil, err
+			}
+			v.log().Debug("auth mount candidate failed", "mount", v.AuthMountPath, "error", err)
+			msgs = append(msgs, fmt.Sprintf("%s: %s", v.AuthMountPath, err))
+			continue
+		}
+		v.mountDiscovered = true
+		v.log().Info("auth mount discovered", "mount", v.AuthMountPath)
+		return s, nil
+	}
+	return nil, errors.Errorf("login failed with all %s auth mount candidates: %s", v.authType(), strings.Join(msgs, " - "))
+}
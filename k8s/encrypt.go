@@ -0,0 +1,101 @@
+package k8s
+
+import (
+	"bytes"
+	"crypto/aes"
+	"crypto/cipher"
+	"crypto/rand"
+	"crypto/sha256"
+	"encoding/base64"
+	"io"
+	"io/ioutil"
+	"strings"
+
+	"github.com/pkg/errors"
+)
+
+// encryptedPrefix marks a token encrypted by EncryptedStore
+const encryptedPrefix = "enc:v1:"
+
+// KeyFunc returns the key material of EncryptedStore, the AES-256 key is its SHA-256 hash
+// It is called on every Store and Load, so a key of a KMS or a key decrypted with Vault transit
+// can be rotated.
+type KeyFunc func() ([]byte, error)
+
+// KeyFromFile returns a KeyFunc reading the key material from the file with path p, e.g. a mounted
+// Kubernetes Secret
+func KeyFromFile(p string) KeyFunc {
+	return func() ([]byte, error) {
+		content, err := ioutil.ReadFile(p)
+		if err != nil {
+			return nil, errors.Wrap(err, "failed to read token key")
+		}
+		content = bytes.TrimSpace(content)
+		if len(content) == 0 {
+			return nil, errors.Errorf("empty token key in %s", p)
+		}
+		return content, nil
+	}
+}
+
+// EncryptedStore encrypts the token with AES-GCM before it is stored in TokenStore, so a copy of the
+// storage does not contain a usable token
+type EncryptedStore struct {
+	TokenStore TokenStore
+	Key        KeyFunc
+}
+
+// aead returns the AES-GCM cipher of the key
+func (e *EncryptedStore) aead() (cipher.AEAD, error) {
+	material, err := e.Key()
+	if err != nil {
+		return nil, err
+	}
+	key := sha256.Sum256(material)
+	block, err := aes.NewCipher(key[:])
+	if err != nil {
+		return nil, err
+	}
+	return cipher.NewGCM(block)
+}
+
+// Store the encrypted token
+func (e *EncryptedStore) Store(token string) error {
+	aead, err := e.aead()
+	if err != nil {
+		return errors.Wrap(err, "failed to encrypt token")
+	}
+	nonce := make([]byte, aead.NonceSize())
+	if _, err := io.ReadFull(rand.Reader, nonce); err != nil {
+		return errors.Wrap(err, "failed to encrypt token")
+	}
+	sealed := aead.Seal(nonce, nonce, []byte(token), nil)
+	return e.TokenStore.Store(encryptedPrefix + base64.StdEncoding.EncodeToString(sealed))
+}
+
+// Load and decrypt the token, a token which is not encrypted is an error
+func (e *EncryptedStore) Load() (string, error) {
+	stored, err := e.TokenStore.Load()
+	if err != nil {
+		return "", err
+	}
+	if !strings.HasPrefix(stored, encryptedPrefix) {
+		return "", errors.New("stored token is not encrypted")
+	}
+	sealed, err := base64.StdEncoding.DecodeString(strings.TrimSpace(strings.TrimPrefix(stored, encryptedPrefix)))
+	if err != nil {
+		return "", errors.Wrap(err, "failed to decrypt token")
+	}
+	aead, err := e.aead()
+	if err != nil {
+		return "", errors.Wrap(err, "failed to decrypt token")
+	}
+	if len(sealed) < aead.NonceSize() {
+		return "", errors.New("failed to decrypt token: too short")
+	}
+	token, err := aead.Open(nil, sealed[:aead.NonceSize()], sealed[aead.NonceSize():], nil)
+	if err != nil {
+		return "", errors.Wrap(err, "failed to decrypt token")
+	}
+	return string(token), nil
+}
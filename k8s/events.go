@@ -0,0 +1,154 @@
+package k8s
+
+import (
+	"fmt"
+	"os"
+	"sync"
+
+	"github.com/pkg/errors"
+	corev1 "k8s.io/api/core/v1"
+	"k8s.io/client-go/kubernetes"
+	"k8s.io/client-go/kubernetes/scheme"
+	typedcorev1 "k8s.io/client-go/kubernetes/typed/core/v1"
+	"k8s.io/client-go/tools/record"
+)
+
+// DefaultEventThreshold is the number of consecutive failures before an EventRecorder posts an Event
+const DefaultEventThreshold = 3
+
+// Reasons of the Events posted by an EventRecorder
+const (
+	EventReasonLoginFailed   = "VaultLoginFailed"
+	EventReasonRenewalFailed = "VaultRenewalFailed"
+)
+
+// eventComponent is the source of the Events posted by an EventRecorder
+const eventComponent = "vault-k8s"
+
+// EventRecorder posts Warning Events of the core/v1 API on the pod if the login or the renewal
+// fails repeatedly, they are shown by kubectl describe pod
+// The requests are authenticated with the mounted token of ServiceAccountTokenPath, the service
+// account needs the permission to create Events.
+type EventRecorder struct {
+	// Pod is the name of the pod, if empty the hostname (i.e. the pod name) is used
+	Pod string `yaml:"pod"`
+	// Namespace of the pod, if empty the namespace of the pod is read
+	Namespace string `yaml:"namespace"`
+	// Threshold of consecutive failures before an Event is posted, 0 uses DefaultEventThreshold
+	Threshold int `yaml:"threshold"`
+
+	// clientset of the API server, set by tests
+	clientset   kubernetes.Interface
+	mu          sync.Mutex
+	broadcaster record.EventBroadcaster
+	recorder    record.EventRecorder
+	// consecutive failures by reason
+	failures map[string]int
+}
+
+// validate checks the EventRecorder
+func (r *EventRecorder) validate() error {
+	if r.Threshold < 0 {
+		return errors.Errorf("negative event threshold %d", r.Threshold)
+	}
+	return nil
+}
+
+// success resets the failures of reason, r may be nil
+func (r *EventRecorder) success(reason string) {
+	if r == nil {
+		return
+	}
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	delete(r.failures, reason)
+}
+
+// failure counts the failure err of reason and posts an Event once the threshold is reached, r may
+// be nil
+func (r *EventRecorder) failure(v *Vault, reason string, err error) {
+	if r == nil {
+		return
+	}
+	r.mu.Lock()
+	if r.failures == nil {
+		r.failures = map[string]int{}
+	}
+	r.failures[reason]++
+	n := r.failures[reason]
+	r.mu.Unlock()
+	threshold := r.Threshold
+	if threshold == 0 {
+		threshold = DefaultEventThreshold
+	}
+	if n < threshold {
+		return
+	}
+	if err := r.post(v, reason, fmt.Sprintf("%d consecutive failures: %s", n, err)); err != nil {
+		v.log().Info("failed to post event", "reason", reason, "error", err)
+	}
+}
+
+// init sets the defaults of the in-cluster configuration and starts the recorder
+func (r *EventRecorder) init(v *Vault) error {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	if r.recorder != nil {
+		return nil
+	}
+	if r.Pod == "" {
+		name, err := os.Hostname()
+		if err != nil {
+			return errors.Wrap(err, "failed to get pod name")
+		}
+		r.Pod = name
+	}
+	if r.Namespace == "" {
+		ns, err := podNamespace()
+		if err != nil {
+			return err
+		}
+		r.Namespace = ns
+	}
+	if r.clientset == nil {
+		config, err := inClusterConfig(v.ServiceAccountTokenPath)
+		if err != nil {
+			return err
+		}
+		if r.clientset, err = kubernetes.NewForConfig(config); err != nil {
+			return err
+		}
+	}
+	r.broadcaster = record.NewBroadcaster()
+	r.broadcaster.StartRecordingToSink(&typedcorev1.EventSinkImpl{Interface: r.clientset.CoreV1().Events(r.Namespace)})
+	r.recorder = r.broadcaster.NewRecorder(scheme.Scheme, corev1.EventSource{Component: eventComponent})
+	return nil
+}
+
+// post records a Warning Event on the pod, the Event is sent asynchronously
+func (r *EventRecorder) post(v *Vault, reason, msg string) error {
+	if err := r.init(v); err != nil {
+		return err
+	}
+	pod := &corev1.ObjectReference{
+		APIVersion: "v1",
+		Kind:       "Pod",
+		Name:       r.Pod,
+		Namespace:  r.Namespace,
+	}
+	r.recorder.Event(pod, corev1.EventTypeWarning, reason, msg)
+	return nil
+}
+
+// close stops the recorder, r may be nil
+func (r *EventRecorder) close() {
+	if r == nil {
+		return
+	}
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	if r.broadcaster != nil {
+		r.broadcaster.Shutdown()
+		r.broadcaster, r.recorder = nil, nil
+	}
+}
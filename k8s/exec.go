@@ -0,0 +1,196 @@
+package k8s
+
+import (
+	"context"
+	"encoding/json"
+	"os"
+	"os/exec"
+	"regexp"
+	"sort"
+	"syscall"
+	"time"
+
+	"github.com/pkg/errors"
+	"github.com/postfinance/vault/kv"
+)
+
+var envKey = regexp.MustCompile(`^[A-Za-z_][A-Za-z0-9_]*$`)
+
+// defaultStopTimeout is the time to wait for the command if Exec.StopTimeout is 0
+const defaultStopTimeout = 10 * time.Second
+
+// Exec runs a command with the keys of secrets of K/V engines added to its environment
+// Values which are not strings are added as JSON. The token is loaded with LoadToken like the
+// token of a Fetcher.
+type Exec struct {
+	// Paths of the secrets, keys of later secrets override keys of earlier ones
+	Paths   []string
+	Command []string
+	// Interval to read the secrets again, if a secret changed the command is stopped with Signal
+	// and started again with the new environment, 0 disables the check
+	Interval time.Duration
+	// Signal to stop the command, nil uses SIGTERM
+	Signal os.Signal
+	// StopTimeout is the time the command has to exit after Signal before it is killed, 0 uses 10s
+	StopTimeout time.Duration
+	// Options of the kv.Clients of the secrets
+	Options []kv.Option
+
+	f *Fetcher
+}
+
+// NewExec returns an Exec of command with the secrets of paths
+func (v *Vault) NewExec(paths []string, command ...string) *Exec {
+	return &Exec{
+		Paths:   paths,
+		Command: command,
+		f:       v.NewFetcher(),
+	}
+}
+
+// Run starts the command and returns its error when it exits, if ctx is done or the Vault is closed
+// the command is stopped and Run returns nil
+func (e *Exec) Run(ctx context.Context) error {
+	if len(e.Command) == 0 {
+		return errors.New("missing command")
+	}
+	e.f.Options = e.Options
+	ctx, done, err := e.f.v.start(ctx)
+	if err != nil {
+		return err
+	}
+	defer done()
+	env, err := e.environment()
+	if err != nil {
+		return err
+	}
+	for {
+		next, err := e.run(ctx, env)
+		if next == nil {
+			return err
+		}
+		env = next
+	}
+}
+
+// run runs the command with env until it exits or ctx is done, it returns the new environment if
+// the command was stopped because a secret changed
+func (e *Exec) run(ctx context.Context, env []string) ([]string, error) {
+	cmd := exec.Command(e.Command[0], e.Command[1:]...)
+	cmd.Env = append(os.Environ(), env...)
+	cmd.Stdin, cmd.Stdout, cmd.Stderr = os.Stdin, os.Stdout, os.Stderr
+	if err := cmd.Start(); err != nil {
+		return nil, errors.Wrapf(err, "failed to start %s", e.Command[0])
+	}
+	e.f.v.log().Info("command started", "command", e.Command[0], "pid", cmd.Process.Pid)
+	done := make(chan error, 1)
+	go func() {
+		done <- cmd.Wait()
+	}()
+	var tick <-chan time.Time
+	if e.Interval > 0 {
+		ticker := time.NewTicker(e.Interval)
+		defer ticker.Stop()
+		tick = ticker.C
+	}
+	for {
+		select {
+		case err := <-done:
+			return nil, err
+		case <-ctx.Done():
+			e.stop(cmd, done)
+			return nil, nil
+		case <-tick:
+			next, err := e.environment()
+			if err != nil {
+				e.f.v.log().Info("failed to read secrets", "error", err)
+				continue
+			}
+			if equalStrings(next, env) {
+				continue
+			}
+			e.f.v.log().Info("secrets changed, restarting command", "command", e.Command[0])
+			e.stop(cmd, done)
+			return next, nil
+		}
+	}
+}
+
+// stop sends Signal to the command and waits until it exited, the command is killed if it does not
+// exit within StopTimeout
+func (e *Exec) stop(cmd *exec.Cmd, done <-chan error) {
+	sig := e.Signal
+	if sig == nil {
+		sig = syscall.SIGTERM
+	}
+	if err := cmd.Process.Signal(sig); err != nil {
+		e.f.v.log().Debug("failed to signal command", "error", err)
+	}
+	timeout := e.StopTimeout
+	if timeout <= 0 {
+		timeout = defaultStopTimeout
+	}
+	t := time.NewTimer(timeout)
+	defer t.Stop()
+	select {
+	case <-done:
+		return
+	case <-t.C:
+	}
+	e.f.v.log().Info("command did not stop, killing it", "command", e.Command[0], "timeout", timeout)
+	if err := cmd.Process.Kill(); err != nil {
+		e.f.v.log().Debug("failed to kill command", "error", err)
+	}
+	<-done
+}
+
+// environment returns the KEY=value pairs of the secrets sorted by key
+func (e *Exec) environment() ([]string, error) {
+	values := make(map[string]string)
+	for _, p := range e.Paths {
+		c, err := e.f.client(p)
+		if err != nil {
+			return nil, errors.Wrapf(err, "failed to read secret %s", p)
+		}
+		data, err := c.Read(p)
+		if err != nil {
+			return nil, errors.Wrapf(err, "failed to read secret %s", p)
+		}
+		if data == nil {
+			return nil, errors.Errorf("secret %s not found", p)
+		}
+		for k, v := range data {
+			if !envKey.MatchString(k) {
+				return nil, errors.Errorf("key %q of secret %s is not a valid environment variable name", k, p)
+			}
+			s, ok := v.(string)
+			if !ok {
+				b, err := json.Marshal(v)
+				if err != nil {
+					return nil, err
+				}
+				s = string(b)
+			}
+			values[k] = s
+		}
+	}
+	env := make([]string, 0, len(values))
+	for k, v := range values {
+		env = append(env, k+"="+v)
+	}
+	sort.Strings(env)
+	return env, nil
+}
+
+// equalStrings returns true if a and b contain the same strings in the same order
+func equalStrings(a, b []string) bool {
+	if len(a) != len(b) {
+		return false
+	}
+	for i := range a {
+		if a[i] != b[i] {
+			return false
+		}
+	}
+	return true
+}
@@ -0,0 +1,86 @@
+package k8s
+
+import (
+	"context"
+	"net/http"
+	"os"
+	"strings"
+
+	"github.com/hashicorp/vault/api"
+	"github.com/pkg/errors"
+)
+
+// vaultHealth returns the status code of sys/health of the Vault at address, it will be
+// overwritten by tests
+var vaultHealth = func(ctx context.Context, c *api.Client, address string) (int, error) {
+	clone, err := c.Clone()
+	if err != nil {
+		return 0, err
+	}
+	if err := clone.SetAddress(address); err != nil {
+		return 0, err
+	}
+	r := clone.NewRequest(http.MethodGet, "/v1/sys/health")
+	// a standby forwards the requests to the active node
+	r.Params.Set("standbyok", "true")
+	r.Params.Set("perfstandbyok", "true")
+	resp, err := clone.RawRequestWithContext(ctx, r)
+	if resp != nil {
+		resp.Body.Close()
+		// the error of a status >= 400 is replaced by the status
+		return resp.StatusCode, nil
+	}
+	return 0, err
+}
+
+// addressesFromEnvironment returns the comma separated addresses of VAULT_ADDRS
+func addressesFromEnvironment() []string {
+	var addrs []string
+	for _, a := range strings.Split(os.Getenv("VAULT_ADDRS"), ",") {
+		if a = strings.TrimSpace(a); a != "" {
+			addrs = append(addrs, a)
+		}
+	}
+	return addrs
+}
+
+// useAddress sets the address i of Addresses on the Vault client
+func (v *Vault) useAddress(i int) error {
+	if err := v.client.SetAddress(v.Addresses[i]); err != nil {
+		return errors.Wrapf(err, "failed to set vault address %s", v.Addresses[i])
+	}
+	v.address = i
+	return nil
+}
+
+// failover switches the Vault client to the next healthy address of Addresses, it returns false if
+// no other address is healthy
+func (v *Vault) failover(ctx context.Context) bool {
+	for i := 1; i < len(v.Addresses); i++ {
+		next := (v.address + i) % len(v.Addresses)
+		if err := healthError(vaultHealth(ctx, v.client, v.Addresses[next])); err != nil {
+			v.log().Debug("vault address unhealthy", "address", v.Addresses[next], "error", err)
+			continue
+		}
+		if err := v.useAddress(next); err != nil {
+			v.log().Info("failover failed", "address", v.Addresses[next], "error", err)
+			continue
+		}
+		v.log().Info("failover", "address", v.Addresses[next])
+		return true
+	}
+	return false
+}
+
+// withFailover calls f and on connection errors calls it again with the next healthy address of
+// Addresses until every address was tried
+func (v *Vault) withFailover(ctx context.Context, f func() error) error {
+	err := f()
+	for i := 1; i < len(v.Addresses) && err != nil && failureReason(err) == reasonConnection; i++ {
+		if !v.failover(ctx) {
+			break
+		}
+		err = f()
+	}
+	return err
+}
@@ -0,0 +1,231 @@
+package k8s
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"fmt"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"time"
+
+	"github.com/pkg/errors"
+	"github.com/postfinance/vault/kv"
+	yaml "gopkg.in/yaml.v2"
+)
+
+// File formats of FetchSecret
+const (
+	FetchFormatJSON   = "json"
+	FetchFormatYAML   = "yaml"
+	FetchFormatDotenv = "dotenv"
+	FetchFormatExport = "export"
+	FetchFormatRaw    = "raw"
+)
+
+// FetchSecret is a secret of a K/V engine written to a file by a Fetcher
+type FetchSecret struct {
+	// Path of the secret including the mount path, e.g. secret/app/db
+	Path string `yaml:"path"`
+	// File the secret is written to
+	File string `yaml:"file"`
+	// Format of the file, empty uses json, dotenv and export write KEY=value lines, export lines
+	// can be sourced by a shell
+	Format string `yaml:"format"`
+	// Key of the secret whose value is written with the raw format
+	Key string `yaml:"key"`
+}
+
+// validate checks path, file, format and key
+func (s FetchSecret) validate() error {
+	if s.Path == "" || s.File == "" {
+		return errors.New("missing path or file of secret")
+	}
+	switch s.Format {
+	case "", FetchFormatJSON, FetchFormatYAML, FetchFormatDotenv, FetchFormatExport:
+	case FetchFormatRaw:
+		if s.Key == "" {
+			return errors.Errorf("missing key of secret %s with raw format", s.Path)
+		}
+	default:
+		return errors.Errorf("unsupported format %q of secret %s", s.Format, s.Path)
+	}
+	return nil
+}
+
+// Fetcher reads secrets of K/V engines with the token of a Vault and writes them to files, e.g. in
+// an init container or together with Run in a sidecar
+// The token is loaded with LoadToken before every request, so it has to be stored first.
+type Fetcher struct {
+	Secrets []FetchSecret
+	// Templates rendered with the secrets they read
+	Templates []FetchTemplate
+	// Interval of Run to read the secrets again, a file is only written if its content changed
+	Interval time.Duration
+	// Options of the kv.Clients of the secrets
+	Options []kv.Option
+
+	v       *Vault
+	clients map[string]*kv.Client
+}
+
+// NewFetcher returns a Fetcher for secrets
+func (v *Vault) NewFetcher(secrets ...FetchSecret) *Fetcher {
+	return &Fetcher{
+		Secrets: secrets,
+		v:       v,
+		clients: make(map[string]*kv.Client),
+	}
+}
+
+// Fetch reads the secrets, renders the templates and writes the files whose content changed
+func (f *Fetcher) Fetch(ctx context.Context) error {
+	for _, s := range f.Secrets {
+		if err := s.validate(); err != nil {
+			return err
+		}
+	}
+	for _, t := range f.Templates {
+		if err := t.validate(); err != nil {
+			return err
+		}
+	}
+	for _, s := range f.Secrets {
+		if err := ctx.Err(); err != nil {
+			return err
+		}
+		content, err := f.content(s)
+		if err != nil {
+			return errors.Wrapf(err, "failed to fetch secret %s", s.Path)
+		}
+		changed, err := writeFileIfChanged(s.File, content)
+		if err != nil {
+			return errors.Wrapf(err, "failed to write secret %s", s.Path)
+		}
+		if changed {
+			f.v.log().Info("secret written", "path", s.Path, "file", s.File)
+		}
+	}
+	if err := ctx.Err(); err != nil {
+		return err
+	}
+	return f.renderTemplates()
+}
+
+// Run fetches the secrets every Interval until ctx is done or the Vault is closed, then it returns
+// nil
+// Without Interval the secrets are fetched once.
+func (f *Fetcher) Run(ctx context.Context) error {
+	ctx, done, err := f.v.start(ctx)
+	if err != nil {
+		return err
+	}
+	defer done()
+	if err := f.Fetch(ctx); err != nil || f.Interval <= 0 {
+		return err
+	}
+	ticker := time.NewTicker(f.Interval)
+	defer ticker.Stop()
+	for {
+		select {
+		case <-ctx.Done():
+			return nil
+		case <-ticker.C:
+			if err := f.Fetch(ctx); err != nil && ctx.Err() == nil {
+				return err
+			}
+		}
+	}
+}
+
+// client returns the kv.Client of the secret path p
+func (f *Fetcher) client(p string) (*kv.Client, error) {
+	if c, ok := f.clients[p]; ok {
+		return c, nil
+	}
+	opts := append([]kv.Option{kv.WithTokenSource(kv.TokenSourceFunc(f.v.LoadToken))}, f.Options...)
+	c, err := kv.New(f.v.client, p, opts...)
+	if err != nil {
+		return nil, err
+	}
+	f.clients[p] = c
+	return c, nil
+}
+
+// content returns the content of the file of the secret s
+func (f *Fetcher) content(s FetchSecret) ([]byte, error) {
+	c, err := f.client(s.Path)
+	if err != nil {
+		return nil, err
+	}
+	if s.Format == FetchFormatDotenv || s.Format == FetchFormatExport {
+		format := kv.EnvFormatDotenv
+		if s.Format == FetchFormatExport {
+			format = kv.EnvFormatExport
+		}
+		buf := &bytes.Buffer{}
+		if err := c.ExportEnv(s.Path, buf, format); err != nil {
+			return nil, err
+		}
+		return buf.Bytes(), nil
+	}
+	data, err := c.Read(s.Path)
+	if err != nil {
+		return nil, err
+	}
+	if data == nil {
+		return nil, errors.New("secret not found")
+	}
+	switch s.Format {
+	case FetchFormatYAML:
+		return yaml.Marshal(data)
+	case FetchFormatRaw:
+		v, ok := data[s.Key]
+		if !ok {
+			return nil, errors.Errorf("key %s not found", s.Key)
+		}
+		if str, ok := v.(string); ok {
+			return []byte(str), nil
+		}
+		return json.Marshal(v)
+	}
+	b, err := json.MarshalIndent(data, "", "  ")
+	if err != nil {
+		return nil, err
+	}
+	return append(b, '\n'), nil
+}
+
+// writeFileIfChanged replaces the file name with content if its content differs, the file is
+// renamed into place so readers never see a partial file
+func writeFileIfChanged(name string, content []byte) (bool, error) {
+	if current, err := ioutil.ReadFile(name); err == nil && bytes.Equal(current, content) {
+		return false, nil
+	}
+	if err := writeFileAtomic(name, content, 0600); err != nil {
+		return false, err
+	}
+	return true, nil
+}
+
+// writeFileAtomic writes content to a temporary file in the directory of name and renames it to
+// name, readers see either the old or the new content
+func writeFileAtomic(name string, content []byte, perm os.FileMode) error {
+	tmp, err := ioutil.TempFile(filepath.Dir(name), fmt.Sprintf(".%s-", filepath.Base(name)))
+	if err != nil {
+		return err
+	}
+	defer os.Remove(tmp.Name())
+	if _, err := tmp.Write(content); err != nil {
+		tmp.Close()
+		return err
+	}
+	if err := tmp.Close(); err != nil {
+		return err
+	}
+	if err := os.Chmod(tmp.Name(), perm); err != nil {
+		return err
+	}
+	return os.Rename(tmp.Name(), name)
+}
@@ -0,0 +1,59 @@
+package k8s
+
+import (
+	"flag"
+	"os"
+
+	"github.com/pkg/errors"
+)
+
+// envFlags are the environment variables of the flags of Config.Flags
+var envFlags = []struct {
+	flag, env string
+}{
+	{"role", "VAULT_ROLE"},
+	{"token-path", "VAULT_TOKEN_PATH"},
+	{"reauth", "VAULT_REAUTH"},
+	{"ttl", "VAULT_TTL"},
+	{"auth-method", "VAULT_AUTH_METHOD"},
+	{"auth-mount-path", "VAULT_AUTH_MOUNT_PATH"},
+	{"service-account-token-path", "SERVICE_ACCOUNT_TOKEN_PATH"},
+	{"allow-fail", "ALLOW_FAIL"},
+	{"wrap-ttl", "VAULT_WRAP_TTL"},
+	{"namespace", "VAULT_NAMESPACE"},
+	{"revoke-on-close", "VAULT_REVOKE_ON_CLOSE"},
+	{"agent-address", "VAULT_AGENT_ADDR"},
+}
+
+// Flags returns a flag set with the flags --role, --token-path, --auth-mount-path and others of
+// the main fields of cfg, parsing it sets the fields
+// The defaults of the flags are the environment variables of NewFromEnvironment if they are set,
+// otherwise the values of cfg, so a flag overrides the environment. The flags can be added to
+// another flag set with VisitAll.
+func (cfg *Config) Flags() (*flag.FlagSet, error) {
+	fs := flag.NewFlagSet("vault", flag.ContinueOnError)
+	fs.StringVar(&cfg.Role, "role", cfg.Role, "vault role of the login (VAULT_ROLE)")
+	fs.StringVar(&cfg.TokenPath, "token-path", cfg.TokenPath, "file the token is stored in (VAULT_TOKEN_PATH)")
+	fs.BoolVar(&cfg.ReAuth, "reauth", cfg.ReAuth, "authenticate again if the token is not usable (VAULT_REAUTH)")
+	fs.DurationVar(&cfg.TTL, "ttl", cfg.TTL, "ttl requested when the token is renewed (VAULT_TTL)")
+	fs.StringVar(&cfg.AuthMethod, "auth-method", cfg.AuthMethod, "auth method of the login (VAULT_AUTH_METHOD)")
+	fs.StringVar(&cfg.AuthMountPath, "auth-mount-path", cfg.AuthMountPath, "mount path of the auth method (VAULT_AUTH_MOUNT_PATH)")
+	fs.StringVar(&cfg.ServiceAccountTokenPath, "service-account-token-path", cfg.ServiceAccountTokenPath, "file of the service account token (SERVICE_ACCOUNT_TOKEN_PATH)")
+	fs.BoolVar(&cfg.AllowFail, "allow-fail", cfg.AllowFail, "do not fail if the login fails (ALLOW_FAIL)")
+	fs.DurationVar(&cfg.WrapTTL, "wrap-ttl", cfg.WrapTTL, "ttl of a response-wrapped login (VAULT_WRAP_TTL)")
+	fs.StringVar(&cfg.Namespace, "namespace", cfg.Namespace, "vault enterprise namespace (VAULT_NAMESPACE)")
+	fs.BoolVar(&cfg.RevokeOnClose, "revoke-on-close", cfg.RevokeOnClose, "revoke the token when the vault is closed (VAULT_REVOKE_ON_CLOSE)")
+	fs.StringVar(&cfg.AgentAddress, "agent-address", cfg.AgentAddress, "address of a vault agent providing the token (VAULT_AGENT_ADDR)")
+	for _, e := range envFlags {
+		s := os.Getenv(e.env)
+		if s == "" {
+			continue
+		}
+		f := fs.Lookup(e.flag)
+		if err := f.Value.Set(s); err != nil {
+			return nil, errors.Wrapf(err, "%s is not a valid value for %s", s, e.env)
+		}
+		f.DefValue = f.Value.String()
+	}
+	return fs, nil
+}
@@ -0,0 +1,84 @@
+package k8s
+
+import (
+	"bytes"
+	"context"
+	"io/ioutil"
+	"net/http"
+	"net/url"
+	"os"
+	"time"
+
+	"github.com/pkg/errors"
+)
+
+// AuthMethodGCP is the GCP auth method of Vault with the gce type
+const AuthMethodGCP = "gcp"
+
+const gcpMetadataEndpoint = "http://metadata.google.internal"
+
+// GCP configures the login with the gce type of the GCP auth method
+// The signed identity JWT of the instance is requested from the metadata server.
+type GCP struct {
+	// ServiceAccount of the instance the identity token is requested for, empty uses the default
+	// service account
+	ServiceAccount string `yaml:"serviceAccount"`
+	// Audience of the identity token, empty uses http://vault/<role>
+	Audience string `yaml:"audience"`
+
+	// endpoint and client, set by tests
+	metadataEndpoint string
+	client           *http.Client
+}
+
+// gcpFromEnvironment reads the GCP configuration from the environment
+func gcpFromEnvironment() *GCP {
+	return &GCP{
+		ServiceAccount: os.Getenv("VAULT_GCP_SERVICE_ACCOUNT"),
+		Audience:       os.Getenv("VAULT_GCP_AUDIENCE"),
+	}
+}
+
+// loginData returns the data of the login with the identity token of the metadata server
+func (g *GCP) loginData(ctx context.Context, role string) (map[string]interface{}, error) {
+	endpoint, client := g.metadataEndpoint, g.client
+	if endpoint == "" {
+		endpoint = gcpMetadataEndpoint
+	}
+	if client == nil {
+		client = &http.Client{Timeout: 10 * time.Second}
+	}
+	sa := g.ServiceAccount
+	if sa == "" {
+		sa = "default"
+	}
+	audience := g.Audience
+	if audience == "" {
+		audience = "http://vault/" + role
+	}
+	params := url.Values{
+		"audience": {audience},
+		"format":   {"full"},
+	}
+	req, err := http.NewRequest(http.MethodGet, endpoint+"/computeMetadata/v1/instance/service-accounts/"+url.PathEscape(sa)+"/identity?"+params.Encode(), nil)
+	if err != nil {
+		return nil, err
+	}
+	req.Header.Set("Metadata-Flavor", "Google")
+	resp, err := client.Do(req.WithContext(ctx))
+	if err != nil {
+		return nil, errors.Wrap(err, "failed to get gcp identity token")
+	}
+	defer resp.Body.Close()
+	if resp.StatusCode != http.StatusOK {
+		return nil, errors.Errorf("failed to get gcp identity token: status %d", resp.StatusCode)
+	}
+	jwt, err := ioutil.ReadAll(resp.Body)
+	if err != nil {
+		return nil, errors.Wrap(err, "failed to read gcp identity token")
+	}
+	return map[string]interface{}{
+		"role": role,
+		"jwt":  string(bytes.TrimSpace(jwt)),
+	}, nil
+}
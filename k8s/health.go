@@ -0,0 +1,63 @@
+package k8s
+
+import (
+	"net/http"
+	"sync"
+	"time"
+
+	"github.com/pkg/errors"
+)
+
+// health is the expiry of the token held by a Vault, zero if the token does not expire
+type health struct {
+	mu     sync.Mutex
+	held   bool
+	expiry time.Time
+}
+
+// tokenHeld records a token valid for ttl, a ttl of 0 never expires like a root token
+func (v *Vault) tokenHeld(ttl time.Duration) {
+	v.health.mu.Lock()
+	defer v.health.mu.Unlock()
+	v.health.held = true
+	v.health.expiry = time.Time{}
+	if ttl > 0 {
+		v.health.expiry = time.Now().Add(ttl)
+	}
+}
+
+// tokenDropped records that no token is held anymore
+func (v *Vault) tokenDropped() {
+	v.health.mu.Lock()
+	defer v.health.mu.Unlock()
+	v.health.held = false
+	v.health.expiry = time.Time{}
+}
+
+// Healthy returns an error if no token was obtained by the login or the renewal, or if the token
+// is expired
+func (v *Vault) Healthy() error {
+	v.health.mu.Lock()
+	defer v.health.mu.Unlock()
+	if !v.health.held {
+		return errors.New("no token")
+	}
+	if !v.health.expiry.IsZero() && !time.Now().Before(v.health.expiry) {
+		return errors.Errorf("token expired at %s", v.health.expiry.Format(time.RFC3339))
+	}
+	return nil
+}
+
+// HealthHandler returns a handler for readiness and liveness probes, it responds with status 200 if
+// Healthy returns nil and with status 503 otherwise, e.g. http.Handle("/healthz", v.HealthHandler())
+func (v *Vault) HealthHandler() http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.Header().Set("Content-Type", "text/plain; charset=utf-8")
+		if err := v.Healthy(); err != nil {
+			w.WriteHeader(http.StatusServiceUnavailable)
+			_, _ = w.Write([]byte(err.Error() + "\n"))
+			return
+		}
+		_, _ = w.Write([]byte("ok\n"))
+	})
+}
@@ -0,0 +1,77 @@
+package k8s
+
+import (
+	"bytes"
+	"io/ioutil"
+	"os"
+	"strings"
+
+	"github.com/pkg/errors"
+)
+
+// AuthMethodJWT is the JWT/OIDC auth method of Vault
+const AuthMethodJWT = "jwt"
+
+// JWT configures the login with the JWT auth method, e.g. with the ID token of a CI job or a SPIFFE
+// JWT-SVID, the sources of the JWT are alternatives
+type JWT struct {
+	// Path of a file containing the JWT, the file is read on every login
+	Path string `yaml:"path"`
+	// Env is the name of an environment variable containing the JWT
+	Env string `yaml:"env"`
+	// Func returns the JWT
+	Func func() (string, error) `yaml:"-"`
+}
+
+// jwtFromEnvironment reads the JWT configuration from the environment
+func jwtFromEnvironment() (*JWT, error) {
+	j := &JWT{
+		Path: os.Getenv("VAULT_JWT_PATH"),
+		Env:  os.Getenv("VAULT_JWT_ENV"),
+	}
+	if err := j.validate(); err != nil {
+		return nil, err
+	}
+	return j, nil
+}
+
+// validate checks that exactly one source of the JWT is set
+func (j *JWT) validate() error {
+	n := 0
+	for _, set := range []bool{j.Path != "", j.Env != "", j.Func != nil} {
+		if set {
+			n++
+		}
+	}
+	if n != 1 {
+		return errors.New("exactly one of jwt path, env or func is required")
+	}
+	return nil
+}
+
+// loginData returns the data of the login with the JWT
+func (j *JWT) loginData(role string) (map[string]interface{}, error) {
+	var jwt string
+	switch {
+	case j.Path != "":
+		content, err := ioutil.ReadFile(j.Path)
+		if err != nil {
+			return nil, errors.Wrap(err, "failed to read jwt")
+		}
+		jwt = string(bytes.TrimSpace(content))
+	case j.Env != "":
+		jwt = strings.TrimSpace(os.Getenv(j.Env))
+	case j.Func != nil:
+		var err error
+		if jwt, err = j.Func(); err != nil {
+			return nil, errors.Wrap(err, "failed to get jwt")
+		}
+	}
+	if jwt == "" {
+		return nil, errors.New("empty jwt")
+	}
+	return map[string]interface{}{
+		"role": role,
+		"jwt":  jwt,
+	}, nil
+}
@@ -0,0 +1,57 @@
+package k8s
+
+import (
+	"bytes"
+	"io"
+	"io/ioutil"
+	"os"
+	"sync"
+
+	"github.com/pkg/errors"
+)
+
+// JWTSource returns the service account token of the Kubernetes login, it is called for every login
+type JWTSource func() (string, error)
+
+// JWTFromFile reads the token from the file p for every login, e.g. a rotated projected token
+// The token is returned as a string which cannot be zeroed, the login with ServiceAccountTokenPath
+// and WithLockedToken sends the token without converting it to a string.
+func JWTFromFile(p string) JWTSource {
+	return func() (string, error) {
+		content, err := ioutil.ReadFile(p)
+		if err != nil {
+			return "", err
+		}
+		return string(bytes.TrimSpace(content)), nil
+	}
+}
+
+// JWTFromEnv reads the token from the environment variable name for every login
+func JWTFromEnv(name string) JWTSource {
+	return func() (string, error) {
+		jwt := os.Getenv(name)
+		if jwt == "" {
+			return "", errors.Errorf("environment variable %s is not set", name)
+		}
+		return jwt, nil
+	}
+}
+
+// JWTFromReader reads the token from r once, e.g. os.Stdin, and returns it for every login
+func JWTFromReader(r io.Reader) JWTSource {
+	var once sync.Once
+	var jwt string
+	var err error
+	return func() (string, error) {
+		once.Do(func() {
+			var content []byte
+			if content, err = ioutil.ReadAll(r); err != nil {
+				return
+			}
+			if jwt = string(bytes.TrimSpace(content)); jwt == "" {
+				err = errors.New("found empty jwt")
+			}
+		})
+		return jwt, err
+	}
+}
@@ -8,6 +8,8 @@ package k8s
 
 import (
 	"bytes"
+	"context"
+	"crypto/sha256"
 	"fmt"
 	"io/ioutil"
 	"os"
@@ -32,20 +34,134 @@ type vaultLogicalWriter interface {
 }
 
 // vaultLogical will be overwritten by tests
-var vaultLogical = func(c *api.Client) vaultLogicalWriter {
-	return c.Logical()
+var vaultLogical = func(ctx context.Context, c *api.Client) vaultLogicalWriter {
+	return contextLogical{ctx: ctx, c: c}
 }
 
 // Vault represents the configuration to get a valid Vault token
 type Vault struct {
-	Role                    string
-	TokenPath               string
-	ReAuth                  bool
-	TTL                     int
-	AuthMountPath           string
+	Role          string
+	TokenPath     string
+	ReAuth        bool
+	TTL           int
+	AuthMountPath string
+	// DiscoverAuthMount finds the mount of AuthMethod in sys/auth before the first login instead of
+	// using AuthMountPath, e.g. auth/k8s-prod-eu1 in a Vault shared by several clusters
+	DiscoverAuthMount bool
+	// AuthMountCandidates are tried by the discovery if listing sys/auth is not permitted or finds
+	// several mounts
+	AuthMountCandidates     []string
 	ServiceAccountTokenPath string
-	AllowFail               bool
-	client                  *api.Client
+	// ServiceAccountTokenPaths are tried in order by the login instead of ServiceAccountTokenPath,
+	// e.g. a projected token with the audience of Vault and the default token during the migration
+	// to bound audiences, AuthInfo contains the path used
+	ServiceAccountTokenPaths []string
+	// JWTSource provides the service account token instead of the files of ServiceAccountTokenPath
+	// and ServiceAccountTokenPaths if it is not nil
+	JWTSource JWTSource
+	// AllowFail makes a failed login non-fatal for TryAuthenticate and TryGetToken, they return a
+	// *SoftFailure instead of an error
+	AllowFail bool
+	// ServiceAccountTokenWatchInterval enables the re-authentication of Run if the content of the
+	// service account token file changes (e.g. a rotated projected token), 0 disables the check
+	ServiceAccountTokenWatchInterval time.Duration
+	// TokenRequest obtains the JWT from the Kubernetes TokenRequest API instead of the service
+	// account token file, nil disables it
+	TokenRequest *TokenRequest
+	// AuthMethod is the auth method used by Authenticate, empty means AuthMethodKubernetes
+	AuthMethod string
+	// AppRole contains the credentials of AuthMethodAppRole
+	AppRole *AppRole
+	// AWS configures AuthMethodAWS
+	AWS *AWS
+	// GCP configures AuthMethodGCP
+	GCP *GCP
+	// Azure configures AuthMethodAzure
+	Azure *Azure
+	// JWT configures AuthMethodJWT
+	JWT *JWT
+	// Cert configures AuthMethodCert
+	Cert *Cert
+	// AgentAddress of a listener of a Vault Agent with use_auto_auth_token, e.g.
+	// unix:///var/run/vault/agent.sock, the auto-auth token of the agent is used instead of a login
+	// of AuthMethod as long as the agent is reachable
+	AgentAddress string
+	// Authenticator replaces the login of AuthMethod if it is not nil
+	Authenticator Authenticator
+	// LoginTimeout bounds each login request instead of the timeout of the Vault client, e.g. for
+	// slow token reviews of the Kubernetes API, 0 uses the client timeout
+	LoginTimeout time.Duration
+	// TokenStore replaces the file TokenPath if it is not nil
+	TokenStore TokenStore
+	// RenewThreshold is the remaining TTL below which GetToken renews a loaded token, 0 uses
+	// DefaultRenewThreshold
+	RenewThreshold time.Duration
+	// RenewBefore is the remaining TTL at which Run renews the token, nil uses the schedule of
+	// api.LifetimeWatcher
+	RenewBefore *RenewBefore
+	// RevokeOnClose revokes the stored token when the Vault is closed
+	RevokeOnClose bool
+	// MinTokenUses is the number of remaining uses at which a token with limited uses is replaced by
+	// a new login, 0 uses DefaultMinTokenUses
+	MinTokenUses int
+	// TokenUsesInterval is the interval Run checks the remaining uses of a token with limited uses,
+	// every check is a use, 0 uses DefaultTokenUsesInterval
+	TokenUsesInterval time.Duration
+	// TokenCheckInterval is the interval Run checks that the stored token is unchanged and stores it
+	// again otherwise, 0 disables the check
+	TokenCheckInterval time.Duration
+	// TokenKey encrypts the stored token with an EncryptedStore if it is not nil, consumers of the
+	// token have to decrypt it with LoadToken
+	TokenKey KeyFunc
+	// LockedToken keeps the token in a LockedStore instead of TokenPath if no TokenStore is set and
+	// avoids copies of the token on the heap, see WithLockedToken
+	LockedToken bool
+	// Logger receives the events of the login and the renewal, nil discards them
+	Logger Logger
+	// Metrics records the login and the renewal if it is not nil
+	Metrics *Metrics
+	// EventRecorder posts Kubernetes Events on the pod if the login or the renewal fails repeatedly, nil
+	// disables them
+	EventRecorder *EventRecorder
+	// Retry the login and the renewal of the stored token on transient errors if it is not nil
+	Retry *Retry
+	// Breaker stops the logins during an outage of Vault after repeated failures if it is not nil
+	Breaker *CircuitBreaker
+	// Namespace of Vault Enterprise used for the login and the renewal, AuthMountPath is relative
+	// to it, e.g. the mount auth/kubernetes of the child namespace team/a is either Namespace
+	// team/a with AuthMountPath auth/kubernetes or no Namespace with AuthMountPath
+	// team/a/auth/kubernetes, the token is issued in the namespace of the mount
+	Namespace string
+	// Addresses of independent Vault clusters, on connection errors the login and the renewal are
+	// tried with the next healthy address, the first address replaces VAULT_ADDR
+	Addresses []string
+	// LeaderElection lets only the leader of several replicas get, store and renew the token in Run
+	// if it is not nil
+	LeaderElection *LeaderElection
+	// WrapTTL requests a response-wrapped login, Authenticate returns the wrapping token which has
+	// to be unwrapped with UnwrapToken or LoadWrappedToken by the consumer of the token
+	WrapTTL time.Duration
+	client  *api.Client
+	// hash of the credential file used by the last authentication
+	credential credential
+	// expiry of the token for Healthy
+	health health
+	// index of the address of Addresses used by client
+	address int
+	// running loops stopped by Close
+	loops loops
+	// tokens of CreateChildToken revoked by Close
+	children childTokens
+	// service account token file of the last login
+	saTokenPath string
+	// true if the auth mount was discovered
+	mountDiscovered bool
+	// callbacks of RegisterTokenCallback
+	callbacks tokenCallbacks
+	// auth information of the last login
+	lastAuth lastAuth
+	// lifecycle events of Events
+	events eventStream
 }
 
 // NewFromEnvironment returns a initialized Vault type for authentication
@@ -70,14 +186,104 @@ func NewFromEnvironment() (*Vault, error) {
 		}
 		v.TTL = int(d.Seconds())
 	}
+	v.AuthMethod = os.Getenv("VAULT_AUTH_METHOD")
 	v.AuthMountPath = FixAuthMountPath(AuthMountPath) // use default
+	switch v.AuthMethod {
+	case "", AuthMethodKubernetes:
+	case AuthMethodAppRole:
+		a, err := appRoleFromEnvironment()
+		if err != nil {
+			return nil, err
+		}
+		v.AppRole = a
+		v.AuthMountPath = FixAuthMountPath(v.AuthMethod)
+	case AuthMethodAWS:
+		if v.Role == "" {
+			return nil, errors.Errorf("missing VAULT_ROLE for %s auth method", v.AuthMethod)
+		}
+		v.AWS = awsFromEnvironment()
+		v.AuthMountPath = FixAuthMountPath(v.AuthMethod)
+	case AuthMethodGCP:
+		if v.Role == "" {
+			return nil, errors.Errorf("missing VAULT_ROLE for %s auth method", v.AuthMethod)
+		}
+		v.GCP = gcpFromEnvironment()
+		v.AuthMountPath = FixAuthMountPath(v.AuthMethod)
+	case AuthMethodAzure:
+		if v.Role == "" {
+			return nil, errors.Errorf("missing VAULT_ROLE for %s auth method", v.AuthMethod)
+		}
+		v.Azure = azureFromEnvironment()
+		v.AuthMountPath = FixAuthMountPath(v.AuthMethod)
+	case AuthMethodJWT:
+		j, err := jwtFromEnvironment()
+		if err != nil {
+			return nil, err
+		}
+		v.JWT = j
+		v.AuthMountPath = FixAuthMountPath(v.AuthMethod)
+	case AuthMethodCert:
+		c, err := certFromEnvironment()
+		if err != nil {
+			return nil, err
+		}
+		v.Cert = c
+		v.AuthMountPath = FixAuthMountPath(v.AuthMethod)
+	default:
+		return nil, errors.Errorf("unsupported auth method %q in VAULT_AUTH_METHOD", v.AuthMethod)
+	}
 	if p := os.Getenv("VAULT_AUTH_MOUNT_PATH"); p != "" {
 		v.AuthMountPath = FixAuthMountPath(p) // if set, use value from environment
+	} else if s := os.Getenv("VAULT_AUTH_MOUNT_DISCOVERY"); s != "" {
+		b, err := strconv.ParseBool(s)
+		if err != nil {
+			return nil, errors.Wrap(err, "1, t, T, TRUE, true, True, 0, f, F, FALSE, false, False are valid values for VAULT_AUTH_MOUNT_DISCOVERY")
+		}
+		v.DiscoverAuthMount = b
+		v.AuthMountCandidates = authMountCandidatesFromEnvironment()
 	}
 	v.ServiceAccountTokenPath = os.Getenv("SERVICE_ACCOUNT_TOKEN_PATH")
 	if v.ServiceAccountTokenPath == "" {
 		v.ServiceAccountTokenPath = "/var/run/secrets/kubernetes.io/serviceaccount/token"
 	}
+	for _, p := range strings.Split(os.Getenv("SERVICE_ACCOUNT_TOKEN_PATHS"), ",") {
+		if p = strings.TrimSpace(p); p != "" {
+			v.ServiceAccountTokenPaths = append(v.ServiceAccountTokenPaths, p)
+		}
+	}
+	if s := os.Getenv("SERVICE_ACCOUNT_TOKEN_WATCH_INTERVAL"); s != "" {
+		d, err := time.ParseDuration(s)
+		if err != nil {
+			return nil, errors.Wrapf(err, "%s is not a valid duration for SERVICE_ACCOUNT_TOKEN_WATCH_INTERVAL", s)
+		}
+		v.ServiceAccountTokenWatchInterval = d
+	}
+	if s := os.Getenv("SERVICE_ACCOUNT_TOKEN_AUDIENCES"); s != "" {
+		v.TokenRequest = &TokenRequest{
+			Audiences: strings.Split(s, ","),
+		}
+		if s := os.Getenv("SERVICE_ACCOUNT_TOKEN_EXPIRATION"); s != "" {
+			d, err := time.ParseDuration(s)
+			if err != nil {
+				return nil, errors.Wrapf(err, "%s is not a valid duration for SERVICE_ACCOUNT_TOKEN_EXPIRATION", s)
+			}
+			v.TokenRequest.ExpirationSeconds = int64(d.Seconds())
+		}
+	}
+	if s := os.Getenv("VAULT_WRAP_TTL"); s != "" {
+		d, err := time.ParseDuration(s)
+		if err != nil {
+			return nil, errors.Wrapf(err, "%s is not a valid duration for VAULT_WRAP_TTL", s)
+		}
+		v.WrapTTL = d
+	}
+	if s := os.Getenv("VAULT_REVOKE_ON_CLOSE"); s != "" {
+		b, err := strconv.ParseBool(s)
+		if err != nil {
+			return nil, errors.Wrap(err, "1, t, T, TRUE, true, True, 0, f, F, FALSE, false, False are valid values for VAULT_REVOKE_ON_CLOSE")
+		}
+		v.RevokeOnClose = b
+	}
 	if s := os.Getenv("ALLOW_FAIL"); s != "" {
 		b, err := strconv.ParseBool(s)
 		if err != nil {
@@ -85,16 +291,93 @@ func NewFromEnvironment() (*Vault, error) {
 		}
 		v.AllowFail = b
 	}
+	r, err := retryFromEnvironment()
+	if err != nil {
+		return nil, err
+	}
+	v.Retry = r
+	b, err := breakerFromEnvironment()
+	if err != nil {
+		return nil, err
+	}
+	v.Breaker = b
+	v.Addresses = addressesFromEnvironment()
+	v.Namespace = os.Getenv("VAULT_NAMESPACE")
+	if s := os.Getenv("VAULT_LOGIN_TIMEOUT"); s != "" {
+		d, err := time.ParseDuration(s)
+		if err != nil {
+			return nil, errors.Wrapf(err, "%s is not a valid duration for VAULT_LOGIN_TIMEOUT", s)
+		}
+		v.LoginTimeout = d
+	}
+	if s := os.Getenv("VAULT_RENEW_THRESHOLD"); s != "" {
+		d, err := time.ParseDuration(s)
+		if err != nil {
+			return nil, errors.Wrapf(err, "%s is not a valid duration for VAULT_RENEW_THRESHOLD", s)
+		}
+		v.RenewThreshold = d
+	}
+	if s := os.Getenv("VAULT_RENEW_BEFORE"); s != "" {
+		r, err := ParseRenewBefore(s)
+		if err != nil {
+			return nil, errors.Wrap(err, "invalid VAULT_RENEW_BEFORE")
+		}
+		v.RenewBefore = r
+	}
+	if s := os.Getenv("VAULT_MIN_TOKEN_USES"); s != "" {
+		n, err := strconv.Atoi(s)
+		if err != nil || n < 0 {
+			return nil, errors.Errorf("%s is not a valid number for VAULT_MIN_TOKEN_USES", s)
+		}
+		v.MinTokenUses = n
+	}
+	if s := os.Getenv("VAULT_TOKEN_USES_INTERVAL"); s != "" {
+		d, err := time.ParseDuration(s)
+		if err != nil {
+			return nil, errors.Wrapf(err, "%s is not a valid duration for VAULT_TOKEN_USES_INTERVAL", s)
+		}
+		v.TokenUsesInterval = d
+	}
+	if s := os.Getenv("VAULT_TOKEN_CHECK_INTERVAL"); s != "" {
+		d, err := time.ParseDuration(s)
+		if err != nil {
+			return nil, errors.Wrapf(err, "%s is not a valid duration for VAULT_TOKEN_CHECK_INTERVAL", s)
+		}
+		v.TokenCheckInterval = d
+	}
+	v.AgentAddress = os.Getenv("VAULT_AGENT_ADDR")
+	if s := os.Getenv("VAULT_EVENTS"); s != "" {
+		b, err := strconv.ParseBool(s)
+		if err != nil {
+			return nil, errors.Wrap(err, "1, t, T, TRUE, true, True, 0, f, F, FALSE, false, False are valid values for VAULT_EVENTS")
+		}
+		if b {
+			v.EventRecorder = &EventRecorder{}
+		}
+	}
+	if s := os.Getenv("VAULT_LEADER_ELECTION_LEASE"); s != "" {
+		v.LeaderElection = &LeaderElection{Lease: s}
+	}
+	if p := os.Getenv("VAULT_TOKEN_KEY_FILE"); p != "" {
+		v.TokenKey = KeyFromFile(p)
+	}
 	// create vault client
 	vaultConfig := api.DefaultConfig()
 	if err := vaultConfig.ReadEnvironment(); err != nil {
 		return nil, errors.Wrap(err, "failed to read environment for vault")
 	}
-	var err error
 	v.client, err = api.NewClient(vaultConfig)
 	if err != nil {
 		return nil, errors.Wrap(err, "failed to create vault client")
 	}
+	if len(v.Addresses) > 0 {
+		if err := v.useAddress(0); err != nil {
+			return nil, err
+		}
+	}
+	if v.Namespace != "" {
+		v.client.SetNamespace(v.Namespace)
+	}
 	return v, nil
 }
 
@@ -103,48 +386,298 @@ func (v *Vault) Client() *api.Client {
 	return v.client
 }
 
-// Authenticate with vault
+// Authenticate with vault using Authenticator or the auth method AuthMethod
 func (v *Vault) Authenticate() (string, error) {
+	return v.AuthenticateWithContext(context.Background())
+}
+
+// AuthenticateWithContext is Authenticate with a context bounding the login
+// A failed login returns an *AuthError, see AuthErrorKind. A login rejected by Breaker returns
+// ErrCircuitOpen or ErrRetryBudgetExhausted.
+func (v *Vault) AuthenticateWithContext(ctx context.Context) (string, error) {
+	method := v.AuthMethod
+	if method == "" {
+		method = AuthMethodKubernetes
+	}
+	if v.Authenticator != nil {
+		method = "custom"
+	}
+	v.log().Info("login", "method", method, "mount", v.AuthMountPath, "role", v.Role)
+	var token string
+	err := v.retry(ctx, "login", func() error {
+		if err := v.Breaker.allow(); err != nil {
+			v.log().Info("login rejected", "method", method, "error", err, "retry", v.Breaker.retryAfter())
+			return err
+		}
+		v.Metrics.loginAttempt()
+		var err error
+		token, err = v.authenticate(ctx)
+		v.Breaker.record(err)
+		if err != nil {
+			v.log().Info("login failed", "method", method, "error", err)
+			v.Metrics.loginFailure(err)
+			v.EventRecorder.failure(v, EventReasonLoginFailed, err)
+		}
+		return err
+	})
+	return token, authError(err)
+}
+
+// authenticate with Authenticator or the auth method AuthMethod
+func (v *Vault) authenticate(ctx context.Context) (string, error) {
 	var empty string
+	a := v.authenticator()
+	c := v.client
+	if v.LoginTimeout > 0 {
+		var err error
+		if c, err = v.loginClient(c); err != nil {
+			return empty, err
+		}
+		var cancel context.CancelFunc
+		ctx, cancel = context.WithTimeout(ctx, v.LoginTimeout)
+		defer cancel()
+	}
+	if v.WrapTTL > 0 {
+		var err error
+		if c, err = v.wrappingClient(c); err != nil {
+			return empty, err
+		}
+	}
+	s, err := v.discoverLogin(ctx, a, c)
+	if err != nil {
+		return empty, err
+	}
+	if s == nil {
+		return empty, errors.New("login returned no secret")
+	}
+	if len(s.Warnings) > 0 {
+		return empty, fmt.Errorf("login failed with: %s", strings.Join(s.Warnings, " - "))
+	}
+	if v.WrapTTL > 0 {
+		if s.WrapInfo == nil || s.WrapInfo.Token == "" {
+			return empty, errors.New("login response is not wrapped")
+		}
+		v.log().Info("login succeeded", "wrapped", true, "ttl", time.Duration(s.WrapInfo.TTL)*time.Second)
+		v.Metrics.loginSuccess(time.Duration(s.WrapInfo.TTL) * time.Second)
+		v.tokenHeld(time.Duration(s.WrapInfo.TTL) * time.Second)
+		v.setLastAuth(nil)
+		v.newToken(s.WrapInfo.Token, nil)
+		return s.WrapInfo.Token, nil
+	}
+	if s.Auth == nil {
+		return empty, errors.New("login returned no token")
+	}
+	v.log().Info("login succeeded", "ttl", time.Duration(s.Auth.LeaseDuration)*time.Second, "renewable", s.Auth.Renewable, "policies", s.Auth.Policies)
+	v.Metrics.loginSuccess(time.Duration(s.Auth.LeaseDuration) * time.Second)
+	v.EventRecorder.success(EventReasonLoginFailed)
+	v.tokenHeld(time.Duration(s.Auth.LeaseDuration) * time.Second)
+	info := newAuthInfo(s.Auth)
+	if v.Authenticator == nil && (v.AuthMethod == "" || v.AuthMethod == AuthMethodKubernetes) {
+		info.ServiceAccountTokenPath = v.saTokenPath
+	}
+	v.setLastAuth(info)
+	v.newToken(s.Auth.ClientToken, s.Auth)
+	return s.Auth.ClientToken, nil
+}
+
+// authenticator returns Authenticator, the Vault Agent of AgentAddress or the auth method
+func (v *Vault) authenticator() Authenticator {
+	if v.Authenticator != nil {
+		return v.Authenticator
+	}
+	var a Authenticator = authMethod{v}
+	if v.AgentAddress != "" {
+		a = agentAuthenticator{v: v, fallback: a}
+	}
+	return a
+}
+
+// authMethod is the Authenticator of the auth method AuthMethod
+type authMethod struct {
+	v *Vault
+}
+
+// Login with the auth method AuthMethod
+func (a authMethod) Login(ctx context.Context, c *api.Client) (*api.Secret, error) {
+	v := a.v
+	switch v.AuthMethod {
+	case "", AuthMethodKubernetes:
+		return v.kubernetesLogin(ctx, c)
+	case AuthMethodAppRole:
+		if v.AppRole == nil {
+			return nil, errors.New("missing approle credentials")
+		}
+		data, err := v.AppRole.loginData(c)
+		if err != nil {
+			return nil, err
+		}
+		return v.login(ctx, c, data, "approle login failed")
+	case AuthMethodAWS:
+		if v.AWS == nil {
+			v.AWS = &AWS{}
+		}
+		data, err := v.AWS.loginData(ctx, v.Role)
+		if err != nil {
+			return nil, err
+		}
+		return v.login(ctx, c, data, fmt.Sprintf("aws login failed with role %q", v.Role))
+	case AuthMethodGCP:
+		if v.GCP == nil {
+			v.GCP = &GCP{}
+		}
+		data, err := v.GCP.loginData(ctx, v.Role)
+		if err != nil {
+			return nil, err
+		}
+		return v.login(ctx, c, data, fmt.Sprintf("gcp login failed with role %q", v.Role))
+	case AuthMethodAzure:
+		if v.Azure == nil {
+			v.Azure = &Azure{}
+		}
+		data, err := v.Azure.loginData(ctx, v.Role)
+		if err != nil {
+			return nil, err
+		}
+		return v.login(ctx, c, data, fmt.Sprintf("azure login failed with role %q", v.Role))
+	case AuthMethodJWT:
+		if v.JWT == nil {
+			return nil, errors.New("missing jwt configuration")
+		}
+		data, err := v.JWT.loginData(v.Role)
+		if err != nil {
+			return nil, err
+		}
+		return v.login(ctx, c, data, fmt.Sprintf("jwt login failed with role %q", v.Role))
+	case AuthMethodCert:
+		return v.certLogin(ctx, c)
+	}
+	return nil, errors.Errorf("unsupported auth method %q", v.AuthMethod)
+}
+
+// kubernetesLogin authenticates with the service account token
+func (v *Vault) kubernetesLogin(ctx context.Context, c *api.Client) (*api.Secret, error) {
+	if v.JWTSource != nil {
+		return v.kubernetesLoginWith(ctx, c, v.JWTSource, "")
+	}
+	paths := v.ServiceAccountTokenPaths
+	if len(paths) == 0 {
+		paths = []string{v.ServiceAccountTokenPath}
+	}
+	var err error
+	for i, p := range paths {
+		var s *api.Secret
+		s, err = v.kubernetesLoginWith(ctx, c, JWTFromFile(p), p)
+		if err == nil {
+			v.saTokenPath = p
+			return s, nil
+		}
+		if i < len(paths)-1 {
+			v.log().Debug("login with service account token failed", "path", p, "error", err)
+		}
+	}
+	return nil, err
+}
+
+// kubernetesLoginWith authenticates with the service account token of source, p is the file of the
+// token if source reads a file
+func (v *Vault) kubernetesLoginWith(ctx context.Context, c *api.Client, source JWTSource, p string) (*api.Secret, error) {
+	if v.LockedToken && p != "" && v.TokenRequest == nil {
+		return v.kubernetesLoginFile(ctx, c, p)
+	}
 	// read jwt of serviceaccount
-	content, err := ioutil.ReadFile(v.ServiceAccountTokenPath)
+	jwt, err := source()
 	if err != nil {
-		return empty, errors.Wrap(err, "failed to read jwt token")
+		return nil, &AuthError{Kind: ErrInvalidJWT, Err: errors.Wrap(err, "failed to read jwt token")}
+	}
+	v.setCredentialSum(sha256.Sum256([]byte(jwt)))
+	v.log().Debug("service account token", "path", p, "audiences", jwtAudiences(jwt))
+	if v.TokenRequest != nil {
+		jwt, err = v.TokenRequest.requestToken(ctx, jwt)
+		if err != nil {
+			return nil, err
+		}
 	}
-	jwt := string(bytes.TrimSpace(content))
 
 	// authenticate
 	data := make(map[string]interface{})
 	data["role"] = v.Role
 	data["jwt"] = jwt
-	s, err := vaultLogical(v.client).Write(path.Join(FixAuthMountPath(v.AuthMountPath), "login"), data)
+	return v.login(ctx, c, data, fmt.Sprintf("login failed with role from environment variable VAULT_ROLE: %q", v.Role))
+}
+
+// kubernetesLoginFile authenticates with the service account token file p without converting the
+// token to a string, the read buffer is zeroed after the login
+// Copies of the request body made by the HTTP client are not zeroed.
+func (v *Vault) kubernetesLoginFile(ctx context.Context, c *api.Client, p string) (*api.Secret, error) {
+	content, err := ioutil.ReadFile(p)
 	if err != nil {
-		return empty, errors.Wrapf(err, "login failed with role from environment variable VAULT_ROLE: %q", v.Role)
+		return nil, &AuthError{Kind: ErrInvalidJWT, Err: errors.Wrap(err, "failed to read jwt token")}
 	}
-	if len(s.Warnings) > 0 {
-		return empty, fmt.Errorf("login failed with: %s", strings.Join(s.Warnings, " - "))
+	defer zero(content)
+	jwt := bytes.TrimSpace(content)
+	v.setCredentialSum(sha256.Sum256(jwt))
+	data := make(map[string]interface{})
+	data["role"] = v.Role
+	data["jwt"] = secretBytes(jwt)
+	return v.login(ctx, c, data, fmt.Sprintf("login failed with role from environment variable VAULT_ROLE: %q", v.Role))
+}
+
+// certLogin authenticates over mTLS with the client certificate
+func (v *Vault) certLogin(ctx context.Context, c *api.Client) (*api.Secret, error) {
+	if v.Cert == nil {
+		return nil, errors.New("missing client certificate configuration")
 	}
-	return s.Auth.ClientToken, nil
+	content, err := ioutil.ReadFile(v.Cert.CertPath)
+	if err != nil {
+		return nil, errors.Wrap(err, "failed to read client certificate")
+	}
+	tlsClient, err := v.Cert.client(c.Address())
+	if err != nil {
+		return nil, err
+	}
+	tlsClient.SetHeaders(c.Headers())
+	tlsClient.SetWrappingLookupFunc(c.CurrentWrappingLookupFunc())
+	v.setCredentialSum(sha256.Sum256(bytes.TrimSpace(content)))
+	data := make(map[string]interface{})
+	if v.Role != "" {
+		data["name"] = v.Role
+	}
+	return v.login(ctx, tlsClient, data, fmt.Sprintf("cert login failed with role %q", v.Role))
 }
 
-// StoreToken in VaultTokenPath
+// login writes data to the login endpoint of AuthMountPath with the Vault client c
+func (v *Vault) login(ctx context.Context, c *api.Client, data map[string]interface{}, msg string) (*api.Secret, error) {
+	s, err := vaultLogical(ctx, c).Write(path.Join(FixAuthMountPath(v.AuthMountPath), "login"), data)
+	if err != nil {
+		return nil, errors.Wrap(err, msg)
+	}
+	return s, nil
+}
+
+// StoreToken in TokenStore or VaultTokenPath
 func (v *Vault) StoreToken(token string) error {
-	if err := ioutil.WriteFile(v.TokenPath, []byte(token), 0644); err != nil {
-		return errors.Wrap(err, "failed to store token")
+	err := v.tokenStore().Store(token)
+	if err != nil {
+		v.Metrics.storeFailure()
 	}
-	return nil
+	return err
 }
 
-// LoadToken from VaultTokenPath
+// LoadToken from TokenStore or VaultTokenPath
 func (v *Vault) LoadToken() (string, error) {
-	content, err := ioutil.ReadFile(v.TokenPath)
-	if err != nil {
-		return "", errors.Wrap(err, "failed to load token")
+	return v.tokenStore().Load()
+}
+
+// tokenStore returns TokenStore or a FileStore of TokenPath
+func (v *Vault) tokenStore() TokenStore {
+	var s TokenStore = FileStore(v.TokenPath)
+	if v.TokenStore != nil {
+		s = v.TokenStore
 	}
-	if len(content) == 0 {
-		return "", fmt.Errorf("found empty token")
+	if v.TokenKey != nil {
+		return &EncryptedStore{TokenStore: s, Key: v.TokenKey}
 	}
-	return string(content), nil
+	return s
 }
 
 // UseToken directly for requests with Vault
@@ -152,41 +685,141 @@ func (v *Vault) UseToken(token string) {
 	v.client.SetToken(token)
 }
 
-// GetToken tries to load the vault token from VaultTokenPath
-// if token is not available, invalid or not renewable
+// clearToken removes the token from the Vault client after it was used if LockedToken is set
+func (v *Vault) clearToken() {
+	if v.LockedToken {
+		v.client.ClearToken()
+	}
+}
+
+// GetToken tries to load the vault token from VaultTokenPath and validates it with a lookup
+// The token is only renewed if its remaining TTL is below RenewThreshold.
+// if token is not available, invalid or expiring and not renewable
 // and VaultReAuth is true, try to re-authenticate
+// With WrapTTL a new wrapping token is returned by Authenticate
 func (v *Vault) GetToken() (string, error) {
+	return v.GetTokenWithContext(context.Background())
+}
+
+// GetTokenWithContext is GetToken with a context bounding the renewal and the login
+func (v *Vault) GetTokenWithContext(ctx context.Context) (string, error) {
 	var empty string
+	if v.WrapTTL > 0 {
+		return v.AuthenticateWithContext(ctx)
+	}
 	token, err := v.LoadToken()
 	if err != nil {
 		if v.ReAuth {
-			return v.Authenticate()
+			v.log().Debug("no stored token", "error", err)
+			return v.AuthenticateWithContext(ctx)
+		}
+		if f, ok := v.tokenStore().(FileStore); ok {
+			return empty, errors.Wrapf(err, "failed to load token from %s", string(f))
 		}
-		return empty, errors.Wrapf(err, "failed to load token form: %s", v.TokenPath)
+		return empty, errors.Wrap(err, "failed to load token")
 	}
 	v.client.SetToken(token)
-	if _, err = v.client.Auth().Token().RenewSelf(v.TTL); err != nil {
+	defer v.clearToken()
+	var s *api.Secret
+	err = v.retry(ctx, "lookup", func() error {
+		var err error
+		s, err = vaultLookupSelf(ctx, v.client)
+		return err
+	})
+	var info tokenInfo
+	if err == nil {
+		info, err = parseTokenInfo(s)
+	}
+	if err != nil {
 		if v.ReAuth {
-			return v.Authenticate()
+			v.log().Debug("stored token invalid", "error", err)
+			return v.AuthenticateWithContext(ctx)
+		}
+		return empty, errors.Wrap(err, "failed to lookup token")
+	}
+	if info.usesExhausted(v.minTokenUses()) {
+		if v.ReAuth {
+			v.log().Debug("stored token uses exhausted", "uses", info.numUses)
+			return v.AuthenticateWithContext(ctx)
+		}
+		return empty, errors.Errorf("token has only %d uses left", info.numUses)
+	}
+	if info.ttl == 0 || info.ttl >= v.renewThreshold() {
+		v.log().Debug("stored token valid", "ttl", info.ttl)
+		v.tokenHeld(info.ttl)
+		return token, nil
+	}
+	if !info.renewable {
+		err = errors.Errorf("token expires in %s and is not renewable", info.ttl)
+	} else {
+		err = v.retry(ctx, "renewal", func() error {
+			var err error
+			s, err = vaultRenewSelf(ctx, v.client, v.increment(info))
+			return err
+		})
+	}
+	if err != nil {
+		if info.renewable {
+			v.EventRecorder.failure(v, EventReasonRenewalFailed, err)
+		}
+		if v.ReAuth {
+			v.log().Debug("stored token not renewable", "error", err)
+			return v.AuthenticateWithContext(ctx)
 		}
 		return empty, errors.Wrap(err, "failed to renew token")
 	}
+	if s != nil && s.Auth != nil {
+		v.log().Debug("stored token renewed", "ttl", time.Duration(s.Auth.LeaseDuration)*time.Second)
+		v.Metrics.renewal(time.Duration(s.Auth.LeaseDuration) * time.Second)
+		v.EventRecorder.success(EventReasonRenewalFailed)
+		v.tokenHeld(time.Duration(s.Auth.LeaseDuration) * time.Second)
+	}
 	return token, nil
 }
 
 // NewRenewer returns a *api.Renewer to renew the vault token regularly
+//
+// Deprecated: use NewWatcher, which also authenticates again and stores the new token, or
+// NewLifetimeWatcher
 func (v *Vault) NewRenewer(token string) (*api.Renewer, error) {
+	return v.NewLifetimeWatcher(context.Background(), token)
+}
+
+// NewRenewerWithContext is NewRenewer with a context bounding the initial renewal
+//
+// Deprecated: use NewWatcher or NewLifetimeWatcher
+func (v *Vault) NewRenewerWithContext(ctx context.Context, token string) (*api.Renewer, error) {
+	return v.NewLifetimeWatcher(ctx, token)
+}
+
+// NewLifetimeWatcher returns a *api.LifetimeWatcher to renew the vault token regularly, ctx bounds
+// the lookup and the initial renewal
+// Batch tokens cannot be renewed and periodic tokens are renewed with their period.
+func (v *Vault) NewLifetimeWatcher(ctx context.Context, token string) (*api.LifetimeWatcher, error) {
 	v.client.SetToken(token)
-	// renew the token to get a secret usable for renewer
-	secret, err := v.client.Auth().Token().RenewSelf(v.TTL)
+	info, err := v.lookup(ctx)
+	if err != nil {
+		return nil, err
+	}
+	if info.batch {
+		return nil, errors.New("batch tokens cannot be renewed")
+	}
+	return v.newLifetimeWatcher(ctx, v.increment(info))
+}
+
+// newLifetimeWatcher returns a *api.LifetimeWatcher renewing the token of the Vault client with
+// increment
+func (v *Vault) newLifetimeWatcher(ctx context.Context, increment int) (*api.LifetimeWatcher, error) {
+	// renew the token to get a secret usable for the watcher
+	secret, err := vaultRenewSelf(ctx, v.client, increment)
 	if err != nil {
 		return nil, errors.Wrap(err, "failed to renew-self token")
 	}
-	renewer, err := v.client.NewRenewer(&api.RenewerInput{Secret: secret})
+	watcher, err := v.client.NewLifetimeWatcher(&api.LifetimeWatcherInput{Secret: secret, Increment: increment})
 	if err != nil {
-		return nil, errors.Wrap(err, "failed to get token renewer")
+		return nil, errors.Wrap(err, "failed to get token lifetime watcher")
 	}
-	return renewer, nil
+	return watcher, nil
 }
 
 // FixAuthMountPath add the auth prefix
@@ -1,19 +1,43 @@
 package k8s
 
 import (
+	"context"
+	"crypto/ecdsa"
+	"crypto/elliptic"
+	"crypto/rand"
+	"crypto/x509"
+	"crypto/x509/pkix"
+	"encoding/base64"
+	"encoding/json"
+	"encoding/pem"
 	"flag"
 	"fmt"
 	"io/ioutil"
 	"log"
+	"math/big"
+	"net"
+	"net/http"
+	"net/http/httptest"
 	"os"
+	"path/filepath"
+	"strconv"
 	"strings"
+	"sync"
 	"testing"
+	"time"
 
 	"github.com/hashicorp/vault/api"
 	"github.com/ory/dockertest"
 	"github.com/pkg/errors"
+	"github.com/postfinance/vault/kv"
 	"github.com/stretchr/testify/assert"
 	"github.com/stretchr/testify/require"
+	authenticationv1 "k8s.io/api/authentication/v1"
+	corev1 "k8s.io/api/core/v1"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/apimachinery/pkg/runtime"
+	"k8s.io/client-go/kubernetes/fake"
+	k8stesting "k8s.io/client-go/testing"
 )
 
 const (
@@ -250,7 +274,7 @@ func TestToken(t *testing.T) {
 		assert.Equal(t, "", token)
 	})
 
-	t.Run("failed to renew token without ReAuth", func(t *testing.T) {
+	t.Run("valid non-expiring token without ReAuth", func(t *testing.T) {
 		vaultTokenPath, err := ioutil.TempFile("", "vault-token")
 		if err != nil {
 			t.Fatal(err)
@@ -263,9 +287,10 @@ func TestToken(t *testing.T) {
 		assert.NotNil(t, v)
 		assert.NoError(t, err)
 		require.NoError(t, v.StoreToken(rootToken))
+		// the root token does not expire and is not renewed
 		token, err := v.GetToken()
-		assert.Error(t, err)
-		assert.Equal(t, "", token)
+		assert.NoError(t, err)
+		assert.Equal(t, rootToken, token)
 	})
 
 	t.Run("successful renew token without ReAuth", func(t *testing.T) {
@@ -339,7 +364,7 @@ func TestAuthenticate(t *testing.T) {
 		assert.NotNil(t, v)
 		assert.NoError(t, err)
 		vaultLogicalBackup := vaultLogical
-		vaultLogical = func(c *api.Client) vaultLogicalWriter {
+		vaultLogical = func(ctx context.Context, c *api.Client) vaultLogicalWriter {
 			return &fakeWriter{}
 		}
 		defer func() { vaultLogical = vaultLogicalBackup }()
@@ -356,7 +381,7 @@ func TestAuthenticate(t *testing.T) {
 		assert.NotNil(t, v)
 		assert.NoError(t, err)
 		vaultLogicalBackup := vaultLogical
-		vaultLogical = func(c *api.Client) vaultLogicalWriter {
+		vaultLogical = func(ctx context.Context, c *api.Client) vaultLogicalWriter {
 			return &fakeWriterWithWarnings{}
 		}
 		defer func() { vaultLogical = vaultLogicalBackup }()
@@ -382,7 +407,7 @@ func TestAuthenticate(t *testing.T) {
 		assert.Equal(t, "", token)
 	})
 
-	t.Run("failed to renew token with ReAuth", func(t *testing.T) {
+	t.Run("valid non-expiring token with ReAuth", func(t *testing.T) {
 		vaultTokenPath, err := ioutil.TempFile("", "vault-token")
 		if err != nil {
 			t.Fatal(err)
@@ -395,9 +420,10 @@ func TestAuthenticate(t *testing.T) {
 		assert.NotNil(t, v)
 		assert.NoError(t, err)
 		require.NoError(t, v.StoreToken(rootToken))
+		// the root token does not expire and is not renewed
 		token, err := v.GetToken()
-		assert.Error(t, err)
-		assert.Equal(t, "", token)
+		assert.NoError(t, err)
+		assert.Equal(t, rootToken, token)
 	})
 }
 
@@ -460,3 +486,2442 @@ func (f *fakeWriterWithWarnings) Write(path string, data map[string]interface{})
 		Warnings: []string{"warning"},
 	}, nil
 }
+
+func TestRun(t *testing.T) {
+	vaultTokenPath, err := ioutil.TempFile("", "vault-token")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.Remove(vaultTokenPath.Name())
+	serviceAccountTokenPath, err := ioutil.TempFile("", "sa-token")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.Remove(serviceAccountTokenPath.Name())
+	os.Setenv("VAULT_TOKEN_PATH", vaultTokenPath.Name())
+	os.Setenv("SERVICE_ACCOUNT_TOKEN_PATH", serviceAccountTokenPath.Name())
+	defer os.Setenv("SERVICE_ACCOUNT_TOKEN_PATH", "")
+
+	t.Run("failed to get token without ReAuth", func(t *testing.T) {
+		v, err := NewFromEnvironment()
+		require.NoError(t, err)
+		assert.Error(t, v.Run(context.Background()))
+	})
+
+	t.Run("authenticate, store and renew token", func(t *testing.T) {
+		os.Setenv("VAULT_REAUTH", "true")
+		defer os.Setenv("VAULT_REAUTH", "")
+		v, err := NewFromEnvironment()
+		require.NoError(t, err)
+		v.UseToken(rootToken)
+		secret, err := v.Client().Auth().Token().CreateOrphan(&api.TokenCreateRequest{
+			TTL: "3600s",
+		})
+		require.NoError(t, err)
+		vaultLogicalBackup := vaultLogical
+		vaultLogical = func(ctx context.Context, c *api.Client) vaultLogicalWriter {
+			return &fakeTokenWriter{token: secret.Auth.ClientToken}
+		}
+		defer func() { vaultLogical = vaultLogicalBackup }()
+		ctx, cancel := context.WithTimeout(context.Background(), time.Second)
+		defer cancel()
+		assert.NoError(t, v.Run(ctx))
+		token, err := v.LoadToken()
+		assert.NoError(t, err)
+		assert.Equal(t, secret.Auth.ClientToken, token)
+	})
+
+	t.Run("re-authenticate on service account token change", func(t *testing.T) {
+		os.Setenv("VAULT_REAUTH", "true")
+		defer os.Setenv("VAULT_REAUTH", "")
+		os.Setenv("SERVICE_ACCOUNT_TOKEN_WATCH_INTERVAL", "50ms")
+		defer os.Setenv("SERVICE_ACCOUNT_TOKEN_WATCH_INTERVAL", "")
+		require.NoError(t, ioutil.WriteFile(serviceAccountTokenPath.Name(), []byte("first"), 0600))
+		v, err := NewFromEnvironment()
+		require.NoError(t, err)
+		assert.Equal(t, 50*time.Millisecond, v.ServiceAccountTokenWatchInterval)
+		require.NoError(t, v.StoreToken(""))
+		v.UseToken(rootToken)
+		secret, err := v.Client().Auth().Token().CreateOrphan(&api.TokenCreateRequest{
+			TTL: "3600s",
+		})
+		require.NoError(t, err)
+		writer := &fakeTokenWriter{token: secret.Auth.ClientToken}
+		vaultLogicalBackup := vaultLogical
+		vaultLogical = func(ctx context.Context, c *api.Client) vaultLogicalWriter {
+			return writer
+		}
+		defer func() { vaultLogical = vaultLogicalBackup }()
+		ctx, cancel := context.WithTimeout(context.Background(), time.Second)
+		defer cancel()
+		go func() {
+			time.Sleep(200 * time.Millisecond)
+			_ = ioutil.WriteFile(serviceAccountTokenPath.Name(), []byte("rotated"), 0600)
+		}()
+		assert.NoError(t, v.Run(ctx))
+		assert.Equal(t, 2, writer.calls)
+	})
+}
+
+type fakeTokenWriter struct {
+	token string
+	calls int
+}
+
+func (f *fakeTokenWriter) Write(path string, data map[string]interface{}) (*api.Secret, error) {
+	f.calls++
+	return &api.Secret{
+		Auth: &api.SecretAuth{
+			ClientToken: f.token,
+		},
+	}, nil
+}
+
+func TestTokenRequest(t *testing.T) {
+	// header and claims of a projected service account token
+	saToken := "eyJhbGciOiJSUzI1NiJ9.eyJrdWJlcm5ldGVzLmlvIjp7InNlcnZpY2VhY2NvdW50Ijp7Im5hbWUiOiJteS1zYSJ9fX0.c2ln"
+	var got *authenticationv1.TokenRequest
+	clientset := fake.NewSimpleClientset()
+	clientset.PrependReactor("create", "serviceaccounts", func(action k8stesting.Action) (bool, runtime.Object, error) {
+		create := action.(k8stesting.CreateAction)
+		assert.Equal(t, "token", create.GetSubresource())
+		assert.Equal(t, "my-ns", create.GetNamespace())
+		got = create.GetObject().(*authenticationv1.TokenRequest)
+		return true, &authenticationv1.TokenRequest{Status: authenticationv1.TokenRequestStatus{Token: "audience-bound"}}, nil
+	})
+
+	t.Run("request token", func(t *testing.T) {
+		tr := &TokenRequest{
+			Audiences:         []string{"vault"},
+			ExpirationSeconds: 600,
+			Namespace:         "my-ns",
+			clientset:         clientset,
+		}
+		token, err := tr.requestToken(context.Background(), saToken)
+		require.NoError(t, err)
+		assert.Equal(t, "audience-bound", token)
+		require.NotNil(t, got)
+		assert.Equal(t, []string{"vault"}, got.Spec.Audiences)
+		require.NotNil(t, got.Spec.ExpirationSeconds)
+		assert.Equal(t, int64(600), *got.Spec.ExpirationSeconds)
+	})
+
+	t.Run("invalid service account token", func(t *testing.T) {
+		tr := &TokenRequest{Namespace: "my-ns", clientset: clientset}
+		_, err := tr.requestToken(context.Background(), "invalid")
+		assert.Error(t, err)
+	})
+
+	t.Run("from environment", func(t *testing.T) {
+		os.Setenv("SERVICE_ACCOUNT_TOKEN_AUDIENCES", "vault,other")
+		defer os.Setenv("SERVICE_ACCOUNT_TOKEN_AUDIENCES", "")
+		os.Setenv("SERVICE_ACCOUNT_TOKEN_EXPIRATION", "10m")
+		defer os.Setenv("SERVICE_ACCOUNT_TOKEN_EXPIRATION", "")
+		os.Setenv("VAULT_TOKEN_PATH", "/tmp/vault-token")
+		v, err := NewFromEnvironment()
+		require.NoError(t, err)
+		require.NotNil(t, v.TokenRequest)
+		assert.Equal(t, []string{"vault", "other"}, v.TokenRequest.Audiences)
+		assert.Equal(t, int64(600), v.TokenRequest.ExpirationSeconds)
+	})
+}
+
+func TestNew(t *testing.T) {
+	t.Run("without token path", func(t *testing.T) {
+		v, err := New(WithRole("role"))
+		assert.Error(t, err)
+		assert.Nil(t, v)
+	})
+
+	t.Run("with options", func(t *testing.T) {
+		c, err := api.NewClient(api.DefaultConfig())
+		require.NoError(t, err)
+		v, err := New(
+			WithRole("role"),
+			WithTokenPath("/tmp/vault-token"),
+			WithAuthMountPath("k8s-cluster"),
+			WithClient(c),
+			WithTTL(time.Hour),
+			WithReAuth(true),
+		)
+		require.NoError(t, err)
+		assert.Equal(t, "role", v.Role)
+		assert.Equal(t, "/tmp/vault-token", v.TokenPath)
+		assert.Equal(t, "auth/k8s-cluster", v.AuthMountPath)
+		assert.Equal(t, ServiceAccountTokenPath, v.ServiceAccountTokenPath)
+		assert.Equal(t, 3600, v.TTL)
+		assert.True(t, v.ReAuth)
+		assert.Equal(t, c, v.Client())
+	})
+
+	t.Run("invalid option", func(t *testing.T) {
+		v, err := New(WithTokenPath("/tmp/vault-token"), WithTTL(-time.Second))
+		assert.Error(t, err)
+		assert.Nil(t, v)
+	})
+}
+
+func TestConfig(t *testing.T) {
+	t.Run("aggregated validation errors", func(t *testing.T) {
+		err := Config{
+			TTL:                           -time.Second,
+			ServiceAccountTokenExpiration: time.Minute,
+		}.Validate()
+		require.Error(t, err)
+		verr, ok := err.(*ValidationError)
+		require.True(t, ok)
+		assert.Len(t, verr.Errors, 4)
+	})
+
+	t.Run("new from config", func(t *testing.T) {
+		v, err := NewFromConfig(Config{
+			Role:                         "role",
+			TokenPath:                    "/tmp/vault-token",
+			AuthMountPath:                "k8s-cluster",
+			ServiceAccountTokenAudiences: []string{"vault"},
+		})
+		require.NoError(t, err)
+		assert.Equal(t, "role", v.Role)
+		assert.Equal(t, "auth/k8s-cluster", v.AuthMountPath)
+		assert.Equal(t, ServiceAccountTokenPath, v.ServiceAccountTokenPath)
+		require.NotNil(t, v.TokenRequest)
+		assert.Equal(t, []string{"vault"}, v.TokenRequest.Audiences)
+	})
+
+	t.Run("options override config", func(t *testing.T) {
+		r := &TokenRequest{Audiences: []string{"other"}}
+		v, err := NewFromConfig(Config{
+			TokenPath:                        "/tmp/vault-token",
+			ServiceAccountTokenAudiences:     []string{"vault"},
+			ServiceAccountTokenWatchInterval: time.Minute,
+		}, WithTokenRequest(r), WithServiceAccountTokenWatchInterval(time.Second))
+		require.NoError(t, err)
+		assert.Equal(t, r, v.TokenRequest)
+		assert.Equal(t, time.Second, v.ServiceAccountTokenWatchInterval)
+		v, err = NewFromConfig(Config{TokenPath: "/tmp/vault-token"}, WithTokenRequest(r))
+		require.NoError(t, err)
+		assert.Equal(t, r, v.TokenRequest)
+		_, err = New(WithTokenPath("/tmp/vault-token"), WithTokenRequest(nil))
+		assert.Error(t, err)
+	})
+
+	t.Run("namespace", func(t *testing.T) {
+		cfg := Config{
+			TokenPath:     "/tmp/vault-token",
+			Namespace:     "team/a/",
+			AuthMountPath: "team/a/auth/kubernetes",
+		}
+		assert.Error(t, cfg.Validate())
+		cfg.AuthMountPath = "auth/kubernetes"
+		v, err := NewFromConfig(cfg)
+		require.NoError(t, err)
+		assert.Equal(t, "team/a", v.Namespace)
+		assert.Equal(t, "auth/kubernetes", v.AuthMountPath)
+	})
+
+	t.Run("new with client", func(t *testing.T) {
+		c, err := api.NewClient(api.DefaultConfig())
+		require.NoError(t, err)
+		v, err := NewWithClient(c, Config{
+			Role:      "role",
+			TokenPath: "/tmp/vault-token",
+		})
+		require.NoError(t, err)
+		assert.Equal(t, c, v.Client())
+		assert.Equal(t, "role", v.Role)
+
+		_, err = NewWithClient(nil, Config{TokenPath: "/tmp/vault-token"})
+		assert.Error(t, err)
+		_, err = NewWithClient(c, Config{})
+		assert.Error(t, err)
+	})
+}
+
+type recordingWriter struct {
+	path string
+	data map[string]interface{}
+}
+
+func (f *recordingWriter) Write(path string, data map[string]interface{}) (*api.Secret, error) {
+	f.path, f.data = path, data
+	return &api.Secret{
+		Auth: &api.SecretAuth{
+			ClientToken: rootToken,
+		},
+	}, nil
+}
+
+func TestAppRole(t *testing.T) {
+	secretIDPath, err := ioutil.TempFile("", "secret-id")
+	require.NoError(t, err)
+	defer os.Remove(secretIDPath.Name())
+	require.NoError(t, ioutil.WriteFile(secretIDPath.Name(), []byte("wrapping-token\n"), 0600))
+	writer := &recordingWriter{}
+	vaultLogicalBackup := vaultLogical
+	vaultLogical = func(ctx context.Context, c *api.Client) vaultLogicalWriter {
+		return writer
+	}
+	defer func() { vaultLogical = vaultLogicalBackup }()
+	unwraps := 0
+	vaultUnwrapBackup := vaultUnwrap
+	vaultUnwrap = func(c *api.Client, token string) (*api.Secret, error) {
+		unwraps++
+		assert.Equal(t, "wrapping-token", token)
+		return &api.Secret{Data: map[string]interface{}{"secret_id": "secret"}}, nil
+	}
+	defer func() { vaultUnwrap = vaultUnwrapBackup }()
+
+	t.Run("missing role id", func(t *testing.T) {
+		os.Setenv("VAULT_TOKEN_PATH", "/tmp/vault-token")
+		os.Setenv("VAULT_AUTH_METHOD", "approle")
+		defer os.Setenv("VAULT_AUTH_METHOD", "")
+		v, err := NewFromEnvironment()
+		assert.Error(t, err)
+		assert.Nil(t, v)
+	})
+
+	t.Run("login with wrapped secret id", func(t *testing.T) {
+		os.Setenv("VAULT_TOKEN_PATH", "/tmp/vault-token")
+		os.Setenv("VAULT_AUTH_METHOD", "approle")
+		defer os.Setenv("VAULT_AUTH_METHOD", "")
+		os.Setenv("VAULT_APPROLE_ROLE_ID", "role")
+		defer os.Setenv("VAULT_APPROLE_ROLE_ID", "")
+		os.Setenv("VAULT_APPROLE_SECRET_ID_PATH", secretIDPath.Name())
+		defer os.Setenv("VAULT_APPROLE_SECRET_ID_PATH", "")
+		os.Setenv("VAULT_APPROLE_SECRET_ID_WRAPPED", "true")
+		defer os.Setenv("VAULT_APPROLE_SECRET_ID_WRAPPED", "")
+		v, err := NewFromEnvironment()
+		require.NoError(t, err)
+		assert.Equal(t, "auth/approle", v.AuthMountPath)
+		for i := 0; i < 2; i++ {
+			token, err := v.Authenticate()
+			require.NoError(t, err)
+			assert.Equal(t, rootToken, token)
+		}
+		assert.Equal(t, "auth/approle/login", writer.path)
+		assert.Equal(t, map[string]interface{}{"role_id": "role", "secret_id": "secret"}, writer.data)
+		assert.Equal(t, 1, unwraps)
+	})
+}
+
+func TestAWS(t *testing.T) {
+	t.Run("signature version 4", func(t *testing.T) {
+		// example of the AWS documentation
+		req, err := http.NewRequest(http.MethodGet, "https://iam.amazonaws.com/?Action=ListUsers&Version=2010-05-08", nil)
+		require.NoError(t, err)
+		req.Header.Set("Content-Type", "application/x-www-form-urlencoded; charset=utf-8")
+		signV4(req, nil, awsCredentials{
+			AccessKeyID:     "AKIDEXAMPLE",
+			SecretAccessKey: "wJalrXUtnFEMI/K7MDENG+bPxRfiCYEXAMPLEKEY",
+		}, "us-east-1", "iam", time.Date(2015, 8, 30, 12, 36, 0, 0, time.UTC))
+		assert.Equal(t, "AWS4-HMAC-SHA256 Credential=AKIDEXAMPLE/20150830/us-east-1/iam/aws4_request, "+
+			"SignedHeaders=content-type;host;x-amz-date, "+
+			"Signature=5d672d79c15b13162d9279b0855cfba6789a8edb4c82c400e06b5924a6f2b5d7", req.Header.Get("Authorization"))
+	})
+
+	t.Run("login with instance profile", func(t *testing.T) {
+		srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+			switch r.URL.Path {
+			case "/latest/api/token":
+				fmt.Fprint(w, "imds-token")
+			case "/latest/meta-data/iam/security-credentials/":
+				assert.Equal(t, "imds-token", r.Header.Get("X-aws-ec2-metadata-token"))
+				fmt.Fprint(w, "my-profile")
+			case "/latest/meta-data/iam/security-credentials/my-profile":
+				fmt.Fprint(w, `{"AccessKeyId":"id","SecretAccessKey":"secret","Token":"session"}`)
+			default:
+				w.WriteHeader(http.StatusNotFound)
+			}
+		}))
+		defer srv.Close()
+		writer := &recordingWriter{}
+		vaultLogicalBackup := vaultLogical
+		vaultLogical = func(ctx context.Context, c *api.Client) vaultLogicalWriter {
+			return writer
+		}
+		defer func() { vaultLogical = vaultLogicalBackup }()
+		v, err := New(WithTokenPath("/tmp/vault-token"), WithRole("ec2"), WithAWS(&AWS{
+			ServerIDHeader:   "vault.example.com",
+			metadataEndpoint: srv.URL,
+			client:           srv.Client(),
+		}))
+		require.NoError(t, err)
+		token, err := v.Authenticate()
+		require.NoError(t, err)
+		assert.Equal(t, rootToken, token)
+		assert.Equal(t, "auth/aws/login", writer.path)
+		assert.Equal(t, "ec2", writer.data["role"])
+		b, err := base64.StdEncoding.DecodeString(writer.data["iam_request_headers"].(string))
+		require.NoError(t, err)
+		headers := http.Header{}
+		require.NoError(t, json.Unmarshal(b, &headers))
+		assert.Equal(t, "session", headers.Get("X-Amz-Security-Token"))
+		assert.Equal(t, "vault.example.com", headers.Get("X-Vault-AWS-IAM-Server-ID"))
+		assert.Contains(t, headers.Get("Authorization"), "Credential=id/")
+	})
+}
+
+func TestGCP(t *testing.T) {
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		assert.Equal(t, "Google", r.Header.Get("Metadata-Flavor"))
+		assert.Equal(t, "/computeMetadata/v1/instance/service-accounts/default/identity", r.URL.Path)
+		assert.Equal(t, "http://vault/gke", r.URL.Query().Get("audience"))
+		assert.Equal(t, "full", r.URL.Query().Get("format"))
+		fmt.Fprint(w, "identity-jwt")
+	}))
+	defer srv.Close()
+	writer := &recordingWriter{}
+	vaultLogicalBackup := vaultLogical
+	vaultLogical = func(ctx context.Context, c *api.Client) vaultLogicalWriter {
+		return writer
+	}
+	defer func() { vaultLogical = vaultLogicalBackup }()
+	v, err := New(WithTokenPath("/tmp/vault-token"), WithRole("gke"), WithGCP(&GCP{
+		metadataEndpoint: srv.URL,
+		client:           srv.Client(),
+	}))
+	require.NoError(t, err)
+	token, err := v.Authenticate()
+	require.NoError(t, err)
+	assert.Equal(t, rootToken, token)
+	assert.Equal(t, "auth/gcp/login", writer.path)
+	assert.Equal(t, map[string]interface{}{"role": "gke", "jwt": "identity-jwt"}, writer.data)
+}
+
+func TestAzure(t *testing.T) {
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		assert.Equal(t, "true", r.Header.Get("Metadata"))
+		switch r.URL.Path {
+		case "/metadata/identity/oauth2/token":
+			assert.Equal(t, azureDefaultResource, r.URL.Query().Get("resource"))
+			fmt.Fprint(w, `{"access_token":"msi-token"}`)
+		case "/metadata/instance":
+			fmt.Fprint(w, `{"compute":{"subscriptionId":"sub","resourceGroupName":"rg","name":"node-1","vmScaleSetName":"aks-pool"}}`)
+		default:
+			w.WriteHeader(http.StatusNotFound)
+		}
+	}))
+	defer srv.Close()
+	writer := &recordingWriter{}
+	vaultLogicalBackup := vaultLogical
+	vaultLogical = func(ctx context.Context, c *api.Client) vaultLogicalWriter {
+		return writer
+	}
+	defer func() { vaultLogical = vaultLogicalBackup }()
+	v, err := New(WithTokenPath("/tmp/vault-token"), WithRole("aks"), WithAzure(&Azure{
+		metadataEndpoint: srv.URL,
+		client:           srv.Client(),
+	}))
+	require.NoError(t, err)
+	token, err := v.Authenticate()
+	require.NoError(t, err)
+	assert.Equal(t, rootToken, token)
+	assert.Equal(t, "auth/azure/login", writer.path)
+	assert.Equal(t, map[string]interface{}{
+		"role":                "aks",
+		"jwt":                 "msi-token",
+		"subscription_id":     "sub",
+		"resource_group_name": "rg",
+		"vm_name":             "",
+		"vmss_name":           "aks-pool",
+	}, writer.data)
+
+	t.Run("configured fields are kept", func(t *testing.T) {
+		v, err := New(WithTokenPath("/tmp/vault-token"), WithRole("aks"), WithAzure(&Azure{
+			ResourceGroupName: "node-rg",
+			VMName:            "vm-1",
+			metadataEndpoint:  srv.URL,
+			client:            srv.Client(),
+		}))
+		require.NoError(t, err)
+		_, err = v.Authenticate()
+		require.NoError(t, err)
+		assert.Equal(t, map[string]interface{}{
+			"role":                "aks",
+			"jwt":                 "msi-token",
+			"subscription_id":     "sub",
+			"resource_group_name": "node-rg",
+			"vm_name":             "vm-1",
+			"vmss_name":           "",
+		}, writer.data)
+	})
+}
+
+func TestJWT(t *testing.T) {
+	writer := &recordingWriter{}
+	vaultLogicalBackup := vaultLogical
+	vaultLogical = func(ctx context.Context, c *api.Client) vaultLogicalWriter {
+		return writer
+	}
+	defer func() { vaultLogical = vaultLogicalBackup }()
+
+	t.Run("invalid sources", func(t *testing.T) {
+		_, err := New(WithTokenPath("/tmp/vault-token"), WithJWT(&JWT{Path: "/tmp/jwt", Env: "CI_JOB_JWT"}))
+		assert.Error(t, err)
+	})
+
+	t.Run("jwt from environment variable", func(t *testing.T) {
+		os.Setenv("VAULT_TOKEN_PATH", "/tmp/vault-token")
+		os.Setenv("VAULT_AUTH_METHOD", "jwt")
+		defer os.Setenv("VAULT_AUTH_METHOD", "")
+		os.Setenv("VAULT_JWT_ENV", "CI_JOB_JWT")
+		defer os.Setenv("VAULT_JWT_ENV", "")
+		os.Setenv("CI_JOB_JWT", "ci-jwt")
+		defer os.Setenv("CI_JOB_JWT", "")
+		os.Setenv("VAULT_ROLE", "ci")
+		defer os.Setenv("VAULT_ROLE", "")
+		v, err := NewFromEnvironment()
+		require.NoError(t, err)
+		token, err := v.Authenticate()
+		require.NoError(t, err)
+		assert.Equal(t, rootToken, token)
+		assert.Equal(t, "auth/jwt/login", writer.path)
+		assert.Equal(t, map[string]interface{}{"role": "ci", "jwt": "ci-jwt"}, writer.data)
+	})
+
+	t.Run("jwt from callback", func(t *testing.T) {
+		v, err := New(WithTokenPath("/tmp/vault-token"), WithRole("spiffe"), WithAuthMountPath("spiffe"), WithJWT(&JWT{
+			Func: func() (string, error) { return "svid", nil },
+		}))
+		require.NoError(t, err)
+		_, err = v.Authenticate()
+		require.NoError(t, err)
+		assert.Equal(t, "auth/spiffe/login", writer.path)
+		assert.Equal(t, "svid", writer.data["jwt"])
+	})
+}
+
+// writeKeyPair writes a self-signed client certificate and its key to dir
+func writeKeyPair(t *testing.T, dir string) (string, string) {
+	key, err := ecdsa.GenerateKey(elliptic.P256(), rand.Reader)
+	require.NoError(t, err)
+	tmpl := &x509.Certificate{
+		SerialNumber: big.NewInt(1),
+		Subject:      pkix.Name{CommonName: "client"},
+		NotBefore:    time.Now(),
+		NotAfter:     time.Now().Add(time.Hour),
+		ExtKeyUsage:  []x509.ExtKeyUsage{x509.ExtKeyUsageClientAuth},
+	}
+	der, err := x509.CreateCertificate(rand.Reader, tmpl, tmpl, &key.PublicKey, key)
+	require.NoError(t, err)
+	keyDER, err := x509.MarshalECPrivateKey(key)
+	require.NoError(t, err)
+	certPath, keyPath := filepath.Join(dir, "client-cert"), filepath.Join(dir, "client-key")
+	require.NoError(t, ioutil.WriteFile(certPath, pem.EncodeToMemory(&pem.Block{Type: "CERTIFICATE", Bytes: der}), 0600))
+	require.NoError(t, ioutil.WriteFile(keyPath, pem.EncodeToMemory(&pem.Block{Type: "EC PRIVATE KEY", Bytes: keyDER}), 0600))
+	return certPath, keyPath
+}
+
+func TestCert(t *testing.T) {
+	dir, err := ioutil.TempDir("", "client-cert")
+	require.NoError(t, err)
+	defer os.RemoveAll(dir)
+	certPath, keyPath := writeKeyPair(t, dir)
+
+	t.Run("missing key", func(t *testing.T) {
+		_, err := New(WithTokenPath("/tmp/vault-token"), WithCert(&Cert{CertPath: certPath}))
+		assert.Error(t, err)
+	})
+
+	t.Run("certificate change", func(t *testing.T) {
+		os.Setenv("VAULT_TOKEN_PATH", "/tmp/vault-token")
+		os.Setenv("VAULT_AUTH_METHOD", "cert")
+		defer os.Setenv("VAULT_AUTH_METHOD", "")
+		os.Setenv("VAULT_CLIENT_CERT", certPath)
+		defer os.Setenv("VAULT_CLIENT_CERT", "")
+		os.Setenv("VAULT_CLIENT_KEY", keyPath)
+		defer os.Setenv("VAULT_CLIENT_KEY", "")
+		os.Setenv("VAULT_CLIENT_CERT_WATCH_INTERVAL", "1m")
+		defer os.Setenv("VAULT_CLIENT_CERT_WATCH_INTERVAL", "")
+		v, err := NewFromEnvironment()
+		require.NoError(t, err)
+		assert.Equal(t, "auth/cert", v.AuthMountPath)
+		assert.Equal(t, time.Minute, v.watchInterval())
+		sum, err := v.credentialHash()
+		require.NoError(t, err)
+		v.setCredentialSum(sum)
+		assert.False(t, v.credentialChanged())
+		require.NoError(t, ioutil.WriteFile(certPath, []byte("renewed"), 0600))
+		assert.True(t, v.credentialChanged())
+	})
+}
+
+func TestAuthenticator(t *testing.T) {
+	failing := AuthenticatorFunc(func(ctx context.Context, c *api.Client) (*api.Secret, error) {
+		return nil, errors.New("failed")
+	})
+	succeeding := AuthenticatorFunc(func(ctx context.Context, c *api.Client) (*api.Secret, error) {
+		return &api.Secret{Auth: &api.SecretAuth{ClientToken: "custom"}}, nil
+	})
+
+	t.Run("chained authenticators", func(t *testing.T) {
+		v, err := New(WithTokenPath("/tmp/vault-token"), WithAuthenticator(Chain(failing, succeeding)))
+		require.NoError(t, err)
+		token, err := v.Authenticate()
+		require.NoError(t, err)
+		assert.Equal(t, "custom", token)
+	})
+
+	t.Run("kubernetes authenticator with fallback", func(t *testing.T) {
+		writer := &recordingWriter{}
+		defer func(f func(context.Context, *api.Client) vaultLogicalWriter) { vaultLogical = f }(vaultLogical)
+		vaultLogical = func(ctx context.Context, c *api.Client) vaultLogicalWriter {
+			return writer
+		}
+		v, err := New(WithTokenPath("/tmp/vault-token"), WithRole("app"), WithServiceAccountTokenPath("/not/existing/token"))
+		require.NoError(t, err)
+		v.Authenticator = Chain(v.KubernetesAuthenticator(), succeeding)
+		token, err := v.Authenticate()
+		require.NoError(t, err)
+		assert.Equal(t, "custom", token)
+
+		saToken, err := ioutil.TempFile("", "sa-token")
+		require.NoError(t, err)
+		defer os.Remove(saToken.Name())
+		require.NoError(t, ioutil.WriteFile(saToken.Name(), []byte("jwt"), 0600))
+		v.ServiceAccountTokenPath = saToken.Name()
+		token, err = v.Authenticate()
+		require.NoError(t, err)
+		assert.Equal(t, rootToken, token)
+		assert.Equal(t, "auth/kubernetes/login", writer.path)
+		assert.Equal(t, map[string]interface{}{"role": "app", "jwt": "jwt"}, writer.data)
+	})
+
+	t.Run("all authenticators fail", func(t *testing.T) {
+		v, err := New(WithTokenPath("/tmp/vault-token"), WithAuthenticator(Chain(failing, failing)))
+		require.NoError(t, err)
+		token, err := v.Authenticate()
+		assert.Error(t, err)
+		assert.Equal(t, "", token)
+	})
+}
+
+func TestTokenStore(t *testing.T) {
+	t.Run("missing token file", func(t *testing.T) {
+		v, err := New(WithTokenPath("/not/existing/path"))
+		require.NoError(t, err)
+		_, err = v.GetToken()
+		require.Error(t, err)
+		assert.Contains(t, err.Error(), "failed to load token from /not/existing/path")
+	})
+
+	t.Run("memory store", func(t *testing.T) {
+		v, err := New(WithTokenStore(&MemoryStore{}))
+		require.NoError(t, err)
+		_, err = v.LoadToken()
+		assert.Error(t, err)
+		require.NoError(t, v.StoreToken("token"))
+		token, err := v.LoadToken()
+		require.NoError(t, err)
+		assert.Equal(t, "token", token)
+	})
+
+	t.Run("environment store", func(t *testing.T) {
+		defer os.Unsetenv("TEST_VAULT_TOKEN")
+		s := EnvStore("TEST_VAULT_TOKEN")
+		require.NoError(t, s.Store("token"))
+		assert.Equal(t, "token", os.Getenv("TEST_VAULT_TOKEN"))
+		token, err := s.Load()
+		require.NoError(t, err)
+		assert.Equal(t, "token", token)
+	})
+}
+
+func TestSecretStore(t *testing.T) {
+	clientset := fake.NewSimpleClientset()
+	s := &SecretStore{
+		Name:            "vault-token",
+		Namespace:       "my-ns",
+		OwnerReferences: []metav1.OwnerReference{{APIVersion: "batch/v1", Kind: "CronJob", Name: "job", UID: "uid"}},
+		clientset:       clientset,
+	}
+	_, err := s.Load()
+	assert.Error(t, err)
+	require.NoError(t, s.Store("first"))
+	stored, err := clientset.CoreV1().Secrets("my-ns").Get(context.Background(), "vault-token", metav1.GetOptions{})
+	require.NoError(t, err)
+	assert.Equal(t, "CronJob", stored.OwnerReferences[0].Kind)
+	require.NoError(t, s.Store("second"))
+	token, err := s.Load()
+	require.NoError(t, err)
+	assert.Equal(t, "second", token)
+}
+
+func TestWrappedLogin(t *testing.T) {
+	login := AuthenticatorFunc(func(ctx context.Context, c *api.Client) (*api.Secret, error) {
+		assert.Equal(t, "60s", c.NewRequest(http.MethodPut, "/v1/auth/approle/login").WrapTTL)
+		assert.Equal(t, "60s", c.NewRequest(http.MethodPut, "/v1/auth/userpass/login/user").WrapTTL)
+		assert.Equal(t, "", c.NewRequest(http.MethodPut, "/v1/sys/wrapping/unwrap").WrapTTL)
+		return &api.Secret{WrapInfo: &api.SecretWrapInfo{Token: "wrapping-token"}}, nil
+	})
+	vaultUnwrapBackup := vaultUnwrap
+	vaultUnwrap = func(c *api.Client, token string) (*api.Secret, error) {
+		assert.Equal(t, "wrapping-token", token)
+		return &api.Secret{Auth: &api.SecretAuth{ClientToken: "client-token"}}, nil
+	}
+	defer func() { vaultUnwrap = vaultUnwrapBackup }()
+	v, err := New(WithTokenStore(&MemoryStore{}), WithWrapTTL(time.Minute), WithAuthenticator(login))
+	require.NoError(t, err)
+	token, err := v.GetToken()
+	require.NoError(t, err)
+	assert.Equal(t, "wrapping-token", token)
+	require.NoError(t, v.StoreToken(token))
+	token, err = v.LoadWrappedToken()
+	require.NoError(t, err)
+	assert.Equal(t, "client-token", token)
+	assert.Error(t, v.Run(context.Background()))
+}
+
+func TestContext(t *testing.T) {
+	type key struct{}
+	ctx, cancel := context.WithCancel(context.WithValue(context.Background(), key{}, "value"))
+	login := AuthenticatorFunc(func(ctx context.Context, c *api.Client) (*api.Secret, error) {
+		assert.Equal(t, "value", ctx.Value(key{}))
+		if err := ctx.Err(); err != nil {
+			return nil, err
+		}
+		return &api.Secret{Auth: &api.SecretAuth{ClientToken: "token"}}, nil
+	})
+	v, err := New(WithTokenStore(&MemoryStore{}), WithReAuth(true), WithAuthenticator(login))
+	require.NoError(t, err)
+	token, err := v.GetTokenWithContext(ctx)
+	require.NoError(t, err)
+	assert.Equal(t, "token", token)
+	cancel()
+	_, err = v.AuthenticateWithContext(ctx)
+	assert.Equal(t, context.Canceled, err)
+
+	t.Run("canceled metadata request", func(t *testing.T) {
+		srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+			fmt.Fprint(w, "identity-jwt")
+		}))
+		defer srv.Close()
+		g := &GCP{metadataEndpoint: srv.URL, client: srv.Client()}
+		_, err := g.loginData(ctx, "role")
+		assert.Error(t, err)
+	})
+}
+
+type recordingLogger struct {
+	events []string
+}
+
+func (l *recordingLogger) Debug(msg string, keysAndValues ...interface{}) {
+	l.events = append(l.events, msg)
+}
+
+func (l *recordingLogger) Info(msg string, keysAndValues ...interface{}) {
+	l.events = append(l.events, fmt.Sprint(append([]interface{}{msg}, keysAndValues...)...))
+}
+
+func TestLogger(t *testing.T) {
+	login := AuthenticatorFunc(func(ctx context.Context, c *api.Client) (*api.Secret, error) {
+		return &api.Secret{Auth: &api.SecretAuth{ClientToken: "token", LeaseDuration: 60}}, nil
+	})
+	l := &recordingLogger{}
+	v, err := New(WithTokenStore(&MemoryStore{}), WithReAuth(true), WithAuthenticator(login), WithLogger(l))
+	require.NoError(t, err)
+	_, err = v.GetToken()
+	require.NoError(t, err)
+	require.Len(t, l.events, 3)
+	assert.Equal(t, "no stored token", l.events[0])
+	assert.Contains(t, l.events[1], "login")
+	assert.Contains(t, l.events[1], "custom")
+	assert.Contains(t, l.events[2], "login succeeded")
+	assert.Contains(t, l.events[2], "1m0s")
+}
+
+func TestMetrics(t *testing.T) {
+	fail := true
+	login := AuthenticatorFunc(func(ctx context.Context, c *api.Client) (*api.Secret, error) {
+		if fail {
+			return nil, errors.New("Code: 403. Errors: permission denied")
+		}
+		return &api.Secret{Auth: &api.SecretAuth{ClientToken: "token", LeaseDuration: 3600}}, nil
+	})
+	m := &Metrics{}
+	v, err := New(WithTokenStore(&MemoryStore{}), WithAuthenticator(login), WithMetrics(m))
+	require.NoError(t, err)
+	_, err = v.Authenticate()
+	assert.Error(t, err)
+	fail = false
+	_, err = v.Authenticate()
+	require.NoError(t, err)
+	rec := httptest.NewRecorder()
+	m.ServeHTTP(rec, httptest.NewRequest(http.MethodGet, "/metrics", nil))
+	body := rec.Body.String()
+	assert.Contains(t, body, "vault_k8s_login_attempts_total 2\n")
+	assert.Contains(t, body, "vault_k8s_login_failures_total{reason=\"permission_denied\"} 1\n")
+	assert.Contains(t, body, "vault_k8s_token_ttl_seconds 3")
+	assert.NotContains(t, body, "vault_k8s_last_login_success_timestamp_seconds 0.000")
+
+	t.Run("failure reasons", func(t *testing.T) {
+		assert.Equal(t, reasonPermissionDenied, failureReason(errors.New("Code: 403. Errors: permission denied")))
+		assert.Equal(t, reasonBadRequest, failureReason(errors.New(`Code: 400. Errors: * invalid role name "app"`)))
+		assert.Equal(t, reasonBadRequest, failureReason(errors.Wrap(&api.ResponseError{StatusCode: http.StatusBadRequest}, "login failed")))
+		assert.Equal(t, reasonServerError, failureReason(&api.ResponseError{StatusCode: http.StatusServiceUnavailable}))
+	})
+}
+
+func TestHealthy(t *testing.T) {
+	ttl := 3600
+	login := AuthenticatorFunc(func(ctx context.Context, c *api.Client) (*api.Secret, error) {
+		return &api.Secret{Auth: &api.SecretAuth{ClientToken: "token", LeaseDuration: ttl}}, nil
+	})
+	v, err := New(WithTokenStore(&MemoryStore{}), WithAuthenticator(login))
+	require.NoError(t, err)
+	h := v.HealthHandler()
+	t.Run("no token", func(t *testing.T) {
+		assert.Error(t, v.Healthy())
+		rec := httptest.NewRecorder()
+		h.ServeHTTP(rec, httptest.NewRequest(http.MethodGet, "/healthz", nil))
+		assert.Equal(t, http.StatusServiceUnavailable, rec.Code)
+	})
+	t.Run("valid token", func(t *testing.T) {
+		_, err := v.Authenticate()
+		require.NoError(t, err)
+		assert.NoError(t, v.Healthy())
+		rec := httptest.NewRecorder()
+		h.ServeHTTP(rec, httptest.NewRequest(http.MethodGet, "/healthz", nil))
+		assert.Equal(t, http.StatusOK, rec.Code)
+	})
+	t.Run("non-expiring token", func(t *testing.T) {
+		ttl = 0
+		_, err := v.Authenticate()
+		require.NoError(t, err)
+		assert.NoError(t, v.Healthy())
+	})
+	t.Run("expired token", func(t *testing.T) {
+		v.tokenHeld(time.Nanosecond)
+		time.Sleep(time.Millisecond)
+		assert.Error(t, v.Healthy())
+	})
+}
+
+func TestRetry(t *testing.T) {
+	t.Run("transient errors", func(t *testing.T) {
+		calls := 0
+		login := AuthenticatorFunc(func(ctx context.Context, c *api.Client) (*api.Secret, error) {
+			calls++
+			if calls < 3 {
+				return nil, errors.New("Code: 503. Errors: Vault is sealed")
+			}
+			return &api.Secret{Auth: &api.SecretAuth{ClientToken: "token"}}, nil
+		})
+		v, err := New(WithTokenStore(&MemoryStore{}), WithAuthenticator(login), WithRetry(&Retry{MaxAttempts: 3, Base: time.Millisecond, Jitter: 0.5}))
+		require.NoError(t, err)
+		token, err := v.Authenticate()
+		require.NoError(t, err)
+		assert.Equal(t, "token", token)
+		assert.Equal(t, 3, calls)
+	})
+	t.Run("max attempts", func(t *testing.T) {
+		calls := 0
+		login := AuthenticatorFunc(func(ctx context.Context, c *api.Client) (*api.Secret, error) {
+			calls++
+			return nil, errors.New("Code: 500. Errors: internal error")
+		})
+		v, err := New(WithTokenStore(&MemoryStore{}), WithAuthenticator(login), WithRetry(&Retry{MaxAttempts: 2, Base: time.Millisecond}))
+		require.NoError(t, err)
+		_, err = v.Authenticate()
+		assert.Error(t, err)
+		assert.Equal(t, 2, calls)
+	})
+	t.Run("permanent error", func(t *testing.T) {
+		calls := 0
+		login := AuthenticatorFunc(func(ctx context.Context, c *api.Client) (*api.Secret, error) {
+			calls++
+			return nil, errors.New("Code: 403. Errors: permission denied")
+		})
+		v, err := New(WithTokenStore(&MemoryStore{}), WithAuthenticator(login), WithRetry(&Retry{MaxAttempts: 5, Base: time.Millisecond}))
+		require.NoError(t, err)
+		_, err = v.Authenticate()
+		assert.Error(t, err)
+		assert.Equal(t, 1, calls)
+	})
+	t.Run("delay", func(t *testing.T) {
+		r := &Retry{Base: time.Second, Cap: 5 * time.Second}
+		assert.Equal(t, time.Second, r.delay(1))
+		assert.Equal(t, 2*time.Second, r.delay(2))
+		assert.Equal(t, 4*time.Second, r.delay(3))
+		assert.Equal(t, 5*time.Second, r.delay(4))
+		r.Jitter = 0.5
+		d := r.delay(2)
+		assert.True(t, d > time.Second && d <= 2*time.Second)
+	})
+	t.Run("invalid", func(t *testing.T) {
+		_, err := New(WithTokenPath("/tmp/token"), WithRetry(&Retry{MaxAttempts: 3, Jitter: 2}))
+		assert.Error(t, err)
+	})
+}
+
+func TestFailover(t *testing.T) {
+	defer func(f func(context.Context, *api.Client, string) (int, error)) { vaultHealth = f }(vaultHealth)
+	healthy := map[string]bool{"https://b:8200": false, "https://c:8200": true}
+	vaultHealth = func(ctx context.Context, c *api.Client, address string) (int, error) {
+		if !healthy[address] {
+			return http.StatusServiceUnavailable, nil
+		}
+		return http.StatusOK, nil
+	}
+	var v *Vault
+	login := AuthenticatorFunc(func(ctx context.Context, c *api.Client) (*api.Secret, error) {
+		if !healthy[v.Addresses[v.address]] {
+			return nil, &net.OpError{Op: "dial", Err: errors.New("connection refused")}
+		}
+		return &api.Secret{Auth: &api.SecretAuth{ClientToken: "token"}}, nil
+	})
+	var err error
+	v, err = New(WithTokenStore(&MemoryStore{}), WithAuthenticator(login), WithAddresses("https://a:8200", "https://b:8200", "https://c:8200"))
+	require.NoError(t, err)
+	token, err := v.Authenticate()
+	require.NoError(t, err)
+	assert.Equal(t, "token", token)
+	assert.Equal(t, 2, v.address)
+
+	t.Run("no healthy address", func(t *testing.T) {
+		healthy["https://c:8200"] = false
+		_, err := v.Authenticate()
+		assert.Error(t, err)
+		assert.Equal(t, 2, v.address)
+	})
+}
+
+func TestRegisterTokenCallback(t *testing.T) {
+	n := 0
+	login := AuthenticatorFunc(func(ctx context.Context, c *api.Client) (*api.Secret, error) {
+		n++
+		return &api.Secret{Auth: &api.SecretAuth{ClientToken: fmt.Sprintf("token-%d", n), Policies: []string{"default"}}}, nil
+	})
+	v, err := New(WithTokenStore(&MemoryStore{}), WithAuthenticator(login))
+	require.NoError(t, err)
+	var tokens []string
+	v.RegisterTokenCallback(func(token string, auth *api.SecretAuth) {
+		require.NotNil(t, auth)
+		assert.Equal(t, []string{"default"}, auth.Policies)
+		tokens = append(tokens, token)
+	})
+	_, err = v.Authenticate()
+	require.NoError(t, err)
+	_, err = v.Authenticate()
+	require.NoError(t, err)
+	assert.Equal(t, []string{"token-1", "token-2"}, tokens)
+}
+
+func TestAuthInfo(t *testing.T) {
+	login := AuthenticatorFunc(func(ctx context.Context, c *api.Client) (*api.Secret, error) {
+		return &api.Secret{Auth: &api.SecretAuth{
+			ClientToken:   "token",
+			Accessor:      "accessor",
+			Policies:      []string{"default", "app"},
+			TokenPolicies: []string{"default"},
+			LeaseDuration: 60,
+			Renewable:     true,
+			EntityID:      "entity",
+		}}, nil
+	})
+	v, err := New(WithTokenStore(&MemoryStore{}), WithAuthenticator(login))
+	require.NoError(t, err)
+	assert.Nil(t, v.LastAuth())
+	info, err := v.AuthenticateFull(context.Background())
+	require.NoError(t, err)
+	assert.Equal(t, &AuthInfo{
+		Token:         "token",
+		Accessor:      "accessor",
+		Policies:      []string{"default", "app"},
+		TokenPolicies: []string{"default"},
+		LeaseDuration: time.Minute,
+		Renewable:     true,
+		EntityID:      "entity",
+	}, info)
+	assert.Equal(t, info, v.LastAuth())
+}
+
+func TestWatcher(t *testing.T) {
+	v, err := New(WithTokenStore(&MemoryStore{}), WithWrapTTL(time.Minute))
+	require.NoError(t, err)
+	w := v.NewWatcher()
+	for i := 0; i < eventBuffer+1; i++ {
+		w.emit(Event{Type: EventRenewed, TTL: time.Duration(i) * time.Second})
+	}
+	assert.Error(t, w.Run(context.Background()))
+	var events []Event
+	for e := range w.Events() {
+		events = append(events, e)
+	}
+	// the oldest event is dropped for the one exceeding the buffer
+	require.Len(t, events, eventBuffer)
+	assert.Equal(t, Event{Type: EventRenewed, TTL: time.Second}, events[0])
+	assert.Equal(t, Event{Type: EventRenewed, TTL: eventBuffer * time.Second}, events[eventBuffer-1])
+	var nilWatcher *Watcher
+	nilWatcher.emit(Event{Type: EventAuthenticated})
+}
+
+type kvLogical map[string]interface{}
+
+func (l kvLogical) ReadWithData(string, map[string][]string) (*api.Secret, error) {
+	return &api.Secret{Data: l}, nil
+}
+
+func (l kvLogical) List(string) (*api.Secret, error) {
+	return nil, nil
+}
+
+func (l kvLogical) Write(string, map[string]interface{}) (*api.Secret, error) {
+	return nil, nil
+}
+
+func (l kvLogical) Delete(string) (*api.Secret, error) {
+	return nil, nil
+}
+
+func TestFetcher(t *testing.T) {
+	dir, err := ioutil.TempDir("", "fetch")
+	require.NoError(t, err)
+	defer os.RemoveAll(dir)
+	v, err := New(WithTokenStore(&MemoryStore{}))
+	require.NoError(t, err)
+	secret := kvLogical{"user": "admin", "password": "secret"}
+	f := v.NewFetcher(
+		FetchSecret{Path: "secret/db", File: filepath.Join(dir, "db.json")},
+		FetchSecret{Path: "secret/db", File: filepath.Join(dir, "db.yaml"), Format: FetchFormatYAML},
+		FetchSecret{Path: "secret/db", File: filepath.Join(dir, "db.env"), Format: FetchFormatDotenv},
+		FetchSecret{Path: "secret/db", File: filepath.Join(dir, "password"), Format: FetchFormatRaw, Key: "password"},
+	)
+	f.Options = []kv.Option{
+		kv.WithDetector(func(*api.Client, string) (int, string, error) {
+			return 1, "secret/", nil
+		}),
+		kv.WithLogical(secret),
+	}
+	require.NoError(t, f.Fetch(context.Background()))
+	for name, expected := range map[string]string{
+		"db.json":  "{\n  \"password\": \"secret\",\n  \"user\": \"admin\"\n}\n",
+		"db.yaml":  "password: secret\nuser: admin\n",
+		"db.env":   "password=\"secret\"\nuser=\"admin\"\n",
+		"password": "secret",
+	} {
+		content, err := ioutil.ReadFile(filepath.Join(dir, name))
+		require.NoError(t, err)
+		assert.Equal(t, expected, string(content), name)
+	}
+
+	t.Run("unchanged file", func(t *testing.T) {
+		changed, err := writeFileIfChanged(filepath.Join(dir, "password"), []byte("secret"))
+		require.NoError(t, err)
+		assert.False(t, changed)
+	})
+
+	t.Run("invalid secret", func(t *testing.T) {
+		f := v.NewFetcher(FetchSecret{Path: "secret/db", File: filepath.Join(dir, "raw"), Format: FetchFormatRaw})
+		assert.Error(t, f.Fetch(context.Background()))
+	})
+}
+
+type countingLogical struct {
+	kvLogical
+	reads int
+}
+
+func (l *countingLogical) ReadWithData(p string, data map[string][]string) (*api.Secret, error) {
+	l.reads++
+	return l.kvLogical.ReadWithData(p, data)
+}
+
+func TestFetchTemplate(t *testing.T) {
+	dir, err := ioutil.TempDir("", "template")
+	require.NoError(t, err)
+	defer os.RemoveAll(dir)
+	source := filepath.Join(dir, "database.yml.tmpl")
+	require.NoError(t, ioutil.WriteFile(source, []byte(`{{ with secret "secret/db" }}username: {{ .user }}
+password: {{ .password }}{{ end }}
+hosts: {{ toJSON (secret "secret/db").hosts }}
+`), 0600))
+	logical := &countingLogical{kvLogical: kvLogical{"user": "admin", "password": "secret", "hosts": []interface{}{"a", "b"}}}
+	f := &Fetcher{
+		Templates: []FetchTemplate{{Source: source, File: filepath.Join(dir, "database.yml")}},
+		clients:   map[string]*kv.Client{},
+	}
+	f.v, err = New(WithTokenStore(&MemoryStore{}))
+	require.NoError(t, err)
+	f.Options = []kv.Option{
+		kv.WithDetector(func(*api.Client, string) (int, string, error) {
+			return 1, "secret/", nil
+		}),
+		kv.WithLogical(logical),
+	}
+	require.NoError(t, f.Fetch(context.Background()))
+	content, err := ioutil.ReadFile(filepath.Join(dir, "database.yml"))
+	require.NoError(t, err)
+	assert.Equal(t, "username: admin\npassword: secret\nhosts: [\"a\",\"b\"]\n", string(content))
+	assert.Equal(t, 1, logical.reads)
+
+	t.Run("missing key", func(t *testing.T) {
+		f.Templates = []FetchTemplate{{Text: `{{ (secret "secret/db").missing }}`, File: filepath.Join(dir, "missing")}}
+		assert.Error(t, f.Fetch(context.Background()))
+	})
+
+	t.Run("invalid template", func(t *testing.T) {
+		f.Templates = []FetchTemplate{{File: filepath.Join(dir, "invalid")}}
+		assert.Error(t, f.Fetch(context.Background()))
+	})
+}
+
+func TestExec(t *testing.T) {
+	dir, err := ioutil.TempDir("", "exec")
+	require.NoError(t, err)
+	defer os.RemoveAll(dir)
+	out := filepath.Join(dir, "out")
+	v, err := New(WithTokenStore(&MemoryStore{}))
+	require.NoError(t, err)
+	e := v.NewExec([]string{"secret/db", "secret/app"}, "/bin/sh", "-c", `echo "$user:$password:$ports" > `+out)
+	e.Options = []kv.Option{
+		kv.WithDetector(func(*api.Client, string) (int, string, error) {
+			return 1, "secret/", nil
+		}),
+		kv.WithLogical(kvLogical{"user": "admin", "password": "secret", "ports": []interface{}{80, 443}}),
+	}
+	require.NoError(t, e.Run(context.Background()))
+	content, err := ioutil.ReadFile(out)
+	require.NoError(t, err)
+	assert.Equal(t, "admin:secret:[80,443]\n", string(content))
+
+	t.Run("invalid key", func(t *testing.T) {
+		e := v.NewExec([]string{"secret/db"}, "/bin/true")
+		e.Options = []kv.Option{
+			kv.WithDetector(func(*api.Client, string) (int, string, error) {
+				return 1, "secret/", nil
+			}),
+			kv.WithLogical(kvLogical{"invalid-key": "value"}),
+		}
+		assert.Error(t, e.Run(context.Background()))
+	})
+
+	t.Run("command ignoring the signal is killed", func(t *testing.T) {
+		e := v.NewExec([]string{"secret/db"}, "/bin/sh", "-c", `trap "" TERM; exec sleep 5`)
+		e.StopTimeout = 100 * time.Millisecond
+		e.Options = []kv.Option{
+			kv.WithDetector(func(*api.Client, string) (int, string, error) {
+				return 1, "secret/", nil
+			}),
+			kv.WithLogical(kvLogical{"user": "admin"}),
+		}
+		ctx, cancel := context.WithTimeout(context.Background(), 200*time.Millisecond)
+		defer cancel()
+		start := time.Now()
+		require.NoError(t, e.Run(ctx))
+		assert.True(t, time.Since(start) < 3*time.Second)
+	})
+}
+
+func TestEncryptedStore(t *testing.T) {
+	dir, err := ioutil.TempDir("", "key")
+	require.NoError(t, err)
+	defer os.RemoveAll(dir)
+	keyFile := filepath.Join(dir, "key")
+	require.NoError(t, ioutil.WriteFile(keyFile, []byte("key material\n"), 0600))
+	tokenFile := filepath.Join(dir, "token")
+	v, err := New(WithTokenPath(tokenFile), WithTokenKey(KeyFromFile(keyFile)))
+	require.NoError(t, err)
+	require.NoError(t, v.StoreToken("s.token"))
+	content, err := ioutil.ReadFile(tokenFile)
+	require.NoError(t, err)
+	assert.True(t, strings.HasPrefix(string(content), encryptedPrefix))
+	assert.NotContains(t, string(content), "s.token")
+	token, err := v.LoadToken()
+	require.NoError(t, err)
+	assert.Equal(t, "s.token", token)
+
+	t.Run("wrong key", func(t *testing.T) {
+		require.NoError(t, ioutil.WriteFile(keyFile, []byte("other key"), 0600))
+		_, err := v.LoadToken()
+		assert.Error(t, err)
+	})
+
+	t.Run("plaintext token", func(t *testing.T) {
+		require.NoError(t, ioutil.WriteFile(tokenFile, []byte("s.token"), 0600))
+		_, err := v.LoadToken()
+		assert.Error(t, err)
+	})
+}
+
+func TestWaitForVault(t *testing.T) {
+	defer func(f func(context.Context, *api.Client, string) (int, error)) { vaultHealth = f }(vaultHealth)
+	defer func(d time.Duration) { waitInterval = d }(waitInterval)
+	waitInterval = time.Millisecond
+	v, err := New(WithTokenStore(&MemoryStore{}))
+	require.NoError(t, err)
+
+	t.Run("unsealed", func(t *testing.T) {
+		statuses := []int{http.StatusNotImplemented, http.StatusServiceUnavailable, http.StatusTooManyRequests}
+		vaultHealth = func(ctx context.Context, c *api.Client, address string) (int, error) {
+			status := statuses[0]
+			statuses = statuses[1:]
+			return status, nil
+		}
+		assert.NoError(t, v.WaitForVault(context.Background(), time.Second))
+		assert.Empty(t, statuses)
+	})
+
+	t.Run("sealed", func(t *testing.T) {
+		vaultHealth = func(ctx context.Context, c *api.Client, address string) (int, error) {
+			return http.StatusServiceUnavailable, nil
+		}
+		assert.Equal(t, ErrVaultSealed, v.WaitForVault(context.Background(), 10*time.Millisecond))
+	})
+
+	t.Run("unreachable", func(t *testing.T) {
+		vaultHealth = func(ctx context.Context, c *api.Client, address string) (int, error) {
+			return 0, errors.New("connection refused")
+		}
+		err := v.WaitForVault(context.Background(), 10*time.Millisecond)
+		_, ok := err.(*UnreachableError)
+		assert.True(t, ok)
+	})
+}
+
+func TestGetTokenLookup(t *testing.T) {
+	defer func(f func(context.Context, *api.Client) (*api.Secret, error)) { vaultLookupSelf = f }(vaultLookupSelf)
+	logins := 0
+	login := AuthenticatorFunc(func(ctx context.Context, c *api.Client) (*api.Secret, error) {
+		logins++
+		return &api.Secret{Auth: &api.SecretAuth{ClientToken: "new-token"}}, nil
+	})
+	store := &MemoryStore{}
+	require.NoError(t, store.Store("stored-token"))
+	v, err := New(WithTokenStore(store), WithReAuth(true), WithAuthenticator(login), WithRenewThreshold(time.Minute))
+	require.NoError(t, err)
+
+	t.Run("valid token is not renewed", func(t *testing.T) {
+		vaultLookupSelf = func(ctx context.Context, c *api.Client) (*api.Secret, error) {
+			return &api.Secret{Data: map[string]interface{}{"ttl": json.Number("3600"), "renewable": false}}, nil
+		}
+		token, err := v.GetToken()
+		require.NoError(t, err)
+		assert.Equal(t, "stored-token", token)
+		assert.Equal(t, 0, logins)
+		assert.NoError(t, v.Healthy())
+	})
+
+	t.Run("expiring token is not renewable", func(t *testing.T) {
+		vaultLookupSelf = func(ctx context.Context, c *api.Client) (*api.Secret, error) {
+			return &api.Secret{Data: map[string]interface{}{"ttl": json.Number("30"), "renewable": false}}, nil
+		}
+		token, err := v.GetToken()
+		require.NoError(t, err)
+		assert.Equal(t, "new-token", token)
+		assert.Equal(t, 1, logins)
+	})
+
+	t.Run("invalid token", func(t *testing.T) {
+		vaultLookupSelf = func(ctx context.Context, c *api.Client) (*api.Secret, error) {
+			return nil, errors.New("Code: 403. Errors: permission denied")
+		}
+		v.ReAuth = false
+		_, err := v.GetToken()
+		assert.Error(t, err)
+	})
+}
+
+func TestBatchToken(t *testing.T) {
+	defer func(f func(context.Context, *api.Client) (*api.Secret, error)) { vaultLookupSelf = f }(vaultLookupSelf)
+	lookup := map[string]interface{}{"ttl": json.Number("0"), "type": "batch", "renewable": false}
+	vaultLookupSelf = func(ctx context.Context, c *api.Client) (*api.Secret, error) {
+		return &api.Secret{Data: lookup}, nil
+	}
+	v, err := New(WithTokenStore(&MemoryStore{}))
+	require.NoError(t, err)
+
+	t.Run("not renewable", func(t *testing.T) {
+		_, err := v.NewLifetimeWatcher(context.Background(), "b.token")
+		assert.Error(t, err)
+	})
+
+	t.Run("expiring", func(t *testing.T) {
+		info, err := parseTokenInfo(&api.Secret{Data: lookup})
+		require.NoError(t, err)
+		assert.True(t, info.batch)
+		assert.False(t, info.renewable)
+		lookup["ttl"] = 0.03
+		start := time.Now()
+		assert.Equal(t, errTokenExpiring, v.watch(context.Background(), "b.token", nil))
+		assert.True(t, time.Since(start) >= 20*time.Millisecond)
+	})
+
+	t.Run("periodic token", func(t *testing.T) {
+		info, err := parseTokenInfo(&api.Secret{Data: map[string]interface{}{"ttl": json.Number("3600"), "period": json.Number("7200"), "renewable": true}})
+		require.NoError(t, err)
+		v.TTL = 60
+		assert.Equal(t, 7200, v.increment(info))
+		assert.Equal(t, 60, v.increment(tokenInfo{}))
+	})
+}
+
+func TestRenewBefore(t *testing.T) {
+	defer func(f func(context.Context, *api.Client) (*api.Secret, error)) { vaultLookupSelf = f }(vaultLookupSelf)
+	defer func(f func(context.Context, *api.Client, int) (*api.Secret, error)) { vaultRenewSelf = f }(vaultRenewSelf)
+
+	t.Run("parse", func(t *testing.T) {
+		r, err := ParseRenewBefore("30%")
+		require.NoError(t, err)
+		assert.Equal(t, 18*time.Minute, r.remaining(time.Hour))
+		r, err = ParseRenewBefore("5m")
+		require.NoError(t, err)
+		assert.Equal(t, 5*time.Minute, r.remaining(time.Hour))
+		assert.Equal(t, 3*time.Minute, r.remaining(6*time.Minute))
+		for _, s := range []string{"100%", "-1%", "x%", "-5m", "0", "soon"} {
+			_, err := ParseRenewBefore(s)
+			assert.Error(t, err, s)
+		}
+		assert.Error(t, Config{TokenPath: "/tmp/vault-token", RenewBefore: "150%"}.Validate())
+	})
+
+	t.Run("renew ahead until max ttl", func(t *testing.T) {
+		vaultLookupSelf = func(ctx context.Context, c *api.Client) (*api.Secret, error) {
+			return &api.Secret{Data: map[string]interface{}{"ttl": 0.1, "renewable": true}}, nil
+		}
+		leases := []int{1, 0}
+		renewals := 0
+		vaultRenewSelf = func(ctx context.Context, c *api.Client, ttl int) (*api.Secret, error) {
+			renewals++
+			return &api.Secret{Auth: &api.SecretAuth{LeaseDuration: leases[renewals-1]}}, nil
+		}
+		v, err := New(WithTokenStore(&MemoryStore{}), WithRenewBefore(&RenewBefore{Percent: 90}))
+		require.NoError(t, err)
+		start := time.Now()
+		err = v.watch(context.Background(), "s.token", nil)
+		require.Error(t, err)
+		assert.Equal(t, 2, renewals)
+		assert.True(t, time.Since(start) >= 100*time.Millisecond)
+	})
+}
+
+type closingStore struct {
+	MemoryStore
+	closed bool
+}
+
+func (s *closingStore) Close() error {
+	s.closed = true
+	return nil
+}
+
+func TestClose(t *testing.T) {
+	defer func(f func(context.Context, *api.Client) (*api.Secret, error)) { vaultLookupSelf = f }(vaultLookupSelf)
+	vaultLookupSelf = func(ctx context.Context, c *api.Client) (*api.Secret, error) {
+		return &api.Secret{Data: map[string]interface{}{"ttl": json.Number("0"), "renewable": false}}, nil
+	}
+	defer func(f func(context.Context, *api.Client) vaultLogicalWriter) { vaultLogical = f }(vaultLogical)
+	w := &recordingWriter{}
+	vaultLogical = func(ctx context.Context, c *api.Client) vaultLogicalWriter {
+		return w
+	}
+	store := &closingStore{}
+	require.NoError(t, store.Store("s.token"))
+	v, err := New(WithTokenStore(store), WithRevokeOnClose(true))
+	require.NoError(t, err)
+	events := v.Events()
+
+	errc := make(chan error, 1)
+	go func() { errc <- v.Run(context.Background()) }()
+	// wait until Run is started
+	for start := time.Now(); time.Since(start) < time.Second; time.Sleep(time.Millisecond) {
+		v.loops.mu.Lock()
+		n := len(v.loops.cancels)
+		v.loops.mu.Unlock()
+		if n > 0 {
+			break
+		}
+	}
+	require.NoError(t, v.Close(context.Background()))
+	assert.NoError(t, <-errc)
+	assert.Equal(t, "auth/token/revoke-self", w.path)
+	assert.True(t, store.closed)
+	assert.Error(t, v.Healthy())
+	assert.Equal(t, ErrClosed, v.Run(context.Background()))
+	var types []EventType
+	for e := range events {
+		types = append(types, e.Type)
+	}
+	assert.Equal(t, []EventType{EventStored, EventRevoked}, types)
+}
+
+type mountWriter struct {
+	mount  string
+	denied string
+	paths  []string
+}
+
+func (w *mountWriter) Write(p string, data map[string]interface{}) (*api.Secret, error) {
+	w.paths = append(w.paths, p)
+	switch p {
+	case w.mount + "/login":
+		return &api.Secret{Auth: &api.SecretAuth{ClientToken: rootToken}}, nil
+	case w.denied + "/login":
+		return nil, errors.New("Error making API request.\n\nCode: 403. Errors:\n\n* permission denied")
+	}
+	// Vault denies the unauthenticated login of a missing mount
+	return nil, errors.New("Error making API request.\n\nCode: 403. Errors:\n\n* permission denied")
+}
+
+func TestDiscoverAuthMount(t *testing.T) {
+	defer func(f func(context.Context, *api.Client) (*api.Secret, error)) { vaultAuthMounts = f }(vaultAuthMounts)
+	defer func(f func(context.Context, *api.Client) vaultLogicalWriter) { vaultLogical = f }(vaultLogical)
+	w := &mountWriter{mount: "auth/k8s-prod-eu1"}
+	vaultLogical = func(ctx context.Context, c *api.Client) vaultLogicalWriter {
+		return w
+	}
+	mounts := map[string]interface{}{
+		"token/":         map[string]interface{}{"type": "token"},
+		"k8s-prod-eu1/":  map[string]interface{}{"type": "kubernetes"},
+		"approle/":       map[string]interface{}{"type": "approle"},
+		"k8s-stage-eu1/": map[string]interface{}{"type": "kubernetes"},
+	}
+	vaultAuthMounts = func(ctx context.Context, c *api.Client) (*api.Secret, error) {
+		return &api.Secret{Data: mounts}, nil
+	}
+	dir, err := ioutil.TempDir("", "discover")
+	require.NoError(t, err)
+	defer os.RemoveAll(dir)
+	saToken := filepath.Join(dir, "token")
+	require.NoError(t, ioutil.WriteFile(saToken, []byte("jwt"), 0600))
+	newVault := func(candidates ...string) *Vault {
+		v, err := New(WithTokenStore(&MemoryStore{}), WithServiceAccountTokenPath(saToken), WithAuthMountDiscovery(candidates...))
+		require.NoError(t, err)
+		return v
+	}
+
+	t.Run("several mounts", func(t *testing.T) {
+		_, err := newVault().Authenticate()
+		assert.Error(t, err)
+	})
+
+	t.Run("listed mount of candidates", func(t *testing.T) {
+		v := newVault("k8s-prod-eu1", "k8s-stage-eu1")
+		_, err := v.Authenticate()
+		require.NoError(t, err)
+		assert.Equal(t, "auth/k8s-prod-eu1", v.AuthMountPath)
+	})
+
+	t.Run("candidates without permission to list", func(t *testing.T) {
+		vaultAuthMounts = func(ctx context.Context, c *api.Client) (*api.Secret, error) {
+			return nil, errors.New("Code: 403. Errors: permission denied")
+		}
+		w.paths = nil
+		v := newVault("k8s-stage-eu1", "k8s-prod-eu1")
+		_, err := v.Authenticate()
+		require.NoError(t, err)
+		assert.Equal(t, "auth/k8s-prod-eu1", v.AuthMountPath)
+		assert.Equal(t, []string{"auth/k8s-stage-eu1/login", "auth/k8s-prod-eu1/login"}, w.paths)
+
+		// the discovered mount is kept
+		_, err = v.Authenticate()
+		require.NoError(t, err)
+		assert.Len(t, w.paths, 3)
+
+		_, err = newVault().Authenticate()
+		assert.Error(t, err)
+	})
+
+	t.Run("unlisted candidates until a login succeeds", func(t *testing.T) {
+		w.paths = nil
+		v := newVault("k8s-missing", "k8s-stage-eu1", "k8s-prod-eu1")
+		_, err := v.Authenticate()
+		require.NoError(t, err)
+		assert.Equal(t, []string{"auth/k8s-missing/login", "auth/k8s-stage-eu1/login", "auth/k8s-prod-eu1/login"}, w.paths)
+
+		_, err = newVault("k8s-missing", "k8s-stage-eu1").Authenticate()
+		require.Error(t, err)
+		assert.Contains(t, err.Error(), "auth/k8s-missing: ")
+		assert.Contains(t, err.Error(), "auth/k8s-stage-eu1: ")
+	})
+
+	t.Run("denied login of a listed mount", func(t *testing.T) {
+		vaultAuthMounts = func(ctx context.Context, c *api.Client) (*api.Secret, error) {
+			return &api.Secret{Data: mounts}, nil
+		}
+		w.denied = "auth/k8s-stage-eu1"
+		defer func() { w.denied = "" }()
+		w.paths = nil
+		v := newVault("k8s-stage-eu1", "k8s-prod-eu1")
+		_, err := v.Authenticate()
+		require.Error(t, err)
+		assert.Contains(t, err.Error(), "permission denied")
+		assert.Equal(t, []string{"auth/k8s-stage-eu1/login"}, w.paths)
+		assert.Equal(t, "auth/k8s-stage-eu1", v.AuthMountPath)
+	})
+}
+
+func TestClusters(t *testing.T) {
+	t.Run("invalid configs", func(t *testing.T) {
+		_, err := NewClusters()
+		assert.Error(t, err)
+		_, err = NewClusters(Config{TokenPath: "/tmp/regional"})
+		assert.Error(t, err)
+		_, err = NewClusters(
+			Config{TokenPath: "/tmp/token", Addresses: []string{"https://regional:8200"}},
+			Config{TokenPath: "/tmp/token", Addresses: []string{"https://global:8200"}},
+		)
+		assert.Error(t, err)
+	})
+
+	t.Run("run", func(t *testing.T) {
+		c, err := NewClusters(
+			Config{TokenPath: "/tmp/regional", Role: "regional", Addresses: []string{"https://regional:8200"}},
+			Config{TokenPath: "/tmp/global", Role: "global", AuthMountPath: "k8s-global", Addresses: []string{"https://global:8200"}},
+		)
+		require.NoError(t, err)
+		require.Len(t, c, 2)
+		assert.Equal(t, "auth/k8s-global", c[1].AuthMountPath)
+		assert.Error(t, c.Healthy())
+
+		// a failing cluster stops the other ones
+		c[0].WrapTTL = time.Minute
+		c[1].TokenStore = &MemoryStore{}
+		c[1].ReAuth = true
+		c[1].Authenticator = AuthenticatorFunc(func(ctx context.Context, _ *api.Client) (*api.Secret, error) {
+			<-ctx.Done()
+			return nil, ctx.Err()
+		})
+		errc := make(chan error, 1)
+		go func() { errc <- c.Run(context.Background()) }()
+		select {
+		case err := <-errc:
+			assert.Error(t, err)
+		case <-time.After(5 * time.Second):
+			t.Fatal("run did not return")
+		}
+		assert.NoError(t, c.Close(context.Background()))
+	})
+}
+
+func TestLeaderElection(t *testing.T) {
+	clientset := fake.NewSimpleClientset()
+	candidate := func(identity string) (*Vault, *LeaderElection) {
+		le := &LeaderElection{Lease: "vault-token", Namespace: "default", Identity: identity, LeaseDuration: time.Second, RetryPeriod: 10 * time.Millisecond, clientset: clientset}
+		v, err := New(WithTokenStore(&MemoryStore{}), WithLeaderElection(le))
+		require.NoError(t, err)
+		return v, le
+	}
+	va, a := candidate("pod-a")
+	vb, b := candidate("pod-b")
+	// lead runs le until ctx is done, leading receives a value when the replica leads
+	lead := func(ctx context.Context, v *Vault, le *LeaderElection, leading chan<- string) <-chan error {
+		errc := make(chan error, 1)
+		go func() {
+			errc <- le.lead(ctx, v, func(ctx context.Context) error {
+				leading <- le.Identity
+				<-ctx.Done()
+				return nil
+			})
+		}()
+		return errc
+	}
+
+	t.Run("validate", func(t *testing.T) {
+		assert.Error(t, (&LeaderElection{}).validate())
+		assert.Error(t, (&LeaderElection{Lease: "l", LeaseDuration: time.Second, RetryPeriod: time.Second}).validate())
+		assert.NoError(t, (&LeaderElection{Lease: "l"}).validate())
+	})
+
+	t.Run("one leader", func(t *testing.T) {
+		leading := make(chan string, 2)
+		ctxA, cancelA := context.WithCancel(context.Background())
+		errA := lead(ctxA, va, a, leading)
+		assert.Equal(t, "pod-a", <-leading)
+		ctxB, cancelB := context.WithCancel(context.Background())
+		defer cancelB()
+		errB := lead(ctxB, vb, b, leading)
+		select {
+		case id := <-leading:
+			t.Fatalf("%s leads while pod-a holds the lease", id)
+		case <-time.After(100 * time.Millisecond):
+		}
+		// the released lease is taken over without waiting for its expiry
+		cancelA()
+		require.NoError(t, <-errA)
+		select {
+		case id := <-leading:
+			assert.Equal(t, "pod-b", id)
+		case <-time.After(500 * time.Millisecond):
+			t.Fatal("pod-b does not take over the released lease")
+		}
+		cancelB()
+		require.NoError(t, <-errB)
+	})
+
+	t.Run("error is returned", func(t *testing.T) {
+		err := a.lead(context.Background(), va, func(ctx context.Context) error {
+			return errors.New("failed")
+		})
+		assert.EqualError(t, err, "failed")
+	})
+
+	t.Run("lost leadership", func(t *testing.T) {
+		ctx, cancel := context.WithCancel(context.Background())
+		defer cancel()
+		leads := 0
+		err := a.lead(ctx, va, func(ctx context.Context) error {
+			leads++
+			if leads > 1 {
+				cancel()
+				return nil
+			}
+			// another replica takes over the lease
+			leases := clientset.CoordinationV1().Leases("default")
+			l, err := leases.Get(ctx, "vault-token", metav1.GetOptions{})
+			require.NoError(t, err)
+			intruder := "intruder"
+			now := metav1.NewMicroTime(time.Now())
+			l.Spec.HolderIdentity, l.Spec.RenewTime = &intruder, &now
+			_, err = leases.Update(ctx, l, metav1.UpdateOptions{})
+			require.NoError(t, err)
+			<-ctx.Done()
+			return nil
+		})
+		require.NoError(t, err)
+		assert.Equal(t, 2, leads, "leads again after the lost leadership")
+	})
+}
+
+func TestFileStoreLock(t *testing.T) {
+	dir, err := ioutil.TempDir("", "filestore")
+	require.NoError(t, err)
+	defer os.RemoveAll(dir)
+	f := FileStore(filepath.Join(dir, "token"))
+
+	_, err = f.Load()
+	assert.Error(t, err)
+
+	tokens := []string{strings.Repeat("a", 4096), strings.Repeat("b", 8192)}
+	var wg sync.WaitGroup
+	for i := 0; i < 20; i++ {
+		wg.Add(2)
+		go func(i int) {
+			defer wg.Done()
+			assert.NoError(t, f.Store(tokens[i%2]))
+		}(i)
+		go func() {
+			defer wg.Done()
+			token, err := f.Load()
+			if err == nil {
+				assert.Contains(t, tokens, token)
+			}
+		}()
+	}
+	wg.Wait()
+	info, err := os.Stat(string(f))
+	require.NoError(t, err)
+	assert.Equal(t, os.FileMode(0644), info.Mode().Perm())
+	files, err := ioutil.ReadDir(dir)
+	require.NoError(t, err)
+	assert.Len(t, files, 1, "no lock or temporary files are left")
+
+	t.Run("symlink and read-only directory", func(t *testing.T) {
+		target := filepath.Join(dir, "target")
+		require.NoError(t, ioutil.WriteFile(target, []byte("old"), 0644))
+		linkDir := filepath.Join(dir, "link")
+		require.NoError(t, os.Mkdir(linkDir, 0755))
+		link := FileStore(filepath.Join(linkDir, "token"))
+		require.NoError(t, os.Symlink(target, string(link)))
+		require.NoError(t, os.Chmod(linkDir, 0555))
+		defer os.Chmod(linkDir, 0755)
+		require.NoError(t, link.Store("new"))
+		fi, err := os.Lstat(string(link))
+		require.NoError(t, err)
+		assert.True(t, fi.Mode()&os.ModeSymlink != 0)
+		content, err := ioutil.ReadFile(target)
+		require.NoError(t, err)
+		assert.Equal(t, "new", string(content))
+	})
+}
+
+func TestEventRecorder(t *testing.T) {
+	clientset := fake.NewSimpleClientset()
+	events := func() []corev1.Event {
+		list, err := clientset.CoreV1().Events("default").List(context.Background(), metav1.ListOptions{})
+		require.NoError(t, err)
+		return list.Items
+	}
+
+	fail := true
+	login := AuthenticatorFunc(func(ctx context.Context, c *api.Client) (*api.Secret, error) {
+		if fail {
+			return nil, errors.New("Code: 403. Errors: permission denied")
+		}
+		return &api.Secret{Auth: &api.SecretAuth{ClientToken: rootToken}}, nil
+	})
+	r := &EventRecorder{Pod: "app-0", Namespace: "default", Threshold: 2, clientset: clientset}
+	v, err := New(WithTokenStore(&MemoryStore{}), WithAuthenticator(login), WithEventRecorder(r))
+	require.NoError(t, err)
+
+	for i := 0; i < 2; i++ {
+		_, err := v.Authenticate()
+		assert.Error(t, err)
+	}
+	require.Eventually(t, func() bool { return len(events()) == 1 }, time.Second, 10*time.Millisecond)
+	e := events()[0]
+	assert.Equal(t, corev1.EventTypeWarning, e.Type)
+	assert.Equal(t, EventReasonLoginFailed, e.Reason)
+	assert.Equal(t, "app-0", e.InvolvedObject.Name)
+	assert.Equal(t, "Pod", e.InvolvedObject.Kind)
+	assert.Equal(t, "vault-k8s", e.Source.Component)
+	assert.Contains(t, e.Message, "2 consecutive failures")
+
+	// a successful login resets the failures
+	fail = false
+	_, err = v.Authenticate()
+	require.NoError(t, err)
+	fail = true
+	_, err = v.Authenticate()
+	assert.Error(t, err)
+	time.Sleep(100 * time.Millisecond)
+	assert.Len(t, events(), 1)
+
+	require.NoError(t, v.Close(context.Background()))
+	assert.Error(t, (&EventRecorder{Threshold: -1}).validate())
+}
+
+type jwtWriter struct {
+	jwt string
+}
+
+func (w *jwtWriter) Write(p string, data map[string]interface{}) (*api.Secret, error) {
+	if data["jwt"] != w.jwt {
+		return nil, errors.New("Code: 403. Errors: permission denied")
+	}
+	return &api.Secret{Auth: &api.SecretAuth{ClientToken: rootToken}}, nil
+}
+
+func TestServiceAccountTokenPaths(t *testing.T) {
+	dir, err := ioutil.TempDir("", "satokens")
+	require.NoError(t, err)
+	defer os.RemoveAll(dir)
+	claims := base64.RawURLEncoding.EncodeToString([]byte(`{"aud":["vault"]}`))
+	projectedJWT := "header." + claims + ".signature"
+	projected := filepath.Join(dir, "vault-token")
+	require.NoError(t, ioutil.WriteFile(projected, []byte(projectedJWT), 0600))
+	standard := filepath.Join(dir, "token")
+	require.NoError(t, ioutil.WriteFile(standard, []byte("standard"), 0600))
+	assert.Equal(t, []string{"vault"}, jwtAudiences(projectedJWT))
+	assert.Nil(t, jwtAudiences("standard"))
+
+	defer func(f func(context.Context, *api.Client) vaultLogicalWriter) { vaultLogical = f }(vaultLogical)
+	w := &jwtWriter{}
+	vaultLogical = func(ctx context.Context, c *api.Client) vaultLogicalWriter {
+		return w
+	}
+	v, err := New(WithTokenStore(&MemoryStore{}), WithServiceAccountTokenPaths(filepath.Join(dir, "missing"), projected, standard))
+	require.NoError(t, err)
+
+	for _, tc := range []struct {
+		jwt  string
+		path string
+	}{
+		{"standard", standard},
+		{projectedJWT, projected},
+	} {
+		w.jwt = tc.jwt
+		_, err := v.Authenticate()
+		require.NoError(t, err)
+		require.NotNil(t, v.LastAuth())
+		assert.Equal(t, tc.path, v.LastAuth().ServiceAccountTokenPath)
+		assert.Equal(t, tc.path, v.credentialPath())
+	}
+
+	w.jwt = "other"
+	_, err = v.Authenticate()
+	assert.Error(t, err)
+	_, err = New(WithTokenStore(&MemoryStore{}), WithServiceAccountTokenPaths(""))
+	assert.Error(t, err)
+}
+
+func TestAuthError(t *testing.T) {
+	for _, tc := range []struct {
+		err  error
+		kind error
+	}{
+		{&net.OpError{Op: "dial", Err: errors.New("connection refused")}, ErrNetwork},
+		{errors.New("Code: 503. Errors: * Vault is sealed"), ErrVaultSealed},
+		{errors.New(`Code: 400. Errors: * invalid role name "app"`), ErrPermissionDenied},
+		{errors.New("Code: 403. Errors: * permission denied"), ErrPermissionDenied},
+		{errors.New("Code: 403. Errors: * failed to validate JWT: token is expired"), ErrInvalidJWT},
+		{errors.New("unexpected"), nil},
+	} {
+		err := authError(errors.Wrap(tc.err, "login failed"))
+		assert.Equal(t, tc.kind, AuthErrorKind(err), tc.err.Error())
+		assert.Equal(t, "login failed: "+tc.err.Error(), err.Error())
+	}
+	assert.Equal(t, context.Canceled, authError(context.Canceled))
+	assert.Nil(t, authError(nil))
+
+	v, err := New(WithTokenStore(&MemoryStore{}), WithServiceAccountTokenPath("/nonexistent/token"))
+	require.NoError(t, err)
+	_, err = v.Authenticate()
+	assert.Equal(t, ErrInvalidJWT, AuthErrorKind(err))
+	assert.Equal(t, reasonOther, failureReason(err))
+}
+
+func TestAllowFail(t *testing.T) {
+	login := AuthenticatorFunc(func(ctx context.Context, c *api.Client) (*api.Secret, error) {
+		return nil, errors.New("Code: 403. Errors: permission denied")
+	})
+	v, err := New(WithTokenStore(&MemoryStore{}), WithReAuth(true), WithAuthenticator(login))
+	require.NoError(t, err)
+
+	t.Run("without allow fail", func(t *testing.T) {
+		token, soft, err := v.TryAuthenticate(context.Background())
+		assert.Error(t, err)
+		assert.Nil(t, soft)
+		assert.Empty(t, token)
+	})
+
+	t.Run("with allow fail", func(t *testing.T) {
+		v.AllowFail = true
+		token, soft, err := v.TryGetToken(context.Background())
+		require.NoError(t, err)
+		require.NotNil(t, soft)
+		assert.Empty(t, token)
+		assert.Equal(t, ErrPermissionDenied, soft.Kind())
+	})
+
+	t.Run("canceled", func(t *testing.T) {
+		ctx, cancel := context.WithCancel(context.Background())
+		cancel()
+		_, soft, err := v.TryAuthenticate(ctx)
+		assert.Error(t, err)
+		assert.Nil(t, soft)
+	})
+}
+
+func TestJWTSource(t *testing.T) {
+	defer func(f func(context.Context, *api.Client) vaultLogicalWriter) { vaultLogical = f }(vaultLogical)
+	w := &jwtWriter{jwt: "injected"}
+	vaultLogical = func(ctx context.Context, c *api.Client) vaultLogicalWriter {
+		return w
+	}
+
+	t.Run("environment", func(t *testing.T) {
+		os.Setenv("TEST_VAULT_JWT", "injected")
+		defer os.Unsetenv("TEST_VAULT_JWT")
+		v, err := New(WithTokenStore(&MemoryStore{}), WithJWTSource(JWTFromEnv("TEST_VAULT_JWT")))
+		require.NoError(t, err)
+		_, err = v.Authenticate()
+		require.NoError(t, err)
+		assert.Equal(t, "", v.credentialPath())
+
+		_, err = JWTFromEnv("TEST_VAULT_JWT_MISSING")()
+		assert.Error(t, err)
+	})
+
+	t.Run("reader", func(t *testing.T) {
+		source := JWTFromReader(strings.NewReader("injected\n"))
+		v, err := New(WithTokenStore(&MemoryStore{}), WithJWTSource(source))
+		require.NoError(t, err)
+		for i := 0; i < 2; i++ {
+			_, err = v.Authenticate()
+			require.NoError(t, err)
+		}
+		_, err = JWTFromReader(strings.NewReader(""))()
+		assert.Error(t, err)
+	})
+
+	_, err := New(WithTokenStore(&MemoryStore{}), WithJWTSource(nil))
+	assert.Error(t, err)
+}
+
+func TestTokenUses(t *testing.T) {
+	defer func(f func(context.Context, *api.Client) (*api.Secret, error)) { vaultLookupSelf = f }(vaultLookupSelf)
+	uses := 10
+	vaultLookupSelf = func(ctx context.Context, c *api.Client) (*api.Secret, error) {
+		uses--
+		return &api.Secret{Data: map[string]interface{}{"ttl": json.Number("3600"), "renewable": true, "num_uses": json.Number(strconv.Itoa(uses))}}, nil
+	}
+	logins := 0
+	login := AuthenticatorFunc(func(ctx context.Context, c *api.Client) (*api.Secret, error) {
+		logins++
+		return &api.Secret{Auth: &api.SecretAuth{ClientToken: "new-token"}}, nil
+	})
+	store := &MemoryStore{}
+	require.NoError(t, store.Store("stored-token"))
+	v, err := New(WithTokenStore(store), WithReAuth(true), WithAuthenticator(login), WithMinTokenUses(3, 5*time.Millisecond))
+	require.NoError(t, err)
+
+	t.Run("get token", func(t *testing.T) {
+		token, err := v.GetToken()
+		require.NoError(t, err)
+		assert.Equal(t, "stored-token", token)
+		uses = 3
+		token, err = v.GetToken()
+		require.NoError(t, err)
+		assert.Equal(t, "new-token", token)
+		assert.Equal(t, 1, logins)
+	})
+
+	t.Run("watch", func(t *testing.T) {
+		uses = 10
+		err := v.watch(context.Background(), "stored-token", nil)
+		assert.Equal(t, errTokenUsesExhausted, err)
+		assert.Equal(t, 3, uses)
+	})
+
+	_, err = New(WithTokenStore(store), WithMinTokenUses(-1, 0))
+	assert.Error(t, err)
+}
+
+type childWriter struct {
+	paths []string
+	data  map[string]interface{}
+}
+
+func (w *childWriter) Write(p string, data map[string]interface{}) (*api.Secret, error) {
+	w.paths = append(w.paths, p)
+	if p != "auth/token/create" {
+		return nil, nil
+	}
+	w.data = data
+	return &api.Secret{Auth: &api.SecretAuth{ClientToken: "child-token", Accessor: "child-accessor", Policies: []string{"read"}, LeaseDuration: 60}}, nil
+}
+
+func TestCreateChildToken(t *testing.T) {
+	defer func(f func(context.Context, *api.Client) vaultLogicalWriter) { vaultLogical = f }(vaultLogical)
+	w := &childWriter{}
+	vaultLogical = func(ctx context.Context, c *api.Client) vaultLogicalWriter {
+		return w
+	}
+	store := &MemoryStore{}
+	v, err := New(WithTokenStore(store))
+	require.NoError(t, err)
+
+	_, err = v.CreateChildToken(context.Background(), ChildTokenOptions{})
+	assert.Error(t, err, "without a stored token")
+
+	require.NoError(t, store.Store("parent-token"))
+	info, err := v.CreateChildToken(context.Background(), ChildTokenOptions{Policies: []string{"read"}, TTL: time.Minute, NumUses: 5})
+	require.NoError(t, err)
+	assert.Equal(t, "child-token", info.Token)
+	assert.Equal(t, time.Minute, info.LeaseDuration)
+	assert.Equal(t, []string{"read"}, w.data["policies"])
+	assert.Equal(t, "60s", w.data["ttl"])
+	assert.Equal(t, 5, w.data["num_uses"])
+	assert.Equal(t, "false", w.data["renewable"])
+
+	require.NoError(t, v.Close(context.Background()))
+	assert.Equal(t, []string{"auth/token/create", "auth/token/revoke-self"}, w.paths)
+}
+
+func TestTokenCheck(t *testing.T) {
+	defer func(f func(context.Context, *api.Client) (*api.Secret, error)) { vaultLookupSelf = f }(vaultLookupSelf)
+	vaultLookupSelf = func(ctx context.Context, c *api.Client) (*api.Secret, error) {
+		return &api.Secret{Data: map[string]interface{}{"ttl": json.Number("0"), "renewable": false}}, nil
+	}
+	dir, err := ioutil.TempDir("", "tokencheck")
+	require.NoError(t, err)
+	defer os.RemoveAll(dir)
+	tokenPath := filepath.Join(dir, "token")
+	l := &recordingLogger{}
+	v, err := New(WithTokenPath(tokenPath), WithTokenCheckInterval(5*time.Millisecond), WithLogger(l))
+	require.NoError(t, err)
+	require.NoError(t, v.StoreToken("s.token"))
+
+	ctx, cancel := context.WithCancel(context.Background())
+	errc := make(chan error, 1)
+	go func() { errc <- v.Run(ctx) }()
+	for _, drift := range []func(){
+		func() { require.NoError(t, os.Remove(tokenPath)) },
+		func() { require.NoError(t, ioutil.WriteFile(tokenPath, []byte("s.tok"), 0644)) },
+	} {
+		time.Sleep(20 * time.Millisecond)
+		drift()
+		time.Sleep(20 * time.Millisecond)
+		token, err := v.LoadToken()
+		require.NoError(t, err)
+		assert.Equal(t, "s.token", token)
+	}
+	cancel()
+	require.NoError(t, <-errc)
+	drifted := 0
+	for _, e := range l.events {
+		if strings.HasPrefix(e, "stored token drifted") {
+			drifted++
+		}
+	}
+	assert.Equal(t, 2, drifted)
+}
+
+func TestAgent(t *testing.T) {
+	defer func(f func(context.Context, *api.Client) (*api.Secret, error)) { vaultLookupSelf = f }(vaultLookupSelf)
+	defer func(f func(context.Context, *api.Client) vaultLogicalWriter) { vaultLogical = f }(vaultLogical)
+	w := &jwtWriter{jwt: "jwt"}
+	vaultLogical = func(ctx context.Context, c *api.Client) vaultLogicalWriter {
+		return w
+	}
+	dir, err := ioutil.TempDir("", "agent")
+	require.NoError(t, err)
+	defer os.RemoveAll(dir)
+	saToken := filepath.Join(dir, "token")
+	require.NoError(t, ioutil.WriteFile(saToken, []byte("jwt"), 0600))
+	v, err := New(WithTokenStore(&MemoryStore{}), WithServiceAccountTokenPath(saToken), WithAgent("unix:///var/run/vault/agent.sock"))
+	require.NoError(t, err)
+
+	t.Run("auto-auth token", func(t *testing.T) {
+		vaultLookupSelf = func(ctx context.Context, c *api.Client) (*api.Secret, error) {
+			return &api.Secret{Data: map[string]interface{}{
+				"id":        "agent-token",
+				"accessor":  "agent-accessor",
+				"policies":  []interface{}{"default", "app"},
+				"ttl":       json.Number("3600"),
+				"renewable": true,
+			}}, nil
+		}
+		token, err := v.Authenticate()
+		require.NoError(t, err)
+		assert.Equal(t, "agent-token", token)
+		info := v.LastAuth()
+		require.NotNil(t, info)
+		assert.Equal(t, []string{"default", "app"}, info.Policies)
+		assert.Equal(t, time.Hour, info.LeaseDuration)
+	})
+
+	t.Run("without auto-auth token", func(t *testing.T) {
+		vaultLookupSelf = func(ctx context.Context, c *api.Client) (*api.Secret, error) {
+			return &api.Secret{Data: map[string]interface{}{"ttl": json.Number("3600")}}, nil
+		}
+		_, err := v.Authenticate()
+		assert.Error(t, err)
+	})
+
+	t.Run("agent not reachable", func(t *testing.T) {
+		vaultLookupSelf = func(ctx context.Context, c *api.Client) (*api.Secret, error) {
+			return nil, &net.OpError{Op: "dial", Net: "unix", Err: errors.New("no such file or directory")}
+		}
+		token, err := v.Authenticate()
+		require.NoError(t, err)
+		assert.Equal(t, rootToken, token)
+	})
+}
+
+func TestCircuitBreaker(t *testing.T) {
+	var logins int
+	var fail bool
+	a := AuthenticatorFunc(func(ctx context.Context, c *api.Client) (*api.Secret, error) {
+		logins++
+		if fail {
+			return nil, errors.New("Code: 503. vault is sealed")
+		}
+		return &api.Secret{Auth: &api.SecretAuth{ClientToken: "custom"}}, nil
+	})
+
+	t.Run("open after failures", func(t *testing.T) {
+		logins, fail = 0, true
+		b := &CircuitBreaker{Failures: 2, OpenDuration: 50 * time.Millisecond}
+		v, err := New(WithTokenStore(&MemoryStore{}), WithAuthenticator(a), WithCircuitBreaker(b))
+		require.NoError(t, err)
+		for i := 0; i < 2; i++ {
+			_, err = v.Authenticate()
+			assert.Equal(t, ErrVaultSealed, AuthErrorKind(err))
+		}
+		_, err = v.Authenticate()
+		assert.Equal(t, ErrCircuitOpen, errors.Cause(err))
+		assert.Equal(t, 2, logins)
+
+		// a failed probe opens the breaker again
+		time.Sleep(60 * time.Millisecond)
+		_, err = v.Authenticate()
+		assert.Equal(t, ErrVaultSealed, AuthErrorKind(err))
+		_, err = v.Authenticate()
+		assert.Equal(t, ErrCircuitOpen, errors.Cause(err))
+		assert.Equal(t, 3, logins)
+
+		// a successful probe closes it
+		time.Sleep(60 * time.Millisecond)
+		fail = false
+		token, err := v.Authenticate()
+		require.NoError(t, err)
+		assert.Equal(t, "custom", token)
+		_, err = v.Authenticate()
+		require.NoError(t, err)
+		assert.Equal(t, 5, logins)
+	})
+
+	t.Run("retry budget", func(t *testing.T) {
+		logins, fail = 0, false
+		b := &CircuitBreaker{Budget: 2, BudgetWindow: time.Hour}
+		v1, err := New(WithTokenStore(&MemoryStore{}), WithAuthenticator(a), WithCircuitBreaker(b))
+		require.NoError(t, err)
+		v2, err := New(WithTokenStore(&MemoryStore{}), WithAuthenticator(a), WithCircuitBreaker(b))
+		require.NoError(t, err)
+		_, err = v1.Authenticate()
+		require.NoError(t, err)
+		_, err = v2.Authenticate()
+		require.NoError(t, err)
+		_, err = v1.Authenticate()
+		assert.Equal(t, ErrRetryBudgetExhausted, errors.Cause(err))
+		assert.Equal(t, 2, logins)
+		assert.True(t, b.retryAfter() > 59*time.Minute)
+	})
+
+	t.Run("environment", func(t *testing.T) {
+		os.Setenv("VAULT_BREAKER_FAILURES", "3")
+		os.Setenv("VAULT_RETRY_BUDGET", "10")
+		os.Setenv("VAULT_RETRY_BUDGET_WINDOW", "5m")
+		defer os.Unsetenv("VAULT_BREAKER_FAILURES")
+		defer os.Unsetenv("VAULT_RETRY_BUDGET")
+		defer os.Unsetenv("VAULT_RETRY_BUDGET_WINDOW")
+		b, err := breakerFromEnvironment()
+		require.NoError(t, err)
+		require.NotNil(t, b)
+		assert.Equal(t, 3, b.Failures)
+		assert.Equal(t, 10, b.Budget)
+		assert.Equal(t, 5*time.Minute, b.BudgetWindow)
+		assert.Equal(t, DefaultBreakerOpenDuration, b.openDuration())
+	})
+}
+
+func TestFlags(t *testing.T) {
+	os.Setenv("VAULT_ROLE", "env-role")
+	os.Setenv("VAULT_TOKEN_PATH", "/env/token")
+	os.Setenv("VAULT_TTL", "1h")
+	defer os.Unsetenv("VAULT_ROLE")
+	defer os.Unsetenv("VAULT_TOKEN_PATH")
+	defer os.Unsetenv("VAULT_TTL")
+
+	t.Run("flags override the environment", func(t *testing.T) {
+		cfg := Config{AuthMountPath: "kubernetes"}
+		fs, err := cfg.Flags()
+		require.NoError(t, err)
+		require.NoError(t, fs.Parse([]string{"--role", "flag-role", "--reauth"}))
+		assert.Equal(t, "flag-role", cfg.Role)
+		assert.Equal(t, "/env/token", cfg.TokenPath)
+		assert.Equal(t, time.Hour, cfg.TTL)
+		assert.True(t, cfg.ReAuth)
+		assert.Equal(t, "kubernetes", cfg.AuthMountPath)
+		assert.Equal(t, "env-role", fs.Lookup("role").DefValue)
+	})
+
+	t.Run("invalid environment", func(t *testing.T) {
+		os.Setenv("VAULT_REAUTH", "maybe")
+		defer os.Unsetenv("VAULT_REAUTH")
+		cfg := Config{}
+		_, err := cfg.Flags()
+		assert.Error(t, err)
+	})
+}
+
+func TestAuthMethodFromEnvironment(t *testing.T) {
+	os.Setenv("VAULT_TOKEN_PATH", "/tmp/vault-token")
+	defer os.Setenv("VAULT_TOKEN_PATH", "")
+	defer os.Setenv("VAULT_AUTH_METHOD", "")
+
+	t.Run("missing role", func(t *testing.T) {
+		for _, m := range []string{AuthMethodAWS, AuthMethodGCP, AuthMethodAzure} {
+			os.Setenv("VAULT_AUTH_METHOD", m)
+			_, err := NewFromEnvironment()
+			assert.Error(t, err, m)
+		}
+	})
+
+	t.Run("aws", func(t *testing.T) {
+		os.Setenv("VAULT_AUTH_METHOD", AuthMethodAWS)
+		os.Setenv("VAULT_ROLE", "app")
+		defer os.Setenv("VAULT_ROLE", "")
+		v, err := NewFromEnvironment()
+		require.NoError(t, err)
+		assert.NotNil(t, v.AWS)
+		assert.Equal(t, "auth/aws", v.AuthMountPath)
+	})
+
+	t.Run("unsupported", func(t *testing.T) {
+		os.Setenv("VAULT_AUTH_METHOD", "ldap")
+		_, err := NewFromEnvironment()
+		assert.Error(t, err)
+	})
+}
+
+func TestLoginTimeout(t *testing.T) {
+	slow := AuthenticatorFunc(func(ctx context.Context, c *api.Client) (*api.Secret, error) {
+		if _, ok := ctx.Deadline(); !ok {
+			return nil, errors.New("login without deadline")
+		}
+		select {
+		case <-ctx.Done():
+			return nil, ctx.Err()
+		case <-time.After(50 * time.Millisecond):
+		}
+		return &api.Secret{Auth: &api.SecretAuth{ClientToken: "custom"}}, nil
+	})
+
+	t.Run("login within timeout", func(t *testing.T) {
+		v, err := New(WithTokenStore(&MemoryStore{}), WithAuthenticator(slow), WithLoginTimeout(time.Second))
+		require.NoError(t, err)
+		token, err := v.Authenticate()
+		require.NoError(t, err)
+		assert.Equal(t, "custom", token)
+	})
+
+	t.Run("login exceeds timeout", func(t *testing.T) {
+		v, err := New(WithTokenStore(&MemoryStore{}), WithAuthenticator(slow), WithLoginTimeout(10*time.Millisecond))
+		require.NoError(t, err)
+		_, err = v.Authenticate()
+		assert.Equal(t, context.DeadlineExceeded, errors.Cause(err))
+	})
+
+	t.Run("negative timeout", func(t *testing.T) {
+		_, err := New(WithTokenStore(&MemoryStore{}), WithLoginTimeout(-time.Second))
+		assert.Error(t, err)
+	})
+}
+
+func TestDiagnose(t *testing.T) {
+	defer func(f func(context.Context, *api.Client, string) (int, error)) { vaultHealth = f }(vaultHealth)
+	defer func(f func(context.Context, *api.Client) (*api.Secret, error)) { vaultAuthMounts = f }(vaultAuthMounts)
+	defer func(f func(context.Context, *api.Client) vaultLogicalWriter) { vaultLogical = f }(vaultLogical)
+	dir, err := ioutil.TempDir("", "diagnose")
+	require.NoError(t, err)
+	defer os.RemoveAll(dir)
+	claims := base64.RawURLEncoding.EncodeToString([]byte(`{"sub":"system:serviceaccount:default:app","aud":["vault"]}`))
+	jwt := "header." + claims + ".signature"
+	saToken := filepath.Join(dir, "sa-token")
+	require.NoError(t, ioutil.WriteFile(saToken, []byte(jwt), 0600))
+	vaultLogical = func(ctx context.Context, c *api.Client) vaultLogicalWriter {
+		return &jwtWriter{jwt: jwt}
+	}
+	vaultAuthMounts = func(ctx context.Context, c *api.Client) (*api.Secret, error) {
+		return nil, errors.New("Code: 403. Errors: permission denied")
+	}
+	status := func(d *Diagnosis) map[string]string {
+		m := map[string]string{}
+		for _, c := range d.Checks {
+			m[c.Name] = c.Status
+		}
+		return m
+	}
+
+	t.Run("all preconditions met", func(t *testing.T) {
+		vaultHealth = func(ctx context.Context, c *api.Client, address string) (int, error) {
+			return http.StatusOK, nil
+		}
+		v, err := New(WithTokenPath(filepath.Join(dir, "token")), WithServiceAccountTokenPath(saToken), WithRole("app"))
+		require.NoError(t, err)
+		d := v.Diagnose(context.Background())
+		require.NoError(t, d.Err(), d.String())
+		assert.Equal(t, map[string]string{
+			"service account token": DiagnosisOK,
+			"vault reachable":       DiagnosisOK,
+			"auth mount":            DiagnosisSkipped,
+			"login":                 DiagnosisOK,
+			"token store":           DiagnosisOK,
+		}, status(d))
+		assert.Contains(t, d.String(), "system:serviceaccount:default:app")
+		_, err = v.LoadToken()
+		assert.Error(t, err)
+	})
+
+	t.Run("sealed vault and invalid service account token", func(t *testing.T) {
+		vaultHealth = func(ctx context.Context, c *api.Client, address string) (int, error) {
+			return http.StatusServiceUnavailable, nil
+		}
+		invalid := filepath.Join(dir, "invalid")
+		require.NoError(t, ioutil.WriteFile(invalid, []byte("not-a-jwt"), 0600))
+		v, err := New(WithTokenPath(filepath.Join(dir, "missing", "token")), WithServiceAccountTokenPath(invalid), WithRole("app"))
+		require.NoError(t, err)
+		d := v.Diagnose(context.Background())
+		assert.Error(t, d.Err())
+		assert.Equal(t, map[string]string{
+			"service account token": DiagnosisFailed,
+			"vault reachable":       DiagnosisFailed,
+			"auth mount":            DiagnosisSkipped,
+			"login":                 DiagnosisSkipped,
+			"token store":           DiagnosisFailed,
+		}, status(d))
+	})
+
+	t.Run("approle login is not spent", func(t *testing.T) {
+		vaultHealth = func(ctx context.Context, c *api.Client, address string) (int, error) {
+			return http.StatusOK, nil
+		}
+		vaultLogical = func(ctx context.Context, c *api.Client) vaultLogicalWriter {
+			t.Fatal("unexpected login")
+			return nil
+		}
+		v, err := New(WithTokenPath(filepath.Join(dir, "token")), WithAppRole(&AppRole{RoleID: "role", SecretID: "secret"}))
+		require.NoError(t, err)
+		d := v.Diagnose(context.Background())
+		require.NoError(t, d.Err(), d.String())
+		assert.Equal(t, DiagnosisSkipped, status(d)["login"])
+	})
+}
+
+func TestWatcherEvents(t *testing.T) {
+	defer func(f func(context.Context, *api.Client) (*api.Secret, error)) { vaultLookupSelf = f }(vaultLookupSelf)
+	vaultLookupSelf = func(ctx context.Context, c *api.Client) (*api.Secret, error) {
+		return &api.Secret{Data: map[string]interface{}{"ttl": json.Number("0"), "renewable": false}}, nil
+	}
+	a := AuthenticatorFunc(func(ctx context.Context, c *api.Client) (*api.Secret, error) {
+		return &api.Secret{Auth: &api.SecretAuth{ClientToken: "custom", LeaseDuration: 3600}}, nil
+	})
+	v, err := New(WithTokenStore(&MemoryStore{}), WithAuthenticator(a), WithReAuth(true), WithTokenCheckInterval(5*time.Millisecond))
+	require.NoError(t, err)
+	w := v.NewWatcher()
+	events := v.Events()
+	ctx, cancel := context.WithCancel(context.Background())
+	errc := make(chan error, 1)
+	go func() { errc <- w.Run(ctx) }()
+
+	e := <-w.Events()
+	assert.Equal(t, EventAuthenticated, e.Type)
+	assert.Equal(t, "custom", e.Token)
+	assert.Equal(t, time.Hour, e.TTL)
+	assert.Equal(t, EventStored, (<-w.Events()).Type)
+	require.NoError(t, v.StoreToken("replaced"))
+	e = <-w.Events()
+	assert.Equal(t, EventStored, e.Type)
+	assert.Equal(t, "custom", e.Token)
+	cancel()
+	require.NoError(t, <-errc)
+	// the Vault sends the same events
+	for _, typ := range []EventType{EventAuthenticated, EventStored, EventStored} {
+		assert.Equal(t, typ, (<-events).Type)
+	}
+}
+
+func TestMultiStore(t *testing.T) {
+	dir, err := ioutil.TempDir("", "multistore")
+	require.NoError(t, err)
+	defer os.RemoveAll(dir)
+	file := FileStore(filepath.Join(dir, "token"))
+	broken := FileStore(filepath.Join(dir, "missing", "token"))
+	mem := &MemoryStore{}
+
+	t.Run("all sinks updated", func(t *testing.T) {
+		v, err := New(WithTokenSinks(Sink{TokenStore: file}, Sink{TokenStore: mem}))
+		require.NoError(t, err)
+		require.NoError(t, v.StoreToken("s.token"))
+		for _, s := range []TokenStore{file, mem} {
+			token, err := s.Load()
+			require.NoError(t, err)
+			assert.Equal(t, "s.token", token)
+		}
+		token, err := v.LoadToken()
+		require.NoError(t, err)
+		assert.Equal(t, "s.token", token)
+	})
+
+	t.Run("optional sink fails", func(t *testing.T) {
+		var failed []Sink
+		m := &MultiStore{
+			Sinks:   []Sink{{TokenStore: broken, Optional: true}, {TokenStore: mem}},
+			OnError: func(s Sink, err error) { failed = append(failed, s) },
+		}
+		require.NoError(t, m.Store("s.other"))
+		require.Len(t, failed, 1)
+		assert.Equal(t, broken, failed[0].TokenStore)
+		token, err := m.Load()
+		require.NoError(t, err)
+		assert.Equal(t, "s.other", token)
+	})
+
+	t.Run("required sink fails", func(t *testing.T) {
+		m := &MultiStore{Sinks: []Sink{{TokenStore: broken}, {TokenStore: mem}}}
+		assert.Error(t, m.Store("s.third"))
+		token, err := mem.Load()
+		require.NoError(t, err)
+		assert.Equal(t, "s.third", token)
+	})
+
+	t.Run("no sinks", func(t *testing.T) {
+		_, err := New(WithTokenSinks())
+		assert.Error(t, err)
+	})
+}
+
+func TestLockedStore(t *testing.T) {
+	l := &LockedStore{}
+	_, err := l.Load()
+	assert.Error(t, err)
+	require.NoError(t, l.Store("s.second"))
+	buf := l.buf
+	assert.Equal(t, os.Getpagesize(), len(buf))
+	require.NoError(t, l.Store("s.x"))
+	assert.True(t, &buf[0] == &l.buf[0], "buffer is not reused")
+	assert.Equal(t, []byte("s.x\x00\x00\x00\x00\x00"), l.buf[:len("s.second")])
+	token, err := l.Load()
+	require.NoError(t, err)
+	assert.Equal(t, "s.x", token)
+	long := strings.Repeat("x", os.Getpagesize()+1)
+	require.NoError(t, l.Store(long))
+	assert.Equal(t, 2*os.Getpagesize(), len(l.buf))
+	token, err = l.Load()
+	require.NoError(t, err)
+	assert.Equal(t, long, token)
+	require.NoError(t, l.Close())
+	assert.Nil(t, l.buf)
+	_, err = l.Load()
+	assert.Error(t, err)
+	require.NoError(t, l.Store("s.third"))
+	require.NoError(t, l.Close())
+}
+
+type secretWriter struct {
+	jwt  secretBytes
+	sent string
+}
+
+func (w *secretWriter) Write(p string, data map[string]interface{}) (*api.Secret, error) {
+	if jwt, ok := data["jwt"].(secretBytes); ok {
+		w.jwt, w.sent = jwt, string(jwt)
+	}
+	return &api.Secret{Auth: &api.SecretAuth{ClientToken: rootToken, LeaseDuration: 60}}, nil
+}
+
+func TestLockedToken(t *testing.T) {
+	f, err := ioutil.TempFile("", "satoken")
+	require.NoError(t, err)
+	defer os.Remove(f.Name())
+	require.NoError(t, ioutil.WriteFile(f.Name(), []byte("header.claims.signature\n"), 0600))
+	defer func(f func(context.Context, *api.Client) vaultLogicalWriter) { vaultLogical = f }(vaultLogical)
+	w := &secretWriter{}
+	vaultLogical = func(ctx context.Context, c *api.Client) vaultLogicalWriter {
+		return w
+	}
+	v, err := New(WithLockedToken(), WithServiceAccountTokenPath(f.Name()))
+	require.NoError(t, err)
+	assert.IsType(t, &LockedStore{}, v.TokenStore)
+	events := v.Events()
+
+	token, err := v.Authenticate()
+	require.NoError(t, err)
+	assert.Equal(t, rootToken, token)
+	assert.Equal(t, "header.claims.signature", w.sent)
+	assert.Equal(t, make(secretBytes, len(w.jwt)), w.jwt)
+	info := v.LastAuth()
+	require.NotNil(t, info)
+	assert.Empty(t, info.Token)
+	assert.Equal(t, time.Minute, info.LeaseDuration)
+
+	require.NoError(t, v.StoreToken(token))
+	stored, err := v.LoadToken()
+	require.NoError(t, err)
+	assert.Equal(t, rootToken, stored)
+	v.emit(nil, Event{Type: EventRenewed, Token: rootToken})
+	e := <-events
+	assert.Equal(t, EventRenewed, e.Type)
+	assert.Empty(t, e.Token)
+
+	require.NoError(t, v.revoke(context.Background()))
+	assert.Empty(t, v.client.Token())
+	require.NoError(t, v.Close(context.Background()))
+	_, err = v.LoadToken()
+	assert.Error(t, err)
+}
+
+func TestSecretBody(t *testing.T) {
+	body, err := secretBody(map[string]interface{}{"role": "app", "jwt": secretBytes("a.b.c")})
+	require.NoError(t, err)
+	assert.Equal(t, len(body), cap(body))
+	decoded := map[string]interface{}{}
+	require.NoError(t, json.Unmarshal(body, &decoded))
+	assert.Equal(t, map[string]interface{}{"role": "app", "jwt": "a.b.c"}, decoded)
+	_, err = secretBody(map[string]interface{}{"jwt": secretBytes(`a"b`)})
+	assert.Error(t, err)
+}
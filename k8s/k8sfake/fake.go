@@ -0,0 +1,264 @@
+// Package k8sfake provides a fake of k8s.Vault with scripted logins to test applications without
+// a Vault server
+package k8sfake
+
+import (
+	"context"
+	"sync"
+	"time"
+
+	"github.com/hashicorp/vault/api"
+	"github.com/pkg/errors"
+	"github.com/postfinance/vault/k8s"
+)
+
+// Login is a scripted response of a login, a login with Err fails
+type Login struct {
+	Token     string
+	Accessor  string
+	Policies  []string
+	TTL       time.Duration
+	Renewable bool
+	Err       error
+}
+
+// Vault is a fake of k8s.Vault, the logins return the scripted responses in order and the last
+// response is repeated
+// Run stores the token and waits until it expires, either after its TTL or when Expire is called,
+// then it logs in again if ReAuth is true.
+type Vault struct {
+	// ReAuth lets Run log in again when the token expired
+	ReAuth bool
+
+	mu        sync.Mutex
+	logins    []Login
+	count     int
+	token     string
+	expires   time.Time
+	info      *k8s.AuthInfo
+	expired   chan struct{}
+	closed    bool
+	done      chan struct{}
+	callbacks []k8s.TokenCallback
+}
+
+var _ k8s.TokenProvider = (*Vault)(nil)
+
+// New returns a fake Vault with the scripted logins
+func New(logins ...Login) *Vault {
+	return &Vault{
+		logins:  logins,
+		expired: make(chan struct{}),
+		done:    make(chan struct{}),
+	}
+}
+
+// AddLogins appends scripted logins
+func (f *Vault) AddLogins(logins ...Login) {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+	f.logins = append(f.logins, logins...)
+}
+
+// Logins returns the number of logins
+func (f *Vault) Logins() int {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+	return f.count
+}
+
+// Expire expires the stored token
+func (f *Vault) Expire() {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+	f.expire()
+}
+
+// expire expires the stored token, f.mu must be held
+func (f *Vault) expire() {
+	f.expires = time.Now()
+	close(f.expired)
+	f.expired = make(chan struct{})
+}
+
+// Authenticate returns the token of the next scripted login
+func (f *Vault) Authenticate() (string, error) {
+	return f.AuthenticateWithContext(context.Background())
+}
+
+// AuthenticateWithContext returns the token of the next scripted login
+func (f *Vault) AuthenticateWithContext(ctx context.Context) (string, error) {
+	if err := ctx.Err(); err != nil {
+		return "", err
+	}
+	f.mu.Lock()
+	if len(f.logins) == 0 {
+		f.mu.Unlock()
+		return "", errors.New("no scripted login")
+	}
+	l := f.logins[0]
+	if len(f.logins) > 1 {
+		f.logins = f.logins[1:]
+	}
+	f.count++
+	if l.Err != nil {
+		f.mu.Unlock()
+		return "", l.Err
+	}
+	f.info = &k8s.AuthInfo{
+		Token:         l.Token,
+		Accessor:      l.Accessor,
+		Policies:      l.Policies,
+		TokenPolicies: l.Policies,
+		LeaseDuration: l.TTL,
+		Renewable:     l.Renewable,
+	}
+	callbacks := f.callbacks
+	f.mu.Unlock()
+	auth := &api.SecretAuth{
+		ClientToken:   l.Token,
+		Accessor:      l.Accessor,
+		Policies:      l.Policies,
+		TokenPolicies: l.Policies,
+		LeaseDuration: int(l.TTL.Seconds()),
+		Renewable:     l.Renewable,
+	}
+	for _, cb := range callbacks {
+		cb(l.Token, auth)
+	}
+	return l.Token, nil
+}
+
+// GetToken returns the stored token if it is not expired, otherwise the token of a new login
+func (f *Vault) GetToken() (string, error) {
+	return f.GetTokenWithContext(context.Background())
+}
+
+// GetTokenWithContext returns the stored token if it is not expired, otherwise the token of a new
+// login which is stored
+func (f *Vault) GetTokenWithContext(ctx context.Context) (string, error) {
+	f.mu.Lock()
+	token, valid := f.token, f.valid()
+	f.mu.Unlock()
+	if token != "" && valid {
+		return token, nil
+	}
+	token, err := f.AuthenticateWithContext(ctx)
+	if err != nil {
+		return "", err
+	}
+	f.store(token)
+	return token, nil
+}
+
+// valid returns true if the stored token is not expired, f.mu must be held
+func (f *Vault) valid() bool {
+	return f.expires.IsZero() || time.Now().Before(f.expires)
+}
+
+// store stores token with the TTL of the last login
+func (f *Vault) store(token string) {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+	f.token, f.expires = token, time.Time{}
+	if f.info != nil && f.info.Token == token && f.info.LeaseDuration > 0 {
+		f.expires = time.Now().Add(f.info.LeaseDuration)
+	}
+}
+
+// LoadToken returns the stored token
+func (f *Vault) LoadToken() (string, error) {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+	if f.token == "" {
+		return "", errors.New("no token stored")
+	}
+	return f.token, nil
+}
+
+// StoreToken stores token without expiry
+func (f *Vault) StoreToken(token string) error {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+	f.token, f.expires = token, time.Time{}
+	return nil
+}
+
+// LastAuth returns the AuthInfo of the last successful login, nil before
+func (f *Vault) LastAuth() *k8s.AuthInfo {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+	if f.info == nil {
+		return nil
+	}
+	info := *f.info
+	return &info
+}
+
+// RegisterTokenCallback registers cb to be called after every successful login
+func (f *Vault) RegisterTokenCallback(cb k8s.TokenCallback) {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+	f.callbacks = append(f.callbacks, cb)
+}
+
+// Run gets and stores a token and waits until it expires, then it logs in again if ReAuth is true,
+// otherwise an error is returned
+// Run returns nil when ctx is done or the Vault is closed.
+func (f *Vault) Run(ctx context.Context) error {
+	f.mu.Lock()
+	closed := f.closed
+	f.mu.Unlock()
+	if closed {
+		return k8s.ErrClosed
+	}
+	token, err := f.GetTokenWithContext(ctx)
+	if err != nil {
+		return err
+	}
+	for {
+		f.mu.Lock()
+		if f.closed {
+			f.mu.Unlock()
+			return nil
+		}
+		expired, done := f.expired, f.done
+		t := time.NewTimer(time.Until(f.expires))
+		if f.expires.IsZero() {
+			t.Stop()
+		}
+		f.mu.Unlock()
+		select {
+		case <-ctx.Done():
+			t.Stop()
+			return nil
+		case <-done:
+			t.Stop()
+			return nil
+		case <-expired:
+			t.Stop()
+		case <-t.C:
+		}
+		if !f.ReAuth {
+			return errors.New("token renewal stopped")
+		}
+		if token, err = f.AuthenticateWithContext(ctx); err != nil {
+			if ctx.Err() != nil {
+				return nil
+			}
+			return err
+		}
+		f.store(token)
+	}
+}
+
+// Close stops Run, a Run started after Close returns k8s.ErrClosed
+func (f *Vault) Close(ctx context.Context) error {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+	if !f.closed {
+		f.closed = true
+		close(f.done)
+	}
+	return nil
+}
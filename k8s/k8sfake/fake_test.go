@@ -0,0 +1,60 @@
+package k8sfake
+
+import (
+	"context"
+	"testing"
+	"time"
+
+	"github.com/hashicorp/vault/api"
+	"github.com/pkg/errors"
+	"github.com/postfinance/vault/k8s"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestFake(t *testing.T) {
+	t.Run("scripted logins", func(t *testing.T) {
+		f := New(Login{Err: &k8s.AuthError{Kind: k8s.ErrVaultSealed, Err: errors.New("sealed")}}, Login{Token: "t1", TTL: time.Hour})
+		_, err := f.Authenticate()
+		assert.Equal(t, k8s.ErrVaultSealed, k8s.AuthErrorKind(err))
+		token, err := f.GetToken()
+		require.NoError(t, err)
+		assert.Equal(t, "t1", token)
+		token, err = f.GetToken()
+		require.NoError(t, err)
+		assert.Equal(t, "t1", token)
+		assert.Equal(t, 2, f.Logins())
+		require.NotNil(t, f.LastAuth())
+		assert.Equal(t, time.Hour, f.LastAuth().LeaseDuration)
+	})
+
+	t.Run("run with expiry", func(t *testing.T) {
+		f := New(Login{Token: "t1", TTL: time.Hour}, Login{Token: "t2", TTL: 20 * time.Millisecond}, Login{Token: "t3", TTL: time.Hour})
+		f.ReAuth = true
+		tokens := make(chan string, 3)
+		f.RegisterTokenCallback(func(token string, auth *api.SecretAuth) {
+			tokens <- token
+		})
+		errCh := make(chan error)
+		go func() {
+			errCh <- f.Run(context.Background())
+		}()
+		assert.Equal(t, "t1", <-tokens)
+		f.Expire()
+		assert.Equal(t, "t2", <-tokens)
+		// t2 expires after its TTL
+		assert.Equal(t, "t3", <-tokens)
+		require.NoError(t, f.Close(context.Background()))
+		assert.NoError(t, <-errCh)
+		token, err := f.LoadToken()
+		require.NoError(t, err)
+		assert.Equal(t, "t3", token)
+		assert.Equal(t, k8s.ErrClosed, f.Run(context.Background()))
+	})
+
+	t.Run("run without reauth", func(t *testing.T) {
+		f := New(Login{Token: "t1", TTL: 10 * time.Millisecond})
+		assert.Error(t, f.Run(context.Background()))
+		assert.Equal(t, 1, f.Logins())
+	})
+}
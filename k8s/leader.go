@@ -0,0 +1,192 @@
+package k8s
+
+import (
+	"context"
+	"os"
+	"sync"
+	"time"
+
+	"github.com/pkg/errors"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/client-go/kubernetes"
+	"k8s.io/client-go/tools/leaderelection"
+	"k8s.io/client-go/tools/leaderelection/resourcelock"
+)
+
+// Defaults of LeaderElection
+const (
+	DefaultLeaseDuration    = 15 * time.Second
+	DefaultLeaseRetryPeriod = 2 * time.Second
+)
+
+// LeaderElection elects the replica which gets, stores and renews the token in Run with a Lease of
+// the coordination.k8s.io/v1 API, e.g. for the replicas of a Deployment writing the same token
+// The requests are authenticated with the mounted token of ServiceAccountTokenPath, the service
+// account needs the permission to get, create and update the Lease.
+type LeaderElection struct {
+	// Lease is the name of the Lease
+	Lease string `yaml:"lease"`
+	// Namespace of the Lease, if empty the namespace of the pod is used
+	Namespace string `yaml:"namespace"`
+	// Identity of the replica, if empty the hostname (i.e. the pod name) is used
+	Identity string `yaml:"identity"`
+	// LeaseDuration is the time the other replicas wait before they take over a Lease which is not
+	// renewed, 0 uses DefaultLeaseDuration
+	LeaseDuration time.Duration `yaml:"leaseDuration"`
+	// RetryPeriod between the attempts to acquire or renew the Lease, 0 uses DefaultLeaseRetryPeriod
+	RetryPeriod time.Duration `yaml:"retryPeriod"`
+
+	// clientset of the API server, set by tests
+	clientset kubernetes.Interface
+}
+
+// validate checks the LeaderElection
+func (le *LeaderElection) validate() error {
+	if le.Lease == "" {
+		return errors.New("missing leader election lease")
+	}
+	if le.LeaseDuration < 0 || le.RetryPeriod < 0 {
+		return errors.New("negative leader election duration")
+	}
+	if le.renewDeadline() <= time.Duration(leaderelection.JitterFactor*float64(le.retryPeriod())) {
+		return errors.Errorf("leader election lease duration %s is too short for the retry period %s", le.leaseDuration(), le.retryPeriod())
+	}
+	return nil
+}
+
+func (le *LeaderElection) leaseDuration() time.Duration {
+	if le.LeaseDuration > 0 {
+		return le.LeaseDuration
+	}
+	return DefaultLeaseDuration
+}
+
+func (le *LeaderElection) retryPeriod() time.Duration {
+	if le.RetryPeriod > 0 {
+		return le.RetryPeriod
+	}
+	return DefaultLeaseRetryPeriod
+}
+
+// renewDeadline is the time the leader retries to renew the Lease before it gives up the leadership
+func (le *LeaderElection) renewDeadline() time.Duration {
+	return le.leaseDuration() * 2 / 3
+}
+
+// init sets the defaults of the in-cluster configuration
+func (le *LeaderElection) init(v *Vault) error {
+	if le.Identity == "" {
+		name, err := os.Hostname()
+		if err != nil {
+			return errors.Wrap(err, "failed to get leader election identity")
+		}
+		le.Identity = name
+	}
+	if le.Namespace == "" {
+		ns, err := podNamespace()
+		if err != nil {
+			return err
+		}
+		le.Namespace = ns
+	}
+	if le.clientset == nil {
+		config, err := inClusterConfig(v.ServiceAccountTokenPath)
+		if err != nil {
+			return err
+		}
+		if le.clientset, err = kubernetes.NewForConfig(config); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// lead calls f while the replica is the leader, f gets a context which is canceled if the
+// leadership is lost and the replica stands by again
+// The Lease is released when ctx is done or f returns an error.
+func (le *LeaderElection) lead(ctx context.Context, v *Vault, f func(context.Context) error) error {
+	if err := le.init(v); err != nil {
+		return err
+	}
+	for {
+		v.log().Info("waiting for leadership", "lease", le.Lease, "identity", le.Identity)
+		term := &leadership{finished: make(chan struct{})}
+		runCtx, cancel := context.WithCancel(ctx)
+		elector, err := leaderelection.NewLeaderElector(leaderelection.LeaderElectionConfig{
+			Lock: &resourcelock.LeaseLock{
+				LeaseMeta:  metav1.ObjectMeta{Name: le.Lease, Namespace: le.Namespace},
+				Client:     le.clientset.CoordinationV1(),
+				LockConfig: resourcelock.ResourceLockConfig{Identity: le.Identity},
+			},
+			LeaseDuration:   le.leaseDuration(),
+			RenewDeadline:   le.renewDeadline(),
+			RetryPeriod:     le.retryPeriod(),
+			ReleaseOnCancel: true,
+			Name:            le.Lease,
+			Callbacks: leaderelection.LeaderCallbacks{
+				OnStartedLeading: func(leadCtx context.Context) {
+					if !term.start() {
+						return
+					}
+					defer close(term.finished)
+					v.log().Info("leadership acquired", "lease", le.Lease, "identity", le.Identity)
+					term.err = f(leadCtx)
+					term.done = leadCtx.Err() == nil
+					// stops the renewal and releases the Lease
+					cancel()
+				},
+				OnStoppedLeading: func() {},
+			},
+		})
+		if err != nil {
+			cancel()
+			return err
+		}
+		elector.Run(runCtx)
+		cancel()
+		if !term.stop() {
+			// ctx is done before the Lease was acquired
+			return nil
+		}
+		<-term.finished
+		switch {
+		case ctx.Err() != nil:
+			return nil
+		case term.done:
+			return term.err
+		}
+		v.log().Info("leadership lost", "lease", le.Lease, "identity", le.Identity)
+	}
+}
+
+// leadership is a term of the leader, the callback of client-go starts it asynchronously and may
+// start it after the elector already stopped
+type leadership struct {
+	mu      sync.Mutex
+	started bool
+	stopped bool
+	// finished is closed when f returns
+	finished chan struct{}
+	// err of f, done is true if f returned before the leadership was lost
+	err  error
+	done bool
+}
+
+// start returns false if the term is already stopped
+func (l *leadership) start() bool {
+	l.mu.Lock()
+	defer l.mu.Unlock()
+	if l.stopped {
+		return false
+	}
+	l.started = true
+	return true
+}
+
+// stop stops the term and returns true if it was started
+func (l *leadership) stop() bool {
+	l.mu.Lock()
+	defer l.mu.Unlock()
+	l.stopped = true
+	return l.started
+}
@@ -0,0 +1,16 @@
+//go:build !(linux || darwin || freebsd || netbsd || openbsd || dragonfly)
+// +build !linux,!darwin,!freebsd,!netbsd,!openbsd,!dragonfly
+
+package k8s
+
+import "os"
+
+// lockFile does not lock on systems without flock, e.g. windows
+func lockFile(f *os.File, exclusive bool) error {
+	return nil
+}
+
+// unlockFile does nothing on systems without flock
+func unlockFile(f *os.File) error {
+	return nil
+}
@@ -0,0 +1,84 @@
+package k8s
+
+import (
+	"fmt"
+	"os"
+	"sync"
+
+	"github.com/pkg/errors"
+)
+
+// LockedStore keeps the token in memory locked with mlock, so it is not written to swap, and zeroes
+// it when it is replaced and on Close, the zero value is ready to use
+// The token is kept in whole pages mapped for the store alone, which are locked once and reused for
+// every token that fits. Locking requires CAP_IPC_LOCK or a sufficient RLIMIT_MEMLOCK, Store fails
+// otherwise and on systems other than linux and darwin. The strings returned by Load are ordinary heap memory, see WithLockedToken for the
+// copies kept by the Vault.
+type LockedStore struct {
+	mu  sync.Mutex
+	buf []byte
+	n   int
+}
+
+// Store the token in the locked buffer and zero the previous one
+func (l *LockedStore) Store(token string) error {
+	l.mu.Lock()
+	defer l.mu.Unlock()
+	if len(token) > len(l.buf) {
+		buf, err := allocLocked(len(token))
+		if err != nil {
+			return errors.Wrap(err, "failed to lock token memory")
+		}
+		if err := l.release(); err != nil {
+			_ = freeLocked(buf)
+			return err
+		}
+		l.buf = buf
+	}
+	zero(l.buf[:l.n])
+	l.n = copy(l.buf, token)
+	return nil
+}
+
+// Load the token from the locked buffer
+func (l *LockedStore) Load() (string, error) {
+	l.mu.Lock()
+	defer l.mu.Unlock()
+	if l.n == 0 {
+		return "", fmt.Errorf("found empty token")
+	}
+	return string(l.buf[:l.n]), nil
+}
+
+// Close zeroes, unlocks and unmaps the buffer, a later Store maps a new one
+func (l *LockedStore) Close() error {
+	l.mu.Lock()
+	defer l.mu.Unlock()
+	return l.release()
+}
+
+// release zeroes and frees the buffer, l.mu must be held
+func (l *LockedStore) release() error {
+	if l.buf == nil {
+		return nil
+	}
+	err := freeLocked(l.buf)
+	l.buf, l.n = nil, 0
+	return errors.Wrap(err, "failed to unlock token memory")
+}
+
+// pageAlign rounds n up to whole pages, at least one page
+func pageAlign(n int) int {
+	size := os.Getpagesize()
+	if n <= size {
+		return size
+	}
+	return (n + size - 1) / size * size
+}
+
+// zero overwrites b with zeros
+func zero(b []byte) {
+	for i := range b {
+		b[i] = 0
+	}
+}
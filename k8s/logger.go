@@ -0,0 +1,23 @@
+package k8s
+
+// Logger receives structured events, keysAndValues are alternating keys and values
+// A *slog.Logger satisfies Logger, the Info method of a logr.Logger can be adapted with a small
+// wrapper.
+type Logger interface {
+	Debug(msg string, keysAndValues ...interface{})
+	Info(msg string, keysAndValues ...interface{})
+}
+
+// nopLogger discards all events
+type nopLogger struct{}
+
+func (nopLogger) Debug(msg string, keysAndValues ...interface{}) {}
+func (nopLogger) Info(msg string, keysAndValues ...interface{})  {}
+
+// log returns Logger or a Logger discarding the events
+func (v *Vault) log() Logger {
+	if v.Logger == nil {
+		return nopLogger{}
+	}
+	return v.Logger
+}
@@ -0,0 +1,138 @@
+package k8s
+
+import (
+	"context"
+	"encoding/json"
+	"strconv"
+	"time"
+
+	"github.com/hashicorp/vault/api"
+	"github.com/pkg/errors"
+)
+
+// DefaultRenewThreshold is the remaining TTL below which GetToken renews a loaded token
+const DefaultRenewThreshold = 5 * time.Minute
+
+// Defaults of tokens with limited uses
+const (
+	// DefaultMinTokenUses is the number of remaining uses at which a token is replaced
+	DefaultMinTokenUses = 1
+	// DefaultTokenUsesInterval is the interval Run checks the remaining uses of a token
+	DefaultTokenUsesInterval = time.Minute
+)
+
+// tokenInfo is the data of the lookup of a token
+type tokenInfo struct {
+	// ttl is the remaining TTL, 0 if the token does not expire
+	ttl       time.Duration
+	renewable bool
+	// batch tokens cannot be renewed
+	batch bool
+	// period of a periodic token, 0 if the token is not periodic
+	period time.Duration
+	// numUses is the number of remaining uses, 0 if the uses are not limited
+	numUses int
+}
+
+// usesExhausted returns true if the uses of the token are limited and at most min are left
+func (info tokenInfo) usesExhausted(min int) bool {
+	return info.numUses > 0 && info.numUses <= min
+}
+
+// parseTokenInfo returns the tokenInfo of the response of auth/token/lookup-self
+func parseTokenInfo(s *api.Secret) (tokenInfo, error) {
+	info := tokenInfo{}
+	if s == nil || s.Data == nil {
+		return info, errors.New("token lookup returned no data")
+	}
+	ttl, err := seconds(s.Data["ttl"])
+	if err != nil {
+		return info, errors.Wrap(err, "invalid ttl of token lookup")
+	}
+	info.ttl = ttl
+	period, err := seconds(s.Data["period"])
+	if err != nil {
+		return info, errors.Wrap(err, "invalid period of token lookup")
+	}
+	info.period = period
+	switch n := s.Data["num_uses"].(type) {
+	case json.Number:
+		uses, err := n.Int64()
+		if err != nil {
+			return info, errors.Wrap(err, "invalid num_uses of token lookup")
+		}
+		info.numUses = int(uses)
+	case float64:
+		info.numUses = int(n)
+	case int:
+		info.numUses = n
+	}
+	info.renewable, _ = s.Data["renewable"].(bool)
+	typ, _ := s.Data["type"].(string)
+	info.batch = typ == "batch"
+	if info.batch {
+		info.renewable = false
+	}
+	return info, nil
+}
+
+// lookup returns the tokenInfo of the token of the Vault client
+func (v *Vault) lookup(ctx context.Context) (tokenInfo, error) {
+	s, err := vaultLookupSelf(ctx, v.client)
+	if err != nil {
+		return tokenInfo{}, errors.Wrap(err, "failed to lookup token")
+	}
+	return parseTokenInfo(s)
+}
+
+// increment returns the increment in seconds of the renewal of a token, a periodic token is
+// renewed with its period because Vault ignores a different increment
+func (v *Vault) increment(info tokenInfo) int {
+	if info.period > 0 {
+		return int(info.period.Seconds())
+	}
+	return v.TTL
+}
+
+// seconds returns the duration of a number of seconds of a Vault response
+func seconds(v interface{}) (time.Duration, error) {
+	switch n := v.(type) {
+	case nil:
+		return 0, nil
+	case json.Number:
+		i, err := n.Int64()
+		return time.Duration(i) * time.Second, err
+	case float64:
+		return time.Duration(n * float64(time.Second)), nil
+	case int:
+		return time.Duration(n) * time.Second, nil
+	case string:
+		i, err := strconv.ParseInt(n, 10, 64)
+		return time.Duration(i) * time.Second, err
+	}
+	return 0, errors.Errorf("unexpected type %T", v)
+}
+
+// renewThreshold returns RenewThreshold or DefaultRenewThreshold
+func (v *Vault) renewThreshold() time.Duration {
+	if v.RenewThreshold > 0 {
+		return v.RenewThreshold
+	}
+	return DefaultRenewThreshold
+}
+
+// minTokenUses returns MinTokenUses or DefaultMinTokenUses
+func (v *Vault) minTokenUses() int {
+	if v.MinTokenUses > 0 {
+		return v.MinTokenUses
+	}
+	return DefaultMinTokenUses
+}
+
+// tokenUsesInterval returns TokenUsesInterval or DefaultTokenUsesInterval
+func (v *Vault) tokenUsesInterval() time.Duration {
+	if v.TokenUsesInterval > 0 {
+		return v.TokenUsesInterval
+	}
+	return DefaultTokenUsesInterval
+}
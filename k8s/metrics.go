@@ -0,0 +1,168 @@
+package k8s
+
+import (
+	"context"
+	"fmt"
+	"net"
+	"net/http"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/hashicorp/vault/api"
+	"github.com/pkg/errors"
+)
+
+// Metrics of the login and the renewal of a Vault, the zero value is ready to use
+// Metrics is an http.Handler serving the Prometheus text format, e.g. http.Handle("/metrics", m).
+type Metrics struct {
+	mu              sync.Mutex
+	loginAttempts   uint64
+	loginFailures   map[string]uint64
+	renewals        uint64
+	renewalFailures uint64
+	storeFailures   uint64
+	lastLogin       time.Time
+	expiry          time.Time
+}
+
+// reasons of failed logins
+const (
+	reasonCanceled         = "canceled"
+	reasonConnection       = "connection"
+	reasonPermissionDenied = "permission_denied"
+	reasonBadRequest       = "bad_request"
+	reasonServerError      = "server_error"
+	reasonOther            = "other"
+)
+
+// failureReason returns the reason label of a failed login
+func failureReason(err error) string {
+	cause := errors.Cause(err)
+	if cause == context.Canceled || cause == context.DeadlineExceeded {
+		return reasonCanceled
+	}
+	if _, ok := cause.(net.Error); ok {
+		return reasonConnection
+	}
+	if e, ok := cause.(*AuthError); ok {
+		return failureReason(e.Err)
+	}
+	if e, ok := cause.(*api.ResponseError); ok {
+		switch {
+		case e.StatusCode == http.StatusForbidden:
+			return reasonPermissionDenied
+		case e.StatusCode == http.StatusBadRequest:
+			return reasonBadRequest
+		case e.StatusCode >= http.StatusInternalServerError:
+			return reasonServerError
+		}
+		return reasonOther
+	}
+	msg := err.Error()
+	switch {
+	case strings.Contains(msg, "Code: 403"):
+		return reasonPermissionDenied
+	case strings.Contains(msg, "Code: 400"):
+		return reasonBadRequest
+	case strings.Contains(msg, "Code: 5"):
+		return reasonServerError
+	}
+	return reasonOther
+}
+
+func (m *Metrics) loginAttempt() {
+	if m == nil {
+		return
+	}
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	m.loginAttempts++
+}
+
+func (m *Metrics) loginFailure(err error) {
+	if m == nil {
+		return
+	}
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	if m.loginFailures == nil {
+		m.loginFailures = make(map[string]uint64)
+	}
+	m.loginFailures[failureReason(err)]++
+}
+
+func (m *Metrics) loginSuccess(ttl time.Duration) {
+	if m == nil {
+		return
+	}
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	m.lastLogin = time.Now()
+	m.expiry = m.lastLogin.Add(ttl)
+}
+
+func (m *Metrics) renewal(ttl time.Duration) {
+	if m == nil {
+		return
+	}
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	m.renewals++
+	m.expiry = time.Now().Add(ttl)
+}
+
+func (m *Metrics) renewalFailure() {
+	if m == nil {
+		return
+	}
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	m.renewalFailures++
+}
+
+func (m *Metrics) storeFailure() {
+	if m == nil {
+		return
+	}
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	m.storeFailures++
+}
+
+// ServeHTTP writes the metrics in the Prometheus text format
+func (m *Metrics) ServeHTTP(w http.ResponseWriter, r *http.Request) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	w.Header().Set("Content-Type", "text/plain; version=0.0.4")
+	metric := func(name, typ, help string) {
+		fmt.Fprintf(w, "# HELP %s %s\n# TYPE %s %s\n", name, help, name, typ)
+	}
+	metric("vault_k8s_login_attempts_total", "counter", "Number of logins to Vault.")
+	fmt.Fprintf(w, "vault_k8s_login_attempts_total %d\n", m.loginAttempts)
+	metric("vault_k8s_login_failures_total", "counter", "Number of failed logins to Vault by reason.")
+	for _, reason := range []string{reasonBadRequest, reasonCanceled, reasonConnection, reasonOther, reasonPermissionDenied, reasonServerError} {
+		fmt.Fprintf(w, "vault_k8s_login_failures_total{reason=%q} %d\n", reason, m.loginFailures[reason])
+	}
+	metric("vault_k8s_renewals_total", "counter", "Number of token renewals.")
+	fmt.Fprintf(w, "vault_k8s_renewals_total %d\n", m.renewals)
+	metric("vault_k8s_renewal_failures_total", "counter", "Number of stopped token renewals.")
+	fmt.Fprintf(w, "vault_k8s_renewal_failures_total %d\n", m.renewalFailures)
+	metric("vault_k8s_token_store_failures_total", "counter", "Number of failures to store the token.")
+	fmt.Fprintf(w, "vault_k8s_token_store_failures_total %d\n", m.storeFailures)
+	metric("vault_k8s_token_ttl_seconds", "gauge", "Remaining TTL of the token.")
+	ttl := 0.0
+	if !m.expiry.IsZero() {
+		ttl = time.Until(m.expiry).Seconds()
+		if ttl < 0 {
+			ttl = 0
+		}
+	}
+	fmt.Fprintf(w, "vault_k8s_token_ttl_seconds %.3f\n", ttl)
+	metric("vault_k8s_last_login_success_timestamp_seconds", "gauge", "Unix time of the last successful login, 0 if none.")
+	last := 0.0
+	if !m.lastLogin.IsZero() {
+		last = float64(m.lastLogin.UnixNano()) / 1e9
+	}
+	fmt.Fprintf(w, "vault_k8s_last_login_success_timestamp_seconds %.3f\n", last)
+}
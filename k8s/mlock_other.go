@@ -0,0 +1,22 @@
+//go:build !(linux || darwin)
+// +build !linux,!darwin
+
+package k8s
+
+import (
+	"runtime"
+
+	"github.com/pkg/errors"
+)
+
+// allocLocked returns an error on systems without mlock in syscall, memory that cannot be locked
+// is not used silently
+func allocLocked(n int) ([]byte, error) {
+	return nil, errors.Errorf("locking memory is not supported on %s", runtime.GOOS)
+}
+
+// freeLocked zeroes b of allocLocked
+func freeLocked(b []byte) error {
+	zero(b)
+	return nil
+}
@@ -0,0 +1,29 @@
+//go:build linux || darwin
+// +build linux darwin
+
+package k8s
+
+import "syscall"
+
+// allocLocked maps n bytes rounded up to whole pages and locks them with mlock, the pages are not
+// shared with other memory and are not swapped
+func allocLocked(n int) ([]byte, error) {
+	b, err := syscall.Mmap(-1, 0, pageAlign(n), syscall.PROT_READ|syscall.PROT_WRITE, syscall.MAP_ANON|syscall.MAP_PRIVATE)
+	if err != nil {
+		return nil, err
+	}
+	if err := syscall.Mlock(b); err != nil {
+		_ = syscall.Munmap(b)
+		return nil, err
+	}
+	return b, nil
+}
+
+// freeLocked zeroes, unlocks and unmaps b of allocLocked
+func freeLocked(b []byte) error {
+	zero(b)
+	if err := syscall.Munlock(b); err != nil {
+		return err
+	}
+	return syscall.Munmap(b)
+}
@@ -0,0 +1,75 @@
+package k8s
+
+import (
+	"fmt"
+	"io"
+	"strings"
+
+	"github.com/pkg/errors"
+)
+
+// Sink is a TokenStore of a MultiStore
+type Sink struct {
+	TokenStore
+	// Optional sinks do not fail MultiStore.Store, their errors are only passed to OnError
+	Optional bool
+}
+
+// MultiStore stores the token in all of its sinks, e.g. a FileStore for consumers reading the
+// token file and a MemoryStore for the process
+// Load returns the token of the first sink which has one.
+type MultiStore struct {
+	Sinks []Sink
+	// OnError is called with every sink which failed to store the token, it may be nil
+	OnError func(s Sink, err error)
+}
+
+// Store the token in all sinks, the failure of a sink does not prevent storing it in the others
+// An error is returned if a sink which is not optional failed.
+func (m *MultiStore) Store(token string) error {
+	var msgs []string
+	for _, s := range m.Sinks {
+		err := s.Store(token)
+		if err == nil {
+			continue
+		}
+		if m.OnError != nil {
+			m.OnError(s, err)
+		}
+		if !s.Optional {
+			msgs = append(msgs, err.Error())
+		}
+	}
+	if len(msgs) > 0 {
+		return errors.Errorf("failed to store token in %d of %d sinks: %s", len(msgs), len(m.Sinks), strings.Join(msgs, "; "))
+	}
+	return nil
+}
+
+// Load the token of the first sink which has one
+func (m *MultiStore) Load() (string, error) {
+	if len(m.Sinks) == 0 {
+		return "", fmt.Errorf("no token sink")
+	}
+	var err error
+	for _, s := range m.Sinks {
+		var token string
+		if token, err = s.Load(); err == nil {
+			return token, nil
+		}
+	}
+	return "", err
+}
+
+// Close closes the sinks implementing io.Closer
+func (m *MultiStore) Close() error {
+	var err error
+	for _, s := range m.Sinks {
+		if c, ok := s.TokenStore.(io.Closer); ok {
+			if cerr := c.Close(); cerr != nil && err == nil {
+				err = cerr
+			}
+		}
+	}
+	return err
+}
@@ -0,0 +1,537 @@
+package k8s
+
+import (
+	"fmt"
+	"strings"
+	"time"
+
+	"github.com/hashicorp/vault/api"
+	"github.com/pkg/errors"
+)
+
+// Option configures a Vault
+type Option func(*Vault) error
+
+// New returns a Vault configured with the options opts
+// Without WithClient a Vault client is created from the VAULT_* environment variables.
+func New(opts ...Option) (*Vault, error) {
+	v := &Vault{
+		AuthMountPath:           FixAuthMountPath(AuthMountPath),
+		ServiceAccountTokenPath: ServiceAccountTokenPath,
+	}
+	for _, opt := range opts {
+		if err := opt(v); err != nil {
+			return nil, err
+		}
+	}
+	if v.LockedToken && v.TokenStore == nil {
+		v.TokenStore = &LockedStore{}
+	}
+	if v.TokenPath == "" && v.TokenStore == nil {
+		return nil, errors.New("missing token path or token store")
+	}
+	if v.client == nil {
+		vaultConfig := api.DefaultConfig()
+		if err := vaultConfig.ReadEnvironment(); err != nil {
+			return nil, errors.Wrap(err, "failed to read environment for vault")
+		}
+		var err error
+		v.client, err = api.NewClient(vaultConfig)
+		if err != nil {
+			return nil, errors.Wrap(err, "failed to create vault client")
+		}
+	}
+	if len(v.Addresses) > 0 {
+		if err := v.useAddress(0); err != nil {
+			return nil, err
+		}
+	}
+	if v.Namespace != "" {
+		v.client.SetNamespace(v.Namespace)
+	}
+	return v, nil
+}
+
+// WithRole sets the Vault role used for the login
+func WithRole(role string) Option {
+	return func(v *Vault) error {
+		v.Role = role
+		return nil
+	}
+}
+
+// WithTokenPath sets the file the Vault token is stored in
+func WithTokenPath(p string) Option {
+	return func(v *Vault) error {
+		v.TokenPath = p
+		return nil
+	}
+}
+
+// WithWrapTTL requests a response-wrapped login with the TTL d, the token stored is the wrapping
+// token and has to be unwrapped with UnwrapToken or LoadWrappedToken
+func WithWrapTTL(d time.Duration) Option {
+	return func(v *Vault) error {
+		if d <= 0 {
+			return errors.Errorf("invalid wrap ttl %s", d)
+		}
+		v.WrapTTL = d
+		return nil
+	}
+}
+
+// WithLogger sends the events of the login and the renewal to l
+func WithLogger(l Logger) Option {
+	return func(v *Vault) error {
+		v.Logger = l
+		return nil
+	}
+}
+
+// WithMetrics records the login and the renewal in m
+func WithMetrics(m *Metrics) Option {
+	return func(v *Vault) error {
+		v.Metrics = m
+		return nil
+	}
+}
+
+// WithRetry retries the login and the renewal of the stored token on transient errors
+func WithRetry(r *Retry) Option {
+	return func(v *Vault) error {
+		if r != nil {
+			if err := r.validate(); err != nil {
+				return err
+			}
+		}
+		v.Retry = r
+		return nil
+	}
+}
+
+// WithCircuitBreaker stops the logins after repeated failures and limits them to the budget of b, b
+// can be shared by several Vaults
+func WithCircuitBreaker(b *CircuitBreaker) Option {
+	return func(v *Vault) error {
+		if b != nil {
+			if err := b.validate(); err != nil {
+				return err
+			}
+		}
+		v.Breaker = b
+		return nil
+	}
+}
+
+// WithAddresses sets the addresses of independent Vault clusters for the failover
+func WithAddresses(addrs ...string) Option {
+	return func(v *Vault) error {
+		v.Addresses = addrs
+		return nil
+	}
+}
+
+// WithNamespace sets the Vault Enterprise namespace of the login and the renewal, the auth mount
+// path is relative to the namespace
+func WithNamespace(namespace string) Option {
+	return func(v *Vault) error {
+		v.Namespace = strings.Trim(namespace, "/")
+		return nil
+	}
+}
+
+// WithLoginTimeout bounds each login request with d instead of the timeout of the Vault client
+func WithLoginTimeout(d time.Duration) Option {
+	return func(v *Vault) error {
+		if d < 0 {
+			return errors.Errorf("negative login timeout %s", d)
+		}
+		v.LoginTimeout = d
+		return nil
+	}
+}
+
+// WithRenewThreshold sets the remaining TTL below which GetToken renews a loaded token
+func WithRenewThreshold(d time.Duration) Option {
+	return func(v *Vault) error {
+		if d < 0 {
+			return errors.Errorf("negative renew threshold %s", d)
+		}
+		v.RenewThreshold = d
+		return nil
+	}
+}
+
+// WithRenewBefore renews the token in Run when its remaining TTL reaches r, nil uses the schedule
+// of api.LifetimeWatcher
+func WithRenewBefore(r *RenewBefore) Option {
+	return func(v *Vault) error {
+		if r != nil {
+			if err := r.validate(); err != nil {
+				return err
+			}
+		}
+		v.RenewBefore = r
+		return nil
+	}
+}
+
+// WithRevokeOnClose revokes the stored token when the Vault is closed
+func WithRevokeOnClose(revoke bool) Option {
+	return func(v *Vault) error {
+		v.RevokeOnClose = revoke
+		return nil
+	}
+}
+
+// WithEventRecorder posts Kubernetes Events on the pod if the login or the renewal fails repeatedly
+func WithEventRecorder(r *EventRecorder) Option {
+	return func(v *Vault) error {
+		if r != nil {
+			if err := r.validate(); err != nil {
+				return err
+			}
+		}
+		v.EventRecorder = r
+		return nil
+	}
+}
+
+// WithLeaderElection lets only the leader of several replicas get, store and renew the token in Run
+func WithLeaderElection(le *LeaderElection) Option {
+	return func(v *Vault) error {
+		if le != nil {
+			if err := le.validate(); err != nil {
+				return err
+			}
+		}
+		v.LeaderElection = le
+		return nil
+	}
+}
+
+// WithMinTokenUses sets the number of remaining uses at which a token with limited uses is replaced
+// and the interval Run checks the remaining uses
+func WithMinTokenUses(n int, interval time.Duration) Option {
+	return func(v *Vault) error {
+		if n < 0 {
+			return errors.Errorf("negative min token uses %d", n)
+		}
+		if interval < 0 {
+			return errors.Errorf("negative token uses interval %s", interval)
+		}
+		v.MinTokenUses, v.TokenUsesInterval = n, interval
+		return nil
+	}
+}
+
+// WithTokenCheckInterval checks the stored token every d in Run and stores it again if it changed
+func WithTokenCheckInterval(d time.Duration) Option {
+	return func(v *Vault) error {
+		if d < 0 {
+			return errors.Errorf("negative token check interval %s", d)
+		}
+		v.TokenCheckInterval = d
+		return nil
+	}
+}
+
+// WithAgent uses the auto-auth token of the Vault Agent listening on address instead of a login
+func WithAgent(address string) Option {
+	return func(v *Vault) error {
+		if address == "" {
+			return errors.New("empty vault agent address")
+		}
+		v.AgentAddress = address
+		return nil
+	}
+}
+
+// WithTokenKey encrypts the stored token with the key of key
+func WithTokenKey(key KeyFunc) Option {
+	return func(v *Vault) error {
+		v.TokenKey = key
+		return nil
+	}
+}
+
+// WithTokenStore stores the token in s instead of a file
+func WithTokenStore(s TokenStore) Option {
+	return func(v *Vault) error {
+		if s == nil {
+			return errors.New("token store is nil")
+		}
+		v.TokenStore = s
+		return nil
+	}
+}
+
+// WithLockedToken keeps the token in a LockedStore instead of a file unless a TokenStore is set and
+// avoids copies of the token on the heap: LastAuth and the Events contain no token, the token of the
+// Vault client is cleared when it is not used and the service account token files are read into
+// buffers which are zeroed after the login
+// The token returned by GetToken and Authenticate, passed to the token callbacks and parsed from
+// the responses of Vault is still a string, copies of the login request made by the HTTP client are
+// not zeroed.
+func WithLockedToken() Option {
+	return func(v *Vault) error {
+		v.LockedToken = true
+		return nil
+	}
+}
+
+// WithTokenSinks stores the token in all sinks with a MultiStore, the failures of the sinks are logged
+func WithTokenSinks(sinks ...Sink) Option {
+	return func(v *Vault) error {
+		if len(sinks) == 0 {
+			return errors.New("no token sink")
+		}
+		for _, s := range sinks {
+			if s.TokenStore == nil {
+				return errors.New("token sink is nil")
+			}
+		}
+		v.TokenStore = &MultiStore{
+			Sinks: sinks,
+			OnError: func(s Sink, err error) {
+				v.log().Info("token sink failed", "sink", fmt.Sprintf("%T", s.TokenStore), "optional", s.Optional, "error", err)
+			},
+		}
+		return nil
+	}
+}
+
+// WithAuthMountDiscovery finds the mount of the auth method in sys/auth before the first login, the
+// candidates are tried if listing sys/auth is not permitted or finds several mounts
+func WithAuthMountDiscovery(candidates ...string) Option {
+	return func(v *Vault) error {
+		v.DiscoverAuthMount = true
+		v.AuthMountCandidates = candidates
+		return nil
+	}
+}
+
+// WithAuthMountPath sets the mount path of the Kubernetes auth method, the auth/ prefix is optional
+func WithAuthMountPath(p string) Option {
+	return func(v *Vault) error {
+		if p == "" {
+			return errors.New("empty auth mount path")
+		}
+		v.AuthMountPath = FixAuthMountPath(p)
+		return nil
+	}
+}
+
+// WithServiceAccountTokenPath sets the file of the service account token
+func WithServiceAccountTokenPath(p string) Option {
+	return func(v *Vault) error {
+		if p == "" {
+			return errors.New("empty service account token path")
+		}
+		v.ServiceAccountTokenPath = p
+		return nil
+	}
+}
+
+// WithServiceAccountTokenPaths sets the files of service account tokens tried in order by the login
+func WithServiceAccountTokenPaths(paths ...string) Option {
+	return func(v *Vault) error {
+		for _, p := range paths {
+			if p == "" {
+				return errors.New("empty service account token path")
+			}
+		}
+		v.ServiceAccountTokenPaths = paths
+		return nil
+	}
+}
+
+// WithServiceAccountTokenWatchInterval re-authenticates in Run if the content of the service
+// account token file changed, it is checked every d
+func WithServiceAccountTokenWatchInterval(d time.Duration) Option {
+	return func(v *Vault) error {
+		if d <= 0 {
+			return errors.New("service account token watch interval must be positive")
+		}
+		v.ServiceAccountTokenWatchInterval = d
+		return nil
+	}
+}
+
+// WithTokenRequest obtains the JWT of the Kubernetes login from the TokenRequest API with the
+// audiences and expiration of r
+func WithTokenRequest(r *TokenRequest) Option {
+	return func(v *Vault) error {
+		if r == nil {
+			return errors.New("token request is nil")
+		}
+		v.TokenRequest = r
+		return nil
+	}
+}
+
+// WithJWTSource reads the service account token of the Kubernetes login from source, e.g.
+// JWTFromEnv or JWTFromReader, instead of a file
+func WithJWTSource(source JWTSource) Option {
+	return func(v *Vault) error {
+		if source == nil {
+			return errors.New("jwt source is nil")
+		}
+		v.JWTSource = source
+		return nil
+	}
+}
+
+// WithClient uses the Vault client c
+func WithClient(c *api.Client) Option {
+	return func(v *Vault) error {
+		if c == nil {
+			return errors.New("vault client is nil")
+		}
+		v.client = c
+		return nil
+	}
+}
+
+// WithTTL sets the TTL requested when the token is renewed
+func WithTTL(d time.Duration) Option {
+	return func(v *Vault) error {
+		if d < 0 {
+			return errors.Errorf("negative ttl %s", d)
+		}
+		v.TTL = int(d.Seconds())
+		return nil
+	}
+}
+
+// WithReAuth enables the re-authentication if the stored token is not usable
+func WithReAuth(reAuth bool) Option {
+	return func(v *Vault) error {
+		v.ReAuth = reAuth
+		return nil
+	}
+}
+
+// WithAllowFail makes a failed authentication non-fatal for TryAuthenticate and TryGetToken
+func WithAllowFail(allowFail bool) Option {
+	return func(v *Vault) error {
+		v.AllowFail = allowFail
+		return nil
+	}
+}
+
+// WithAppRole authenticates with the AppRole auth method and the credentials a
+// The auth mount path defaults to auth/approle.
+func WithAppRole(a *AppRole) Option {
+	return func(v *Vault) error {
+		if a == nil {
+			return errors.New("approle credentials are nil")
+		}
+		if err := a.validate(); err != nil {
+			return err
+		}
+		if v.AuthMountPath == FixAuthMountPath(AuthMountPath) {
+			v.AuthMountPath = FixAuthMountPath(AuthMethodAppRole)
+		}
+		v.AuthMethod = AuthMethodAppRole
+		v.AppRole = a
+		return nil
+	}
+}
+
+// WithAWS authenticates with the iam type of the AWS auth method and the Vault role of WithRole
+// The auth mount path defaults to auth/aws.
+func WithAWS(a *AWS) Option {
+	return func(v *Vault) error {
+		if a == nil {
+			a = &AWS{}
+		}
+		if v.AuthMountPath == FixAuthMountPath(AuthMountPath) {
+			v.AuthMountPath = FixAuthMountPath(AuthMethodAWS)
+		}
+		v.AuthMethod = AuthMethodAWS
+		v.AWS = a
+		return nil
+	}
+}
+
+// WithGCP authenticates with the gce type of the GCP auth method and the Vault role of WithRole
+// The auth mount path defaults to auth/gcp.
+func WithGCP(g *GCP) Option {
+	return func(v *Vault) error {
+		if g == nil {
+			g = &GCP{}
+		}
+		if v.AuthMountPath == FixAuthMountPath(AuthMountPath) {
+			v.AuthMountPath = FixAuthMountPath(AuthMethodGCP)
+		}
+		v.AuthMethod = AuthMethodGCP
+		v.GCP = g
+		return nil
+	}
+}
+
+// WithAzure authenticates with the Azure auth method and the Vault role of WithRole
+// The auth mount path defaults to auth/azure.
+func WithAzure(a *Azure) Option {
+	return func(v *Vault) error {
+		if a == nil {
+			a = &Azure{}
+		}
+		if v.AuthMountPath == FixAuthMountPath(AuthMountPath) {
+			v.AuthMountPath = FixAuthMountPath(AuthMethodAzure)
+		}
+		v.AuthMethod = AuthMethodAzure
+		v.Azure = a
+		return nil
+	}
+}
+
+// WithJWT authenticates with the JWT auth method and the Vault role of WithRole
+// The auth mount path defaults to auth/jwt.
+func WithJWT(j *JWT) Option {
+	return func(v *Vault) error {
+		if j == nil {
+			return errors.New("jwt configuration is nil")
+		}
+		if err := j.validate(); err != nil {
+			return err
+		}
+		if v.AuthMountPath == FixAuthMountPath(AuthMountPath) {
+			v.AuthMountPath = FixAuthMountPath(AuthMethodJWT)
+		}
+		v.AuthMethod = AuthMethodJWT
+		v.JWT = j
+		return nil
+	}
+}
+
+// WithCert authenticates with the TLS certificate auth method, the role of WithRole is optional
+// The auth mount path defaults to auth/cert.
+func WithCert(c *Cert) Option {
+	return func(v *Vault) error {
+		if c == nil {
+			return errors.New("client certificate configuration is nil")
+		}
+		if err := c.validate(); err != nil {
+			return err
+		}
+		if v.AuthMountPath == FixAuthMountPath(AuthMountPath) {
+			v.AuthMountPath = FixAuthMountPath(AuthMethodCert)
+		}
+		v.AuthMethod = AuthMethodCert
+		v.Cert = c
+		return nil
+	}
+}
+
+// WithAuthenticator logs in with the Authenticator a instead of the auth method
+func WithAuthenticator(a Authenticator) Option {
+	return func(v *Vault) error {
+		if a == nil {
+			return errors.New("authenticator is nil")
+		}
+		v.Authenticator = a
+		return nil
+	}
+}
@@ -0,0 +1,19 @@
+package k8s
+
+import "context"
+
+// TokenProvider is the part of Vault used by applications to get the token, depend on it instead of
+// *Vault to replace Vault in tests with a fake, e.g. k8sfake.Vault
+type TokenProvider interface {
+	Authenticate() (string, error)
+	AuthenticateWithContext(ctx context.Context) (string, error)
+	GetToken() (string, error)
+	GetTokenWithContext(ctx context.Context) (string, error)
+	LoadToken() (string, error)
+	LastAuth() *AuthInfo
+	RegisterTokenCallback(f TokenCallback)
+	Run(ctx context.Context) error
+	Close(ctx context.Context) error
+}
+
+var _ TokenProvider = (*Vault)(nil)
@@ -0,0 +1,110 @@
+package k8s
+
+import (
+	"context"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/hashicorp/vault/api"
+	"github.com/pkg/errors"
+)
+
+// RenewBefore is the remaining TTL at which Run renews the token, either a percentage of the TTL
+// or a fixed duration, e.g. 30% renews a token with a TTL of 1h when 18m remain
+// A Duration longer than half of the TTL is limited to half of it.
+type RenewBefore struct {
+	// Percent of the TTL between 0 and 100
+	Percent float64
+	// Duration before the expiry of the token
+	Duration time.Duration
+}
+
+// ParseRenewBefore parses a percentage like 30% or a duration like 5m
+func ParseRenewBefore(s string) (*RenewBefore, error) {
+	r := &RenewBefore{}
+	if strings.HasSuffix(s, "%") {
+		f, err := strconv.ParseFloat(strings.TrimSuffix(s, "%"), 64)
+		if err != nil {
+			return nil, errors.Wrapf(err, "%s is not a valid percentage", s)
+		}
+		r.Percent = f
+	} else {
+		d, err := time.ParseDuration(s)
+		if err != nil {
+			return nil, errors.Wrapf(err, "%s is neither a valid percentage nor a valid duration", s)
+		}
+		r.Duration = d
+	}
+	if err := r.validate(); err != nil {
+		return nil, err
+	}
+	return r, nil
+}
+
+// validate checks that exactly one of Percent and Duration is set
+func (r *RenewBefore) validate() error {
+	if r.Percent < 0 || r.Percent >= 100 {
+		return errors.Errorf("renew before percentage %g is not between 0 and 100", r.Percent)
+	}
+	if r.Duration < 0 {
+		return errors.Errorf("negative renew before duration %s", r.Duration)
+	}
+	if (r.Percent == 0) == (r.Duration == 0) {
+		return errors.New("either renew before percentage or duration is required")
+	}
+	return nil
+}
+
+// remaining returns the remaining TTL at which a token with the TTL ttl is renewed
+func (r *RenewBefore) remaining(ttl time.Duration) time.Duration {
+	if r.Percent > 0 {
+		return time.Duration(float64(ttl) * r.Percent / 100)
+	}
+	if r.Duration > ttl/2 {
+		return ttl / 2
+	}
+	return r.Duration
+}
+
+// renewAhead renews the token of the Vault client whenever its remaining TTL reaches RenewBefore,
+// the channels correspond to the ones of api.LifetimeWatcher
+// The renewal stops with a nil error if the max TTL of the token is reached.
+func (v *Vault) renewAhead(ctx context.Context, info tokenInfo) (<-chan *api.RenewOutput, <-chan error) {
+	renewCh := make(chan *api.RenewOutput)
+	doneCh := make(chan error, 1)
+	go func() {
+		ttl := info.ttl
+		for {
+			remaining := v.RenewBefore.remaining(ttl)
+			t := time.NewTimer(ttl - remaining)
+			select {
+			case <-ctx.Done():
+				t.Stop()
+				return
+			case <-t.C:
+			}
+			s, err := vaultRenewSelf(ctx, v.client, v.increment(info))
+			if err != nil {
+				doneCh <- err
+				return
+			}
+			if s == nil || s.Auth == nil {
+				doneCh <- errors.New("token renewal returned no auth data")
+				return
+			}
+			select {
+			case <-ctx.Done():
+				return
+			case renewCh <- &api.RenewOutput{RenewedAt: time.Now(), Secret: s}:
+			}
+			ttl = time.Duration(s.Auth.LeaseDuration) * time.Second
+			if ttl <= remaining {
+				// the renewal did not extend the token
+				doneCh <- nil
+				return
+			}
+		}
+	}()
+	return renewCh, doneCh
+}
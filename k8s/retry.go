@@ -0,0 +1,138 @@
+package k8s
+
+import (
+	"context"
+	"math/rand"
+	"os"
+	"strconv"
+	"time"
+
+	"github.com/pkg/errors"
+)
+
+// Defaults of Retry
+const (
+	DefaultRetryBase = time.Second
+	DefaultRetryCap  = time.Minute
+)
+
+// Retry configures the retry of the login and of the renewal of the stored token on transient
+// errors, i.e. network errors and 5xx responses of Vault
+// The delay before the attempt n+1 is Base*2^(n-1), limited to Cap and reduced by a random
+// fraction of at most Jitter.
+type Retry struct {
+	// MaxAttempts is the number of attempts including the first one, 0 or 1 disables the retry
+	MaxAttempts int `yaml:"maxAttempts"`
+	// Base delay, 0 uses DefaultRetryBase
+	Base time.Duration `yaml:"base"`
+	// Cap of the delay, 0 uses DefaultRetryCap
+	Cap time.Duration `yaml:"cap"`
+	// Jitter is the fraction of the delay between 0 and 1 which is randomly subtracted
+	Jitter float64 `yaml:"jitter"`
+}
+
+// retryFromEnvironment reads the retry configuration from the environment, it returns nil if
+// VAULT_RETRY_MAX_ATTEMPTS is not set
+func retryFromEnvironment() (*Retry, error) {
+	s := os.Getenv("VAULT_RETRY_MAX_ATTEMPTS")
+	if s == "" {
+		return nil, nil
+	}
+	r := &Retry{}
+	n, err := strconv.Atoi(s)
+	if err != nil {
+		return nil, errors.Wrapf(err, "%s is not a valid number for VAULT_RETRY_MAX_ATTEMPTS", s)
+	}
+	r.MaxAttempts = n
+	if s := os.Getenv("VAULT_RETRY_BASE"); s != "" {
+		d, err := time.ParseDuration(s)
+		if err != nil {
+			return nil, errors.Wrapf(err, "%s is not a valid duration for VAULT_RETRY_BASE", s)
+		}
+		r.Base = d
+	}
+	if s := os.Getenv("VAULT_RETRY_CAP"); s != "" {
+		d, err := time.ParseDuration(s)
+		if err != nil {
+			return nil, errors.Wrapf(err, "%s is not a valid duration for VAULT_RETRY_CAP", s)
+		}
+		r.Cap = d
+	}
+	if s := os.Getenv("VAULT_RETRY_JITTER"); s != "" {
+		f, err := strconv.ParseFloat(s, 64)
+		if err != nil {
+			return nil, errors.Wrapf(err, "%s is not a valid number for VAULT_RETRY_JITTER", s)
+		}
+		r.Jitter = f
+	}
+	if err := r.validate(); err != nil {
+		return nil, err
+	}
+	return r, nil
+}
+
+// validate checks the limits of the retry
+func (r *Retry) validate() error {
+	if r.MaxAttempts < 0 {
+		return errors.Errorf("negative retry max attempts %d", r.MaxAttempts)
+	}
+	if r.Base < 0 || r.Cap < 0 {
+		return errors.New("negative retry delay")
+	}
+	if r.Jitter < 0 || r.Jitter > 1 {
+		return errors.Errorf("retry jitter %g is not between 0 and 1", r.Jitter)
+	}
+	return nil
+}
+
+// delay returns the delay after the failed attempt n, starting with 1
+func (r *Retry) delay(n int) time.Duration {
+	base, limit := r.Base, r.Cap
+	if base == 0 {
+		base = DefaultRetryBase
+	}
+	if limit == 0 {
+		limit = DefaultRetryCap
+	}
+	d := base
+	for i := 1; i < n && d < limit; i++ {
+		d *= 2
+	}
+	if d > limit {
+		d = limit
+	}
+	return d - time.Duration(rand.Float64()*r.Jitter*float64(d))
+}
+
+// retryable returns true if err is a network error or a 5xx response of Vault
+func retryable(err error) bool {
+	switch failureReason(err) {
+	case reasonConnection, reasonServerError:
+		return true
+	}
+	return false
+}
+
+// retry calls f until it succeeds, it returns a non-transient error or Retry.MaxAttempts is reached
+// Every attempt tries the other Addresses on connection errors.
+func (v *Vault) retry(ctx context.Context, op string, f func() error) error {
+	attempts := 1
+	if v.Retry != nil && v.Retry.MaxAttempts > 1 {
+		attempts = v.Retry.MaxAttempts
+	}
+	for n := 1; ; n++ {
+		err := v.withFailover(ctx, f)
+		if err == nil || n >= attempts || !retryable(err) {
+			return err
+		}
+		d := v.Retry.delay(n)
+		v.log().Info("retry", "operation", op, "attempt", n, "delay", d, "error", err)
+		t := time.NewTimer(d)
+		select {
+		case <-ctx.Done():
+			t.Stop()
+			return err
+		case <-t.C:
+		}
+	}
+}
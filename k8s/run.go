@@ -0,0 +1,312 @@
+package k8s
+
+import (
+	"bytes"
+	"context"
+	"crypto/sha256"
+	"fmt"
+	"io/ioutil"
+	"sync"
+	"time"
+
+	"github.com/hashicorp/vault/api"
+	"github.com/pkg/errors"
+)
+
+// Run gets a token with GetToken, stores it in TokenPath and renews it until ctx is done
+// If the renewal stops (e.g. the max TTL is reached or the token was revoked) and ReAuth is true,
+// Run authenticates again and stores the new token, otherwise the error is returned
+// With ServiceAccountTokenWatchInterval the service account token file (or with Cert.WatchInterval
+// the client certificate file) is checked regularly and Run authenticates again if its content changed
+// With RenewBefore the token is renewed when the remaining TTL reaches it instead of the schedule
+// of api.LifetimeWatcher
+// Tokens with limited uses are not renewed because a renewal is a use, they are replaced by a new
+// login before they expire or when at most MinTokenUses are left, see TokenUsesInterval
+// Batch tokens and other tokens which are not renewable are replaced by a new login before they
+// expire
+// With TokenCheckInterval the stored token is checked regularly and stored again if it was removed,
+// truncated or replaced
+// While Breaker rejects the login Run waits until it allows a login again
+// Run returns nil when ctx is done or the Vault is closed
+// If the renewal fails with a connection error and another address of Addresses is healthy, Run
+// authenticates with that address
+// With LeaderElection only the leader of the replicas gets, stores and renews the token, the
+// others stand by until they acquire the lease
+// Run does not support WrapTTL because the wrapped token cannot be renewed
+// The lifecycle events of the token are sent to Events, NewWatcher returns a Watcher with its own
+// channel of the events.
+func (v *Vault) Run(ctx context.Context) error {
+	return v.run(ctx, nil)
+}
+
+// run is Run sending the lifecycle events to w, w may be nil
+func (v *Vault) run(ctx context.Context, w *Watcher) error {
+	if v.WrapTTL > 0 {
+		return errors.New("run does not support a response-wrapped login")
+	}
+	ctx, done, err := v.start(ctx)
+	if err != nil {
+		return err
+	}
+	defer done()
+	if v.LeaderElection != nil {
+		return v.LeaderElection.lead(ctx, v, func(ctx context.Context) error {
+			return v.runToken(ctx, w)
+		})
+	}
+	return v.runToken(ctx, w)
+}
+
+// runToken gets, stores and renews the token until ctx is done
+func (v *Vault) runToken(ctx context.Context, w *Watcher) error {
+	last := v.LastAuth()
+	token, err := v.GetTokenWithContext(ctx)
+	if err != nil {
+		return err
+	}
+	if info := v.LastAuth(); info != nil && info.Token == token && (last == nil || last.Token != token) {
+		// the token was not loaded from TokenPath
+		v.emit(w, Event{Type: EventAuthenticated, Token: token, TTL: info.LeaseDuration})
+	}
+	// the token may have been loaded from TokenPath without authentication
+	v.initCredentialSum()
+	for {
+		if err := v.StoreToken(token); err != nil {
+			return err
+		}
+		v.log().Debug("token stored")
+		v.emit(w, Event{Type: EventStored, Token: token})
+		err := v.watch(ctx, token, w)
+		if ctx.Err() != nil {
+			return nil
+		}
+		// a token is only valid for the cluster it was issued by, a failover requires a new login
+		failover := failureReason(err) == reasonConnection && v.failover(ctx)
+		if !v.ReAuth && err != errCredentialChanged && err != errTokenExpiring && err != errTokenUsesExhausted && !failover {
+			return err
+		}
+		token, err = v.reauthenticate(ctx)
+		if ctx.Err() != nil {
+			return nil
+		}
+		if err != nil {
+			return err
+		}
+		var ttl time.Duration
+		if info := v.LastAuth(); info != nil {
+			ttl = info.LeaseDuration
+		}
+		v.emit(w, Event{Type: EventReAuthenticated, Token: token, TTL: ttl})
+	}
+}
+
+// watch renews the token until ctx is done or the renewal stops
+// Batch and other tokens which are not renewable are watched until two thirds of their TTL passed.
+func (v *Vault) watch(ctx context.Context, token string, w *Watcher) error {
+	v.client.SetToken(token)
+	defer v.clearToken()
+	info, err := v.lookup(ctx)
+	if err != nil {
+		return err
+	}
+	var renewCh <-chan *api.RenewOutput
+	var doneCh <-chan error
+	var expiring <-chan time.Time
+	var usesTick <-chan time.Time
+	switch {
+	case info.numUses > 0:
+		// a renewal would consume a use, the token is replaced before it expires or its uses run out
+		v.log().Debug("token uses limited", "uses", info.numUses, "ttl", info.ttl)
+		if info.ttl > 0 {
+			t := time.NewTimer(info.ttl * 2 / 3)
+			defer t.Stop()
+			expiring = t.C
+		}
+		ticker := time.NewTicker(v.tokenUsesInterval())
+		defer ticker.Stop()
+		usesTick = ticker.C
+	case info.renewable && v.RenewBefore != nil:
+		renewCtx, cancel := context.WithCancel(ctx)
+		defer cancel()
+		renewCh, doneCh = v.renewAhead(renewCtx, info)
+	case info.renewable:
+		watcher, err := v.newLifetimeWatcher(ctx, v.increment(info))
+		if err != nil {
+			return err
+		}
+		go watcher.Start()
+		defer watcher.Stop()
+		renewCh, doneCh = watcher.RenewCh(), watcher.DoneCh()
+	case info.ttl > 0:
+		v.log().Debug("token not renewable", "batch", info.batch, "ttl", info.ttl)
+		t := time.NewTimer(info.ttl * 2 / 3)
+		defer t.Stop()
+		expiring = t.C
+	}
+	var check <-chan time.Time
+	if v.TokenCheckInterval > 0 {
+		ticker := time.NewTicker(v.TokenCheckInterval)
+		defer ticker.Stop()
+		check = ticker.C
+	}
+	var tick <-chan time.Time
+	if d := v.watchInterval(); d > 0 {
+		ticker := time.NewTicker(d)
+		defer ticker.Stop()
+		tick = ticker.C
+	}
+	for {
+		select {
+		case <-ctx.Done():
+			return ctx.Err()
+		case <-tick:
+			if v.credentialChanged() {
+				v.log().Info("credential changed", "path", v.credentialPath())
+				v.emit(w, Event{Type: EventCredentialChanged})
+				return errCredentialChanged
+			}
+		case <-check:
+			if err := v.healToken(token, w); err != nil {
+				return err
+			}
+		case <-expiring:
+			v.log().Info("token expiring")
+			return errTokenExpiring
+		case <-usesTick:
+			info, err := v.lookup(ctx)
+			if err != nil && failureReason(err) != reasonPermissionDenied {
+				return err
+			}
+			if err != nil || info.usesExhausted(v.minTokenUses()) {
+				v.log().Info("token uses exhausted", "uses", info.numUses)
+				return errTokenUsesExhausted
+			}
+		case r := <-renewCh:
+			if r != nil && r.Secret != nil && r.Secret.Auth != nil {
+				v.log().Debug("token renewed", "ttl", time.Duration(r.Secret.Auth.LeaseDuration)*time.Second)
+				v.Metrics.renewal(time.Duration(r.Secret.Auth.LeaseDuration) * time.Second)
+				v.EventRecorder.success(EventReasonRenewalFailed)
+				v.tokenHeld(time.Duration(r.Secret.Auth.LeaseDuration) * time.Second)
+				v.emit(w, Event{Type: EventRenewed, TTL: time.Duration(r.Secret.Auth.LeaseDuration) * time.Second})
+			}
+		case err := <-doneCh:
+			v.log().Info("token renewal stopped", "error", err)
+			v.Metrics.renewalFailure()
+			if err == nil {
+				v.emit(w, Event{Type: EventRenewalStopped})
+				return fmt.Errorf("token renewal stopped")
+			}
+			v.EventRecorder.failure(v, EventReasonRenewalFailed, err)
+			v.emit(w, Event{Type: EventRenewalFailed, Err: err})
+			if failureReason(err) == reasonPermissionDenied {
+				v.emit(w, Event{Type: EventRevoked, Token: token, Err: err})
+			}
+			return errors.Wrap(err, "token renewal failed")
+		}
+	}
+}
+
+// Errors of watch which lead to a new login
+var (
+	// errCredentialChanged is returned if the credential file changed
+	errCredentialChanged = errors.New("credential changed")
+	// errTokenExpiring is returned if a token which is not renewable expires soon
+	errTokenExpiring = errors.New("token expiring")
+	// errTokenUsesExhausted is returned if a token with limited uses has at most MinTokenUses left
+	errTokenUsesExhausted = errors.New("token uses exhausted")
+)
+
+// healToken stores token again if the stored token differs, e.g. the volume of TokenPath was reset
+func (v *Vault) healToken(token string, w *Watcher) error {
+	stored, err := v.LoadToken()
+	if err == nil && stored == token {
+		return nil
+	}
+	v.log().Info("stored token drifted, storing it again", "error", err)
+	if err := v.StoreToken(token); err != nil {
+		return err
+	}
+	v.emit(w, Event{Type: EventStored, Token: token})
+	return nil
+}
+
+// watchInterval returns the interval to check the credential file of the auth method
+func (v *Vault) watchInterval() time.Duration {
+	switch v.AuthMethod {
+	case "", AuthMethodKubernetes:
+		return v.ServiceAccountTokenWatchInterval
+	case AuthMethodCert:
+		if v.Cert != nil {
+			return v.Cert.WatchInterval
+		}
+	}
+	return 0
+}
+
+// credentialPath returns the credential file of the auth method, the service account token or the
+// client certificate
+func (v *Vault) credentialPath() string {
+	switch v.AuthMethod {
+	case "", AuthMethodKubernetes:
+		if v.JWTSource != nil {
+			return ""
+		}
+		if v.saTokenPath != "" {
+			return v.saTokenPath
+		}
+		return v.ServiceAccountTokenPath
+	case AuthMethodCert:
+		if v.Cert != nil {
+			return v.Cert.CertPath
+		}
+	}
+	return ""
+}
+
+// credential is the hash of the credential file used by the last authentication, it is set by
+// the login and read by Run
+type credential struct {
+	mu  sync.Mutex
+	sum [sha256.Size]byte
+}
+
+// setCredentialSum records the hash of the credential of a login
+func (v *Vault) setCredentialSum(sum [sha256.Size]byte) {
+	v.credential.mu.Lock()
+	defer v.credential.mu.Unlock()
+	v.credential.sum = sum
+}
+
+// initCredentialSum records the hash of the current credential file if there was no login
+func (v *Vault) initCredentialSum() {
+	v.credential.mu.Lock()
+	defer v.credential.mu.Unlock()
+	if v.credential.sum == ([sha256.Size]byte{}) {
+		v.credential.sum, _ = v.credentialHash()
+	}
+}
+
+// credentialChanged returns true if the content of the credential file differs from the one used
+// by the last authentication, a file that cannot be read is not a change
+func (v *Vault) credentialChanged() bool {
+	h, err := v.credentialHash()
+	if err != nil {
+		return false
+	}
+	v.credential.mu.Lock()
+	defer v.credential.mu.Unlock()
+	return h != v.credential.sum
+}
+
+// credentialHash returns the hash of the content of the credential file
+func (v *Vault) credentialHash() ([sha256.Size]byte, error) {
+	p := v.credentialPath()
+	if p == "" {
+		return [sha256.Size]byte{}, errors.New("auth method has no credential file")
+	}
+	content, err := ioutil.ReadFile(p)
+	if err != nil {
+		return [sha256.Size]byte{}, err
+	}
+	return sha256.Sum256(bytes.TrimSpace(content)), nil
+}
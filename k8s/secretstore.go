@@ -0,0 +1,121 @@
+package k8s
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+
+	"github.com/pkg/errors"
+	corev1 "k8s.io/api/core/v1"
+	apierrors "k8s.io/apimachinery/pkg/api/errors"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/apimachinery/pkg/types"
+	"k8s.io/client-go/kubernetes"
+)
+
+// SecretStore stores the token in a Kubernetes Secret, the Secret is created if it does not exist
+// The Kubernetes API is accessed with the in-cluster configuration and the service account token.
+type SecretStore struct {
+	// Name of the Secret
+	Name string
+	// Namespace of the Secret, empty uses the namespace of the pod
+	Namespace string
+	// Key of the token in the Secret, empty uses "token"
+	Key string
+	// OwnerReferences of a created Secret, e.g. the Pod or CronJob the SecretStore belongs to, the
+	// Secret is deleted by the garbage collector with its owner
+	OwnerReferences []metav1.OwnerReference
+	// ServiceAccountTokenPath is the token used for the Kubernetes API, empty uses
+	// ServiceAccountTokenPath
+	ServiceAccountTokenPath string
+
+	// clientset of the API server, set by tests
+	clientset kubernetes.Interface
+}
+
+// Store the token in the Secret
+func (s *SecretStore) Store(token string) error {
+	if err := s.init(); err != nil {
+		return errors.Wrap(err, "failed to store token")
+	}
+	ctx := context.Background()
+	data := map[string][]byte{s.key(): []byte(token)}
+	patch, err := json.Marshal(map[string]interface{}{"data": data})
+	if err != nil {
+		return errors.Wrap(err, "failed to store token")
+	}
+	secrets := s.clientset.CoreV1().Secrets(s.Namespace)
+	_, err = secrets.Patch(ctx, s.Name, types.MergePatchType, patch, metav1.PatchOptions{})
+	if err == nil {
+		return nil
+	}
+	if !apierrors.IsNotFound(err) {
+		return errors.Wrap(err, "failed to store token")
+	}
+	_, err = secrets.Create(ctx, &corev1.Secret{
+		ObjectMeta: metav1.ObjectMeta{
+			Name:            s.Name,
+			OwnerReferences: s.OwnerReferences,
+		},
+		Type: corev1.SecretTypeOpaque,
+		Data: data,
+	}, metav1.CreateOptions{})
+	if err != nil {
+		return errors.Wrap(err, "failed to store token")
+	}
+	return nil
+}
+
+// Load the token from the Secret
+func (s *SecretStore) Load() (string, error) {
+	if err := s.init(); err != nil {
+		return "", errors.Wrap(err, "failed to load token")
+	}
+	secret, err := s.clientset.CoreV1().Secrets(s.Namespace).Get(context.Background(), s.Name, metav1.GetOptions{})
+	if apierrors.IsNotFound(err) {
+		return "", errors.Errorf("failed to load token: secret %s not found", s.Name)
+	}
+	if err != nil {
+		return "", errors.Wrap(err, "failed to load token")
+	}
+	token := secret.Data[s.key()]
+	if len(token) == 0 {
+		return "", fmt.Errorf("found empty token")
+	}
+	return string(token), nil
+}
+
+// key returns the key of the token in the Secret
+func (s *SecretStore) key() string {
+	if s.Key == "" {
+		return "token"
+	}
+	return s.Key
+}
+
+// init sets the clientset and the namespace of the in-cluster configuration
+func (s *SecretStore) init() error {
+	if s.Name == "" {
+		return errors.New("missing secret name")
+	}
+	if s.clientset == nil {
+		tokenPath := s.ServiceAccountTokenPath
+		if tokenPath == "" {
+			tokenPath = ServiceAccountTokenPath
+		}
+		config, err := inClusterConfig(tokenPath)
+		if err != nil {
+			return err
+		}
+		if s.clientset, err = kubernetes.NewForConfig(config); err != nil {
+			return err
+		}
+	}
+	if s.Namespace == "" {
+		var err error
+		if s.Namespace, err = podNamespace(); err != nil {
+			return err
+		}
+	}
+	return nil
+}
@@ -0,0 +1,109 @@
+package k8s
+
+import (
+	"fmt"
+	"io/ioutil"
+	"os"
+	"sync"
+
+	"github.com/pkg/errors"
+)
+
+// TokenStore stores and loads the Vault token
+type TokenStore interface {
+	Store(token string) error
+	Load() (string, error)
+}
+
+// FileStore stores the token in the file with the path of its value
+// The token is written in place and the access is serialized with an advisory lock of the token
+// file, so a FileStore never reads a partial token. A symlink is followed and the directory of the
+// file does not have to be writable.
+type FileStore string
+
+// Store the token in the file
+func (f FileStore) Store(token string) error {
+	file, err := os.OpenFile(string(f), os.O_WRONLY|os.O_CREATE, 0644)
+	if err != nil {
+		return errors.Wrap(err, "failed to store token")
+	}
+	defer file.Close()
+	if err := lockFile(file, true); err != nil {
+		return errors.Wrap(err, "failed to lock token file")
+	}
+	defer func() {
+		_ = unlockFile(file)
+	}()
+	if err := file.Truncate(0); err != nil {
+		return errors.Wrap(err, "failed to store token")
+	}
+	if _, err := file.Write([]byte(token)); err != nil {
+		return errors.Wrap(err, "failed to store token")
+	}
+	return nil
+}
+
+// Load the token from the file
+func (f FileStore) Load() (string, error) {
+	file, err := os.Open(string(f))
+	if err != nil {
+		return "", errors.Wrap(err, "failed to read token file")
+	}
+	defer file.Close()
+	if err := lockFile(file, false); err != nil {
+		return "", errors.Wrap(err, "failed to lock token file")
+	}
+	defer func() {
+		_ = unlockFile(file)
+	}()
+	content, err := ioutil.ReadAll(file)
+	if err != nil {
+		return "", errors.Wrap(err, "failed to read token file")
+	}
+	if len(content) == 0 {
+		return "", fmt.Errorf("found empty token")
+	}
+	return string(content), nil
+}
+
+// MemoryStore keeps the token in memory, the zero value is ready to use
+type MemoryStore struct {
+	mu    sync.Mutex
+	token string
+}
+
+// Store the token in memory
+func (m *MemoryStore) Store(token string) error {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	m.token = token
+	return nil
+}
+
+// Load the token from memory
+func (m *MemoryStore) Load() (string, error) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	if m.token == "" {
+		return "", fmt.Errorf("found empty token")
+	}
+	return m.token, nil
+}
+
+// EnvStore stores the token in the environment variable with the name of its value, e.g. VAULT_TOKEN
+// for child processes or Vault clients created later
+type EnvStore string
+
+// Store the token in the environment variable
+func (e EnvStore) Store(token string) error {
+	return errors.Wrap(os.Setenv(string(e), token), "failed to store token")
+}
+
+// Load the token from the environment variable
+func (e EnvStore) Load() (string, error) {
+	token := os.Getenv(string(e))
+	if token == "" {
+		return "", fmt.Errorf("found empty token")
+	}
+	return token, nil
+}
@@ -0,0 +1,104 @@
+package k8s
+
+import (
+	"bytes"
+	"encoding/json"
+	"io/ioutil"
+	"text/template"
+
+	"github.com/pkg/errors"
+)
+
+// FetchTemplate is a Go text/template rendered to a file by a Fetcher
+// The function secret returns the data of a secret of a K/V engine, e.g.
+//
+//	password: {{ (secret "secret/db").password }}
+//
+// or
+//
+//	{{ with secret "secret/db" }}url: postgres://{{ .user }}:{{ .password }}@db{{ end }}
+//
+// toJSON returns a value as JSON. Every secret is read once per Fetch.
+type FetchTemplate struct {
+	// Source is the path of the template file
+	Source string `yaml:"source"`
+	// Text of the template, alternative to Source
+	Text string `yaml:"text"`
+	// File the rendered template is written to
+	File string `yaml:"file"`
+}
+
+// validate checks that the template has one source and a file
+func (t FetchTemplate) validate() error {
+	if t.File == "" {
+		return errors.New("missing file of template")
+	}
+	if (t.Source == "") == (t.Text == "") {
+		return errors.Errorf("template of %s requires either source or text", t.File)
+	}
+	return nil
+}
+
+// render returns the rendered template, read returns the data of a secret
+func (t FetchTemplate) render(read func(p string) (map[string]interface{}, error)) ([]byte, error) {
+	text := t.Text
+	if t.Source != "" {
+		b, err := ioutil.ReadFile(t.Source)
+		if err != nil {
+			return nil, errors.Wrap(err, "failed to read template")
+		}
+		text = string(b)
+	}
+	tmpl, err := template.New(t.File).Option("missingkey=error").Funcs(template.FuncMap{
+		"secret": read,
+		"toJSON": func(v interface{}) (string, error) {
+			b, err := json.Marshal(v)
+			return string(b), err
+		},
+	}).Parse(text)
+	if err != nil {
+		return nil, errors.Wrap(err, "failed to parse template")
+	}
+	buf := &bytes.Buffer{}
+	if err := tmpl.Execute(buf, nil); err != nil {
+		return nil, errors.Wrap(err, "failed to render template")
+	}
+	return buf.Bytes(), nil
+}
+
+// renderTemplates renders the templates of the Fetcher and writes the files whose content changed
+func (f *Fetcher) renderTemplates() error {
+	secrets := make(map[string]map[string]interface{})
+	read := func(p string) (map[string]interface{}, error) {
+		if data, ok := secrets[p]; ok {
+			return data, nil
+		}
+		c, err := f.client(p)
+		if err != nil {
+			return nil, err
+		}
+		data, err := c.Read(p)
+		if err != nil {
+			return nil, err
+		}
+		if data == nil {
+			return nil, errors.Errorf("secret %s not found", p)
+		}
+		secrets[p] = data
+		return data, nil
+	}
+	for _, t := range f.Templates {
+		content, err := t.render(read)
+		if err != nil {
+			return errors.Wrapf(err, "failed to render template of %s", t.File)
+		}
+		changed, err := writeFileIfChanged(t.File, content)
+		if err != nil {
+			return errors.Wrapf(err, "failed to write template of %s", t.File)
+		}
+		if changed {
+			f.v.log().Info("template written", "file", t.File)
+		}
+	}
+	return nil
+}
@@ -0,0 +1,174 @@
+package k8s
+
+import (
+	"bytes"
+	"context"
+	"encoding/base64"
+	"encoding/json"
+	"io/ioutil"
+	"strings"
+	"time"
+
+	"github.com/pkg/errors"
+	authenticationv1 "k8s.io/api/authentication/v1"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/client-go/kubernetes"
+	"k8s.io/client-go/rest"
+)
+
+// Files of the in-cluster configuration
+const (
+	ServiceAccountCAPath        = "/var/run/secrets/kubernetes.io/serviceaccount/ca.crt"
+	ServiceAccountNamespacePath = "/var/run/secrets/kubernetes.io/serviceaccount/namespace"
+)
+
+// inClusterTimeout bounds the requests to the API server
+const inClusterTimeout = 30 * time.Second
+
+// TokenRequest configures a short-lived, audience-bound service account token requested from the
+// Kubernetes TokenRequest API instead of reading the mounted service account token file
+// The request is authenticated with the mounted token of ServiceAccountTokenPath.
+type TokenRequest struct {
+	// Audiences of the requested token, they have to match the bound audiences of the Vault role
+	Audiences []string
+	// ExpirationSeconds of the requested token, 0 uses the default of the API server
+	ExpirationSeconds int64
+	// ServiceAccount is the name of the service account, if empty the name is read from the
+	// mounted token
+	ServiceAccount string
+	// Namespace of the service account, if empty the namespace of the pod is used
+	Namespace string
+
+	// clientset of the API server, set by tests
+	clientset kubernetes.Interface
+}
+
+// requestToken returns a token of the TokenRequest API, saToken authenticates the request
+func (tr *TokenRequest) requestToken(ctx context.Context, saToken string) (string, error) {
+	name := tr.ServiceAccount
+	if name == "" {
+		var err error
+		if name, err = serviceAccountName(saToken); err != nil {
+			return "", err
+		}
+	}
+	namespace := tr.Namespace
+	if namespace == "" {
+		var err error
+		if namespace, err = podNamespace(); err != nil {
+			return "", err
+		}
+	}
+	clientset := tr.clientset
+	if clientset == nil {
+		config, err := inClusterConfig("")
+		if err != nil {
+			return "", err
+		}
+		config.BearerToken = saToken
+		if clientset, err = kubernetes.NewForConfig(config); err != nil {
+			return "", err
+		}
+	}
+	req := &authenticationv1.TokenRequest{
+		Spec: authenticationv1.TokenRequestSpec{
+			Audiences: tr.Audiences,
+		},
+	}
+	if tr.ExpirationSeconds > 0 {
+		req.Spec.ExpirationSeconds = &tr.ExpirationSeconds
+	}
+	result, err := clientset.CoreV1().ServiceAccounts(namespace).CreateToken(ctx, name, req, metav1.CreateOptions{})
+	if err != nil {
+		return "", errors.Wrap(err, "token request failed")
+	}
+	if result.Status.Token == "" {
+		return "", errors.New("token request returned no token")
+	}
+	return result.Status.Token, nil
+}
+
+// inClusterConfig returns the in-cluster configuration of the API server, a non-empty tokenPath
+// replaces the mounted service account token
+func inClusterConfig(tokenPath string) (*rest.Config, error) {
+	config, err := rest.InClusterConfig()
+	if err != nil {
+		return nil, err
+	}
+	config.Timeout = inClusterTimeout
+	if tokenPath != "" {
+		config.BearerToken, config.BearerTokenFile = "", tokenPath
+	}
+	return config, nil
+}
+
+// podNamespace returns the namespace of the pod
+func podNamespace() (string, error) {
+	content, err := ioutil.ReadFile(ServiceAccountNamespacePath)
+	if err != nil {
+		return "", errors.Wrap(err, "failed to read namespace")
+	}
+	return string(bytes.TrimSpace(content)), nil
+}
+
+// serviceAccountName returns the service account name of the claims of a service account token
+func serviceAccountName(jwt string) (string, error) {
+	parts := strings.Split(jwt, ".")
+	if len(parts) != 3 {
+		return "", errors.New("invalid service account token")
+	}
+	payload, err := base64.RawURLEncoding.DecodeString(strings.TrimRight(parts[1], "="))
+	if err != nil {
+		return "", errors.Wrap(err, "invalid service account token")
+	}
+	claims := struct {
+		Name       string `json:"kubernetes.io/serviceaccount/service-account.name"`
+		Kubernetes struct {
+			ServiceAccount struct {
+				Name string `json:"name"`
+			} `json:"serviceaccount"`
+		} `json:"kubernetes.io"`
+	}{}
+	if err := json.Unmarshal(payload, &claims); err != nil {
+		return "", errors.Wrap(err, "invalid service account token")
+	}
+	// projected tokens use the nested claim
+	if claims.Kubernetes.ServiceAccount.Name != "" {
+		return claims.Kubernetes.ServiceAccount.Name, nil
+	}
+	if claims.Name != "" {
+		return claims.Name, nil
+	}
+	return "", errors.New("service account name not found in service account token")
+}
+
+// jwtAudiences returns the audiences of the claims of a JWT, nil if the JWT cannot be decoded
+func jwtAudiences(jwt string) []string {
+	parts := strings.Split(jwt, ".")
+	if len(parts) != 3 {
+		return nil
+	}
+	payload, err := base64.RawURLEncoding.DecodeString(strings.TrimRight(parts[1], "="))
+	if err != nil {
+		return nil
+	}
+	claims := struct {
+		Aud interface{} `json:"aud"`
+	}{}
+	if err := json.Unmarshal(payload, &claims); err != nil {
+		return nil
+	}
+	switch aud := claims.Aud.(type) {
+	case string:
+		return []string{aud}
+	case []interface{}:
+		var audiences []string
+		for _, a := range aud {
+			if s, ok := a.(string); ok {
+				audiences = append(audiences, s)
+			}
+		}
+		return audiences
+	}
+	return nil
+}
@@ -0,0 +1,76 @@
+package k8s
+
+import (
+	"context"
+	"net/http"
+	"time"
+
+	"github.com/pkg/errors"
+)
+
+// Errors of WaitForVault
+var (
+	ErrVaultSealed         = errors.New("vault is sealed")
+	ErrVaultNotInitialized = errors.New("vault is not initialized")
+)
+
+// UnreachableError is returned by WaitForVault if the health endpoint of Vault cannot be reached
+type UnreachableError struct {
+	Address string
+	Err     error
+}
+
+func (e *UnreachableError) Error() string {
+	return "vault " + e.Address + " is unreachable: " + e.Err.Error()
+}
+
+// waitInterval is the interval of the health checks of WaitForVault, it will be overwritten by tests
+var waitInterval = time.Second
+
+// healthError returns the error of the status of sys/health
+func healthError(status int, err error) error {
+	if err != nil {
+		return err
+	}
+	switch status {
+	case http.StatusOK, http.StatusTooManyRequests, 472, 473:
+		// active, standby, disaster recovery or performance standby
+		return nil
+	case http.StatusNotImplemented:
+		return ErrVaultNotInitialized
+	case http.StatusServiceUnavailable:
+		return ErrVaultSealed
+	}
+	return errors.Errorf("unexpected vault health status %d", status)
+}
+
+// WaitForVault polls sys/health until Vault is initialized and unsealed, ctx and timeout bound the
+// wait, 0 waits until ctx is done
+// If Vault is not ready in time the error of the last check is returned, ErrVaultSealed,
+// ErrVaultNotInitialized or an *UnreachableError.
+func (v *Vault) WaitForVault(ctx context.Context, timeout time.Duration) error {
+	if timeout > 0 {
+		var cancel context.CancelFunc
+		ctx, cancel = context.WithTimeout(ctx, timeout)
+		defer cancel()
+	}
+	address := v.client.Address()
+	for {
+		status, err := vaultHealth(ctx, v.client, address)
+		if err != nil {
+			err = &UnreachableError{Address: address, Err: err}
+		}
+		err = healthError(status, err)
+		if err == nil {
+			return nil
+		}
+		v.log().Debug("waiting for vault", "address", address, "error", err)
+		t := time.NewTimer(waitInterval)
+		select {
+		case <-ctx.Done():
+			t.Stop()
+			return err
+		case <-t.C:
+		}
+	}
+}
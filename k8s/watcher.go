@@ -0,0 +1,159 @@
+package k8s
+
+import (
+	"context"
+	"sync"
+	"time"
+)
+
+// eventBuffer is the capacity of the event channels of a Vault and a Watcher
+const eventBuffer = 16
+
+// EventType is the type of a lifecycle event of the token
+type EventType string
+
+// Lifecycle events of the token
+const (
+	// EventAuthenticated is the first login of Run, a token loaded from TokenPath has none
+	EventAuthenticated EventType = "authenticated"
+	// EventReAuthenticated is a login of Run replacing the previous token
+	EventReAuthenticated EventType = "reauthenticated"
+	EventStored          EventType = "stored"
+	EventRenewed         EventType = "renewed"
+	// EventRenewalFailed is sent if the renewal stopped with an error
+	EventRenewalFailed EventType = "renewal_failed"
+	// EventRenewalStopped is sent if the renewal stopped without an error, e.g. the max TTL is
+	// reached
+	EventRenewalStopped    EventType = "renewal_stopped"
+	EventCredentialChanged EventType = "credential_changed"
+	// EventRevoked is sent if Close revoked the token or the renewal was denied, e.g. the token
+	// was revoked by someone else
+	EventRevoked EventType = "revoked"
+
+	// Deprecated: use EventReAuthenticated
+	EventLogin = EventReAuthenticated
+)
+
+// Event of the lifecycle of the token
+type Event struct {
+	Type EventType
+	// Token of EventAuthenticated, EventReAuthenticated, EventStored and EventRevoked
+	Token string
+	// TTL of the token of EventAuthenticated, EventReAuthenticated and EventRenewed
+	TTL time.Duration
+	// Err of EventRenewalFailed and EventRevoked
+	Err error
+}
+
+// eventStream is a buffered channel of events which never blocks the sender, if it is full the
+// oldest event is dropped so the latest events, e.g. a login, are always delivered
+type eventStream struct {
+	mu     sync.Mutex
+	ch     chan Event
+	closed bool
+}
+
+// channel returns the channel of s, it is created by the first call
+func (s *eventStream) channel() <-chan Event {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	if s.ch == nil {
+		s.ch = make(chan Event, eventBuffer)
+		if s.closed {
+			close(s.ch)
+		}
+	}
+	return s.ch
+}
+
+// send sends e if the channel was created and is not closed, it returns the dropped events
+func (s *eventStream) send(e Event) (dropped []EventType) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	if s.ch == nil || s.closed {
+		return nil
+	}
+	for {
+		select {
+		case s.ch <- e:
+			return dropped
+		default:
+		}
+		select {
+		case old := <-s.ch:
+			dropped = append(dropped, old.Type)
+		default:
+		}
+	}
+}
+
+// close closes the channel, later events are discarded
+func (s *eventStream) close() {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	if s.closed {
+		return
+	}
+	s.closed = true
+	if s.ch != nil {
+		close(s.ch)
+	}
+}
+
+// Events returns the channel of the lifecycle events of the token of Run and Close, it is closed by
+// Close
+// Events are only sent after the first call. If the channel is full the oldest event is dropped,
+// the latest events are always delivered.
+func (v *Vault) Events() <-chan Event {
+	return v.events.channel()
+}
+
+// emit sends e to the events of v and of w, w may be nil
+func (v *Vault) emit(w *Watcher, e Event) {
+	if v.LockedToken {
+		e.Token = ""
+	}
+	for _, t := range v.events.send(e) {
+		v.log().Debug("event dropped", "type", t)
+	}
+	w.emit(e)
+}
+
+// Watcher renews the token with an api.LifetimeWatcher, authenticates again and stores the new
+// token like Run and sends the lifecycle events to a channel
+type Watcher struct {
+	v      *Vault
+	events *eventStream
+}
+
+// NewWatcher returns a Watcher of v
+func (v *Vault) NewWatcher() *Watcher {
+	w := &Watcher{
+		v:      v,
+		events: &eventStream{},
+	}
+	w.events.channel()
+	return w
+}
+
+// Events returns the channel of the lifecycle events, it is closed when Run returns
+// If the channel is full the oldest event is dropped, the latest events are always delivered.
+func (w *Watcher) Events() <-chan Event {
+	return w.events.channel()
+}
+
+// Run is Vault.Run sending the lifecycle events, it can only be called once
+func (w *Watcher) Run(ctx context.Context) error {
+	defer w.events.close()
+	return w.v.run(ctx, w)
+}
+
+// emit sends e without blocking, w may be nil
+func (w *Watcher) emit(e Event) {
+	if w == nil {
+		return
+	}
+	for _, t := range w.events.send(e) {
+		w.v.log().Debug("event dropped", "type", t)
+	}
+}
@@ -0,0 +1,73 @@
+package k8s
+
+import (
+	"strconv"
+	"strings"
+
+	"github.com/hashicorp/vault/api"
+	"github.com/pkg/errors"
+)
+
+// wrappingClient returns a clone of the Vault client c requesting a response wrapped with WrapTTL
+// for the login, other requests of the login like unwrapping a secret ID are not wrapped
+func (v *Vault) wrappingClient(c *api.Client) (*api.Client, error) {
+	clone, err := c.Clone()
+	if err != nil {
+		return nil, errors.Wrap(err, "failed to clone vault client")
+	}
+	clone.SetToken(c.Token())
+	clone.SetHeaders(c.Headers())
+	ttl := strconv.Itoa(int(v.WrapTTL.Seconds())) + "s"
+	clone.SetWrappingLookupFunc(func(operation, p string) string {
+		if !isLoginPath(p) {
+			return ""
+		}
+		return ttl
+	})
+	return clone, nil
+}
+
+// isLoginPath returns true if p is the login of an auth method, e.g. auth/kubernetes/login or
+// auth/userpass/login/user
+func isLoginPath(p string) bool {
+	p = strings.Trim(p, "/")
+	if !strings.HasPrefix(p, "auth/") {
+		return false
+	}
+	return strings.HasSuffix(p, "/login") || strings.Contains(p, "/login/")
+}
+
+// loginClient returns a clone of the Vault client c with the timeout LoginTimeout
+func (v *Vault) loginClient(c *api.Client) (*api.Client, error) {
+	clone, err := c.Clone()
+	if err != nil {
+		return nil, errors.Wrap(err, "failed to clone vault client")
+	}
+	clone.SetToken(c.Token())
+	clone.SetHeaders(c.Headers())
+	clone.SetClientTimeout(v.LoginTimeout)
+	return clone, nil
+}
+
+// UnwrapToken returns the client token of the response-wrapped login wrappingToken
+// A wrapping token can only be unwrapped once.
+func UnwrapToken(c *api.Client, wrappingToken string) (string, error) {
+	s, err := vaultUnwrap(c, wrappingToken)
+	if err != nil {
+		return "", errors.Wrap(err, "failed to unwrap token")
+	}
+	if s == nil || s.Auth == nil || s.Auth.ClientToken == "" {
+		return "", errors.New("unwrapped data contains no token")
+	}
+	return s.Auth.ClientToken, nil
+}
+
+// LoadWrappedToken loads the wrapping token stored by a Vault with WrapTTL and returns the
+// unwrapped client token
+func (v *Vault) LoadWrappedToken() (string, error) {
+	wrappingToken, err := v.LoadToken()
+	if err != nil {
+		return "", err
+	}
+	return UnwrapToken(v.client, wrappingToken)
+}
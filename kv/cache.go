@@ -0,0 +1,107 @@
+package kv
+
+import (
+	"fmt"
+	"sync"
+	"time"
+)
+
+// StaleError is returned together with the cached data of a secret if the live request failed
+type StaleError struct {
+	Err error
+	Age time.Duration
+}
+
+func (e *StaleError) Error() string {
+	return fmt.Sprintf("stale secret (age %s): %s", e.Age, e.Err)
+}
+
+// Cause returns the error of the failed live request
+func (e *StaleError) Cause() error {
+	return e.Err
+}
+
+// Unwrap returns the error of the failed live request
+func (e *StaleError) Unwrap() error {
+	return e.Err
+}
+
+// IsStale returns true if the data returned with err was served from the cache
+func IsStale(err error) bool {
+	return hasCause(err, func(err error) bool {
+		_, ok := err.(*StaleError)
+		return ok
+	})
+}
+
+// WithStaleIfError caches every secret read successfully, if a later read of the same
+// secret fails, the cached data is returned together with a *StaleError as long as it
+// is not older than maxStale
+func WithStaleIfError(maxStale time.Duration) Option {
+	return func(c *Client) error {
+		c.cache = &readCache{
+			maxStale: maxStale,
+			entries:  make(map[string]cacheEntry),
+		}
+		return nil
+	}
+}
+
+type cacheEntry struct {
+	data    map[string]interface{}
+	meta    *SecretMeta
+	created time.Time
+}
+
+// readCache holds the last successfully read data per secret path
+type readCache struct {
+	mu       sync.Mutex
+	maxStale time.Duration
+	entries  map[string]cacheEntry
+}
+
+// set the cached data of path p, nil data removes the entry
+func (rc *readCache) set(p string, data map[string]interface{}, meta *SecretMeta) {
+	rc.mu.Lock()
+	defer rc.mu.Unlock()
+	if data == nil {
+		delete(rc.entries, p)
+		return
+	}
+	rc.entries[p] = cacheEntry{data: copyMap(data), meta: meta, created: time.Now()}
+}
+
+// invalidate removes the entries of the paths matched by match
+func (rc *readCache) invalidate(match func(p string) bool) {
+	rc.mu.Lock()
+	defer rc.mu.Unlock()
+	for p := range rc.entries {
+		if match(p) {
+			delete(rc.entries, p)
+		}
+	}
+}
+
+// stale returns the cached data of path p with a *StaleError or err if no usable entry exists
+func (rc *readCache) stale(p string, err error) (map[string]interface{}, *SecretMeta, error) {
+	rc.mu.Lock()
+	defer rc.mu.Unlock()
+	e, ok := rc.entries[p]
+	if !ok {
+		return nil, nil, err
+	}
+	age := time.Since(e.created)
+	if age > rc.maxStale {
+		return nil, nil, err
+	}
+	return copyMap(e.data), e.meta, &StaleError{Err: err, Age: age}
+}
+
+// copyMap returns a shallow copy of m
+func copyMap(m map[string]interface{}) map[string]interface{} {
+	c := make(map[string]interface{}, len(m))
+	for k, v := range m {
+		c[k] = v
+	}
+	return c
+}
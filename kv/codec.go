@@ -0,0 +1,126 @@
+package kv
+
+import (
+	"bytes"
+	"encoding/base64"
+	"encoding/gob"
+	"encoding/json"
+	"fmt"
+
+	"gopkg.in/yaml.v2"
+)
+
+// Codec encodes values to strings stored in a key of a secret and decodes them
+type Codec interface {
+	Encode(v interface{}) (string, error)
+	Decode(s string, v interface{}) error
+}
+
+// Codecs
+var (
+	// JSONCodec stores values as JSON
+	JSONCodec Codec = jsonCodec{}
+	// YAMLCodec stores values as YAML
+	YAMLCodec Codec = yamlCodec{}
+	// GobCodec stores values as base64 encoded gob, the types have to be registered with gob.Register
+	// if they are stored in interface values
+	GobCodec Codec = gobCodec{}
+)
+
+// WithCodec sets the codec of ReadValue and WriteValue, defaults to JSONCodec
+func WithCodec(codec Codec) Option {
+	return func(c *Client) error {
+		if codec == nil {
+			return fmt.Errorf("missing codec")
+		}
+		c.codec = codec
+		return nil
+	}
+}
+
+// ReadValue reads the secret p and decodes the value of key into v with the codec of the client
+func (c *Client) ReadValue(p, key string, v interface{}) error {
+	data, err := c.Read(p)
+	if err != nil {
+		return err
+	}
+	if data == nil {
+		return c.wrap(opRead, p, fmt.Errorf("secret %s not found", p))
+	}
+	raw, ok := data[key]
+	if !ok {
+		return c.wrap(opRead, p, fmt.Errorf("key %s not found in secret %s", key, p))
+	}
+	s, ok := raw.(string)
+	if !ok {
+		return c.wrap(opRead, p, fmt.Errorf("value of key %s in secret %s is not a string", key, p))
+	}
+	if err := c.valueCodec().Decode(s, v); err != nil {
+		return c.wrap(opRead, p, fmt.Errorf("failed to decode key %s: %s", key, err))
+	}
+	return nil
+}
+
+// WriteValue encodes v with the codec of the client and writes it as value of key to the secret p,
+// the other keys of the secret are kept
+func (c *Client) WriteValue(p, key string, v interface{}) error {
+	s, err := c.valueCodec().Encode(v)
+	if err != nil {
+		return c.wrap(opWrite, p, fmt.Errorf("failed to encode key %s: %s", key, err))
+	}
+	return c.Update(p, func(data map[string]interface{}) (map[string]interface{}, error) {
+		if data == nil {
+			data = map[string]interface{}{}
+		}
+		data[key] = s
+		return data, nil
+	})
+}
+
+// valueCodec returns the codec of the client
+func (c *Client) valueCodec() Codec {
+	if c.codec == nil {
+		return JSONCodec
+	}
+	return c.codec
+}
+
+type jsonCodec struct{}
+
+func (jsonCodec) Encode(v interface{}) (string, error) {
+	b, err := json.Marshal(v)
+	return string(b), err
+}
+
+func (jsonCodec) Decode(s string, v interface{}) error {
+	return json.Unmarshal([]byte(s), v)
+}
+
+type yamlCodec struct{}
+
+func (yamlCodec) Encode(v interface{}) (string, error) {
+	b, err := yaml.Marshal(v)
+	return string(b), err
+}
+
+func (yamlCodec) Decode(s string, v interface{}) error {
+	return yaml.Unmarshal([]byte(s), v)
+}
+
+type gobCodec struct{}
+
+func (gobCodec) Encode(v interface{}) (string, error) {
+	var b bytes.Buffer
+	if err := gob.NewEncoder(&b).Encode(v); err != nil {
+		return "", err
+	}
+	return base64.StdEncoding.EncodeToString(b.Bytes()), nil
+}
+
+func (gobCodec) Decode(s string, v interface{}) error {
+	b, err := base64.StdEncoding.DecodeString(s)
+	if err != nil {
+		return err
+	}
+	return gob.NewDecoder(bytes.NewReader(b)).Decode(v)
+}
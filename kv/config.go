@@ -0,0 +1,79 @@
+package kv
+
+import (
+	"fmt"
+	"net/http"
+	"strings"
+	"time"
+)
+
+// MountConfig is the configuration of a K/V version 2 mount
+type MountConfig struct {
+	// MaxVersions is the number of versions kept per secret, 0 means the default of Vault (10)
+	MaxVersions int
+	// CASRequired requires check-and-set for all writes
+	CASRequired bool
+	// DeleteVersionAfter deletes versions automatically after the duration, 0 disables it
+	DeleteVersionAfter time.Duration
+}
+
+// MountConfig reads the configuration of the mount from <mount>/config (version 2 only)
+func (c *Client) MountConfig() (*MountConfig, error) {
+	if err := c.init(); err != nil {
+		return nil, c.wrap(opConfig, c.Mount, err)
+	}
+	return c.mountConfig()
+}
+
+// mountConfig reads the configuration of the mount without initializing a lazy client
+func (c *Client) mountConfig() (*MountConfig, error) {
+	if c.Version != 2 {
+		return nil, c.wrap(opConfig, c.Mount, fmt.Errorf("mount config is not supported by K/V version %d", c.Version))
+	}
+	s, err := c.request(http.MethodGet, c.configPath(), nil, nil)
+	if err != nil {
+		return nil, c.wrap(opConfig, c.Mount, err)
+	}
+	cfg := &MountConfig{}
+	if s == nil || s.Data == nil {
+		return cfg, nil
+	}
+	cfg.MaxVersions = toInt(s.Data["max_versions"])
+	cfg.CASRequired, _ = s.Data["cas_required"].(bool)
+	if v, ok := s.Data["delete_version_after"].(string); ok {
+		d, err := time.ParseDuration(v)
+		if err != nil {
+			return nil, c.wrap(opConfig, c.Mount, fmt.Errorf("invalid delete_version_after %q: %s", v, err))
+		}
+		cfg.DeleteVersionAfter = d
+	}
+	return cfg, nil
+}
+
+// TuneMountConfig writes the configuration cfg of the mount to <mount>/config (version 2 only),
+// all settings of cfg are written and the token needs update capabilities on <mount>/config
+func (c *Client) TuneMountConfig(cfg MountConfig) error {
+	if err := c.init(); err != nil {
+		return c.wrap(opConfig, c.Mount, err)
+	}
+	if c.Version != 2 {
+		return c.wrap(opConfig, c.Mount, fmt.Errorf("mount config is not supported by K/V version %d", c.Version))
+	}
+	_, err := c.request(http.MethodPut, c.configPath(), nil, map[string]interface{}{
+		"max_versions":         cfg.MaxVersions,
+		"cas_required":         cfg.CASRequired,
+		"delete_version_after": cfg.DeleteVersionAfter.String(),
+	})
+	if err != nil {
+		return c.wrap(opConfig, c.Mount, err)
+	}
+	if !c.noAutoCAS {
+		c.setCASRequired(cfg.CASRequired)
+	}
+	return nil
+}
+
+// configPath returns the path of the mount configuration
+func (c *Client) configPath() string {
+	return strings.TrimSuffix(c.Mount, "/") + "/config"
+}
@@ -0,0 +1,200 @@
+package kv
+
+import (
+	"bufio"
+	"encoding/json"
+	"fmt"
+	"io"
+	"path"
+	"regexp"
+	"sort"
+	"strings"
+)
+
+// envKey matches valid names of environment variables
+var envKey = regexp.MustCompile(`^[A-Za-z_][A-Za-z0-9_]*$`)
+
+// EnvFormat is the output format of ExportEnv
+type EnvFormat int
+
+// Output formats of ExportEnv
+const (
+	EnvFormatDotenv EnvFormat = iota // KEY="value"
+	EnvFormatExport                  // export KEY='value'
+)
+
+// ImportOptions for ImportEnvFile
+type ImportOptions struct {
+	// SecretPerKey writes one secret per key below p instead of a single secret p
+	SecretPerKey bool
+	// ValueKey is the key of the value in the secrets written with SecretPerKey, defaults to "value"
+	ValueKey string
+}
+
+// ImportEnvFile parses KEY=value pairs from the dotenv file r and writes them as secret p
+// Empty lines, comments (#) and a leading "export " are ignored, values may be single or double quoted
+func (c *Client) ImportEnvFile(p string, r io.Reader, opts ImportOptions) error {
+	return c.wrap(opImport, p, c.importEnvFile(p, r, opts))
+}
+
+// importEnvFile parses the dotenv file r and writes the secrets
+func (c *Client) importEnvFile(p string, r io.Reader, opts ImportOptions) error {
+	env, err := parseEnv(r)
+	if err != nil {
+		return err
+	}
+	if !opts.SecretPerKey {
+		data := make(map[string]interface{}, len(env))
+		for k, v := range env {
+			data[k] = v
+		}
+		return c.Write(p, data)
+	}
+	valueKey := opts.ValueKey
+	if valueKey == "" {
+		valueKey = "value"
+	}
+	for k, v := range env {
+		if err := c.Write(path.Join(p, k), map[string]interface{}{valueKey: v}); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// parseEnv parses the KEY=value pairs of a dotenv file
+func parseEnv(r io.Reader) (map[string]string, error) {
+	env := map[string]string{}
+	scanner := bufio.NewScanner(r)
+	n := 0
+	for scanner.Scan() {
+		n++
+		line := strings.TrimSpace(scanner.Text())
+		if line == "" || strings.HasPrefix(line, "#") {
+			continue
+		}
+		line = strings.TrimPrefix(line, "export ")
+		i := strings.IndexRune(line, '=')
+		if i < 0 {
+			return nil, fmt.Errorf("line %d: missing '='", n)
+		}
+		key := strings.TrimSpace(line[:i])
+		if !envKey.MatchString(key) {
+			return nil, fmt.Errorf("line %d: invalid key %q", n, key)
+		}
+		value, err := parseEnvValue(strings.TrimSpace(line[i+1:]))
+		if err != nil {
+			return nil, fmt.Errorf("line %d: %s", n, err)
+		}
+		env[key] = value
+	}
+	if err := scanner.Err(); err != nil {
+		return nil, err
+	}
+	return env, nil
+}
+
+// parseEnvValue removes quotes and comments from the value of a dotenv line
+func parseEnvValue(v string) (string, error) {
+	switch {
+	case strings.HasPrefix(v, "'"):
+		end := strings.IndexRune(v[1:], '\'')
+		if end < 0 {
+			return "", fmt.Errorf("unterminated single quoted value")
+		}
+		return v[1 : end+1], nil
+	case strings.HasPrefix(v, `"`):
+		var b strings.Builder
+		for i := 1; i < len(v); i++ {
+			switch v[i] {
+			case '"':
+				return b.String(), nil
+			case '\\':
+				if i+1 == len(v) {
+					return "", fmt.Errorf("unterminated double quoted value")
+				}
+				i++
+				switch v[i] {
+				case 'n':
+					b.WriteByte('\n')
+				case 'r':
+					b.WriteByte('\r')
+				case 't':
+					b.WriteByte('\t')
+				default:
+					b.WriteByte(v[i])
+				}
+			default:
+				b.WriteByte(v[i])
+			}
+		}
+		return "", fmt.Errorf("unterminated double quoted value")
+	}
+	if i := strings.Index(v, " #"); i >= 0 {
+		v = v[:i]
+	}
+	return strings.TrimSpace(v), nil
+}
+
+// ExportEnv writes the secret p as KEY=value lines sorted by key to w
+// EnvFormatDotenv lines can be read by ImportEnvFile, EnvFormatExport lines can be sourced by a shell
+// Values which are not strings are written as JSON
+func (c *Client) ExportEnv(p string, w io.Writer, format EnvFormat) error {
+	return c.wrap(opExport, p, c.exportEnv(p, w, format))
+}
+
+// exportEnv writes the secret p as KEY=value lines to w
+func (c *Client) exportEnv(p string, w io.Writer, format EnvFormat) error {
+	if err := c.init(); err != nil {
+		return err
+	}
+	data, _, err := c.read(p)
+	if err != nil {
+		return err
+	}
+	if data == nil {
+		return fmt.Errorf("secret %s not found", p)
+	}
+	keys := make([]string, 0, len(data))
+	for k := range data {
+		if !envKey.MatchString(k) {
+			return fmt.Errorf("key %q of secret %s is not a valid environment variable name", k, p)
+		}
+		keys = append(keys, k)
+	}
+	sort.Strings(keys)
+	for _, k := range keys {
+		v, ok := data[k].(string)
+		if !ok {
+			b, err := json.Marshal(data[k])
+			if err != nil {
+				return err
+			}
+			v = string(b)
+		}
+		var line string
+		switch format {
+		case EnvFormatDotenv:
+			line = fmt.Sprintf("%s=%s\n", k, quoteDotenv(v))
+		case EnvFormatExport:
+			line = fmt.Sprintf("export %s=%s\n", k, quoteShell(v))
+		default:
+			return fmt.Errorf("unknown env format %d", format)
+		}
+		if _, err := io.WriteString(w, line); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// quoteDotenv returns v double quoted with escaped special characters
+func quoteDotenv(v string) string {
+	r := strings.NewReplacer(`\`, `\\`, `"`, `\"`, "$", `\$`, "\n", `\n`, "\r", `\r`, "\t", `\t`)
+	return `"` + r.Replace(v) + `"`
+}
+
+// quoteShell returns v single quoted for POSIX shells
+func quoteShell(v string) string {
+	return "'" + strings.Replace(v, "'", `'\''`, -1) + "'"
+}
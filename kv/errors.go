@@ -0,0 +1,151 @@
+package kv
+
+import (
+	"fmt"
+	"net"
+	"net/url"
+	"regexp"
+	"strings"
+	"time"
+	"unicode"
+)
+
+// maxErrorPathLen is the maximum length of a path in an Error
+const maxErrorPathLen = 256
+
+// Error is returned by the operations of a Client, it records the operation, the mount and the
+// path of the secret, the original error is available with errors.Cause
+type Error struct {
+	Op    string
+	Mount string
+	Path  string
+	Err   error
+}
+
+func (e *Error) Error() string {
+	return fmt.Sprintf("kv %s %s (mount %s): %s", e.Op, e.Path, e.Mount, e.Err)
+}
+
+// Cause returns the original error
+func (e *Error) Cause() error {
+	return e.Err
+}
+
+// Unwrap returns the original error
+func (e *Error) Unwrap() error {
+	return e.Err
+}
+
+// wrap err in an *Error with the operation op and the path p
+// nil and errors that are already an *Error are returned unchanged
+func (c *Client) wrap(op, p string, err error) error {
+	if err == nil {
+		return nil
+	}
+	if _, ok := err.(*Error); ok {
+		return err
+	}
+	return &Error{
+		Op:    op,
+		Mount: c.Mount,
+		Path:  sanitizePath(p),
+		Err:   err,
+	}
+}
+
+// sanitizePath replaces control characters in p, so that it cannot break log lines, and truncates it
+func sanitizePath(p string) string {
+	p = strings.Map(func(r rune) rune {
+		if unicode.IsControl(r) {
+			return '?'
+		}
+		return r
+	}, p)
+	if len(p) > maxErrorPathLen {
+		p = p[:maxErrorPathLen] + "..."
+	}
+	return p
+}
+
+// DeletedError is returned if the latest version of a secret on a K/V version 2 is deleted or destroyed
+// Deleted versions can be recovered with undelete until they are destroyed
+type DeletedError struct {
+	Path string
+	Meta SecretMeta
+}
+
+func (e *DeletedError) Error() string {
+	if e.Meta.Destroyed {
+		return fmt.Sprintf("secret %s version %d is destroyed", e.Path, e.Meta.Version)
+	}
+	return fmt.Sprintf("secret %s version %d was deleted at %s", e.Path, e.Meta.Version, e.Meta.DeletionTime.Format(time.RFC3339))
+}
+
+// Cause returns ErrSecretDeleted
+func (e *DeletedError) Cause() error {
+	return ErrSecretDeleted
+}
+
+// Unwrap returns ErrSecretDeleted
+func (e *DeletedError) Unwrap() error {
+	return ErrSecretDeleted
+}
+
+// ReservedKeyError is returned with WithReservedKeyCheck if data written to a K/V version 2 contains
+// a top-level key of the request envelope (data or options), which usually means the data is
+// wrapped twice
+type ReservedKeyError struct {
+	Path string
+	Key  string
+}
+
+func (e *ReservedKeyError) Error() string {
+	return fmt.Sprintf("secret %s contains reserved key %q", e.Path, e.Key)
+}
+
+// Cause returns ErrReservedKey
+func (e *ReservedKeyError) Cause() error {
+	return ErrReservedKey
+}
+
+// Unwrap returns ErrReservedKey
+func (e *ReservedKeyError) Unwrap() error {
+	return ErrReservedKey
+}
+
+// IsDeleted returns true if err is caused by a deleted or destroyed secret
+func IsDeleted(err error) bool {
+	return hasCause(err, func(err error) bool {
+		return err == ErrSecretDeleted
+	})
+}
+
+// hasCause returns true if fn returns true for err or one of its causes
+func hasCause(err error, fn func(error) bool) bool {
+	for err != nil {
+		if fn(err) {
+			return true
+		}
+		c, ok := err.(interface{ Cause() error })
+		if !ok {
+			return false
+		}
+		err = c.Cause()
+	}
+	return false
+}
+
+// serverErrorCode matches the status code of a server error in an error of the Vault API
+var serverErrorCode = regexp.MustCompile(`Code: 5[0-9][0-9]\.`)
+
+// isUnreachable returns true if err is caused by a connection error or a server error of Vault,
+// client errors like a permission denied response are not
+func isUnreachable(err error) bool {
+	return hasCause(err, func(err error) bool {
+		switch err.(type) {
+		case net.Error, *url.Error:
+			return true
+		}
+		return serverErrorCode.MatchString(err.Error())
+	})
+}
@@ -0,0 +1,221 @@
+package kv
+
+import (
+	"context"
+	"encoding/json"
+	"net/http"
+	"net/url"
+	"strings"
+	"time"
+
+	"github.com/gorilla/websocket"
+	"github.com/hashicorp/vault/api"
+	"github.com/pkg/errors"
+)
+
+// kvEventType is the event type of the subscription, all events of K/V version 2 mounts
+const kvEventType = "kv-v2/*"
+
+// defaultEventRetryInterval is the interval between subscriptions if EventOptions.RetryInterval is 0
+const defaultEventRetryInterval = 5 * time.Second
+
+// maxEventSize is the maximum size of an event message
+const maxEventSize = 1 << 20
+
+// EventOptions for WatchEvents
+type EventOptions struct {
+	// OnChange is called with the path of every changed secret of the mount after it was removed
+	// from the caches, e.g. to read it again instead of polling it
+	OnChange func(p string)
+	// OnError is called if the subscription fails, it is subscribed again after RetryInterval
+	OnError func(err error)
+	// RetryInterval between the subscriptions, 0 uses 5s
+	RetryInterval time.Duration
+	// HTTPClient with the proxy and TLS configuration of Vault, nil uses the client of the VAULT_*
+	// environment variables
+	HTTPClient *http.Client
+}
+
+// WatchEvents subscribes to the events of K/V version 2 mounts over the events websocket API of
+// Vault 1.16 or newer until ctx is done, removes every changed secret of the mount from the caches
+// of WithStaleIfError and WithOfflineSnapshot and calls OnChange
+// The subscription is renewed after failures, it returns nil when ctx is done. The token needs read
+// capabilities on sys/events/subscribe/kv-v2/* and list and subscribe capabilities on the paths of
+// the mount.
+func (c *Client) WatchEvents(ctx context.Context, opts EventOptions) error {
+	return c.watchEvents(ctx, opts, "")
+}
+
+// watchEvents subscribes to the events of the Vault at address, empty uses the address of the
+// Vault client
+func (c *Client) watchEvents(ctx context.Context, opts EventOptions, address string) error {
+	if opts.RetryInterval < 0 {
+		return errors.New("event retry interval must not be negative")
+	}
+	interval := opts.RetryInterval
+	if interval == 0 {
+		interval = defaultEventRetryInterval
+	}
+	for {
+		var err error
+		if c.lazy != nil {
+			err = c.initContext(ctx)
+		}
+		if err == nil {
+			if c.Version != 2 {
+				return errors.Errorf("events are not supported by K/V version %d", c.Version)
+			}
+			err = c.subscribe(ctx, opts, address)
+		}
+		if ctx.Err() != nil {
+			return nil
+		}
+		if opts.OnError != nil {
+			opts.OnError(err)
+		}
+		t := time.NewTimer(interval)
+		select {
+		case <-ctx.Done():
+			t.Stop()
+			return nil
+		case <-t.C:
+		}
+	}
+}
+
+// subscribe reads the events of one subscription until it fails or ctx is done
+func (c *Client) subscribe(ctx context.Context, opts EventOptions, address string) error {
+	u, h, err := c.eventRequest(address)
+	if err != nil {
+		return err
+	}
+	hc := opts.HTTPClient
+	if hc == nil {
+		config := api.DefaultConfig()
+		if config.Error != nil {
+			return errors.Wrap(config.Error, "failed to create vault config")
+		}
+		hc = config.HttpClient
+	}
+	conn, resp, err := websocketDialer(hc).DialContext(ctx, u, h)
+	if err != nil {
+		if resp != nil {
+			return errors.Wrapf(err, "failed to subscribe to events: %s", resp.Status)
+		}
+		return errors.Wrap(err, "failed to subscribe to events")
+	}
+	conn.SetReadLimit(maxEventSize)
+	done := make(chan struct{})
+	defer close(done)
+	go func() {
+		select {
+		case <-ctx.Done():
+		case <-done:
+		}
+		conn.Close()
+	}()
+	for {
+		_, msg, err := conn.ReadMessage()
+		if err != nil {
+			return errors.Wrap(err, "failed to read event")
+		}
+		p, ok := c.eventPath(msg)
+		if !ok {
+			continue
+		}
+		c.invalidate(p)
+		if opts.OnChange != nil {
+			opts.OnChange(p)
+		}
+	}
+}
+
+// websocketDialer returns a dialer with the proxy, the dial function and the TLS configuration of
+// the transport of hc
+func websocketDialer(hc *http.Client) *websocket.Dialer {
+	d := *websocket.DefaultDialer
+	if t, ok := hc.Transport.(*http.Transport); ok {
+		d.Proxy = t.Proxy
+		d.NetDialContext = t.DialContext
+		d.TLSClientConfig = t.TLSClientConfig
+	}
+	return &d
+}
+
+// eventRequest returns the URL and the headers of the subscription to the Vault at address
+func (c *Client) eventRequest(address string) (string, http.Header, error) {
+	if address == "" {
+		address = c.client.Address()
+	}
+	u, err := url.Parse(address)
+	if err != nil {
+		return "", nil, errors.Wrap(err, "invalid vault address")
+	}
+	if u.Scheme == "https" {
+		u.Scheme = "wss"
+	} else {
+		u.Scheme = "ws"
+	}
+	u.Path = "/v1/sys/events/subscribe/" + kvEventType
+	u.RawQuery = url.Values{"json": []string{"true"}}.Encode()
+	h := http.Header{}
+	for k, v := range c.client.Headers() {
+		h[k] = v
+	}
+	token := c.client.Token()
+	if c.tokens != nil {
+		if token, err = c.token(); err != nil {
+			return "", nil, err
+		}
+	}
+	h.Set("X-Vault-Token", token)
+	return u.String(), h, nil
+}
+
+// kvEvent is the part of a K/V version 2 event with the path of the secret
+type kvEvent struct {
+	Data struct {
+		Event struct {
+			Metadata struct {
+				Path     string `json:"path"`
+				DataPath string `json:"data_path"`
+			} `json:"metadata"`
+		} `json:"event"`
+	} `json:"data"`
+}
+
+// eventPath returns the path of the secret of the event msg without the data or metadata prefix,
+// false if the event is not about a secret of the mount
+func (c *Client) eventPath(msg []byte) (string, bool) {
+	e := kvEvent{}
+	if err := json.Unmarshal(msg, &e); err != nil {
+		return "", false
+	}
+	p := e.Data.Event.Metadata.DataPath
+	if p == "" {
+		p = e.Data.Event.Metadata.Path
+	}
+	mount := strings.TrimSuffix(c.Mount, "/") + "/"
+	if !strings.HasPrefix(p, mount) {
+		return "", false
+	}
+	parts := strings.SplitN(strings.TrimPrefix(p, mount), "/", 2)
+	if len(parts) != 2 || parts[1] == "" {
+		return "", false
+	}
+	return mount + parts[1], true
+}
+
+// invalidate removes the secret p from the caches
+func (c *Client) invalidate(p string) {
+	fixed := c.fixPath(p, ReadPrefix)
+	match := func(key string) bool {
+		return c.fixPath(key, ReadPrefix) == fixed
+	}
+	if c.cache != nil {
+		c.cache.invalidate(match)
+	}
+	if c.offline != nil {
+		c.offline.invalidate(match)
+	}
+}
@@ -0,0 +1,179 @@
+package kv
+
+import (
+	"context"
+	"errors"
+	"net/http"
+	"net/http/httptest"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/gorilla/websocket"
+	"github.com/hashicorp/vault/api"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+// eventServer returns a Vault with the events websocket API which sends the events msgs, closed is
+// closed when the subscription is closed
+func eventServer(t *testing.T, token string, msgs ...string) (srv *httptest.Server, closed <-chan struct{}) {
+	c := make(chan struct{})
+	upgrader := websocket.Upgrader{}
+	srv = httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		assert.Equal(t, "/v1/sys/events/subscribe/kv-v2/*", r.URL.Path)
+		assert.Equal(t, "true", r.URL.Query().Get("json"))
+		assert.Equal(t, token, r.Header.Get("X-Vault-Token"))
+		conn, err := upgrader.Upgrade(w, r, nil)
+		require.NoError(t, err)
+		defer conn.Close()
+		defer close(c)
+		for _, msg := range msgs {
+			require.NoError(t, conn.WriteMessage(websocket.TextMessage, []byte(msg)))
+		}
+		for {
+			if _, _, err := conn.ReadMessage(); err != nil {
+				return
+			}
+		}
+	}))
+	return srv, c
+}
+
+// events of a secret of another mount and of the changed secret secret/foo
+const (
+	otherEvent   = `{"data":{"event":{"metadata":{"path":"other/data/foo"}}}}`
+	changedEvent = `{"data":{"event":{"metadata":{"path":"secret/metadata/foo","data_path":"secret/data/foo"}}}}`
+)
+
+func TestWatchEvents(t *testing.T) {
+	srv, closed := eventServer(t, "token", otherEvent, changedEvent)
+	defer srv.Close()
+	vc, err := api.NewClient(api.DefaultConfig())
+	require.NoError(t, err)
+	vc.SetToken("token")
+	c := &Client{client: vc, Version: 2, Mount: "secret/"}
+
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+	changes := make(chan string, 2)
+	errc := make(chan error, 1)
+	go func() {
+		errc <- c.watchEvents(ctx, EventOptions{
+			OnChange: func(p string) { changes <- p },
+			OnError:  func(err error) { assert.NoError(t, err) },
+		}, srv.URL)
+	}()
+	select {
+	case p := <-changes:
+		assert.Equal(t, "secret/foo", p)
+	case <-time.After(5 * time.Second):
+		t.Fatal("no change event")
+	}
+
+	cancel()
+	require.NoError(t, <-errc)
+	select {
+	case <-closed:
+	case <-time.After(5 * time.Second):
+		t.Fatal("subscription not closed")
+	}
+
+	t.Run("version 1", func(t *testing.T) {
+		c := &Client{client: vc, Version: 1, Mount: "kv/"}
+		assert.Error(t, c.WatchEvents(context.Background(), EventOptions{}))
+	})
+
+	t.Run("failed subscription", func(t *testing.T) {
+		ctx, cancel := context.WithCancel(context.Background())
+		defer cancel()
+		srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+			w.WriteHeader(http.StatusForbidden)
+		}))
+		defer srv.Close()
+		failures := make(chan error, 1)
+		go func() {
+			_ = c.watchEvents(ctx, EventOptions{
+				OnError:       func(err error) { failures <- err },
+				RetryInterval: time.Hour,
+			}, srv.URL)
+		}()
+		select {
+		case err := <-failures:
+			assert.Contains(t, err.Error(), "403")
+		case <-time.After(5 * time.Second):
+			t.Fatal("no subscription error")
+		}
+	})
+}
+
+type switchLogical struct {
+	mu  sync.Mutex
+	err error
+}
+
+func (l *switchLogical) fail(err error) {
+	l.mu.Lock()
+	defer l.mu.Unlock()
+	l.err = err
+}
+
+func (l *switchLogical) ReadWithData(string, map[string][]string) (*api.Secret, error) {
+	l.mu.Lock()
+	defer l.mu.Unlock()
+	if l.err != nil {
+		return nil, l.err
+	}
+	return &api.Secret{Data: map[string]interface{}{"data": map[string]interface{}{"Bane": "unknown"}}}, nil
+}
+
+func (l *switchLogical) List(string) (*api.Secret, error) {
+	return nil, nil
+}
+
+func (l *switchLogical) Write(string, map[string]interface{}) (*api.Secret, error) {
+	return nil, nil
+}
+
+func (l *switchLogical) Delete(string) (*api.Secret, error) {
+	return nil, nil
+}
+
+func TestEventInvalidation(t *testing.T) {
+	srv, _ := eventServer(t, "", changedEvent)
+	defer srv.Close()
+	vc, err := api.NewClient(api.DefaultConfig())
+	require.NoError(t, err)
+	vc.ClearToken()
+	logical := &switchLogical{}
+	c, err := New(vc, "secret/", WithLogical(logical), WithStaleIfError(time.Hour), WithoutAutoCAS(),
+		WithDetector(func(*api.Client, string) (int, string, error) {
+			return 2, "secret/", nil
+		}))
+	require.NoError(t, err)
+	for _, p := range []string{"secret/foo", "secret/bar"} {
+		_, err = c.Read(p)
+		require.NoError(t, err)
+	}
+	logical.fail(errors.New("Code: 503. Errors: sealed"))
+	_, err = c.Read("secret/foo")
+	assert.True(t, IsStale(err))
+
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+	changes := make(chan string, 1)
+	go func() {
+		_ = c.watchEvents(ctx, EventOptions{OnChange: func(p string) { changes <- p }}, srv.URL)
+	}()
+	select {
+	case p := <-changes:
+		assert.Equal(t, "secret/foo", p)
+	case <-time.After(5 * time.Second):
+		t.Fatal("no change event")
+	}
+	_, err = c.Read("secret/foo")
+	assert.Error(t, err)
+	assert.False(t, IsStale(err))
+	_, err = c.Read("secret/bar")
+	assert.True(t, IsStale(err))
+}
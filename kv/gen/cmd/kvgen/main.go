@@ -0,0 +1,56 @@
+// Command kvgen generates Go constants for the secret paths and keys below a K/V folder
+//
+//	kvgen -prefix secret/app -package secrets -o secrets/secrets.go
+//
+// The Vault address and token are read from the environment (VAULT_ADDR, VAULT_TOKEN)
+package main
+
+import (
+	"flag"
+	"fmt"
+	"io"
+	"os"
+
+	"github.com/hashicorp/vault/api"
+	"github.com/postfinance/vault/kv"
+	"github.com/postfinance/vault/kv/gen"
+)
+
+func main() {
+	prefix := flag.String("prefix", "", "folder of the secrets (e.g. secret/app)")
+	pkg := flag.String("package", "secrets", "package name of the generated file")
+	out := flag.String("o", "", "output file (default stdout)")
+	flag.Parse()
+	if err := run(*prefix, *pkg, *out); err != nil {
+		fmt.Fprintln(os.Stderr, "kvgen:", err)
+		os.Exit(1)
+	}
+}
+
+func run(prefix, pkg, out string) error {
+	if prefix == "" {
+		return fmt.Errorf("missing prefix")
+	}
+	config := api.DefaultConfig()
+	if err := config.ReadEnvironment(); err != nil {
+		return err
+	}
+	client, err := api.NewClient(config)
+	if err != nil {
+		return err
+	}
+	c, err := kv.New(client, prefix+"/")
+	if err != nil {
+		return err
+	}
+	var w io.Writer = os.Stdout
+	if out != "" {
+		f, err := os.Create(out)
+		if err != nil {
+			return err
+		}
+		defer f.Close()
+		w = f
+	}
+	return gen.Generate(c, prefix, gen.Options{Package: pkg}, w)
+}
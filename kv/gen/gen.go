@@ -0,0 +1,145 @@
+// Package gen generates Go constants for the secret paths and keys of a K/V tree, so references to
+// secrets are checked by the compiler
+package gen
+
+import (
+	"bytes"
+	"fmt"
+	"go/format"
+	"io"
+	"sort"
+	"strings"
+	"unicode"
+
+	"github.com/pkg/errors"
+	"github.com/postfinance/vault/kv"
+)
+
+// Options for Generate
+type Options struct {
+	// Package is the package name of the generated file, defaults to secrets
+	Package string
+}
+
+// header of the generated file with the types of the constants and the functions using them, the
+// identifiers are reserved
+const header = `// Code generated by kv/gen from %s. DO NOT EDIT.
+
+package %s
+
+import "github.com/postfinance/vault/kv"
+
+// SecretPath is the path of a secret
+type SecretPath string
+
+// SecretKey is a key of a secret
+type SecretKey string
+
+// ReadSecret returns the data of the secret p read with c
+func ReadSecret(c *kv.Client, p SecretPath) (map[string]interface{}, error) {
+	return c.Read(string(p))
+}
+
+// SecretValue returns the value of the key k in the data of a secret
+func SecretValue(data map[string]interface{}, k SecretKey) interface{} {
+	return data[string(k)]
+}
+`
+
+// Generate walks all secrets below the folder prefix and writes a Go file to w with a SecretPath
+// constant for every secret path and a SecretKey constant for every key of a secret, the values of
+// the secrets are not written
+//
+//	// AppDatabase is the path of the secret secret/app/database
+//	const AppDatabase SecretPath = "secret/app/database"
+//
+//	// Keys of the secret secret/app/database
+//	const (
+//		AppDatabasePassword SecretKey = "password"
+//	)
+//
+// The file also contains ReadSecret and SecretValue, e.g.
+// secrets.SecretValue(data, secrets.AppDatabasePassword).
+func Generate(c *kv.Client, prefix string, opts Options, w io.Writer) error {
+	pkg := opts.Package
+	if pkg == "" {
+		pkg = "secrets"
+	}
+	dir := strings.TrimSuffix(prefix, "/") + "/"
+	var b bytes.Buffer
+	fmt.Fprintf(&b, header, dir, pkg)
+	names := map[string]string{}
+	for _, name := range []string{"SecretPath", "SecretKey", "ReadSecret", "SecretValue"} {
+		names[name] = "kv/gen"
+	}
+	err := c.Walk(prefix, kv.WalkOptions{}, func(p string) error {
+		data, err := c.Read(p)
+		if err != nil {
+			return err
+		}
+		name := Identifier(strings.TrimPrefix(p, dir))
+		if err := register(names, name, p); err != nil {
+			return err
+		}
+		fmt.Fprintf(&b, "\n// %s is the path of the secret %s\nconst %s SecretPath = %q\n", name, p, name, p)
+		if len(data) == 0 {
+			return nil
+		}
+		keys := make([]string, 0, len(data))
+		for k := range data {
+			keys = append(keys, k)
+		}
+		sort.Strings(keys)
+		fmt.Fprintf(&b, "\n// Keys of the secret %s\nconst (\n", p)
+		for _, k := range keys {
+			keyName := name + Identifier(k)
+			if err := register(names, keyName, p+"#"+k); err != nil {
+				return err
+			}
+			fmt.Fprintf(&b, "%s SecretKey = %q\n", keyName, k)
+		}
+		b.WriteString(")\n")
+		return nil
+	})
+	if err != nil {
+		return err
+	}
+	src, err := format.Source(b.Bytes())
+	if err != nil {
+		return errors.Wrap(err, "failed to format generated code")
+	}
+	_, err = w.Write(src)
+	return err
+}
+
+// Identifier returns an exported Go identifier for the path or key s
+// e.g. app/database-1 -> AppDatabase1, 2fa -> S2fa
+func Identifier(s string) string {
+	var b strings.Builder
+	upper := true
+	for _, r := range s {
+		if !unicode.IsLetter(r) && !unicode.IsDigit(r) {
+			upper = true
+			continue
+		}
+		if upper {
+			r = unicode.ToUpper(r)
+			upper = false
+		}
+		b.WriteRune(r)
+	}
+	id := b.String()
+	if id == "" || !unicode.IsLetter([]rune(id)[0]) {
+		id = "S" + id
+	}
+	return id
+}
+
+// register the identifier name for source, an identifier used twice is an error
+func register(names map[string]string, name, source string) error {
+	if other, ok := names[name]; ok {
+		return fmt.Errorf("identifier %s of %s conflicts with %s", name, source, other)
+	}
+	names[name] = source
+	return nil
+}
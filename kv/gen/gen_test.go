@@ -0,0 +1,79 @@
+package gen
+
+import (
+	"bytes"
+	"strings"
+	"testing"
+
+	"github.com/hashicorp/vault/api"
+	"github.com/postfinance/vault/kv"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+// fakeLogical serves lists and secrets of a K/V version 1 by path
+type fakeLogical map[string]map[string]interface{}
+
+func (f fakeLogical) ReadWithData(p string, _ map[string][]string) (*api.Secret, error) {
+	data, ok := f[p]
+	if !ok {
+		return nil, nil
+	}
+	return &api.Secret{Data: data}, nil
+}
+
+func (f fakeLogical) List(p string) (*api.Secret, error) {
+	return f.ReadWithData(p, nil)
+}
+
+func (f fakeLogical) Write(string, map[string]interface{}) (*api.Secret, error) {
+	return nil, nil
+}
+
+func (f fakeLogical) Delete(string) (*api.Secret, error) {
+	return nil, nil
+}
+
+func TestIdentifier(t *testing.T) {
+	testData := map[string]string{
+		"app/database-1": "AppDatabase1",
+		"api_key":        "ApiKey",
+		"2fa":            "S2fa",
+		"":               "S",
+	}
+	for s, expected := range testData {
+		assert.Equal(t, expected, Identifier(s))
+	}
+}
+
+func TestGenerate(t *testing.T) {
+	logical := fakeLogical{
+		"secret/app/":               {"keys": []interface{}{"database", "nested/"}},
+		"secret/app/database":       {"user": "Lucius Fox", "password": "secret"},
+		"secret/app/nested/":        {"keys": []interface{}{"api-key"}},
+		"secret/app/nested/api-key": {"value": "secret"},
+	}
+	c, err := kv.New(nil, "secret/", kv.WithLogical(logical), kv.WithDetector(func(*api.Client, string) (int, string, error) {
+		return 1, "secret/", nil
+	}))
+	require.NoError(t, err)
+
+	var b bytes.Buffer
+	require.NoError(t, Generate(c, "secret/app", Options{Package: "secrets"}, &b))
+	src := b.String()
+	assert.True(t, strings.HasPrefix(src, "// Code generated by kv/gen from secret/app/. DO NOT EDIT."))
+	assert.Contains(t, src, "package secrets")
+	assert.Contains(t, src, "type SecretPath string")
+	assert.Contains(t, src, "func ReadSecret(c *kv.Client, p SecretPath) (map[string]interface{}, error)")
+	assert.Contains(t, src, `const Database SecretPath = "secret/app/database"`)
+	assert.Contains(t, src, `DatabasePassword SecretKey = "password"`)
+	assert.Contains(t, src, `const NestedApiKey SecretPath = "secret/app/nested/api-key"`)
+	assert.Contains(t, src, `NestedApiKeyValue SecretKey = "value"`)
+	assert.NotContains(t, src, "Lucius Fox")
+
+	t.Run("reserved identifier", func(t *testing.T) {
+		logical["secret/app/"] = map[string]interface{}{"keys": []interface{}{"secret-path"}}
+		logical["secret/app/secret-path"] = map[string]interface{}{"value": "secret"}
+		assert.Error(t, Generate(c, "secret/app", Options{}, &bytes.Buffer{}))
+	})
+}
@@ -0,0 +1,70 @@
+package kv
+
+import (
+	"fmt"
+	"net/http"
+)
+
+// DestroyPrefix is the API prefix to destroy versions of a secret on K/V version 2
+const DestroyPrefix = "destroy"
+
+// Handle references exactly the version of a secret written by WriteHandle
+// Version is 0 on K/V version 1
+type Handle struct {
+	Path    string
+	Version int
+}
+
+func (h Handle) String() string {
+	if h.Version == 0 {
+		return h.Path
+	}
+	return fmt.Sprintf("%s@%d", h.Path, h.Version)
+}
+
+// WriteHandle writes a secret to a K/V version 1 or 2 and returns a Handle with the version created
+func (c *Client) WriteHandle(p string, data map[string]interface{}) (Handle, error) {
+	if err := c.init(); err != nil {
+		return Handle{}, c.wrap(opWrite, p, err)
+	}
+	version, err := c.writeVersion(p, data, nil)
+	if err != nil {
+		return Handle{}, c.wrap(opWrite, p, err)
+	}
+	return Handle{Path: p, Version: version}, nil
+}
+
+// ReadHandle reads the version of the secret referenced by h, a *DeletedError is returned if the
+// version is deleted or destroyed
+func (c *Client) ReadHandle(h Handle) (map[string]interface{}, error) {
+	if err := c.init(); err != nil {
+		return nil, c.wrap(opRead, h.Path, err)
+	}
+	if c.Version != 2 && h.Version != 0 {
+		return nil, c.wrap(opRead, h.Path, fmt.Errorf("versions are not supported by K/V version %d", c.Version))
+	}
+	data, _, err := c.readVersion(h.Path, h.Version)
+	return data, c.wrap(opRead, h.Path, err)
+}
+
+// Destroy permanently removes the version of the secret referenced by h from a K/V version 2,
+// on version 1 the secret is deleted
+func (c *Client) Destroy(h Handle) error {
+	if err := c.init(); err != nil {
+		return c.wrap(opDestroy, h.Path, err)
+	}
+	if c.Version != 2 {
+		if h.Version != 0 {
+			return c.wrap(opDestroy, h.Path, fmt.Errorf("versions are not supported by K/V version %d", c.Version))
+		}
+		_, err := c.request(http.MethodDelete, h.Path, nil, nil)
+		return c.wrap(opDestroy, h.Path, err)
+	}
+	if h.Version < 1 {
+		return c.wrap(opDestroy, h.Path, fmt.Errorf("invalid version %d", h.Version))
+	}
+	_, err := c.request(http.MethodPut, c.fixPath(h.Path, DestroyPrefix), nil, map[string]interface{}{
+		"versions": []int{h.Version},
+	})
+	return c.wrap(opDestroy, h.Path, err)
+}
@@ -0,0 +1,86 @@
+// Package vaulttest runs a Vault dev server in docker for the tests of the kv module
+package vaulttest
+
+import (
+	"fmt"
+	"os"
+	"strings"
+
+	"github.com/hashicorp/vault/api"
+	"github.com/ory/dockertest"
+	"github.com/pkg/errors"
+)
+
+// RootToken is the root token of the dev server
+const RootToken = "90b03685-e17b-7e5e-13a0-e14e45baeb2f"
+
+// Server is a Vault dev server in a docker container
+type Server struct {
+	// Client of the server authenticated with RootToken
+	Client *api.Client
+
+	pool     *dockertest.Pool
+	resource *dockertest.Resource
+}
+
+// Start pulls the vault image, starts a dev server and waits until it is ready
+// VAULT_ADDR and VAULT_TOKEN are set to the address of the server and RootToken.
+func Start() (*Server, error) {
+	pool, err := dockertest.NewPool("unix:///var/run/docker.sock")
+	if err != nil {
+		return nil, errors.Wrap(err, "could not connect to docker")
+	}
+
+	// pulls an image, creates a container based on it and runs it
+	resource, err := pool.Run("vault", "latest", []string{
+		"VAULT_DEV_ROOT_TOKEN_ID=" + RootToken,
+		"VAULT_DEV_LISTEN_ADDRESS=0.0.0.0:8200",
+	})
+	if err != nil {
+		return nil, errors.Wrap(err, "could not start resource")
+	}
+	s := &Server{pool: pool, resource: resource}
+
+	host := os.Getenv("DOCKER_HOST")
+	if host == "" {
+		host = "localhost"
+	}
+	if host != "localhost" && !strings.Contains(host, ".") {
+		host = host + ".pnet.ch"
+	}
+	vaultAddr := fmt.Sprintf("http://%s:%s", host, resource.GetPort("8200/tcp"))
+
+	os.Setenv("VAULT_ADDR", vaultAddr)
+	os.Setenv("VAULT_TOKEN", RootToken)
+
+	fmt.Println("VAULT_ADDR:", vaultAddr)
+
+	vaultConfig := api.DefaultConfig()
+	if err := vaultConfig.ReadEnvironment(); err != nil {
+		_ = s.Purge()
+		return nil, err
+	}
+	s.Client, err = api.NewClient(vaultConfig)
+	if err != nil {
+		_ = s.Purge()
+		return nil, err
+	}
+
+	// exponential backoff-retry, because the application in the container might not be ready to accept connections yet
+	if err := pool.Retry(func() error {
+		_, err := s.Client.Sys().ListMounts()
+		return err
+	}); err != nil {
+		_ = s.Purge()
+		return nil, errors.Wrap(err, "could not connect to vault in docker")
+	}
+	return s, nil
+}
+
+// Purge removes the container of the server
+func (s *Server) Purge() error {
+	if err := s.pool.Purge(s.resource); err != nil {
+		return errors.Wrap(err, "could not purge resource")
+	}
+	return nil
+}
@@ -0,0 +1,107 @@
+package kv
+
+import (
+	"fmt"
+	"sort"
+	"strings"
+)
+
+// VersionEntry is a version of a secret returned by VersionIterator
+type VersionEntry struct {
+	Path    string
+	Version int
+	Meta    *SecretMeta
+}
+
+// VersionIterator iterates over all versions of the secrets below a folder on a K/V version 2
+// The folders are listed lazily depth-first, so only the listings of the folders on the current
+// path and the metadata of the current secret are held in memory
+//
+//	it := c.IterateVersions("secret/foo")
+//	for it.Next() {
+//		e := it.Entry()
+//		...
+//	}
+//	err := it.Err()
+type VersionIterator struct {
+	c        *Client
+	stack    []string
+	versions []VersionEntry
+	entry    VersionEntry
+	err      error
+}
+
+// IterateVersions returns an iterator over all versions of the secrets below the folder p,
+// the secrets are visited in lexical order and the versions in ascending order
+func (c *Client) IterateVersions(p string) *VersionIterator {
+	it := &VersionIterator{
+		c:     c,
+		stack: []string{strings.TrimSuffix(p, "/") + "/"},
+	}
+	if err := c.init(); err != nil {
+		it.err = c.wrap(opMetadata, p, err)
+		return it
+	}
+	if c.Version != 2 {
+		it.err = c.wrap(opMetadata, p, fmt.Errorf("versions are not supported by K/V version %d", c.Version))
+	}
+	return it
+}
+
+// Next advances the iterator to the next version, it returns false at the end or on errors
+func (it *VersionIterator) Next() bool {
+	for len(it.versions) == 0 {
+		if it.err != nil || len(it.stack) == 0 {
+			return false
+		}
+		p := it.stack[len(it.stack)-1]
+		it.stack = it.stack[:len(it.stack)-1]
+		if strings.HasSuffix(p, "/") {
+			it.err = it.push(p)
+			continue
+		}
+		it.err = it.load(p)
+	}
+	it.entry = it.versions[0]
+	it.versions = it.versions[1:]
+	return true
+}
+
+// Entry returns the current version
+func (it *VersionIterator) Entry() VersionEntry {
+	return it.entry
+}
+
+// Err returns the first error of the iteration
+func (it *VersionIterator) Err() error {
+	return it.err
+}
+
+// push the entries of folder dir on the stack in reverse lexical order
+func (it *VersionIterator) push(dir string) error {
+	keys, err := it.c.List(dir)
+	if err != nil {
+		return err
+	}
+	sort.Sort(sort.Reverse(sort.StringSlice(keys)))
+	for _, k := range keys {
+		it.stack = append(it.stack, dir+k)
+	}
+	return nil
+}
+
+// load the versions of secret p
+func (it *VersionIterator) load(p string) error {
+	m, err := it.c.ReadMetadata(p)
+	if err != nil || m == nil {
+		return err
+	}
+	for _, v := range m.SortedVersions() {
+		it.versions = append(it.versions, VersionEntry{
+			Path:    p,
+			Version: v,
+			Meta:    m.Versions[v],
+		})
+	}
+	return nil
+}
@@ -0,0 +1,101 @@
+package k8ssync
+
+import (
+	"context"
+	"fmt"
+	"io/ioutil"
+	"strings"
+	"time"
+
+	"github.com/pkg/errors"
+	corev1 "k8s.io/api/core/v1"
+	apierrors "k8s.io/apimachinery/pkg/api/errors"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/client-go/kubernetes"
+	typedcorev1 "k8s.io/client-go/kubernetes/typed/core/v1"
+	"k8s.io/client-go/rest"
+)
+
+// ServiceAccountPath is the directory with the credentials of the service account of a pod
+const ServiceAccountPath = "/var/run/secrets/kubernetes.io/serviceaccount"
+
+// Timeout of the requests of InClusterSecrets
+const Timeout = 30 * time.Second
+
+// clientSecrets implements SecretsAPI with the Secrets of a clientset
+type clientSecrets struct {
+	secrets typedcorev1.SecretInterface
+}
+
+// NewSecrets returns a SecretsAPI for the Secrets of the namespace of the clientset
+func NewSecrets(clientset kubernetes.Interface, namespace string) SecretsAPI {
+	return &clientSecrets{secrets: clientset.CoreV1().Secrets(namespace)}
+}
+
+// InClusterSecrets returns a SecretsAPI for the namespace using the in-cluster configuration and the
+// service account of the pod, an empty namespace uses the namespace of the pod
+// Every request is bounded by Timeout.
+func InClusterSecrets(namespace string) (SecretsAPI, error) {
+	config, err := rest.InClusterConfig()
+	if err != nil {
+		return nil, err
+	}
+	config.Timeout = Timeout
+	clientset, err := kubernetes.NewForConfig(config)
+	if err != nil {
+		return nil, err
+	}
+	if namespace == "" {
+		content, err := ioutil.ReadFile(ServiceAccountPath + "/namespace")
+		if err != nil {
+			return nil, errors.Wrap(err, "failed to read namespace")
+		}
+		namespace = strings.TrimSpace(string(content))
+	}
+	return NewSecrets(clientset, namespace), nil
+}
+
+// Get returns the Secret name or nil if it does not exist
+func (s *clientSecrets) Get(ctx context.Context, name string) (*Secret, error) {
+	obj, err := s.secrets.Get(ctx, name, metav1.GetOptions{})
+	if apierrors.IsNotFound(err) {
+		return nil, nil
+	}
+	if err != nil {
+		return nil, err
+	}
+	return &Secret{
+		Name:        obj.Name,
+		Annotations: obj.Annotations,
+		Data:        obj.Data,
+	}, nil
+}
+
+// Create the Secret
+func (s *clientSecrets) Create(ctx context.Context, secret *Secret) error {
+	_, err := s.secrets.Create(ctx, &corev1.Secret{
+		ObjectMeta: metav1.ObjectMeta{
+			Name:        secret.Name,
+			Annotations: secret.Annotations,
+		},
+		Type: corev1.SecretTypeOpaque,
+		Data: secret.Data,
+	}, metav1.CreateOptions{})
+	return err
+}
+
+// Update the annotations and replace the data of the Secret, all other fields
+// of the object are preserved and the update fails on concurrent modifications
+func (s *clientSecrets) Update(ctx context.Context, secret *Secret) error {
+	obj, err := s.secrets.Get(ctx, secret.Name, metav1.GetOptions{})
+	if apierrors.IsNotFound(err) {
+		return fmt.Errorf("secret %s not found", secret.Name)
+	}
+	if err != nil {
+		return err
+	}
+	obj.Annotations = secret.Annotations
+	obj.Data = secret.Data
+	_, err = s.secrets.Update(ctx, obj, metav1.UpdateOptions{})
+	return err
+}
@@ -0,0 +1,134 @@
+// Package k8ssync synchronizes secrets from @hashicorp Vault's KV secret engines into Kubernetes Secret objects
+//
+// The hash of the synchronized data is stored in the annotation HashAnnotation of every Secret
+// and returned by Sync, it can be added to the pod template of a deployment to trigger a restart
+// of the pods whenever a secret changes.
+package k8ssync
+
+import (
+	"context"
+	"crypto/sha256"
+	"encoding/hex"
+	"encoding/json"
+	"fmt"
+	"sort"
+
+	"github.com/pkg/errors"
+	"github.com/postfinance/vault/kv"
+)
+
+// HashAnnotation is the annotation with the hash of the secret data
+const HashAnnotation = "vault.postfinance.ch/secret-hash"
+
+// Secret represents the parts of a Kubernetes Secret managed by Syncer
+type Secret struct {
+	Name        string
+	Annotations map[string]string
+	Data        map[string][]byte
+}
+
+// SecretsAPI is the subset of the Kubernetes API for Secrets in a namespace used by Syncer
+type SecretsAPI interface {
+	// Get returns the Secret name or nil if it does not exist
+	Get(ctx context.Context, name string) (*Secret, error)
+	// Create the Secret s
+	Create(ctx context.Context, s *Secret) error
+	// Update the annotations and replace the data of the existing Secret s
+	Update(ctx context.Context, s *Secret) error
+}
+
+// Syncer synchronizes K/V secrets into Kubernetes Secrets
+type Syncer struct {
+	KV      *kv.Client
+	Secrets SecretsAPI
+	// Mapping of K/V secret paths to Kubernetes Secret names
+	Mapping map[string]string
+}
+
+// Sync creates or updates the Kubernetes Secrets of the mapping and returns the hashes by Secret name
+// Secrets with an unchanged hash are not updated
+func (s *Syncer) Sync(ctx context.Context) (map[string]string, error) {
+	paths := make([]string, 0, len(s.Mapping))
+	for p := range s.Mapping {
+		paths = append(paths, p)
+	}
+	sort.Strings(paths)
+	hashes := make(map[string]string, len(paths))
+	for _, p := range paths {
+		name := s.Mapping[p]
+		hash, err := s.sync(ctx, p, name)
+		if err != nil {
+			return nil, errors.Wrapf(err, "failed to sync %s to secret %s", p, name)
+		}
+		hashes[name] = hash
+	}
+	return hashes, nil
+}
+
+// sync the K/V secret p to the Kubernetes Secret name
+func (s *Syncer) sync(ctx context.Context, p, name string) (string, error) {
+	data, err := s.KV.Read(p)
+	if err != nil {
+		return "", err
+	}
+	if data == nil {
+		return "", fmt.Errorf("secret %s not found", p)
+	}
+	secretData, err := toSecretData(data)
+	if err != nil {
+		return "", err
+	}
+	hash := Hash(secretData)
+	current, err := s.Secrets.Get(ctx, name)
+	if err != nil {
+		return "", err
+	}
+	if current == nil {
+		return hash, s.Secrets.Create(ctx, &Secret{
+			Name:        name,
+			Annotations: map[string]string{HashAnnotation: hash},
+			Data:        secretData,
+		})
+	}
+	if current.Annotations[HashAnnotation] == hash {
+		return hash, nil
+	}
+	if current.Annotations == nil {
+		current.Annotations = map[string]string{}
+	}
+	current.Annotations[HashAnnotation] = hash
+	current.Data = secretData
+	return hash, s.Secrets.Update(ctx, current)
+}
+
+// Hash returns the hex encoded SHA-256 hash of the secret data
+func Hash(data map[string][]byte) string {
+	keys := make([]string, 0, len(data))
+	for k := range data {
+		keys = append(keys, k)
+	}
+	sort.Strings(keys)
+	h := sha256.New()
+	for _, k := range keys {
+		fmt.Fprintf(h, "%d:%s%d:", len(k), k, len(data[k]))
+		h.Write(data[k])
+	}
+	return hex.EncodeToString(h.Sum(nil))
+}
+
+// toSecretData converts the K/V data to Secret data, values which are not strings are JSON encoded
+func toSecretData(data map[string]interface{}) (map[string][]byte, error) {
+	secretData := make(map[string][]byte, len(data))
+	for k, v := range data {
+		if s, ok := v.(string); ok {
+			secretData[k] = []byte(s)
+			continue
+		}
+		b, err := json.Marshal(v)
+		if err != nil {
+			return nil, err
+		}
+		secretData[k] = b
+	}
+	return secretData, nil
+}
@@ -0,0 +1,171 @@
+package k8ssync_test
+
+import (
+	"context"
+	"flag"
+	"log"
+	"os"
+	"testing"
+
+	"github.com/hashicorp/vault/api"
+	"github.com/postfinance/vault/kv"
+	"github.com/postfinance/vault/kv/internal/vaulttest"
+	"github.com/postfinance/vault/kv/k8ssync"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+	corev1 "k8s.io/api/core/v1"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/client-go/kubernetes/fake"
+)
+
+var vaultClient *api.Client
+
+func TestMain(m *testing.M) {
+	flag.Parse()
+
+	srv, err := vaulttest.Start()
+	if err != nil {
+		log.Fatal(err)
+	}
+	vaultClient = srv.Client
+
+	code := m.Run()
+
+	// You can't defer this because os.Exit doesn't care for defer
+	if err := srv.Purge(); err != nil {
+		log.Fatal(err)
+	}
+	os.Exit(code)
+}
+
+func TestSync(t *testing.T) {
+	clnt, err := kv.New(vaultClient, "secret/")
+	require.NoError(t, err)
+	require.NoError(t, clnt.Write("secret/sync/db", map[string]interface{}{
+		"username": "bruce",
+		"password": "wayne",
+	}))
+	secrets := &fakeSecrets{
+		secrets: map[string]*k8ssync.Secret{},
+	}
+	s := k8ssync.Syncer{
+		KV:      clnt,
+		Secrets: secrets,
+		Mapping: map[string]string{
+			"secret/sync/db": "db",
+		},
+	}
+
+	t.Run("sync missing secret", func(t *testing.T) {
+		missing := k8ssync.Syncer{
+			KV:      clnt,
+			Secrets: secrets,
+			Mapping: map[string]string{
+				"secret/sync/notfound": "notfound",
+			},
+		}
+		_, err := missing.Sync(context.Background())
+		assert.Error(t, err)
+		assert.Equal(t, 0, secrets.writes)
+	})
+
+	t.Run("create secret", func(t *testing.T) {
+		hashes, err := s.Sync(context.Background())
+		assert.NoError(t, err)
+		require.Contains(t, secrets.secrets, "db")
+		assert.Equal(t, []byte("wayne"), secrets.secrets["db"].Data["password"])
+		assert.Equal(t, hashes["db"], secrets.secrets["db"].Annotations[k8ssync.HashAnnotation])
+		assert.Equal(t, 1, secrets.writes)
+	})
+
+	t.Run("skip unchanged secret", func(t *testing.T) {
+		_, err := s.Sync(context.Background())
+		assert.NoError(t, err)
+		assert.Equal(t, 1, secrets.writes)
+	})
+
+	t.Run("update changed secret", func(t *testing.T) {
+		before := secrets.secrets["db"].Annotations[k8ssync.HashAnnotation]
+		require.NoError(t, clnt.Write("secret/sync/db", map[string]interface{}{
+			"username": "bruce",
+		}))
+		hashes, err := s.Sync(context.Background())
+		assert.NoError(t, err)
+		assert.Equal(t, 2, secrets.writes)
+		assert.NotEqual(t, before, hashes["db"])
+		assert.NotContains(t, secrets.secrets["db"].Data, "password")
+	})
+}
+
+func TestSecrets(t *testing.T) {
+	clientset := fake.NewSimpleClientset(&corev1.Secret{
+		ObjectMeta: metav1.ObjectMeta{
+			Name:      "db",
+			Namespace: "app",
+			Labels:    map[string]string{"app": "db"},
+		},
+		Data: map[string][]byte{"password": []byte("old")},
+	})
+	secrets := k8ssync.NewSecrets(clientset, "app")
+	ctx := context.Background()
+
+	t.Run("get missing secret", func(t *testing.T) {
+		s, err := secrets.Get(ctx, "missing")
+		assert.NoError(t, err)
+		assert.Nil(t, s)
+	})
+
+	t.Run("create secret", func(t *testing.T) {
+		require.NoError(t, secrets.Create(ctx, &k8ssync.Secret{
+			Name:        "api",
+			Annotations: map[string]string{k8ssync.HashAnnotation: "hash"},
+			Data:        map[string][]byte{"key": []byte("value")},
+		}))
+		s, err := secrets.Get(ctx, "api")
+		require.NoError(t, err)
+		require.NotNil(t, s)
+		assert.Equal(t, "hash", s.Annotations[k8ssync.HashAnnotation])
+		assert.Equal(t, []byte("value"), s.Data["key"])
+	})
+
+	t.Run("update keeps other fields", func(t *testing.T) {
+		s, err := secrets.Get(ctx, "db")
+		require.NoError(t, err)
+		require.NotNil(t, s)
+		require.NoError(t, secrets.Update(ctx, &k8ssync.Secret{
+			Name:        "db",
+			Annotations: map[string]string{k8ssync.HashAnnotation: "new"},
+			Data:        map[string][]byte{"password": []byte("new")},
+		}))
+		obj, err := clientset.CoreV1().Secrets("app").Get(ctx, "db", metav1.GetOptions{})
+		require.NoError(t, err)
+		assert.Equal(t, "db", obj.Labels["app"])
+		assert.Equal(t, "new", obj.Annotations[k8ssync.HashAnnotation])
+		assert.Equal(t, []byte("new"), obj.Data["password"])
+	})
+
+	t.Run("update missing secret", func(t *testing.T) {
+		assert.Error(t, secrets.Update(ctx, &k8ssync.Secret{Name: "missing"}))
+	})
+}
+
+type fakeSecrets struct {
+	secrets map[string]*k8ssync.Secret
+	writes  int
+}
+
+func (f *fakeSecrets) Get(ctx context.Context, name string) (*k8ssync.Secret, error) {
+	return f.secrets[name], nil
+}
+
+func (f *fakeSecrets) Create(ctx context.Context, s *k8ssync.Secret) error {
+	f.writes++
+	f.secrets[s.Name] = s
+	return nil
+}
+
+func (f *fakeSecrets) Update(ctx context.Context, s *k8ssync.Secret) error {
+	f.writes++
+	f.secrets[s.Name] = s
+	return nil
+}
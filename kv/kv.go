@@ -3,42 +3,226 @@ package kv
 
 import (
 	"fmt"
+	"net/http"
+	"net/url"
 	"strconv"
 	"strings"
+	"sync"
+	"time"
 
 	"github.com/hashicorp/vault/api"
+	"github.com/pkg/errors"
 )
 
 // Constants
 const (
-	ReadPrefix  = "data"
-	WritePrefix = ReadPrefix
-	ListPrefix  = "metadata"
+	ReadPrefix     = "data"
+	WritePrefix    = ReadPrefix
+	ListPrefix     = "metadata"
+	MetadataPrefix = ListPrefix
 )
 
+// Errors
+var (
+	ErrAlreadyExists = errors.New("secret already exists")
+	ErrConflict      = errors.New("secret was modified concurrently")
+	ErrSecretDeleted = errors.New("secret deleted")
+	ErrReservedKey   = errors.New("reserved key")
+)
+
+// reservedKeys are the top-level keys of a write request on K/V version 2
+var reservedKeys = []string{"data", "options"}
+
+// Operations recorded in Error
+const (
+	opRead         = "read"
+	opWrite        = "write"
+	opUpdate       = "update"
+	opList         = "list"
+	opMetadata     = "metadata"
+	opCapabilities = "capabilities"
+	opImport       = "import"
+	opExport       = "export"
+	opSnapshot     = "snapshot"
+	opRestore      = "restore"
+	opMigrate      = "migrate"
+	opDestroy      = "destroy"
+	opConfig       = "config"
+	opRotation     = "rotation"
+	opRename       = "rename"
+)
+
+// updateAttempts is the maximum number of attempts of Update on check-and-set conflicts
+const updateAttempts = 10
+
 // Client represents a KV client
 type Client struct {
 	client  *api.Client
 	Version int
 	Mount   string
+	// CASRequired is true if the K/V version 2 mount requires check-and-set for all writes, it is
+	// updated by TuneMountConfig and must not be read concurrently with it
+	CASRequired       bool
+	casMu             sync.RWMutex
+	noAutoCAS         bool
+	mountTypes        map[string]VersionFunc
+	detect            DetectFunc
+	cache             *readCache
+	timeout           time.Duration
+	validators        []ValidateFunc
+	consistency       *consistencyState
+	tokens            TokenSource
+	offline           *offlineStore
+	probePath         string
+	codec             Codec
+	lazy              *lazyInit
+	logical           LogicalAPI
+	checkReservedKeys bool
+	hooks             []RequestHook
+	paths             *pathCache
+}
+
+// Option configures a Client
+type Option func(*Client) error
+
+// VersionFunc returns the K/V version of a mount with a registered mount type
+type VersionFunc func(m *api.MountOutput) (int, error)
+
+// DetectFunc returns the K/V version and the mount path of the engine for path p
+type DetectFunc func(c *api.Client, p string) (version int, mount string, err error)
+
+// WithMountType accepts mounts of type typ as K/V engine, fn determines the version of the engine
+// e.g. kv.WithMountType("kv-fork", kv.VersionFromOptions)
+func WithMountType(typ string, fn VersionFunc) Option {
+	return func(c *Client) error {
+		if fn == nil {
+			return fmt.Errorf("missing version function for mount type %s", typ)
+		}
+		c.mountTypes[typ] = fn
+		return nil
+	}
+}
+
+// WithDetector overrides the detection of version and mount path entirely
+func WithDetector(fn DetectFunc) Option {
+	return func(c *Client) error {
+		c.detect = fn
+		return nil
+	}
+}
+
+// WithoutAutoCAS disables the detection of cas_required on K/V version 2 mounts
+// By default the mount configuration is read by New and if cas_required is set, the current
+// version of a secret is added to every write without explicit check-and-set
+func WithoutAutoCAS() Option {
+	return func(c *Client) error {
+		c.noAutoCAS = true
+		return nil
+	}
+}
+
+// WithReservedKeyCheck returns a *ReservedKeyError for writes of secrets with a top-level key data
+// or options to a K/V version 2 to detect data that is wrapped twice, by default these keys are
+// written like any other key, e.g. by Update, Migrate or Restore of existing secrets
+func WithReservedKeyCheck() Option {
+	return func(c *Client) error {
+		c.checkReservedKeys = true
+		return nil
+	}
+}
+
+// ValidateFunc validates the data of the secret p before it is written
+type ValidateFunc func(p string, data map[string]interface{}) error
+
+// WithValidator adds a validator called before every write of a secret, if a validator
+// returns an error, the secret is not written
+func WithValidator(fn ValidateFunc) Option {
+	return func(c *Client) error {
+		c.validators = append(c.validators, fn)
+		return nil
+	}
+}
+
+// VersionFromOptions returns the version from the mount options (type kv)
+func VersionFromOptions(m *api.MountOutput) (int, error) {
+	return strconv.Atoi(m.Options["version"])
+}
+
+// FixedVersion returns a VersionFunc that always returns version v (e.g. type generic)
+func FixedVersion(v int) VersionFunc {
+	return func(*api.MountOutput) (int, error) {
+		return v, nil
+	}
 }
 
 // New creates a new kv.Client with the Vault client c and a path p long enough to determine the mount path of the engine
 // p = secret/ -> K/V engine mount path secret/
 // p = secret  -> error
 // p = /secret -> error
-func New(c *api.Client, p string) (*Client, error) {
+func New(c *api.Client, p string, opts ...Option) (*Client, error) {
+	clnt, err := newClient(c, p, opts)
+	if err != nil {
+		return nil, err
+	}
+	if err := clnt.detectMount(p); err != nil {
+		return nil, err
+	}
+	return clnt, nil
+}
+
+// newClient validates the path p and creates a kv.Client with the options applied
+func newClient(c *api.Client, p string, opts []Option) (*Client, error) {
 	if strings.HasPrefix(p, "/") {
 		return nil, fmt.Errorf("path %s must not start with '/'", p)
 	}
 	if !strings.ContainsRune(p, '/') {
 		return nil, fmt.Errorf("path %s must contain at least one '/'", p)
 	}
-	version, mount, err := getVersionAndMount(c, p)
+	clnt := &Client{
+		client: c,
+		mountTypes: map[string]VersionFunc{
+			"kv":      VersionFromOptions,
+			"generic": FixedVersion(1),
+		},
+		paths: newPathCache(defaultPathCacheSize),
+	}
+	for _, opt := range opts {
+		if err := opt(clnt); err != nil {
+			return nil, err
+		}
+	}
+	return clnt, nil
+}
+
+// detectMount determines the version and the mount of the engine for path p
+func (c *Client) detectMount(p string) error {
+	detect := c.detect
+	if detect == nil {
+		detect = c.getVersionAndMount
+	}
+	version, mount, err := detect(c.client, p)
+	if err != nil && c.offline != nil && isUnreachable(err) {
+		snap, loadErr := c.offline.load()
+		if loadErr != nil {
+			return err
+		}
+		c.offline.setActive(true)
+		c.Version = snap.Version
+		c.Mount = snap.Mount
+		return nil
+	}
 	if err != nil {
-		return nil, err
+		return err
 	}
-	return &Client{client: c, Version: version, Mount: mount}, nil
+	c.Version = version
+	c.Mount = mount
+	if c.offline != nil {
+		c.offline.setActive(false)
+	}
+	if c.Version == 2 && !c.noAutoCAS {
+		c.setCASRequired(c.casRequired())
+	}
+	return nil
 }
 
 // Client returns a Vault *api.Client
@@ -47,56 +231,412 @@ func (c *Client) Client() *api.Client {
 }
 
 // Read a secret from a K/V version 1 or 2
+// With WithStaleIfError or WithOfflineSnapshot the cached data is returned together with a *StaleError if the request fails
+// If the latest version of a secret on version 2 is deleted, a *DeletedError is returned
 func (c *Client) Read(p string) (map[string]interface{}, error) {
+	data, _, err := c.ReadWithMeta(p)
+	return data, err
+}
+
+// ReadWithMeta reads a secret from a K/V version 1 or 2 together with the metadata of the
+// version read, the metadata is nil on version 1
+func (c *Client) ReadWithMeta(p string) (map[string]interface{}, *SecretMeta, error) {
+	if err := c.init(); err != nil {
+		return nil, nil, c.wrap(opRead, p, err)
+	}
+	data, meta, err := c.read(p)
+	if err != nil && !IsDeleted(err) {
+		if c.cache != nil {
+			if data, meta, err := c.cache.stale(p, err); data != nil {
+				return data, meta, c.wrap(opRead, p, err)
+			}
+		}
+		if c.offline != nil && isUnreachable(err) {
+			data, meta, err = c.offline.stale(p, err)
+		}
+		return data, meta, c.wrap(opRead, p, err)
+	}
+	if c.cache != nil {
+		c.cache.set(p, data, meta)
+	}
+	if c.offline != nil {
+		c.offline.set(p, data, meta)
+	}
+	return data, meta, c.wrap(opRead, p, err)
+}
+
+// read the latest version of a secret from a K/V version 1 or 2
+func (c *Client) read(p string) (map[string]interface{}, *SecretMeta, error) {
+	return c.readVersion(p, 0)
+}
+
+// readVersion reads a version of a secret from a K/V version 2, version 0 is the latest version
+func (c *Client) readVersion(p string, version int) (map[string]interface{}, *SecretMeta, error) {
+	reqPath := p
+	var params url.Values
 	if c.Version == 2 {
-		p = FixPath(p, c.Mount, ReadPrefix)
+		reqPath = c.fixPath(p, ReadPrefix)
+		if version > 0 {
+			params = url.Values{"version": []string{strconv.Itoa(version)}}
+		}
 	}
-	s, err := c.client.Logical().Read(p)
+	s, err := c.request(http.MethodGet, reqPath, params, nil)
 	if err != nil {
-		return nil, err
+		return nil, nil, err
 	}
 	if s == nil || s.Data == nil {
-		return nil, nil
+		return nil, nil, nil
 	}
 	if c.Version == 2 {
-		return s.Data["data"].(map[string]interface{}), nil
+		data, _ := s.Data["data"].(map[string]interface{})
+		meta := parseSecretMeta(s.Data["metadata"])
+		if data == nil && meta != nil {
+			return nil, meta, &DeletedError{Path: p, Meta: *meta}
+		}
+		return data, meta, nil
 	}
-	return s.Data, nil
+	return s.Data, nil, nil
 }
 
 // Write a secret to a K/V version 1 or 2
 func (c *Client) Write(p string, data map[string]interface{}) error {
+	if err := c.init(); err != nil {
+		return c.wrap(opWrite, p, err)
+	}
+	return c.wrap(opWrite, p, c.write(p, data, nil))
+}
+
+// write a secret to a K/V version 1 or 2 after validation, on version 2 with check-and-set if cas is set
+func (c *Client) write(p string, data map[string]interface{}, cas *int) error {
+	_, err := c.writeVersion(p, data, cas)
+	return err
+}
+
+// writeVersion writes a secret like write and returns the version created on version 2
+func (c *Client) writeVersion(p string, data map[string]interface{}, cas *int) (int, error) {
+	for _, fn := range c.validators {
+		if err := fn(p, data); err != nil {
+			return 0, errors.Wrapf(err, "validation of secret %s failed", p)
+		}
+	}
+	if c.Version == 2 && c.checkReservedKeys {
+		for _, k := range reservedKeys {
+			if _, ok := data[k]; ok {
+				return 0, &ReservedKeyError{Path: p, Key: k}
+			}
+		}
+	}
+	body := data
+	if c.Version == 2 && c.requiresCAS() && cas == nil {
+		_, meta, err := c.read(p)
+		if err != nil && !IsDeleted(err) {
+			return 0, err
+		}
+		version := 0
+		if meta != nil {
+			version = meta.Version
+		}
+		cas = &version
+	}
 	if c.Version == 2 {
-		p = FixPath(p, c.Mount, WritePrefix)
-		data = map[string]interface{}{
+		p = c.fixPath(p, WritePrefix)
+		body = map[string]interface{}{
 			"data": data,
 		}
+		if cas != nil {
+			body["options"] = map[string]interface{}{
+				"cas": *cas,
+			}
+		}
 	}
-	_, err := c.client.Logical().Write(p, data)
-	return err
+	s, err := c.request(http.MethodPut, p, nil, body)
+	if err != nil || s == nil || c.Version != 2 {
+		return 0, err
+	}
+	return toInt(s.Data["version"]), nil
+}
+
+// WriteOptions for WriteWithOptions
+type WriteOptions struct {
+	// DeleteVersionAfter is set as delete_version_after in the metadata of the secret (version 2 only),
+	// this and all following versions of the secret are deleted automatically after the duration
+	DeleteVersionAfter time.Duration
+}
+
+// WriteWithOptions writes a secret to a K/V version 1 or 2 with options
+func (c *Client) WriteWithOptions(p string, data map[string]interface{}, opts WriteOptions) error {
+	if err := c.init(); err != nil {
+		return c.wrap(opWrite, p, err)
+	}
+	if opts.DeleteVersionAfter > 0 {
+		if c.Version != 2 {
+			return c.wrap(opWrite, p, fmt.Errorf("delete_version_after is not supported by K/V version %d", c.Version))
+		}
+		_, err := c.request(http.MethodPut, c.fixPath(p, MetadataPrefix), nil, map[string]interface{}{
+			"delete_version_after": opts.DeleteVersionAfter.String(),
+		})
+		if err != nil {
+			return c.wrap(opWrite, p, err)
+		}
+	}
+	return c.Write(p, data)
+}
+
+// WriteIfAbsent writes a secret to a K/V version 1 or 2 only if it does not exist yet,
+// otherwise ErrAlreadyExists is returned
+// On version 2 the check is done by Vault (cas=0), on version 1 the secret is read before it is written
+func (c *Client) WriteIfAbsent(p string, data map[string]interface{}) error {
+	return c.wrap(opWrite, p, c.writeIfAbsent(p, data))
+}
+
+// writeIfAbsent writes a secret only if it does not exist yet
+func (c *Client) writeIfAbsent(p string, data map[string]interface{}) error {
+	if err := c.init(); err != nil {
+		return err
+	}
+	if c.Version == 2 {
+		version := 0
+		err := c.write(p, data, &version)
+		if isCASMismatch(err) {
+			return ErrAlreadyExists
+		}
+		return err
+	}
+	s, _, err := c.read(p)
+	if err != nil {
+		return err
+	}
+	if s != nil {
+		return ErrAlreadyExists
+	}
+	return c.write(p, data, nil)
+}
+
+// UpdateFunc returns the new data of a secret based on its current data, which is nil if the secret
+// does not exist. If UpdateFunc returns nil data, the secret is left unchanged.
+type UpdateFunc func(data map[string]interface{}) (map[string]interface{}, error)
+
+// Update reads the secret p, applies fn and writes the result back
+// On version 2 the secret is written with check-and-set, on conflicts the secret is read again
+// and fn is applied to the current data, after several failed attempts ErrConflict is returned
+// On version 1 modifications between the read and the write are not detected
+func (c *Client) Update(p string, fn UpdateFunc) error {
+	return c.wrap(opUpdate, p, c.update(p, fn))
+}
+
+// update applies fn to the secret p with check-and-set on version 2
+func (c *Client) update(p string, fn UpdateFunc) error {
+	if err := c.init(); err != nil {
+		return err
+	}
+	for i := 0; i < updateAttempts; i++ {
+		data, meta, err := c.read(p)
+		if err != nil && !IsDeleted(err) {
+			return err
+		}
+		data, err = fn(data)
+		if err != nil {
+			return err
+		}
+		if data == nil {
+			return nil
+		}
+		if c.Version != 2 {
+			return c.write(p, data, nil)
+		}
+		version := 0
+		if meta != nil {
+			version = meta.Version
+		}
+		err = c.write(p, data, &version)
+		if !isCASMismatch(err) {
+			return err
+		}
+	}
+	return errors.Wrapf(ErrConflict, "failed to update %s after %d attempts", p, updateAttempts)
 }
 
 // List secrets from a K/V version 1 or 2
 func (c *Client) List(p string) ([]string, error) {
+	if err := c.init(); err != nil {
+		return nil, c.wrap(opList, p, err)
+	}
+	reqPath := p
 	if c.Version == 2 {
-		p = FixPath(p, c.Mount, ListPrefix)
+		reqPath = c.fixPath(p, ListPrefix)
 	}
-	s, err := c.client.Logical().List(p)
+	s, err := c.request(http.MethodGet, reqPath, url.Values{"list": []string{"true"}}, nil)
 	if err != nil {
-		return nil, err
+		return nil, c.wrap(opList, p, err)
 	}
 	if s == nil || s.Data == nil {
 		return nil, nil
 	}
+	values, ok := s.Data["keys"].([]interface{})
+	if !ok {
+		return nil, c.wrap(opList, p, fmt.Errorf("invalid list response: keys of type %T", s.Data["keys"]))
+	}
 	keys := []string{}
-	for _, v := range s.Data["keys"].([]interface{}) {
-		keys = append(keys, v.(string))
+	for _, v := range values {
+		k, ok := v.(string)
+		if !ok {
+			return nil, c.wrap(opList, p, fmt.Errorf("invalid list response: key of type %T", v))
+		}
+		keys = append(keys, k)
 	}
 	return keys, nil
 }
 
+// Capabilities of the current token on a secret path
+type Capabilities struct {
+	Read   bool
+	Write  bool
+	List   bool
+	Delete bool
+}
+
+// CheckCapabilities queries sys/capabilities-self for the data and metadata paths of
+// the secret paths p and reports which operations the current token is allowed to perform
+func (c *Client) CheckCapabilities(paths ...string) (map[string]Capabilities, error) {
+	if err := c.init(); err != nil {
+		return nil, c.wrap(opCapabilities, strings.Join(paths, ","), err)
+	}
+	result := make(map[string]Capabilities, len(paths))
+	for _, p := range paths {
+		dataPath, metadataPath := p, p
+		if c.Version == 2 {
+			dataPath = c.fixPath(p, ReadPrefix)
+			metadataPath = c.fixPath(p, ListPrefix)
+		}
+		dataCaps, err := c.capabilitiesSelf(dataPath)
+		if err != nil {
+			return nil, c.wrap(opCapabilities, p, err)
+		}
+		metadataCaps, err := c.capabilitiesSelf(metadataPath)
+		if err != nil {
+			return nil, c.wrap(opCapabilities, p, err)
+		}
+		result[p] = Capabilities{
+			Read:   hasCapability(dataCaps, "read"),
+			Write:  hasCapability(dataCaps, "create") || hasCapability(dataCaps, "update"),
+			List:   hasCapability(metadataCaps, "list"),
+			Delete: hasCapability(dataCaps, "delete"),
+		}
+	}
+	return result, nil
+}
+
+// ListOptions for ListWithOptions
+type ListOptions struct {
+	// FullPath returns the paths of the entries (p joined with the key) instead of the keys
+	FullPath bool
+	// FoldersOnly returns only folders (keys ending with '/')
+	FoldersOnly bool
+	// SecretsOnly returns only secrets
+	SecretsOnly bool
+	// SkipDeleted omits secrets whose current version is deleted or destroyed (version 2 only),
+	// the metadata of the secrets is read in parallel, folders are not checked
+	SkipDeleted bool
+	// Concurrency is the maximum number of concurrent metadata requests of SkipDeleted, defaults to 8
+	Concurrency int
+	// SkipForbidden returns no entries instead of an error if the token is not allowed to list p
+	SkipForbidden bool
+	// OnSkip is called with the path and the error if a forbidden path is skipped
+	OnSkip SkipFunc
+}
+
+// SkipFunc is called with the path p and the error if a path is skipped
+type SkipFunc func(p string, err error)
+
+// skipDeletedConcurrency is the default concurrency of ListOptions.SkipDeleted
+const skipDeletedConcurrency = 8
+
+// ListWithOptions lists secrets from a K/V version 1 or 2 with options
+func (c *Client) ListWithOptions(p string, opts ListOptions) ([]string, error) {
+	if opts.FoldersOnly && opts.SecretsOnly {
+		return nil, c.wrap(opList, p, fmt.Errorf("list options FoldersOnly and SecretsOnly are mutually exclusive"))
+	}
+	keys, err := c.List(p)
+	if err != nil && opts.SkipForbidden && isForbidden(err) {
+		if opts.OnSkip != nil {
+			opts.OnSkip(p, err)
+		}
+		return []string{}, nil
+	}
+	if err != nil || keys == nil {
+		return keys, err
+	}
+	dir := strings.TrimSuffix(p, "/") + "/"
+	var deleted map[string]bool
+	if opts.SkipDeleted && c.Version == 2 {
+		deleted, err = c.deletedSecrets(dir, keys, opts.Concurrency)
+		if err != nil {
+			return nil, c.wrap(opList, p, err)
+		}
+	}
+	entries := []string{}
+	for _, k := range keys {
+		folder := strings.HasSuffix(k, "/")
+		if (opts.FoldersOnly && !folder) || (opts.SecretsOnly && folder) || deleted[k] {
+			continue
+		}
+		if opts.FullPath {
+			k = dir + k
+		}
+		entries = append(entries, k)
+	}
+	return entries, nil
+}
+
+// deletedSecrets reads the metadata of the secrets keys in folder dir with up to n concurrent requests
+// and returns the keys of the secrets whose current version is deleted
+func (c *Client) deletedSecrets(dir string, keys []string, n int) (map[string]bool, error) {
+	if n < 1 {
+		n = skipDeletedConcurrency
+	}
+	var (
+		mu       sync.Mutex
+		wg       sync.WaitGroup
+		firstErr error
+	)
+	deleted := map[string]bool{}
+	sem := make(chan struct{}, n)
+	for _, k := range keys {
+		if strings.HasSuffix(k, "/") {
+			continue
+		}
+		wg.Add(1)
+		go func(k string) {
+			defer wg.Done()
+			sem <- struct{}{}
+			m, err := c.ReadMetadata(dir + k)
+			<-sem
+			mu.Lock()
+			defer mu.Unlock()
+			if err != nil {
+				if firstErr == nil {
+					firstErr = err
+				}
+				return
+			}
+			if m == nil {
+				return
+			}
+			if current, ok := m.Versions[m.CurrentVersion]; ok && current.Deleted() {
+				deleted[k] = true
+			}
+		}(k)
+	}
+	wg.Wait()
+	if firstErr != nil {
+		return nil, firstErr
+	}
+	return deleted, nil
+}
+
 // SetToken sets the token directly. This won't perform any auth
 // verification, it simply sets the token properly for future requests.
+// With WithTokenSource the token is ignored by the kv.Client
 func (c *Client) SetToken(v string) {
 	c.client.SetToken(v)
 }
@@ -117,9 +657,54 @@ func FixPath(path, mount, prefix string) string {
 	return fmt.Sprintf("%s%s/%s", mount, prefix, secretPath)
 }
 
+// casRequired returns true if cas_required is set in the configuration of the mount,
+// if the configuration cannot be read, false is returned
+func (c *Client) casRequired() bool {
+	cfg, err := c.mountConfig()
+	if err != nil {
+		return false
+	}
+	return cfg.CASRequired
+}
+
+// setCASRequired sets CASRequired while writes may read it
+func (c *Client) setCASRequired(required bool) {
+	c.casMu.Lock()
+	defer c.casMu.Unlock()
+	c.CASRequired = required
+}
+
+// requiresCAS returns CASRequired
+func (c *Client) requiresCAS() bool {
+	c.casMu.RLock()
+	defer c.casMu.RUnlock()
+	return c.CASRequired
+}
+
+// isCASMismatch returns true if err is caused by a failed check-and-set on K/V version 2
+func isCASMismatch(err error) bool {
+	return err != nil && strings.Contains(err.Error(), "check-and-set parameter did not match the current version")
+}
+
+// isForbidden returns true if err is caused by a permission denied response of Vault
+func isForbidden(err error) bool {
+	e, ok := errors.Cause(err).(*api.ResponseError)
+	return ok && e.StatusCode == http.StatusForbidden
+}
+
+// hasCapability returns true if capability c or root is in caps
+func hasCapability(caps []string, c string) bool {
+	for _, v := range caps {
+		if v == c || v == "root" {
+			return true
+		}
+	}
+	return false
+}
+
 // getVersionAndMount of the KV engine
-func getVersionAndMount(c *api.Client, p string) (int, string, error) {
-	mounts, err := c.Sys().ListMounts()
+func (c *Client) getVersionAndMount(_ *api.Client, p string) (int, string, error) {
+	mounts, err := c.listMounts()
 	if err != nil {
 		return 0, "", err
 	}
@@ -127,18 +712,15 @@ func getVersionAndMount(c *api.Client, p string) (int, string, error) {
 		if !strings.HasPrefix(p, k) {
 			continue
 		}
-		switch m.Type {
-		case "kv":
-			version, err := strconv.Atoi(m.Options["version"])
-			if err != nil {
-				return 0, "", err
-			}
-			return version, k, nil
-		case "generic":
-			return 1, k, nil
-		default:
+		fn, ok := c.mountTypes[m.Type]
+		if !ok {
 			return 0, "", fmt.Errorf("matching mount %s for path %s is not of type kv", k, p)
 		}
+		version, err := fn(m)
+		if err != nil {
+			return 0, "", err
+		}
+		return version, k, nil
 	}
 	return 0, "", fmt.Errorf("failed to get mount for path: %s", p)
 }
@@ -1,29 +1,39 @@
 package kv_test
 
 import (
+	"bytes"
+	"context"
+	"encoding/json"
 	"flag"
 	"fmt"
+	"io/ioutil"
 	"log"
+	"net/http"
+	"net/http/httptest"
+	"net/url"
 	"os"
 	"path"
+	"path/filepath"
+	"strconv"
 	"strings"
+	"sync"
 	"testing"
+	"time"
 
 	"github.com/hashicorp/vault/api"
-	"github.com/ory/dockertest"
 	"github.com/pkg/errors"
 	"github.com/postfinance/vault/kv"
+	"github.com/postfinance/vault/kv/internal/vaulttest"
 	"github.com/stretchr/testify/assert"
 	"github.com/stretchr/testify/require"
 )
 
 const (
-	rootToken  = "90b03685-e17b-7e5e-13a0-e14e45baeb2f"
+	rootToken  = vaulttest.RootToken
 	secretpath = "secret/test"
 )
 
 var (
-	host        string
 	vaultClient *api.Client
 	secrets     = map[string]map[string]interface{}{
 		path.Join(secretpath, "first"): {
@@ -41,56 +51,17 @@ func TestMain(m *testing.M) {
 	//os.Unsetenv("http_proxy")
 	//os.Unsetenv("https_proxy")
 
-	pool, err := dockertest.NewPool("unix:///var/run/docker.sock")
+	srv, err := vaulttest.Start()
 	if err != nil {
-		log.Fatalf("Could not connect to docker: %s", err)
-	}
-
-	// pulls an image, creates a container based on it and runs it
-	resource, err := pool.Run("vault", "latest", []string{
-		"VAULT_DEV_ROOT_TOKEN_ID=" + rootToken,
-		"VAULT_DEV_LISTEN_ADDRESS=0.0.0.0:8200",
-	})
-	if err != nil {
-		log.Fatalf("Could not start resource: %s", err)
-	}
-
-	host = os.Getenv("DOCKER_HOST")
-	if host == "" {
-		host = "localhost"
-	}
-	if host != "localhost" && !strings.Contains(host, ".") {
-		host = host + ".pnet.ch"
-	}
-	vaultAddr := fmt.Sprintf("http://%s:%s", host, resource.GetPort("8200/tcp"))
-
-	os.Setenv("VAULT_ADDR", vaultAddr)
-	os.Setenv("VAULT_TOKEN", rootToken)
-
-	fmt.Println("VAULT_ADDR:", vaultAddr)
-
-	vaultConfig := api.DefaultConfig()
-	if err := vaultConfig.ReadEnvironment(); err != nil {
 		log.Fatal(err)
 	}
-	vaultClient, err = api.NewClient(vaultConfig)
-	if err != nil {
-		log.Fatal(err)
-	}
-
-	// exponential backoff-retry, because the application in the container might not be ready to accept connections yet
-	if err := pool.Retry(func() error {
-		_, err = vaultClient.Sys().ListMounts()
-		return err
-	}); err != nil {
-		log.Fatal(errors.Wrap(err, "could not connect to vault in docker"))
-	}
+	vaultClient = srv.Client
 
 	code := m.Run()
 
 	// You can't defer this because os.Exit doesn't care for defer
-	if err := pool.Purge(resource); err != nil {
-		log.Fatalf("could not purge resource: %s", err)
+	if err := srv.Purge(); err != nil {
+		log.Fatal(err)
 	}
 	os.Exit(code)
 }
@@ -142,6 +113,24 @@ func TestVaultKV(t *testing.T) {
 		assert.Error(t, err)
 	})
 
+	t.Run("new client with additional mount type", func(t *testing.T) {
+		c, err := kv.New(vaultClient, "cubbyhole/", kv.WithMountType("cubbyhole", kv.FixedVersion(1)))
+		require.NoError(t, err)
+		require.NotNil(t, c)
+		assert.Equal(t, 1, c.Version)
+		assert.Equal(t, "cubbyhole/", c.Mount)
+	})
+
+	t.Run("new client with detector", func(t *testing.T) {
+		c, err := kv.New(vaultClient, "custom/", kv.WithDetector(func(*api.Client, string) (int, string, error) {
+			return 2, "custom/", nil
+		}))
+		require.NoError(t, err)
+		require.NotNil(t, c)
+		assert.Equal(t, 2, c.Version)
+		assert.Equal(t, "custom/", c.Mount)
+	})
+
 	t.Run("new client", func(t *testing.T) {
 		c, err := kv.New(vaultClient, "secret/")
 		require.NotNil(t, c)
@@ -169,6 +158,15 @@ func TestVaultKV(t *testing.T) {
 		assert.Nil(t, err)
 	})
 
+	t.Run("check capabilities", func(t *testing.T) {
+		caps, err := clnt.CheckCapabilities(secretpath, path.Join(secretpath, "first"))
+		assert.NoError(t, err)
+		assert.Len(t, caps, 2)
+		for _, c := range caps {
+			assert.Equal(t, kv.Capabilities{Read: true, Write: true, List: true, Delete: true}, c)
+		}
+	})
+
 	t.Run("list path", func(t *testing.T) {
 		keys, err := clnt.List(secretpath)
 		assert.NoError(t, err)
@@ -201,3 +199,1300 @@ func TestVaultKV(t *testing.T) {
 		assert.Equal(t, data, s)
 	})
 }
+
+func TestWriteIfAbsent(t *testing.T) {
+	clnt, err := kv.New(vaultClient, "secret/")
+	require.NoError(t, err)
+	p := path.Join(secretpath, "absent")
+	data := map[string]interface{}{
+		"Riddler": "Edward Nygma",
+	}
+
+	t.Run("write absent secret", func(t *testing.T) {
+		assert.NoError(t, clnt.WriteIfAbsent(p, data))
+		s, err := clnt.Read(p)
+		assert.NoError(t, err)
+		assert.Equal(t, data, s)
+	})
+
+	t.Run("write existing secret", func(t *testing.T) {
+		err := clnt.WriteIfAbsent(p, map[string]interface{}{"Riddler": "-"})
+		assert.Equal(t, kv.ErrAlreadyExists, errors.Cause(err))
+		s, err := clnt.Read(p)
+		assert.NoError(t, err)
+		assert.Equal(t, data, s)
+	})
+}
+
+func TestStaleIfError(t *testing.T) {
+	vc, err := vaultClient.Clone()
+	require.NoError(t, err)
+	vc.SetToken(rootToken)
+	clnt, err := kv.New(vc, "secret/", kv.WithStaleIfError(time.Minute))
+	require.NoError(t, err)
+	p := path.Join(secretpath, "stale")
+	data := map[string]interface{}{
+		"Scarecrow": "Jonathan Crane",
+	}
+	require.NoError(t, clnt.Write(p, data))
+
+	t.Run("read fresh secret", func(t *testing.T) {
+		s, err := clnt.Read(p)
+		assert.NoError(t, err)
+		assert.Equal(t, data, s)
+	})
+
+	t.Run("read stale secret", func(t *testing.T) {
+		clnt.SetToken("invalid")
+		defer clnt.SetToken(rootToken)
+		s, err := clnt.Read(p)
+		assert.Error(t, err)
+		assert.True(t, kv.IsStale(err))
+		assert.Equal(t, data, s)
+	})
+
+	t.Run("read uncached secret", func(t *testing.T) {
+		clnt.SetToken("invalid")
+		defer clnt.SetToken(rootToken)
+		s, err := clnt.Read(secretpath)
+		assert.Error(t, err)
+		assert.False(t, kv.IsStale(err))
+		assert.Nil(t, s)
+	})
+}
+
+func TestWalk(t *testing.T) {
+	clnt, err := kv.New(vaultClient, "secret/")
+	require.NoError(t, err)
+	root := path.Join(secretpath, "walk")
+	expected := []string{
+		path.Join(root, "arkham"),
+		path.Join(root, "gotham", "east"),
+		path.Join(root, "gotham", "narrows", "asylum"),
+		path.Join(root, "gotham", "west"),
+	}
+	for _, p := range expected {
+		require.NoError(t, clnt.Write(p, map[string]interface{}{"path": p}))
+	}
+
+	for _, concurrency := range []int{0, 1, 4} {
+		t.Run(fmt.Sprintf("walk with concurrency %d", concurrency), func(t *testing.T) {
+			var paths []string
+			err := clnt.Walk(root, kv.WalkOptions{Concurrency: concurrency}, func(p string) error {
+				paths = append(paths, p)
+				return nil
+			})
+			assert.NoError(t, err)
+			assert.Equal(t, expected, paths)
+		})
+	}
+
+	t.Run("walk stops on error", func(t *testing.T) {
+		calls := 0
+		err := clnt.Walk(root, kv.WalkOptions{}, func(p string) error {
+			calls++
+			return fmt.Errorf("failed")
+		})
+		assert.Error(t, err)
+		assert.Equal(t, 1, calls)
+	})
+}
+
+func TestReadWithMeta(t *testing.T) {
+	clnt, err := kv.New(vaultClient, "secret/")
+	require.NoError(t, err)
+	p := path.Join(secretpath, "meta")
+
+	t.Run("read versions", func(t *testing.T) {
+		for i := 1; i <= 2; i++ {
+			data := map[string]interface{}{
+				"Mr. Freeze": fmt.Sprintf("Victor Fries %d", i),
+			}
+			require.NoError(t, clnt.Write(p, data))
+			s, meta, err := clnt.ReadWithMeta(p)
+			assert.NoError(t, err)
+			assert.Equal(t, data, s)
+			require.NotNil(t, meta)
+			assert.Equal(t, i, meta.Version)
+			assert.False(t, meta.CreatedTime.IsZero())
+			assert.True(t, meta.DeletionTime.IsZero())
+			assert.False(t, meta.Deleted())
+		}
+	})
+
+	t.Run("read path not found", func(t *testing.T) {
+		s, meta, err := clnt.ReadWithMeta(path.Join(p, "notfound"))
+		assert.NoError(t, err)
+		assert.Nil(t, s)
+		assert.Nil(t, meta)
+	})
+}
+
+func TestTimeout(t *testing.T) {
+	t.Run("new client with timeout", func(t *testing.T) {
+		c, err := kv.New(vaultClient, "secret/", kv.WithTimeout(10*time.Second))
+		require.NoError(t, err)
+		require.NotNil(t, c)
+		_, err = c.Read(path.Join(secretpath, "first"))
+		assert.NoError(t, err)
+	})
+
+	t.Run("new client with exceeded timeout", func(t *testing.T) {
+		c, err := kv.New(vaultClient, "secret/", kv.WithTimeout(time.Nanosecond))
+		assert.Error(t, err)
+		assert.Nil(t, c)
+	})
+}
+
+func TestWriteWithOptions(t *testing.T) {
+	clnt, err := kv.New(vaultClient, "secret/")
+	require.NoError(t, err)
+	p := path.Join(secretpath, "options")
+	data := map[string]interface{}{
+		"Bane": "-",
+	}
+
+	t.Run("write with delete_version_after", func(t *testing.T) {
+		require.NoError(t, clnt.WriteWithOptions(p, data, kv.WriteOptions{DeleteVersionAfter: time.Hour}))
+		s, meta, err := clnt.ReadWithMeta(p)
+		assert.NoError(t, err)
+		assert.Equal(t, data, s)
+		require.NotNil(t, meta)
+		assert.True(t, meta.DeletionTime.After(time.Now()))
+		assert.False(t, meta.Deleted())
+	})
+}
+
+func TestUpdate(t *testing.T) {
+	clnt, err := kv.New(vaultClient, "secret/")
+	require.NoError(t, err)
+	p := path.Join(secretpath, "update")
+	increment := func(data map[string]interface{}) (map[string]interface{}, error) {
+		if data == nil {
+			return map[string]interface{}{"count": "1"}, nil
+		}
+		n, err := strconv.Atoi(data["count"].(string))
+		if err != nil {
+			return nil, err
+		}
+		data["count"] = strconv.Itoa(n + 1)
+		return data, nil
+	}
+
+	t.Run("concurrent updates", func(t *testing.T) {
+		var wg sync.WaitGroup
+		for i := 0; i < 5; i++ {
+			wg.Add(1)
+			go func() {
+				defer wg.Done()
+				assert.NoError(t, clnt.Update(p, increment))
+			}()
+		}
+		wg.Wait()
+		s, err := clnt.Read(p)
+		assert.NoError(t, err)
+		assert.Equal(t, map[string]interface{}{"count": "5"}, s)
+	})
+
+	t.Run("update without changes", func(t *testing.T) {
+		assert.NoError(t, clnt.Update(p, func(map[string]interface{}) (map[string]interface{}, error) {
+			return nil, nil
+		}))
+		_, meta, err := clnt.ReadWithMeta(p)
+		assert.NoError(t, err)
+		assert.Equal(t, 5, meta.Version)
+	})
+
+	t.Run("update with error", func(t *testing.T) {
+		assert.Error(t, clnt.Update(p, func(map[string]interface{}) (map[string]interface{}, error) {
+			return nil, fmt.Errorf("failed")
+		}))
+	})
+}
+
+func TestWriteMerged(t *testing.T) {
+	clnt, err := kv.New(vaultClient, "secret/")
+	require.NoError(t, err)
+	p := path.Join(secretpath, "merged")
+	require.NoError(t, clnt.Write(p, map[string]interface{}{
+		"Joker": "unknown",
+		"Robin": map[string]interface{}{
+			"first":  "Dick Grayson",
+			"second": "Jason Todd",
+		},
+	}))
+
+	t.Run("merge nested secret", func(t *testing.T) {
+		err := clnt.WriteMerged(p, map[string]interface{}{
+			"Catwoman": "Selina Kyle",
+			"Robin": map[string]interface{}{
+				"second": nil,
+				"third":  "Tim Drake",
+			},
+		}, kv.MergeOptions{NullDeletes: true})
+		assert.NoError(t, err)
+		s, err := clnt.Read(p)
+		assert.NoError(t, err)
+		assert.Equal(t, map[string]interface{}{
+			"Joker":    "unknown",
+			"Catwoman": "Selina Kyle",
+			"Robin": map[string]interface{}{
+				"first": "Dick Grayson",
+				"third": "Tim Drake",
+			},
+		}, s)
+	})
+
+	t.Run("merge null values", func(t *testing.T) {
+		err := clnt.WriteMerged(p, map[string]interface{}{
+			"Joker": nil,
+		}, kv.MergeOptions{})
+		assert.NoError(t, err)
+		s, err := clnt.Read(p)
+		assert.NoError(t, err)
+		assert.Contains(t, s, "Joker")
+		assert.Nil(t, s["Joker"])
+	})
+}
+
+func TestImportEnvFile(t *testing.T) {
+	clnt, err := kv.New(vaultClient, "secret/")
+	require.NoError(t, err)
+	p := path.Join(secretpath, "import")
+	env := `# villains
+TWO_FACE=Harvey Dent # comment
+export PENGUIN="Oswald \"Chesterfield\" Cobblepot"
+POISON_IVY='Pamela # Isley'
+
+EMPTY=
+`
+
+	t.Run("import single secret", func(t *testing.T) {
+		require.NoError(t, clnt.ImportEnvFile(p, strings.NewReader(env), kv.ImportOptions{}))
+		s, err := clnt.Read(p)
+		assert.NoError(t, err)
+		assert.Equal(t, map[string]interface{}{
+			"TWO_FACE":   "Harvey Dent",
+			"PENGUIN":    `Oswald "Chesterfield" Cobblepot`,
+			"POISON_IVY": "Pamela # Isley",
+			"EMPTY":      "",
+		}, s)
+	})
+
+	t.Run("import secret per key", func(t *testing.T) {
+		require.NoError(t, clnt.ImportEnvFile(p, strings.NewReader(env), kv.ImportOptions{SecretPerKey: true}))
+		s, err := clnt.Read(path.Join(p, "TWO_FACE"))
+		assert.NoError(t, err)
+		assert.Equal(t, map[string]interface{}{"value": "Harvey Dent"}, s)
+	})
+
+	t.Run("import invalid env file", func(t *testing.T) {
+		for _, env := range []string{"NOVALUE", "1KEY=value", `KEY="unterminated`, "KEY='unterminated"} {
+			assert.Error(t, clnt.ImportEnvFile(p, strings.NewReader(env), kv.ImportOptions{}), env)
+		}
+	})
+}
+
+func TestExportEnv(t *testing.T) {
+	clnt, err := kv.New(vaultClient, "secret/")
+	require.NoError(t, err)
+	p := path.Join(secretpath, "export")
+	require.NoError(t, clnt.Write(p, map[string]interface{}{
+		"NAME":  "Jervis Tetch",
+		"ALIAS": `Mad "Hatter's" $HOME`,
+	}))
+
+	t.Run("export dotenv", func(t *testing.T) {
+		var b strings.Builder
+		require.NoError(t, clnt.ExportEnv(p, &b, kv.EnvFormatDotenv))
+		assert.Equal(t, "ALIAS=\"Mad \\\"Hatter's\\\" \\$HOME\"\nNAME=\"Jervis Tetch\"\n", b.String())
+	})
+
+	t.Run("export shell", func(t *testing.T) {
+		var b strings.Builder
+		require.NoError(t, clnt.ExportEnv(p, &b, kv.EnvFormatExport))
+		assert.Equal(t, "export ALIAS='Mad \"Hatter'\\''s\" $HOME'\nexport NAME='Jervis Tetch'\n", b.String())
+	})
+
+	t.Run("export and import dotenv", func(t *testing.T) {
+		var b strings.Builder
+		require.NoError(t, clnt.ExportEnv(p, &b, kv.EnvFormatDotenv))
+		copyPath := path.Join(secretpath, "export-copy")
+		require.NoError(t, clnt.ImportEnvFile(copyPath, strings.NewReader(b.String()), kv.ImportOptions{}))
+		s, err := clnt.Read(copyPath)
+		assert.NoError(t, err)
+		o, err := clnt.Read(p)
+		assert.NoError(t, err)
+		assert.Equal(t, o, s)
+	})
+
+	t.Run("export secret not found", func(t *testing.T) {
+		var b strings.Builder
+		assert.Error(t, clnt.ExportEnv(path.Join(p, "notfound"), &b, kv.EnvFormatDotenv))
+	})
+}
+
+func TestValidator(t *testing.T) {
+	requireOwner := func(p string, data map[string]interface{}) error {
+		if _, ok := data["owner"]; !ok {
+			return fmt.Errorf("missing key owner")
+		}
+		return nil
+	}
+	clnt, err := kv.New(vaultClient, "secret/", kv.WithValidator(requireOwner))
+	require.NoError(t, err)
+	p := path.Join(secretpath, "validated")
+
+	t.Run("write valid secret", func(t *testing.T) {
+		assert.NoError(t, clnt.Write(p, map[string]interface{}{"owner": "Alfred"}))
+	})
+
+	t.Run("write invalid secret", func(t *testing.T) {
+		assert.Error(t, clnt.Write(p, map[string]interface{}{"butler": "Alfred"}))
+		assert.Error(t, clnt.WriteIfAbsent(path.Join(p, "absent"), map[string]interface{}{}))
+		assert.Error(t, clnt.WriteMerged(p, map[string]interface{}{"owner": nil}, kv.MergeOptions{NullDeletes: true}))
+		s, err := clnt.Read(p)
+		assert.NoError(t, err)
+		assert.Equal(t, map[string]interface{}{"owner": "Alfred"}, s)
+	})
+}
+
+func TestReadDeleted(t *testing.T) {
+	clnt, err := kv.New(vaultClient, "secret/")
+	require.NoError(t, err)
+	p := path.Join(secretpath, "deleted")
+	require.NoError(t, clnt.Write(p, map[string]interface{}{"Killer Croc": "Waylon Jones"}))
+	_, err = vaultClient.Logical().Delete(kv.FixPath(p, clnt.Mount, kv.WritePrefix))
+	require.NoError(t, err)
+
+	t.Run("read deleted secret", func(t *testing.T) {
+		s, meta, err := clnt.ReadWithMeta(p)
+		assert.Nil(t, s)
+		assert.True(t, kv.IsDeleted(err))
+		assert.Equal(t, kv.ErrSecretDeleted, errors.Cause(err))
+		require.IsType(t, &kv.Error{}, err)
+		require.IsType(t, &kv.DeletedError{}, err.(*kv.Error).Err)
+		assert.False(t, err.(*kv.Error).Err.(*kv.DeletedError).Meta.DeletionTime.IsZero())
+		require.NotNil(t, meta)
+		assert.Equal(t, 1, meta.Version)
+		assert.True(t, meta.Deleted())
+	})
+
+	t.Run("update deleted secret", func(t *testing.T) {
+		assert.NoError(t, clnt.Update(p, func(data map[string]interface{}) (map[string]interface{}, error) {
+			assert.Nil(t, data)
+			return map[string]interface{}{"Killer Croc": "-"}, nil
+		}))
+		s, err := clnt.Read(p)
+		assert.NoError(t, err)
+		assert.Equal(t, map[string]interface{}{"Killer Croc": "-"}, s)
+	})
+}
+
+func TestListWithOptions(t *testing.T) {
+	clnt, err := kv.New(vaultClient, "secret/")
+	require.NoError(t, err)
+	root := path.Join(secretpath, "list")
+	for _, p := range []string{"first", "second", "folder/third"} {
+		require.NoError(t, clnt.Write(path.Join(root, p), map[string]interface{}{"path": p}))
+	}
+
+	testData := []struct {
+		name     string
+		opts     kv.ListOptions
+		expected []string
+	}{
+		{"keys", kv.ListOptions{}, []string{"first", "folder/", "second"}},
+		{"full path", kv.ListOptions{FullPath: true}, []string{root + "/first", root + "/folder/", root + "/second"}},
+		{"folders only", kv.ListOptions{FoldersOnly: true}, []string{"folder/"}},
+		{"secrets only with full path", kv.ListOptions{SecretsOnly: true, FullPath: true}, []string{root + "/first", root + "/second"}},
+	}
+	for _, td := range testData {
+		t.Run(td.name, func(t *testing.T) {
+			keys, err := clnt.ListWithOptions(root, td.opts)
+			assert.NoError(t, err)
+			assert.ElementsMatch(t, td.expected, keys)
+		})
+	}
+
+	t.Run("skip deleted", func(t *testing.T) {
+		dir := path.Join(secretpath, "list-deleted")
+		for _, p := range []string{"alive", "deleted", "folder/secret"} {
+			require.NoError(t, clnt.Write(path.Join(dir, p), map[string]interface{}{"path": p}))
+		}
+		_, err := vaultClient.Logical().Delete(kv.FixPath(path.Join(dir, "deleted"), clnt.Mount, kv.WritePrefix))
+		require.NoError(t, err)
+		keys, err := clnt.ListWithOptions(dir, kv.ListOptions{})
+		assert.NoError(t, err)
+		assert.ElementsMatch(t, []string{"alive", "deleted", "folder/"}, keys)
+		keys, err = clnt.ListWithOptions(dir, kv.ListOptions{SkipDeleted: true})
+		assert.NoError(t, err)
+		assert.ElementsMatch(t, []string{"alive", "folder/"}, keys)
+	})
+
+	t.Run("invalid options", func(t *testing.T) {
+		keys, err := clnt.ListWithOptions(root, kv.ListOptions{FoldersOnly: true, SecretsOnly: true})
+		assert.Error(t, err)
+		assert.Nil(t, keys)
+	})
+}
+
+func TestSnapshot(t *testing.T) {
+	clnt, err := kv.New(vaultClient, "secret/")
+	require.NoError(t, err)
+	src := path.Join(secretpath, "snapshot", "src")
+	dst := path.Join(secretpath, "snapshot", "dst")
+	for i := 1; i <= 2; i++ {
+		require.NoError(t, clnt.Write(path.Join(src, "versions"), map[string]interface{}{"version": strconv.Itoa(i)}))
+	}
+	require.NoError(t, clnt.Write(path.Join(src, "nested", "secret"), map[string]interface{}{"Ra's": "al Ghul"}))
+
+	var b bytes.Buffer
+	t.Run("snapshot", func(t *testing.T) {
+		require.NoError(t, clnt.Snapshot(src, &b))
+	})
+
+	t.Run("restore", func(t *testing.T) {
+		require.NoError(t, clnt.Restore(bytes.NewReader(b.Bytes()), dst))
+		s, meta, err := clnt.ReadWithMeta(path.Join(dst, "versions"))
+		assert.NoError(t, err)
+		assert.Equal(t, map[string]interface{}{"version": "2"}, s)
+		assert.Equal(t, 2, meta.Version)
+		s, err = clnt.Read(path.Join(dst, "nested", "secret"))
+		assert.NoError(t, err)
+		assert.Equal(t, map[string]interface{}{"Ra's": "al Ghul"}, s)
+	})
+
+	t.Run("read metadata", func(t *testing.T) {
+		m, err := clnt.ReadMetadata(path.Join(dst, "versions"))
+		assert.NoError(t, err)
+		require.NotNil(t, m)
+		assert.Equal(t, 2, m.CurrentVersion)
+		assert.Equal(t, []int{1, 2}, m.SortedVersions())
+	})
+}
+
+func TestCASRequired(t *testing.T) {
+	require.NoError(t, vaultClient.Sys().Mount("kv-cas", &api.MountInput{
+		Type:    "kv",
+		Options: map[string]string{"version": "2"},
+	}))
+	defer func() {
+		assert.NoError(t, vaultClient.Sys().Unmount("kv-cas"))
+	}()
+	_, err := vaultClient.Logical().Write("kv-cas/config", map[string]interface{}{
+		"cas_required": true,
+	})
+	require.NoError(t, err)
+	p := "kv-cas/cas"
+
+	t.Run("write without auto cas", func(t *testing.T) {
+		clnt, err := kv.New(vaultClient, "kv-cas/", kv.WithoutAutoCAS())
+		require.NoError(t, err)
+		assert.False(t, clnt.CASRequired)
+		assert.Error(t, clnt.Write(p, map[string]interface{}{"Hush": "Thomas Elliot"}))
+	})
+
+	t.Run("write with auto cas", func(t *testing.T) {
+		clnt, err := kv.New(vaultClient, "kv-cas/")
+		require.NoError(t, err)
+		assert.True(t, clnt.CASRequired)
+		for i := 1; i <= 2; i++ {
+			assert.NoError(t, clnt.Write(p, map[string]interface{}{"Hush": "Thomas Elliot"}))
+		}
+		_, meta, err := clnt.ReadWithMeta(p)
+		assert.NoError(t, err)
+		assert.Equal(t, 2, meta.Version)
+	})
+
+	t.Run("mount config", func(t *testing.T) {
+		clnt, err := kv.New(vaultClient, "kv-cas/")
+		require.NoError(t, err)
+		cfg, err := clnt.MountConfig()
+		require.NoError(t, err)
+		assert.True(t, cfg.CASRequired)
+		require.NoError(t, clnt.TuneMountConfig(kv.MountConfig{
+			MaxVersions:        5,
+			DeleteVersionAfter: time.Hour,
+		}))
+		assert.False(t, clnt.CASRequired)
+		cfg, err = clnt.MountConfig()
+		require.NoError(t, err)
+		assert.Equal(t, &kv.MountConfig{MaxVersions: 5, DeleteVersionAfter: time.Hour}, cfg)
+	})
+}
+
+func TestConsistency(t *testing.T) {
+	clnt, err := kv.New(vaultClient, "secret/", kv.WithConsistency(true))
+	require.NoError(t, err)
+	p := path.Join(secretpath, "consistency")
+	data := map[string]interface{}{"Deadshot": "Floyd Lawton"}
+
+	t.Run("read after write", func(t *testing.T) {
+		require.NoError(t, clnt.Write(p, data))
+		s, err := clnt.Read(p)
+		assert.NoError(t, err)
+		assert.Equal(t, data, s)
+	})
+}
+
+func TestHTTPSettings(t *testing.T) {
+	p := path.Join(secretpath, "http")
+	data := map[string]interface{}{"Bane": "unknown"}
+
+	t.Run("request timeout", func(t *testing.T) {
+		clnt, err := kv.New(vaultClient, "secret/", kv.WithRequestTimeout(5*time.Second))
+		require.NoError(t, err)
+		assert.NotEqual(t, vaultClient, clnt.Client())
+		assert.NoError(t, clnt.Write(p, data))
+		s, err := clnt.Read(p)
+		assert.NoError(t, err)
+		assert.Equal(t, data, s)
+	})
+
+	t.Run("request timeout exceeded", func(t *testing.T) {
+		_, err := kv.New(vaultClient, "secret/", kv.WithRequestTimeout(time.Nanosecond))
+		assert.Error(t, err)
+	})
+
+	t.Run("transport", func(t *testing.T) {
+		clnt, err := kv.New(vaultClient, "secret/", kv.WithTransport(http.DefaultTransport))
+		require.NoError(t, err)
+		assert.NotEqual(t, vaultClient, clnt.Client())
+		s, err := clnt.Read(p)
+		assert.NoError(t, err)
+		assert.Equal(t, data, s)
+	})
+}
+
+func TestError(t *testing.T) {
+	clnt, err := kv.New(vaultClient, "secret/")
+	require.NoError(t, err)
+	p := path.Join(secretpath, "error\nline")
+	require.NoError(t, clnt.Write(p, map[string]interface{}{"Mad Hatter": "Jervis Tetch"}))
+
+	t.Run("wrapped error", func(t *testing.T) {
+		err := clnt.WriteIfAbsent(p, map[string]interface{}{"Mad Hatter": "Jervis Tetch"})
+		require.IsType(t, &kv.Error{}, err)
+		e := err.(*kv.Error)
+		assert.Equal(t, "write", e.Op)
+		assert.Equal(t, clnt.Mount, e.Mount)
+		assert.Equal(t, path.Join(secretpath, "error?line"), e.Path)
+		assert.Equal(t, kv.ErrAlreadyExists, errors.Cause(err))
+		assert.NotContains(t, err.Error(), "\n")
+	})
+
+	t.Run("update function error", func(t *testing.T) {
+		err := clnt.WriteMerged(p, nil, kv.MergeOptions{})
+		assert.NoError(t, err)
+		err = clnt.Update(p, func(map[string]interface{}) (map[string]interface{}, error) {
+			return nil, errors.New("failed")
+		})
+		require.IsType(t, &kv.Error{}, err)
+		assert.Equal(t, "update", err.(*kv.Error).Op)
+		assert.Equal(t, "failed", errors.Cause(err).Error())
+	})
+}
+
+func TestTokenSource(t *testing.T) {
+	p := path.Join(secretpath, "tokensource")
+	data := map[string]interface{}{"Poison Ivy": "Pamela Isley"}
+	calls := 0
+	ts := kv.TokenSourceFunc(func() (string, error) {
+		calls++
+		return rootToken, nil
+	})
+	c, err := vaultClient.Clone()
+	require.NoError(t, err)
+	c.ClearToken()
+
+	t.Run("token from token source", func(t *testing.T) {
+		clnt, err := kv.New(c, "secret/", kv.WithTokenSource(ts))
+		require.NoError(t, err)
+		require.NoError(t, clnt.Write(p, data))
+		s, err := clnt.Read(p)
+		assert.NoError(t, err)
+		assert.Equal(t, data, s)
+		assert.True(t, calls > 0)
+	})
+
+	t.Run("token source error", func(t *testing.T) {
+		_, err := kv.New(c, "secret/", kv.WithTokenSource(kv.TokenSourceFunc(func() (string, error) {
+			return "", errors.New("no token")
+		})))
+		assert.Error(t, err)
+	})
+}
+
+func TestRedact(t *testing.T) {
+	data := map[string]interface{}{
+		"user":     "Harvey Dent",
+		"password": kv.RedactedString("Two-Face"),
+		"nested": map[string]interface{}{
+			"coins": []interface{}{"heads", "tails"},
+		},
+		"empty": nil,
+	}
+
+	t.Run("redact", func(t *testing.T) {
+		r := kv.Redact(data)
+		assert.Equal(t, map[string]interface{}{
+			"user":     kv.Mask,
+			"password": kv.Mask,
+			"nested": map[string]interface{}{
+				"coins": []interface{}{kv.Mask, kv.Mask},
+			},
+			"empty": nil,
+		}, r)
+		assert.Equal(t, "Harvey Dent", data["user"])
+	})
+
+	t.Run("redact hashed", func(t *testing.T) {
+		r := kv.RedactHashed(data)
+		assert.True(t, strings.HasPrefix(r["user"].(string), "sha256:"))
+		assert.NotEqual(t, r["user"], r["password"])
+		assert.Equal(t, r, kv.RedactHashed(data))
+	})
+
+	t.Run("redacted string", func(t *testing.T) {
+		s := kv.RedactedString("Two-Face")
+		assert.Equal(t, kv.Mask, fmt.Sprintf("%s", s))
+		assert.Equal(t, kv.Mask, fmt.Sprintf("%#v", s))
+		assert.NotContains(t, fmt.Sprintf("%s %v %#v %+v", s, s, s, data), "Two-Face")
+		b, err := json.Marshal(data)
+		require.NoError(t, err)
+		assert.NotContains(t, string(b), "Two-Face")
+		assert.Equal(t, "Two-Face", string(s))
+	})
+}
+
+func TestMigrateSecret(t *testing.T) {
+	require.NoError(t, vaultClient.Sys().Mount("kv-migrate", &api.MountInput{
+		Type:    "kv",
+		Options: map[string]string{"version": "2"},
+	}))
+	require.NoError(t, vaultClient.Sys().Mount("kv-migrate-v1", &api.MountInput{
+		Type:    "kv",
+		Options: map[string]string{"version": "1"},
+	}))
+	defer func() {
+		assert.NoError(t, vaultClient.Sys().Unmount("kv-migrate"))
+		assert.NoError(t, vaultClient.Sys().Unmount("kv-migrate-v1"))
+	}()
+	src, err := kv.New(vaultClient, "secret/")
+	require.NoError(t, err)
+	dst, err := kv.New(vaultClient, "kv-migrate/")
+	require.NoError(t, err)
+	dstV1, err := kv.New(vaultClient, "kv-migrate-v1/")
+	require.NoError(t, err)
+	p := "test/migrate/versions"
+	for i := 1; i <= 3; i++ {
+		require.NoError(t, src.Write("secret/"+p, map[string]interface{}{"version": strconv.Itoa(i)}))
+	}
+
+	t.Run("with history", func(t *testing.T) {
+		require.NoError(t, kv.MigrateSecret(src, dst, p, true))
+		m, err := dst.ReadMetadata("kv-migrate/" + p)
+		require.NoError(t, err)
+		require.NotNil(t, m)
+		assert.Equal(t, []int{1, 2, 3}, m.SortedVersions())
+		s, err := dst.Read("kv-migrate/" + p)
+		assert.NoError(t, err)
+		assert.Equal(t, map[string]interface{}{"version": "3"}, s)
+	})
+
+	t.Run("without history", func(t *testing.T) {
+		require.NoError(t, kv.MigrateSecret(src, dstV1, p, false))
+		s, err := dstV1.Read("kv-migrate-v1/" + p)
+		assert.NoError(t, err)
+		assert.Equal(t, map[string]interface{}{"version": "3"}, s)
+	})
+
+	t.Run("mount without trailing slash", func(t *testing.T) {
+		dst, err := kv.New(vaultClient, "kv-migrate/", kv.WithDetector(func(*api.Client, string) (int, string, error) {
+			return 2, "kv-migrate", nil
+		}))
+		require.NoError(t, err)
+		require.NoError(t, kv.MigrateSecret(src, dst, "/"+p, false))
+		s, err := dst.Read("kv-migrate/" + p)
+		assert.NoError(t, err)
+		assert.Equal(t, map[string]interface{}{"version": "3"}, s)
+	})
+
+	t.Run("missing secret", func(t *testing.T) {
+		err := kv.MigrateSecret(src, dst, "test/migrate/missing", true)
+		require.IsType(t, &kv.Error{}, err)
+		assert.Equal(t, "migrate", err.(*kv.Error).Op)
+	})
+}
+
+func TestOfflineSnapshot(t *testing.T) {
+	dir, err := ioutil.TempDir("", "kv")
+	require.NoError(t, err)
+	defer os.RemoveAll(dir)
+	opts := kv.OfflineOptions{
+		File:       filepath.Join(dir, "snapshot"),
+		Passphrase: "Alfred Pennyworth",
+		MaxAge:     time.Hour,
+	}
+	p := path.Join(secretpath, "offline")
+	data := map[string]interface{}{"Scarecrow": "Jonathan Crane"}
+
+	unreachable, err := api.NewClient(&api.Config{Address: "http://127.0.0.1:1"})
+	require.NoError(t, err)
+	unreachable.SetToken(rootToken)
+
+	t.Run("save snapshot", func(t *testing.T) {
+		clnt, err := kv.New(vaultClient, "secret/", kv.WithOfflineSnapshot(opts))
+		require.NoError(t, err)
+		assert.False(t, clnt.Offline())
+		require.NoError(t, clnt.Write(p, data))
+		_, err = clnt.Read(p)
+		require.NoError(t, err)
+		require.NoError(t, clnt.SaveOfflineSnapshot())
+	})
+
+	t.Run("permission denied", func(t *testing.T) {
+		vc, err := vaultClient.Clone()
+		require.NoError(t, err)
+		vc.SetToken(rootToken)
+		clnt, err := kv.New(vc, "secret/", kv.WithOfflineSnapshot(opts))
+		require.NoError(t, err)
+		_, err = clnt.Read(p)
+		require.NoError(t, err)
+		clnt.SetToken("invalid")
+		s, err := clnt.Read(p)
+		assert.Error(t, err)
+		assert.False(t, kv.IsStale(err))
+		assert.Nil(t, s)
+	})
+
+	t.Run("start offline", func(t *testing.T) {
+		clnt, err := kv.New(unreachable, "secret/", kv.WithOfflineSnapshot(opts))
+		require.NoError(t, err)
+		assert.True(t, clnt.Offline())
+		assert.Equal(t, "secret/", clnt.Mount)
+		s, err := clnt.Read(p)
+		assert.True(t, kv.IsStale(err))
+		assert.Equal(t, data, s)
+		_, err = clnt.Read(path.Join(secretpath, "unknown"))
+		assert.Error(t, err)
+		assert.False(t, kv.IsStale(err))
+	})
+
+	t.Run("wrong passphrase", func(t *testing.T) {
+		wrong := opts
+		wrong.Passphrase = "Bruce Wayne"
+		_, err := kv.New(unreachable, "secret/", kv.WithOfflineSnapshot(wrong))
+		assert.Error(t, err)
+	})
+
+	t.Run("snapshot too old", func(t *testing.T) {
+		old := opts
+		old.MaxAge = time.Nanosecond
+		_, err := kv.New(unreachable, "secret/", kv.WithOfflineSnapshot(old))
+		assert.Error(t, err)
+	})
+}
+
+func TestHandle(t *testing.T) {
+	clnt, err := kv.New(vaultClient, "secret/")
+	require.NoError(t, err)
+	p := path.Join(secretpath, "handle")
+
+	var first, second kv.Handle
+	t.Run("write handle", func(t *testing.T) {
+		first, err = clnt.WriteHandle(p, map[string]interface{}{"Riddler": "Edward Nygma"})
+		require.NoError(t, err)
+		second, err = clnt.WriteHandle(p, map[string]interface{}{"Riddler": "Edward Nashton"})
+		require.NoError(t, err)
+		assert.Equal(t, p, second.Path)
+		assert.Equal(t, first.Version+1, second.Version)
+	})
+
+	t.Run("read handle", func(t *testing.T) {
+		s, err := clnt.ReadHandle(first)
+		assert.NoError(t, err)
+		assert.Equal(t, map[string]interface{}{"Riddler": "Edward Nygma"}, s)
+	})
+
+	t.Run("destroy", func(t *testing.T) {
+		require.NoError(t, clnt.Destroy(first))
+		_, err := clnt.ReadHandle(first)
+		assert.True(t, kv.IsDeleted(err))
+		s, err := clnt.ReadHandle(second)
+		assert.NoError(t, err)
+		assert.Equal(t, map[string]interface{}{"Riddler": "Edward Nashton"}, s)
+	})
+
+	t.Run("destroy without version", func(t *testing.T) {
+		assert.Error(t, clnt.Destroy(kv.Handle{Path: p}))
+	})
+}
+
+func TestPing(t *testing.T) {
+	t.Run("mount", func(t *testing.T) {
+		clnt, err := kv.New(vaultClient, "secret/")
+		require.NoError(t, err)
+		r, err := clnt.Ping(context.Background())
+		assert.NoError(t, err)
+		require.NotNil(t, r)
+		assert.True(t, r.Ready())
+		assert.Equal(t, "list", r.Op)
+		assert.Equal(t, "secret/", r.Path)
+	})
+
+	t.Run("probe secret", func(t *testing.T) {
+		clnt, err := kv.New(vaultClient, "secret/", kv.WithProbePath(path.Join(secretpath, "probe")))
+		require.NoError(t, err)
+		r, err := clnt.Ping(context.Background())
+		assert.NoError(t, err)
+		assert.Equal(t, "read", r.Op)
+	})
+
+	t.Run("invalid token", func(t *testing.T) {
+		c, err := vaultClient.Clone()
+		require.NoError(t, err)
+		c.SetToken(rootToken)
+		clnt, err := kv.New(c, "secret/")
+		require.NoError(t, err)
+		c.SetToken("invalid")
+		r, err := clnt.Ping(context.Background())
+		assert.Error(t, err)
+		assert.False(t, r.Ready())
+	})
+}
+
+func TestIterateVersions(t *testing.T) {
+	clnt, err := kv.New(vaultClient, "secret/")
+	require.NoError(t, err)
+	root := path.Join(secretpath, "iterate")
+	for _, p := range []string{"b", "a/c", "b"} {
+		require.NoError(t, clnt.Write(path.Join(root, p), map[string]interface{}{"Catwoman": "Selina Kyle"}))
+	}
+
+	t.Run("all versions", func(t *testing.T) {
+		it := clnt.IterateVersions(root)
+		entries := []string{}
+		for it.Next() {
+			e := it.Entry()
+			require.NotNil(t, e.Meta)
+			assert.False(t, e.Meta.CreatedTime.IsZero())
+			entries = append(entries, fmt.Sprintf("%s@%d", e.Path, e.Version))
+		}
+		assert.NoError(t, it.Err())
+		assert.Equal(t, []string{root + "/a/c@1", root + "/b@1", root + "/b@2"}, entries)
+	})
+
+	t.Run("empty folder", func(t *testing.T) {
+		it := clnt.IterateVersions(path.Join(root, "missing"))
+		assert.False(t, it.Next())
+		assert.NoError(t, it.Err())
+	})
+}
+
+func TestRotation(t *testing.T) {
+	clnt, err := kv.New(vaultClient, "secret/")
+	require.NoError(t, err)
+	root := path.Join(secretpath, "rotation")
+	for _, p := range []string{"due", "fresh", "none"} {
+		require.NoError(t, clnt.Write(path.Join(root, p), map[string]interface{}{"Clayface": "Basil Karlo"}))
+	}
+
+	t.Run("set rotation", func(t *testing.T) {
+		require.NoError(t, clnt.SetRotation(path.Join(root, "due"), kv.Rotation{
+			LastRotated: time.Now().Add(-48 * time.Hour),
+			RotateAfter: 24 * time.Hour,
+		}))
+		require.NoError(t, clnt.SetRotation(path.Join(root, "fresh"), kv.Rotation{
+			LastRotated: time.Now(),
+			RotateAfter: 24 * time.Hour,
+		}))
+		r, err := clnt.ReadRotation(path.Join(root, "fresh"))
+		require.NoError(t, err)
+		require.NotNil(t, r)
+		assert.Equal(t, 24*time.Hour, r.RotateAfter)
+		r, err = clnt.ReadRotation(path.Join(root, "none"))
+		assert.NoError(t, err)
+		assert.Nil(t, r)
+	})
+
+	t.Run("due for rotation", func(t *testing.T) {
+		due, err := clnt.DueForRotation(root)
+		assert.NoError(t, err)
+		assert.Equal(t, []string{path.Join(root, "due")}, due)
+	})
+
+	t.Run("mark rotated", func(t *testing.T) {
+		require.NoError(t, clnt.MarkRotated(path.Join(root, "due")))
+		due, err := clnt.DueForRotation(root)
+		assert.NoError(t, err)
+		assert.Empty(t, due)
+		assert.Error(t, clnt.MarkRotated(path.Join(root, "none")))
+	})
+}
+
+func TestCodec(t *testing.T) {
+	type config struct {
+		Name    string
+		Aliases []string
+	}
+	value := config{Name: "Jason Todd", Aliases: []string{"Red Hood", "Robin"}}
+	codecs := map[string]kv.Codec{
+		"json": kv.JSONCodec,
+		"yaml": kv.YAMLCodec,
+		"gob":  kv.GobCodec,
+	}
+	for name, codec := range codecs {
+		t.Run(name, func(t *testing.T) {
+			clnt, err := kv.New(vaultClient, "secret/", kv.WithCodec(codec))
+			require.NoError(t, err)
+			p := path.Join(secretpath, "codec", name)
+			require.NoError(t, clnt.Write(p, map[string]interface{}{"other": "kept"}))
+			require.NoError(t, clnt.WriteValue(p, "config", value))
+			var v config
+			require.NoError(t, clnt.ReadValue(p, "config", &v))
+			assert.Equal(t, value, v)
+			s, err := clnt.Read(p)
+			assert.NoError(t, err)
+			assert.Equal(t, "kept", s["other"])
+			assert.Error(t, clnt.ReadValue(p, "missing", &v))
+		})
+	}
+}
+
+func TestNewLazy(t *testing.T) {
+	t.Run("invalid path", func(t *testing.T) {
+		_, err := kv.NewLazy(vaultClient, "secret")
+		assert.Error(t, err)
+	})
+
+	t.Run("vault unreachable", func(t *testing.T) {
+		c, err := api.NewClient(&api.Config{Address: "http://127.0.0.1:1"})
+		require.NoError(t, err)
+		clnt, err := kv.NewLazy(c, "secret/")
+		require.NoError(t, err)
+		_, err = clnt.Read(path.Join(secretpath, "lazy"))
+		assert.Error(t, err)
+	})
+
+	t.Run("permanent error is not retried", func(t *testing.T) {
+		calls := 0
+		clnt, err := kv.NewLazy(vaultClient, "secret/", kv.WithDetector(func(*api.Client, string) (int, string, error) {
+			calls++
+			return 0, "", errors.New("matching mount secret/ for path secret/ is not of type kv")
+		}))
+		require.NoError(t, err)
+		_, err = clnt.Read(path.Join(secretpath, "lazy"))
+		assert.Error(t, err)
+		assert.Equal(t, 1, calls)
+	})
+
+	t.Run("retry bounded by timeout", func(t *testing.T) {
+		calls := 0
+		clnt, err := kv.NewLazy(vaultClient, "secret/", kv.WithTimeout(300*time.Millisecond), kv.WithDetector(func(*api.Client, string) (int, string, error) {
+			calls++
+			return 0, "", &url.Error{Op: "Get", URL: "http://127.0.0.1:1", Err: errors.New("connection refused")}
+		}))
+		require.NoError(t, err)
+		start := time.Now()
+		_, err = clnt.Read(path.Join(secretpath, "lazy"))
+		assert.Error(t, err)
+		assert.True(t, time.Since(start) < time.Second)
+		assert.Equal(t, 2, calls)
+	})
+
+	t.Run("initialized by first operation", func(t *testing.T) {
+		clnt, err := kv.NewLazy(vaultClient, "secret/")
+		require.NoError(t, err)
+		assert.Equal(t, 0, clnt.Version)
+		data := map[string]interface{}{"Black Mask": "Roman Sionis"}
+		p := path.Join(secretpath, "lazy")
+		require.NoError(t, clnt.Write(p, data))
+		assert.Equal(t, 2, clnt.Version)
+		assert.Equal(t, "secret/", clnt.Mount)
+		s, err := clnt.Read(p)
+		assert.NoError(t, err)
+		assert.Equal(t, data, s)
+	})
+}
+
+type fakeLogical struct {
+	secret *api.Secret
+	err    error
+}
+
+func (f fakeLogical) ReadWithData(string, map[string][]string) (*api.Secret, error) {
+	return f.secret, f.err
+}
+
+func (f fakeLogical) List(string) (*api.Secret, error) {
+	return f.secret, f.err
+}
+
+func (f fakeLogical) Write(string, map[string]interface{}) (*api.Secret, error) {
+	return f.secret, f.err
+}
+
+func (f fakeLogical) Delete(string) (*api.Secret, error) {
+	return f.secret, f.err
+}
+
+func TestWithLogical(t *testing.T) {
+	detector := kv.WithDetector(func(*api.Client, string) (int, string, error) {
+		return 2, "secret/", nil
+	})
+	p := path.Join(secretpath, "logical")
+
+	t.Run("request error", func(t *testing.T) {
+		clnt, err := kv.New(vaultClient, "secret/", detector, kv.WithoutAutoCAS(), kv.WithLogical(fakeLogical{err: errors.New("timeout")}))
+		require.NoError(t, err)
+		_, err = clnt.Read(p)
+		assert.EqualError(t, errors.Cause(err), "timeout")
+		assert.Error(t, clnt.Write(p, map[string]interface{}{"Penguin": "Oswald Cobblepot"}))
+	})
+
+	t.Run("malformed data", func(t *testing.T) {
+		clnt, err := kv.New(vaultClient, "secret/", detector, kv.WithoutAutoCAS(), kv.WithLogical(fakeLogical{
+			secret: &api.Secret{Data: map[string]interface{}{"keys": "invalid"}},
+		}))
+		require.NoError(t, err)
+		_, err = clnt.List(p)
+		assert.Error(t, err)
+	})
+
+	t.Run("data", func(t *testing.T) {
+		clnt, err := kv.New(vaultClient, "secret/", detector, kv.WithoutAutoCAS(), kv.WithLogical(fakeLogical{
+			secret: &api.Secret{Data: map[string]interface{}{"data": map[string]interface{}{"Penguin": "Oswald Cobblepot"}}},
+		}))
+		require.NoError(t, err)
+		s, err := clnt.Read(p)
+		assert.NoError(t, err)
+		assert.Equal(t, map[string]interface{}{"Penguin": "Oswald Cobblepot"}, s)
+	})
+
+	t.Run("mount config during writes", func(t *testing.T) {
+		clnt, err := kv.New(vaultClient, "secret/", detector, kv.WithLogical(fakeLogical{
+			secret: &api.Secret{Data: map[string]interface{}{"cas_required": true}},
+		}))
+		require.NoError(t, err)
+		assert.True(t, clnt.CASRequired)
+		done := make(chan struct{})
+		go func() {
+			defer close(done)
+			for i := 0; i < 50; i++ {
+				assert.NoError(t, clnt.TuneMountConfig(kv.MountConfig{CASRequired: i%2 == 0}))
+			}
+		}()
+		for i := 0; i < 50; i++ {
+			_ = clnt.Write(p, map[string]interface{}{"Penguin": "Oswald Cobblepot"})
+		}
+		<-done
+		assert.False(t, clnt.CASRequired)
+	})
+}
+
+func TestReservedKeys(t *testing.T) {
+	p := path.Join(secretpath, "reserved")
+	data := map[string]interface{}{"data": map[string]interface{}{"Firefly": "Garfield Lynns"}}
+
+	t.Run("reserved key", func(t *testing.T) {
+		clnt, err := kv.New(vaultClient, "secret/", kv.WithReservedKeyCheck())
+		require.NoError(t, err)
+		err = clnt.Write(p, data)
+		assert.Equal(t, kv.ErrReservedKey, errors.Cause(err))
+		require.IsType(t, &kv.Error{}, err)
+		require.IsType(t, &kv.ReservedKeyError{}, err.(*kv.Error).Err)
+		assert.Equal(t, "data", err.(*kv.Error).Err.(*kv.ReservedKeyError).Key)
+	})
+
+	t.Run("reserved keys by default", func(t *testing.T) {
+		clnt, err := kv.New(vaultClient, "secret/")
+		require.NoError(t, err)
+		require.NoError(t, clnt.Write(p, data))
+		s, err := clnt.Read(p)
+		assert.NoError(t, err)
+		assert.Equal(t, data, s)
+	})
+}
+
+func TestRenameKey(t *testing.T) {
+	clnt, err := kv.New(vaultClient, "secret/")
+	require.NoError(t, err)
+	root := path.Join(secretpath, "rename")
+	require.NoError(t, clnt.Write(path.Join(root, "a"), map[string]interface{}{"pwd": "Bane"}))
+	require.NoError(t, clnt.Write(path.Join(root, "nested", "b"), map[string]interface{}{"pwd": "Venom", "user": "Bane"}))
+	require.NoError(t, clnt.Write(path.Join(root, "c"), map[string]interface{}{"user": "Talia"}))
+
+	t.Run("dry run", func(t *testing.T) {
+		changed, err := clnt.RenameKey(root, "pwd", "password", kv.RenameOptions{DryRun: true})
+		assert.NoError(t, err)
+		assert.Equal(t, []string{path.Join(root, "a"), path.Join(root, "nested", "b")}, changed)
+		s, err := clnt.Read(path.Join(root, "a"))
+		assert.NoError(t, err)
+		assert.Equal(t, map[string]interface{}{"pwd": "Bane"}, s)
+	})
+
+	t.Run("rename", func(t *testing.T) {
+		changed, err := clnt.RenameKey(root, "pwd", "password", kv.RenameOptions{})
+		assert.NoError(t, err)
+		assert.Len(t, changed, 2)
+		s, err := clnt.Read(path.Join(root, "nested", "b"))
+		assert.NoError(t, err)
+		assert.Equal(t, map[string]interface{}{"password": "Venom", "user": "Bane"}, s)
+	})
+
+	t.Run("existing key", func(t *testing.T) {
+		_, err := clnt.RenameKey(root, "password", "user", kv.RenameOptions{})
+		assert.Error(t, err)
+	})
+}
+
+func TestRequestHook(t *testing.T) {
+	var infos []kv.RequestInfo
+	clnt, err := kv.New(vaultClient, "secret/", kv.WithRequestHook(func(info kv.RequestInfo) {
+		infos = append(infos, info)
+	}))
+	require.NoError(t, err)
+	p := path.Join(secretpath, "hook")
+
+	t.Run("request info", func(t *testing.T) {
+		infos = nil
+		require.NoError(t, clnt.Write(p, map[string]interface{}{"Zsasz": "Victor Zsasz"}))
+		require.Len(t, infos, 1)
+		assert.Equal(t, "PUT", infos[0].Method)
+		assert.Equal(t, "secret/data/test/hook", infos[0].Path)
+		assert.NotEmpty(t, infos[0].RequestID)
+		assert.True(t, infos[0].Duration > 0)
+		assert.NoError(t, infos[0].Err)
+	})
+}
+
+func TestSkipForbidden(t *testing.T) {
+	root := path.Join(secretpath, "forbidden")
+	require.NoError(t, vaultClient.Sys().PutPolicy("kv-forbidden", fmt.Sprintf(`
+path "secret/metadata/%s/" {
+	capabilities = ["list"]
+}
+path "secret/metadata/%s/allowed/*" {
+	capabilities = ["list"]
+}`, strings.TrimPrefix(root, "secret/"), strings.TrimPrefix(root, "secret/"))))
+	defer func() {
+		assert.NoError(t, vaultClient.Sys().DeletePolicy("kv-forbidden"))
+	}()
+	token, err := vaultClient.Auth().Token().Create(&api.TokenCreateRequest{
+		Policies: []string{"kv-forbidden"},
+	})
+	require.NoError(t, err)
+
+	c, err := vaultClient.Clone()
+	require.NoError(t, err)
+	c.SetToken(rootToken)
+	clnt, err := kv.New(c, "secret/")
+	require.NoError(t, err)
+	for _, p := range []string{"allowed/a", "denied/b"} {
+		require.NoError(t, clnt.Write(path.Join(root, p), map[string]interface{}{"Ventriloquist": "Arnold Wesker"}))
+	}
+	c.SetToken(token.Auth.ClientToken)
+
+	t.Run("walk forbidden", func(t *testing.T) {
+		err := clnt.Walk(root, kv.WalkOptions{}, func(string) error { return nil })
+		assert.Error(t, err)
+	})
+
+	t.Run("walk skip forbidden", func(t *testing.T) {
+		var skipped, paths []string
+		err := clnt.Walk(root, kv.WalkOptions{
+			SkipForbidden: true,
+			OnSkip: func(p string, _ error) {
+				skipped = append(skipped, p)
+			},
+		}, func(p string) error {
+			paths = append(paths, p)
+			return nil
+		})
+		assert.NoError(t, err)
+		assert.Equal(t, []string{root + "/allowed/a"}, paths)
+		assert.Equal(t, []string{root + "/denied/"}, skipped)
+	})
+
+	t.Run("list skip forbidden", func(t *testing.T) {
+		keys, err := clnt.ListWithOptions(path.Join(root, "denied"), kv.ListOptions{SkipForbidden: true})
+		assert.NoError(t, err)
+		assert.Empty(t, keys)
+	})
+}
+
+func TestReadLastVersions(t *testing.T) {
+	clnt, err := kv.New(vaultClient, "secret/")
+	require.NoError(t, err)
+	p := path.Join(secretpath, "lastversions")
+	for i := 1; i <= 3; i++ {
+		require.NoError(t, clnt.Write(p, map[string]interface{}{"version": strconv.Itoa(i)}))
+	}
+
+	t.Run("last two versions", func(t *testing.T) {
+		versions, err := clnt.ReadLastVersions(p, 2)
+		require.NoError(t, err)
+		require.Len(t, versions, 2)
+		assert.Equal(t, 3, versions[0].Version)
+		assert.Equal(t, map[string]interface{}{"version": "3"}, versions[0].Data)
+		assert.Equal(t, 2, versions[1].Version)
+		assert.Equal(t, map[string]interface{}{"version": "2"}, versions[1].Data)
+	})
+
+	t.Run("more versions than retained", func(t *testing.T) {
+		versions, err := clnt.ReadLastVersions(p, 10)
+		require.NoError(t, err)
+		assert.Len(t, versions, 3)
+	})
+
+	t.Run("missing secret", func(t *testing.T) {
+		versions, err := clnt.ReadLastVersions(path.Join(secretpath, "missing"), 2)
+		assert.NoError(t, err)
+		assert.Nil(t, versions)
+	})
+}
+
+func TestPreflightCheck(t *testing.T) {
+	clnt, err := kv.New(vaultClient, "secret/")
+	require.NoError(t, err)
+
+	t.Run("active node", func(t *testing.T) {
+		assert.NoError(t, clnt.PreflightCheck())
+	})
+
+	t.Run("vault unreachable", func(t *testing.T) {
+		c, err := api.NewClient(&api.Config{Address: "http://127.0.0.1:1"})
+		require.NoError(t, err)
+		clnt, err := kv.NewLazy(c, "secret/")
+		require.NoError(t, err)
+		err = clnt.PreflightCheck()
+		assert.Error(t, err)
+		assert.NotEqual(t, kv.ErrSealed, errors.Cause(err))
+	})
+
+	t.Run("sealed vault with request hook", func(t *testing.T) {
+		srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+			assert.Equal(t, "/v1/sys/health", r.URL.Path)
+			assert.Equal(t, "299", r.URL.Query().Get("sealedcode"))
+			w.WriteHeader(299)
+			fmt.Fprint(w, `{"initialized":true,"sealed":true}`)
+		}))
+		defer srv.Close()
+		c, err := api.NewClient(&api.Config{Address: srv.URL})
+		require.NoError(t, err)
+		var paths []string
+		clnt, err := kv.New(c, "secret/",
+			kv.WithDetector(func(*api.Client, string) (int, string, error) {
+				return 1, "secret/", nil
+			}),
+			kv.WithRequestHook(func(info kv.RequestInfo) {
+				paths = append(paths, info.Path)
+			}),
+		)
+		require.NoError(t, err)
+		assert.Equal(t, kv.ErrSealed, errors.Cause(clnt.PreflightCheck()))
+		assert.Equal(t, []string{"sys/health"}, paths)
+	})
+}
@@ -0,0 +1,95 @@
+package kv
+
+import (
+	"context"
+	"sync"
+	"time"
+
+	"github.com/hashicorp/vault/api"
+	"github.com/pkg/errors"
+)
+
+// attempts and initial delay of the mount detection of a lazily initialized client
+const (
+	lazyInitAttempts = 5
+	lazyInitDelay    = 200 * time.Millisecond
+)
+
+// lazyInit holds the state of the deferred mount detection
+type lazyInit struct {
+	mu   sync.Mutex
+	path string
+	done bool
+}
+
+// NewLazy creates a new kv.Client like New, but the version and the mount path of the engine are
+// determined by the first operation, so the client can be created while Vault is unavailable
+// The detection is retried with exponential backoff while Vault is unreachable, bounded by the
+// timeout of WithTimeout or the context of the operation, if it still fails, the operation returns
+// the error and the next operation tries again
+func NewLazy(c *api.Client, p string, opts ...Option) (*Client, error) {
+	clnt, err := newClient(c, p, opts)
+	if err != nil {
+		return nil, err
+	}
+	clnt.lazy = &lazyInit{path: p}
+	return clnt, nil
+}
+
+// init determines the version and the mount path of a lazily initialized client with the default
+// context of the client
+func (c *Client) init() error {
+	if c.lazy == nil {
+		return nil
+	}
+	ctx, cancel := c.context()
+	defer cancel()
+	return c.initContext(ctx)
+}
+
+// initContext determines the version and the mount path of a lazily initialized client, the
+// detection is retried until ctx is done as long as Vault is unreachable
+// While the client uses the offline snapshot, every operation tries the detection once again.
+func (c *Client) initContext(ctx context.Context) error {
+	if c.lazy == nil {
+		return nil
+	}
+	delay := lazyInitDelay
+	var err error
+	for i := 0; i < lazyInitAttempts; i++ {
+		if i > 0 {
+			t := time.NewTimer(delay)
+			select {
+			case <-ctx.Done():
+				t.Stop()
+				return errors.Wrapf(err, "failed to initialize kv client after %d attempts", i)
+			case <-t.C:
+			}
+			delay *= 2
+		}
+		var done bool
+		done, err = c.detectLazy()
+		if done || err == nil {
+			return nil
+		}
+		if !isUnreachable(err) {
+			return errors.Wrap(err, "failed to initialize kv client")
+		}
+	}
+	return errors.Wrapf(err, "failed to initialize kv client after %d attempts", lazyInitAttempts)
+}
+
+// detectLazy detects the mount once, done is true if it was already detected
+// The detection is not done if the client fell back to the offline snapshot.
+func (c *Client) detectLazy() (done bool, err error) {
+	c.lazy.mu.Lock()
+	defer c.lazy.mu.Unlock()
+	if c.lazy.done {
+		return true, nil
+	}
+	if err := c.detectMount(c.lazy.path); err != nil {
+		return false, err
+	}
+	c.lazy.done = !c.Offline()
+	return false, nil
+}
@@ -0,0 +1,51 @@
+package kv
+
+import (
+	"fmt"
+	"net/http"
+	"net/url"
+
+	"github.com/hashicorp/vault/api"
+)
+
+// LogicalAPI sends the requests of a kv.Client to Vault, it is implemented by *api.Logical
+// and allows to test error paths without a Vault server
+type LogicalAPI interface {
+	ReadWithData(path string, data map[string][]string) (*api.Secret, error)
+	List(path string) (*api.Secret, error)
+	Write(path string, data map[string]interface{}) (*api.Secret, error)
+	Delete(path string) (*api.Secret, error)
+}
+
+// WithLogical sends all requests of the client with l instead of the Vault client
+// The contexts of WithTimeout and Ping, WithConsistency and WithTokenSource are not applied to
+// requests sent with l
+func WithLogical(l LogicalAPI) Option {
+	return func(c *Client) error {
+		if l == nil {
+			return fmt.Errorf("missing logical api")
+		}
+		c.logical = l
+		return nil
+	}
+}
+
+// logicalRequest sends a request with the LogicalAPI of the client
+func (c *Client) logicalRequest(method, p string, params url.Values, body interface{}) (*api.Secret, error) {
+	switch method {
+	case http.MethodGet:
+		if params.Get("list") == "true" {
+			return c.logical.List(p)
+		}
+		return c.logical.ReadWithData(p, params)
+	case http.MethodPut, http.MethodPost:
+		data, ok := body.(map[string]interface{})
+		if !ok && body != nil {
+			return nil, fmt.Errorf("unsupported request body %T", body)
+		}
+		return c.logical.Write(p, data)
+	case http.MethodDelete:
+		return c.logical.Delete(p)
+	}
+	return nil, fmt.Errorf("unsupported request method %s", method)
+}
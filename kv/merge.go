@@ -0,0 +1,39 @@
+package kv
+
+// MergeOptions for WriteMerged
+type MergeOptions struct {
+	// NullDeletes removes keys with a nil value from the secret instead of storing null
+	NullDeletes bool
+}
+
+// WriteMerged merges data into the secret p instead of replacing it, nested maps are merged recursively
+// The secret is written with Update, so concurrent modifications on K/V version 2 are not lost
+func (c *Client) WriteMerged(p string, data map[string]interface{}, opts MergeOptions) error {
+	return c.Update(p, func(current map[string]interface{}) (map[string]interface{}, error) {
+		if current == nil {
+			current = map[string]interface{}{}
+		}
+		return merge(current, data, opts.NullDeletes), nil
+	})
+}
+
+// merge src into dst recursively and return dst
+func merge(dst, src map[string]interface{}, nullDeletes bool) map[string]interface{} {
+	for k, v := range src {
+		if v == nil && nullDeletes {
+			delete(dst, k)
+			continue
+		}
+		sm, ok := v.(map[string]interface{})
+		if !ok {
+			dst[k] = v
+			continue
+		}
+		dm, ok := dst[k].(map[string]interface{})
+		if !ok {
+			dm = map[string]interface{}{}
+		}
+		dst[k] = merge(dm, sm, nullDeletes)
+	}
+	return dst
+}
@@ -0,0 +1,133 @@
+package kv
+
+import (
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"sort"
+	"strconv"
+	"time"
+)
+
+// SecretMeta is the metadata of a secret version on a K/V version 2
+type SecretMeta struct {
+	Version      int
+	CreatedTime  time.Time
+	DeletionTime time.Time
+	Destroyed    bool
+}
+
+// Deleted returns true if the secret version is deleted or destroyed
+func (m *SecretMeta) Deleted() bool {
+	if m.Destroyed {
+		return true
+	}
+	return !m.DeletionTime.IsZero() && m.DeletionTime.Before(time.Now())
+}
+
+// Metadata of a secret on a K/V version 2
+type Metadata struct {
+	CurrentVersion int
+	CreatedTime    time.Time
+	UpdatedTime    time.Time
+	// Versions are the metadata of the retained versions by version number
+	Versions map[int]*SecretMeta
+	// CustomMetadata are the user-defined key value pairs of the secret
+	CustomMetadata map[string]string
+}
+
+// SortedVersions returns the version numbers of the retained versions in ascending order
+func (m *Metadata) SortedVersions() []int {
+	versions := make([]int, 0, len(m.Versions))
+	for v := range m.Versions {
+		versions = append(versions, v)
+	}
+	sort.Ints(versions)
+	return versions
+}
+
+// ReadMetadata reads the metadata of the secret p on a K/V version 2, it returns nil if the secret does not exist
+func (c *Client) ReadMetadata(p string) (*Metadata, error) {
+	if err := c.init(); err != nil {
+		return nil, c.wrap(opMetadata, p, err)
+	}
+	if c.Version != 2 {
+		return nil, c.wrap(opMetadata, p, fmt.Errorf("metadata is not supported by K/V version %d", c.Version))
+	}
+	s, err := c.request(http.MethodGet, c.fixPath(p, MetadataPrefix), nil, nil)
+	if err != nil {
+		return nil, c.wrap(opMetadata, p, err)
+	}
+	if s == nil || s.Data == nil {
+		return nil, nil
+	}
+	m := &Metadata{
+		CurrentVersion: toInt(s.Data["current_version"]),
+		CreatedTime:    toTime(s.Data["created_time"]),
+		UpdatedTime:    toTime(s.Data["updated_time"]),
+		Versions:       map[int]*SecretMeta{},
+		CustomMetadata: map[string]string{},
+	}
+	custom, _ := s.Data["custom_metadata"].(map[string]interface{})
+	for k, v := range custom {
+		if v, ok := v.(string); ok {
+			m.CustomMetadata[k] = v
+		}
+	}
+	versions, _ := s.Data["versions"].(map[string]interface{})
+	for k, v := range versions {
+		version, err := strconv.Atoi(k)
+		if err != nil {
+			continue
+		}
+		meta := parseSecretMeta(v)
+		if meta == nil {
+			continue
+		}
+		meta.Version = version
+		m.Versions[version] = meta
+	}
+	return m, nil
+}
+
+// parseSecretMeta from the metadata block of a K/V version 2 read response
+func parseSecretMeta(v interface{}) *SecretMeta {
+	m, ok := v.(map[string]interface{})
+	if !ok {
+		return nil
+	}
+	destroyed, _ := m["destroyed"].(bool)
+	return &SecretMeta{
+		Version:      toInt(m["version"]),
+		CreatedTime:  toTime(m["created_time"]),
+		DeletionTime: toTime(m["deletion_time"]),
+		Destroyed:    destroyed,
+	}
+}
+
+// toInt converts a number decoded by the Vault API to int
+func toInt(v interface{}) int {
+	switch n := v.(type) {
+	case json.Number:
+		i, _ := n.Int64()
+		return int(i)
+	case float64:
+		return int(n)
+	case int:
+		return n
+	case string:
+		i, _ := strconv.Atoi(n)
+		return i
+	}
+	return 0
+}
+
+// toTime converts a RFC3339 timestamp to time.Time, empty or invalid timestamps return the zero time
+func toTime(v interface{}) time.Time {
+	s, _ := v.(string)
+	t, err := time.Parse(time.RFC3339Nano, s)
+	if err != nil {
+		return time.Time{}
+	}
+	return t
+}
@@ -0,0 +1,91 @@
+package kv
+
+import (
+	"fmt"
+	"net/http"
+	"strings"
+)
+
+// MigrateSecret copies the secret p from the client src to the client dst, p is relative to the mounts
+// of the clients and does not contain them, e.g. foo/bar is copied from <src.Mount>/foo/bar to
+// <dst.Mount>/foo/bar
+// With withHistory all retained versions of a secret on a K/V version 2 are written to dst in
+// ascending order, deleted and destroyed versions are skipped and if the current version is deleted,
+// the copy of the last version is deleted as well
+// Without withHistory or from K/V version 1 only the current data is copied
+func MigrateSecret(src, dst *Client, p string, withHistory bool) error {
+	if err := src.init(); err != nil {
+		return src.wrap(opMigrate, p, err)
+	}
+	if err := dst.init(); err != nil {
+		return dst.wrap(opMigrate, p, err)
+	}
+	p = strings.TrimPrefix(p, "/")
+	if p == "" {
+		return src.wrap(opMigrate, p, fmt.Errorf("missing secret path"))
+	}
+	srcPath, dstPath := src.mountPath(p), dst.mountPath(p)
+	if err := migrateSecret(src, dst, srcPath, dstPath, withHistory); err != nil {
+		return src.wrap(opMigrate, srcPath, err)
+	}
+	return nil
+}
+
+// mountPath returns the path p relative to the mount of the client as a path of the client API
+func (c *Client) mountPath(p string) string {
+	return strings.TrimSuffix(c.Mount, "/") + "/" + p
+}
+
+// migrateSecret copies the secret srcPath to dstPath
+func migrateSecret(src, dst *Client, srcPath, dstPath string, withHistory bool) error {
+	if !withHistory || src.Version != 2 {
+		data, _, err := src.read(srcPath)
+		if err != nil {
+			return err
+		}
+		if data == nil {
+			return fmt.Errorf("secret %s not found", srcPath)
+		}
+		return dst.write(dstPath, data, nil)
+	}
+	m, err := src.ReadMetadata(srcPath)
+	if err != nil {
+		return err
+	}
+	if m == nil {
+		return fmt.Errorf("secret %s not found", srcPath)
+	}
+	var latest map[string]interface{}
+	for _, v := range m.SortedVersions() {
+		if m.Versions[v].Deleted() {
+			continue
+		}
+		data, _, err := src.readVersion(srcPath, v)
+		if err != nil && !IsDeleted(err) {
+			return err
+		}
+		if data == nil {
+			continue
+		}
+		latest = data
+		if dst.Version == 2 {
+			if err := dst.write(dstPath, data, nil); err != nil {
+				return err
+			}
+		}
+	}
+	if latest == nil {
+		return fmt.Errorf("secret %s has no versions with data", srcPath)
+	}
+	current, ok := m.Versions[m.CurrentVersion]
+	currentDeleted := ok && current.Deleted()
+	switch {
+	case dst.Version == 2 && currentDeleted:
+		_, err := dst.request(http.MethodDelete, dst.fixPath(dstPath, WritePrefix), nil, nil)
+		return err
+	case dst.Version != 2 && !currentDeleted:
+		// version 1 has no history, only the latest data is written
+		return dst.write(dstPath, latest, nil)
+	}
+	return nil
+}
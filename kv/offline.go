@@ -0,0 +1,259 @@
+package kv
+
+import (
+	"bytes"
+	"crypto/aes"
+	"crypto/cipher"
+	"crypto/rand"
+	"encoding/json"
+	"io"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"sync"
+	"time"
+
+	"github.com/pkg/errors"
+	"golang.org/x/crypto/scrypt"
+)
+
+// offlineMagic identifies an offline snapshot file and is authenticated with the encrypted content
+const offlineMagic = "KVOFFLINE1"
+
+// parameters of the key derivation from a passphrase
+const (
+	offlineSaltLen = 16
+	offlineKeyLen  = 32
+	scryptN        = 1 << 15
+	scryptR        = 8
+	scryptP        = 1
+)
+
+// OfflineOptions for WithOfflineSnapshot
+type OfflineOptions struct {
+	// File is the path of the encrypted snapshot file
+	File string
+	// Key is a 32 byte AES-256 key, e.g. the plaintext of a data key generated by the transit engine
+	// and kept outside of Vault, Key takes precedence over Passphrase
+	Key []byte
+	// Passphrase is used to derive the key with scrypt if no Key is set
+	Passphrase string
+	// MaxAge is the maximum age of the snapshot file and of every secret in it to be used
+	MaxAge time.Duration
+}
+
+// WithOfflineSnapshot keeps the secrets read successfully in memory, SaveOfflineSnapshot writes them
+// encrypted to opts.File
+// If Vault is unreachable in New, the client is created from the snapshot file as long as it is not
+// older than opts.MaxAge and Offline returns true. If a read fails because Vault is unreachable or
+// responds with a server error, the data of the snapshot is returned together with a *StaleError as
+// long as the secret is not older than opts.MaxAge. Client errors, e.g. permission denied, are
+// returned as they are.
+func WithOfflineSnapshot(opts OfflineOptions) Option {
+	return func(c *Client) error {
+		if opts.File == "" {
+			return errors.New("missing offline snapshot file")
+		}
+		if len(opts.Key) == 0 && opts.Passphrase == "" {
+			return errors.New("missing offline snapshot key or passphrase")
+		}
+		if len(opts.Key) > 0 && len(opts.Key) != offlineKeyLen {
+			return errors.Errorf("offline snapshot key must be %d bytes", offlineKeyLen)
+		}
+		if opts.MaxAge <= 0 {
+			return errors.New("missing offline snapshot max age")
+		}
+		c.offline = &offlineStore{
+			opts:    opts,
+			entries: make(map[string]offlineEntry),
+		}
+		return nil
+	}
+}
+
+// Offline returns true while the client uses the offline snapshot because Vault was unreachable, a
+// lazily initialized client leaves it when a later mount detection succeeds
+func (c *Client) Offline() bool {
+	if c.offline == nil {
+		return false
+	}
+	c.offline.mu.Lock()
+	defer c.offline.mu.Unlock()
+	return c.offline.active
+}
+
+// SaveOfflineSnapshot writes the secrets read so far encrypted to the offline snapshot file
+func (c *Client) SaveOfflineSnapshot() error {
+	if err := c.init(); err != nil {
+		return err
+	}
+	if c.offline == nil {
+		return errors.New("offline snapshot is not enabled")
+	}
+	return c.offline.save(c.Version, c.Mount)
+}
+
+// offlineSnapshot is the content of the snapshot file
+type offlineSnapshot struct {
+	Saved   time.Time               `json:"saved"`
+	Version int                     `json:"version"`
+	Mount   string                  `json:"mount"`
+	Entries map[string]offlineEntry `json:"entries"`
+}
+
+type offlineEntry struct {
+	Data    map[string]interface{} `json:"data"`
+	Meta    *SecretMeta            `json:"meta,omitempty"`
+	Created time.Time              `json:"created"`
+}
+
+// offlineStore holds the secrets of the offline snapshot
+type offlineStore struct {
+	mu      sync.Mutex
+	opts    OfflineOptions
+	active  bool
+	entries map[string]offlineEntry
+}
+
+// setActive records whether the client uses the snapshot because Vault is unreachable
+func (o *offlineStore) setActive(active bool) {
+	o.mu.Lock()
+	defer o.mu.Unlock()
+	o.active = active
+}
+
+// set the data of path p, nil data removes the entry
+func (o *offlineStore) set(p string, data map[string]interface{}, meta *SecretMeta) {
+	o.mu.Lock()
+	defer o.mu.Unlock()
+	if data == nil {
+		delete(o.entries, p)
+		return
+	}
+	o.entries[p] = offlineEntry{Data: copyMap(data), Meta: meta, Created: time.Now()}
+}
+
+// invalidate removes the entries of the paths matched by match
+func (o *offlineStore) invalidate(match func(p string) bool) {
+	o.mu.Lock()
+	defer o.mu.Unlock()
+	for p := range o.entries {
+		if match(p) {
+			delete(o.entries, p)
+		}
+	}
+}
+
+// stale returns the data of path p with a *StaleError or err if no usable entry exists
+func (o *offlineStore) stale(p string, err error) (map[string]interface{}, *SecretMeta, error) {
+	o.mu.Lock()
+	defer o.mu.Unlock()
+	e, ok := o.entries[p]
+	if !ok {
+		return nil, nil, err
+	}
+	age := time.Since(e.Created)
+	if age > o.opts.MaxAge {
+		return nil, nil, err
+	}
+	return copyMap(e.Data), e.Meta, &StaleError{Err: err, Age: age}
+}
+
+// load the snapshot file, a snapshot older than MaxAge is not loaded
+func (o *offlineStore) load() (*offlineSnapshot, error) {
+	b, err := ioutil.ReadFile(o.opts.File)
+	if err != nil {
+		return nil, errors.Wrap(err, "failed to read offline snapshot")
+	}
+	if !bytes.HasPrefix(b, []byte(offlineMagic)) || len(b) < len(offlineMagic)+offlineSaltLen {
+		return nil, errors.New("invalid offline snapshot")
+	}
+	salt := b[len(offlineMagic) : len(offlineMagic)+offlineSaltLen]
+	gcm, err := o.cipher(salt)
+	if err != nil {
+		return nil, err
+	}
+	rest := b[len(offlineMagic)+offlineSaltLen:]
+	if len(rest) < gcm.NonceSize() {
+		return nil, errors.New("invalid offline snapshot")
+	}
+	plain, err := gcm.Open(nil, rest[:gcm.NonceSize()], rest[gcm.NonceSize():], b[:len(offlineMagic)+offlineSaltLen])
+	if err != nil {
+		return nil, errors.Wrap(err, "failed to decrypt offline snapshot")
+	}
+	snap := &offlineSnapshot{}
+	dec := json.NewDecoder(bytes.NewReader(plain))
+	dec.UseNumber()
+	if err := dec.Decode(snap); err != nil {
+		return nil, errors.Wrap(err, "failed to decode offline snapshot")
+	}
+	if age := time.Since(snap.Saved); age > o.opts.MaxAge {
+		return nil, errors.Errorf("offline snapshot is too old (age %s)", age)
+	}
+	o.mu.Lock()
+	defer o.mu.Unlock()
+	for p, e := range snap.Entries {
+		o.entries[p] = e
+	}
+	return snap, nil
+}
+
+// save the entries encrypted to the snapshot file, the file is replaced atomically
+func (o *offlineStore) save(version int, mount string) error {
+	o.mu.Lock()
+	plain, err := json.Marshal(offlineSnapshot{
+		Saved:   time.Now(),
+		Version: version,
+		Mount:   mount,
+		Entries: o.entries,
+	})
+	o.mu.Unlock()
+	if err != nil {
+		return errors.Wrap(err, "failed to encode offline snapshot")
+	}
+	header := make([]byte, len(offlineMagic)+offlineSaltLen)
+	copy(header, offlineMagic)
+	if _, err := io.ReadFull(rand.Reader, header[len(offlineMagic):]); err != nil {
+		return err
+	}
+	gcm, err := o.cipher(header[len(offlineMagic):])
+	if err != nil {
+		return err
+	}
+	nonce := make([]byte, gcm.NonceSize())
+	if _, err := io.ReadFull(rand.Reader, nonce); err != nil {
+		return err
+	}
+	b := append(header, nonce...)
+	b = gcm.Seal(b, nonce, plain, header)
+	tmp, err := ioutil.TempFile(filepath.Dir(o.opts.File), filepath.Base(o.opts.File)+".tmp")
+	if err != nil {
+		return errors.Wrap(err, "failed to write offline snapshot")
+	}
+	defer os.Remove(tmp.Name())
+	if _, err := tmp.Write(b); err != nil {
+		tmp.Close()
+		return errors.Wrap(err, "failed to write offline snapshot")
+	}
+	if err := tmp.Close(); err != nil {
+		return errors.Wrap(err, "failed to write offline snapshot")
+	}
+	return errors.Wrap(os.Rename(tmp.Name(), o.opts.File), "failed to write offline snapshot")
+}
+
+// cipher returns AES-GCM with the key or the key derived from the passphrase and salt
+func (o *offlineStore) cipher(salt []byte) (cipher.AEAD, error) {
+	key := o.opts.Key
+	if len(key) == 0 {
+		var err error
+		key, err = scrypt.Key([]byte(o.opts.Passphrase), salt, scryptN, scryptR, scryptP, offlineKeyLen)
+		if err != nil {
+			return nil, errors.Wrap(err, "failed to derive offline snapshot key")
+		}
+	}
+	block, err := aes.NewCipher(key)
+	if err != nil {
+		return nil, err
+	}
+	return cipher.NewGCM(block)
+}
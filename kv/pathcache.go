@@ -0,0 +1,93 @@
+package kv
+
+import (
+	"container/list"
+	"fmt"
+	"sync"
+)
+
+// defaultPathCacheSize is the default number of fixed paths cached per client
+const defaultPathCacheSize = 1024
+
+// WithPathCacheSize sets the number of API paths cached by the client, 0 disables the cache
+func WithPathCacheSize(n int) Option {
+	return func(c *Client) error {
+		if n < 0 {
+			return fmt.Errorf("invalid path cache size %d", n)
+		}
+		c.paths = newPathCache(n)
+		return nil
+	}
+}
+
+// fixPath returns FixPath of p with the mount of the client and prefix, the result is cached
+func (c *Client) fixPath(p, prefix string) string {
+	if c.paths == nil {
+		return FixPath(p, c.Mount, prefix)
+	}
+	key := pathCacheKey{path: p, prefix: prefix}
+	if fixed, ok := c.paths.get(key); ok {
+		return fixed
+	}
+	fixed := FixPath(p, c.Mount, prefix)
+	c.paths.add(key, fixed)
+	return fixed
+}
+
+type pathCacheKey struct {
+	path   string
+	prefix string
+}
+
+type pathCacheEntry struct {
+	key   pathCacheKey
+	fixed string
+}
+
+// pathCache is a concurrent-safe LRU cache of fixed paths
+type pathCache struct {
+	mu      sync.Mutex
+	size    int
+	order   *list.List
+	entries map[pathCacheKey]*list.Element
+}
+
+// newPathCache returns a cache with size entries, nil if size is 0
+func newPathCache(size int) *pathCache {
+	if size == 0 {
+		return nil
+	}
+	return &pathCache{
+		size:    size,
+		order:   list.New(),
+		entries: make(map[pathCacheKey]*list.Element, size),
+	}
+}
+
+// get the fixed path of key and mark it as recently used
+func (pc *pathCache) get(key pathCacheKey) (string, bool) {
+	pc.mu.Lock()
+	defer pc.mu.Unlock()
+	e, ok := pc.entries[key]
+	if !ok {
+		return "", false
+	}
+	pc.order.MoveToFront(e)
+	return e.Value.(*pathCacheEntry).fixed, true
+}
+
+// add the fixed path of key, the least recently used entry is removed if the cache is full
+func (pc *pathCache) add(key pathCacheKey, fixed string) {
+	pc.mu.Lock()
+	defer pc.mu.Unlock()
+	if e, ok := pc.entries[key]; ok {
+		pc.order.MoveToFront(e)
+		return
+	}
+	pc.entries[key] = pc.order.PushFront(&pathCacheEntry{key: key, fixed: fixed})
+	if pc.order.Len() > pc.size {
+		oldest := pc.order.Back()
+		pc.order.Remove(oldest)
+		delete(pc.entries, oldest.Value.(*pathCacheEntry).key)
+	}
+}
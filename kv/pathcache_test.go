@@ -0,0 +1,57 @@
+package kv
+
+import (
+	"strconv"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestPathCache(t *testing.T) {
+	c := &Client{Mount: "secret/", paths: newPathCache(2)}
+
+	t.Run("cached path", func(t *testing.T) {
+		assert.Equal(t, "secret/data/foo", c.fixPath("secret/foo", ReadPrefix))
+		assert.Equal(t, "secret/metadata/foo", c.fixPath("secret/foo", MetadataPrefix))
+		assert.Equal(t, "secret/data/foo", c.fixPath("secret/foo", ReadPrefix))
+		assert.Equal(t, 2, c.paths.order.Len())
+	})
+
+	t.Run("least recently used entry removed", func(t *testing.T) {
+		c.fixPath("secret/bar", ReadPrefix)
+		assert.Equal(t, 2, c.paths.order.Len())
+		_, ok := c.paths.get(pathCacheKey{path: "secret/foo", prefix: MetadataPrefix})
+		assert.False(t, ok)
+		_, ok = c.paths.get(pathCacheKey{path: "secret/foo", prefix: ReadPrefix})
+		assert.True(t, ok)
+	})
+
+	t.Run("disabled cache", func(t *testing.T) {
+		c := &Client{Mount: "secret/"}
+		assert.Equal(t, "secret/data/foo", c.fixPath("secret/foo", ReadPrefix))
+	})
+}
+
+func benchmarkFixPath(b *testing.B, c *Client) {
+	paths := make([]string, 100)
+	for i := range paths {
+		paths[i] = "secret/team/app/" + strconv.Itoa(i) + "/credentials"
+	}
+	b.ReportAllocs()
+	b.ResetTimer()
+	b.RunParallel(func(pb *testing.PB) {
+		i := 0
+		for pb.Next() {
+			c.fixPath(paths[i%len(paths)], ReadPrefix)
+			i++
+		}
+	})
+}
+
+func BenchmarkFixPath(b *testing.B) {
+	benchmarkFixPath(b, &Client{Mount: "secret/"})
+}
+
+func BenchmarkFixPathCached(b *testing.B) {
+	benchmarkFixPath(b, &Client{Mount: "secret/", paths: newPathCache(defaultPathCacheSize)})
+}
@@ -0,0 +1,77 @@
+package kv
+
+import (
+	"context"
+	"net/http"
+	"net/url"
+	"strings"
+	"time"
+)
+
+// WithProbePath sets the path probed by Ping, a folder (ending with '/') is listed and a secret is read
+// It defaults to the mount of the client
+func WithProbePath(p string) Option {
+	return func(c *Client) error {
+		c.probePath = p
+		return nil
+	}
+}
+
+// PingResult contains the diagnostics of Ping
+type PingResult struct {
+	Address string
+	Mount   string
+	Version int
+	// Path is the probed path and Op the operation (list or read)
+	Path string
+	Op   string
+	// Latency of the probe request
+	Latency time.Duration
+	// Err of the probe request, nil if Vault is ready
+	Err error
+}
+
+// Ready returns true if the probe succeeded
+func (r *PingResult) Ready() bool {
+	return r.Err == nil
+}
+
+// Ping verifies that the mount is reachable and the token can list or read the probe path (see WithProbePath)
+// The returned error is the error of the result, a secret or folder that does not exist is not an error
+func (c *Client) Ping(ctx context.Context) (*PingResult, error) {
+	if err := c.initContext(ctx); err != nil {
+		r := &PingResult{
+			Address: c.client.Address(),
+			Path:    c.probePath,
+			Err:     err,
+		}
+		return r, err
+	}
+	p := c.probePath
+	if p == "" {
+		p = c.Mount
+	}
+	r := &PingResult{
+		Address: c.client.Address(),
+		Mount:   c.Mount,
+		Version: c.Version,
+		Path:    p,
+		Op:      opRead,
+	}
+	reqPath := p
+	var params url.Values
+	if strings.HasSuffix(p, "/") {
+		r.Op = opList
+		params = url.Values{"list": []string{"true"}}
+		if c.Version == 2 {
+			reqPath = c.fixPath(p, ListPrefix)
+		}
+	} else if c.Version == 2 {
+		reqPath = c.fixPath(p, ReadPrefix)
+	}
+	start := time.Now()
+	_, err := c.requestWithContext(ctx, http.MethodGet, reqPath, params, nil)
+	r.Latency = time.Since(start)
+	r.Err = c.wrap(r.Op, p, err)
+	return r, r.Err
+}
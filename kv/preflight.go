@@ -0,0 +1,46 @@
+package kv
+
+import (
+	"net/http"
+	"net/url"
+
+	"github.com/hashicorp/vault/api"
+	"github.com/pkg/errors"
+)
+
+// Conditions of Vault returned by PreflightCheck
+var (
+	ErrUninitialized = errors.New("vault is not initialized")
+	ErrSealed        = errors.New("vault is sealed")
+	ErrDRSecondary   = errors.New("vault is a disaster recovery secondary")
+	ErrStandby       = errors.New("vault is a standby node")
+)
+
+// PreflightCheck queries sys/health and returns an error caused by ErrUninitialized, ErrSealed,
+// ErrDRSecondary or ErrStandby if Vault cannot serve the requests of the client, so bulk operations
+// can fail fast with errors.Cause(err) == kv.ErrSealed instead of failing on every request
+// A performance standby serves requests and is not reported
+func (c *Client) PreflightCheck() error {
+	ctx, cancel := c.context()
+	defer cancel()
+	// the status codes of all conditions are set to 299, the API returns an error for codes >= 400
+	params := url.Values{}
+	for _, k := range []string{"uninitcode", "sealedcode", "standbycode", "drsecondarycode", "performancestandbycode"} {
+		params.Set(k, "299")
+	}
+	h := api.HealthResponse{}
+	if _, err := c.decodeWithContext(ctx, http.MethodGet, "sys/health", params, nil, &h); err != nil {
+		return errors.Wrap(err, "failed to query vault health")
+	}
+	switch {
+	case !h.Initialized:
+		return errors.Wrapf(ErrUninitialized, "preflight check of %s failed", c.client.Address())
+	case h.Sealed:
+		return errors.Wrapf(ErrSealed, "preflight check of %s failed", c.client.Address())
+	case h.ReplicationDRMode == "secondary":
+		return errors.Wrapf(ErrDRSecondary, "preflight check of %s failed", c.client.Address())
+	case h.Standby && !h.PerformanceStandby:
+		return errors.Wrapf(ErrStandby, "preflight check of %s failed", c.client.Address())
+	}
+	return nil
+}
@@ -0,0 +1,84 @@
+package kv
+
+import (
+	"crypto/sha256"
+	"encoding/hex"
+	"fmt"
+)
+
+// Mask replaces the values of redacted secrets
+const Mask = "[REDACTED]"
+
+// RedactedString is a secret value which is masked when it is formatted, logged or marshaled,
+// the value is available with string(s)
+type RedactedString string
+
+// String returns Mask
+func (s RedactedString) String() string {
+	return Mask
+}
+
+// GoString returns Mask
+func (s RedactedString) GoString() string {
+	return Mask
+}
+
+// MarshalJSON returns Mask as JSON string
+func (s RedactedString) MarshalJSON() ([]byte, error) {
+	return []byte(`"` + Mask + `"`), nil
+}
+
+// MarshalText returns Mask
+func (s RedactedString) MarshalText() ([]byte, error) {
+	return []byte(Mask), nil
+}
+
+// Redact returns a copy of the secret data with every value replaced by Mask, the keys are kept,
+// nested maps and slices are redacted recursively, data is not modified
+func Redact(data map[string]interface{}) map[string]interface{} {
+	return redactMap(data, func(interface{}) interface{} {
+		return Mask
+	})
+}
+
+// RedactHashed returns a copy of the secret data with every value replaced by a short SHA-256 hash
+// of the value, so changes of values can be detected in logs without revealing them
+// Values with low entropy (e.g. short PINs) can be guessed from the hash and should be masked with Redact
+func RedactHashed(data map[string]interface{}) map[string]interface{} {
+	return redactMap(data, func(v interface{}) interface{} {
+		sum := sha256.Sum256([]byte(fmt.Sprint(v)))
+		return "sha256:" + hex.EncodeToString(sum[:6])
+	})
+}
+
+// redactMap copies m and replaces the values with fn
+func redactMap(m map[string]interface{}, fn func(interface{}) interface{}) map[string]interface{} {
+	if m == nil {
+		return nil
+	}
+	r := make(map[string]interface{}, len(m))
+	for k, v := range m {
+		r[k] = redactValue(v, fn)
+	}
+	return r
+}
+
+// redactValue replaces v with fn, maps and slices are redacted recursively
+func redactValue(v interface{}, fn func(interface{}) interface{}) interface{} {
+	switch t := v.(type) {
+	case nil:
+		return nil
+	case map[string]interface{}:
+		return redactMap(t, fn)
+	case []interface{}:
+		r := make([]interface{}, len(t))
+		for i, e := range t {
+			r[i] = redactValue(e, fn)
+		}
+		return r
+	case RedactedString:
+		return fn(string(t))
+	default:
+		return fn(t)
+	}
+}
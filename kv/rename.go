@@ -0,0 +1,54 @@
+package kv
+
+import "fmt"
+
+// RenameOptions for RenameKey
+type RenameOptions struct {
+	// DryRun returns the secrets that would be changed without writing them
+	DryRun bool
+	// Overwrite replaces the value of newKey if it exists already, otherwise an error is returned
+	Overwrite bool
+	// Concurrency is the maximum number of concurrent list requests, defaults to 1
+	Concurrency int
+}
+
+// RenameKey renames the key oldKey to newKey in all secrets below the folder prefix and returns the
+// paths of the secrets changed, secrets without oldKey are not changed
+// The secrets are written with Update, so concurrent modifications on K/V version 2 are not lost
+func (c *Client) RenameKey(prefix, oldKey, newKey string, opts RenameOptions) ([]string, error) {
+	if oldKey == newKey {
+		return nil, c.wrap(opRename, prefix, fmt.Errorf("old and new key %s are the same", oldKey))
+	}
+	paths, err := c.walk(prefix, WalkOptions{Concurrency: opts.Concurrency})
+	if err != nil {
+		return nil, err
+	}
+	changed := []string{}
+	for _, p := range paths {
+		renamed := false
+		err := c.Update(p, func(data map[string]interface{}) (map[string]interface{}, error) {
+			renamed = false
+			v, ok := data[oldKey]
+			if !ok {
+				return nil, nil
+			}
+			if _, exists := data[newKey]; exists && !opts.Overwrite {
+				return nil, fmt.Errorf("key %s exists already in secret %s", newKey, p)
+			}
+			renamed = true
+			if opts.DryRun {
+				return nil, nil
+			}
+			delete(data, oldKey)
+			data[newKey] = v
+			return data, nil
+		})
+		if err != nil {
+			return changed, err
+		}
+		if renamed {
+			changed = append(changed, p)
+		}
+	}
+	return changed, nil
+}
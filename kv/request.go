@@ -0,0 +1,295 @@
+package kv
+
+import (
+	"context"
+	"encoding/json"
+	"io"
+	"net/http"
+	"net/url"
+	"sync"
+	"time"
+
+	"github.com/hashicorp/vault/api"
+	"github.com/pkg/errors"
+)
+
+// WithTimeout applies a deadline of d to every request to Vault that is not sent with a context
+// supplied by the caller, including the detection of the mount in New
+func WithTimeout(d time.Duration) Option {
+	return func(c *Client) error {
+		c.timeout = d
+		return nil
+	}
+}
+
+// WithRequestTimeout uses a clone of the Vault client with the HTTP client timeout d, the Vault
+// client passed to New is not changed
+// Unlike WithTimeout the timeout also applies to requests sent with a context of the caller
+func WithRequestTimeout(d time.Duration) Option {
+	return func(c *Client) error {
+		clone, err := c.client.Clone()
+		if err != nil {
+			return errors.Wrap(err, "failed to clone vault client")
+		}
+		copySettings(c.client, clone)
+		clone.SetClientTimeout(d)
+		c.client = clone
+		return nil
+	}
+}
+
+// WithTransport uses a new Vault client with the address, token and headers of the Vault client
+// passed to New and an HTTP client with the transport rt
+// TLS settings have to be configured on rt, retries and timeouts are read from the environment
+func WithTransport(rt http.RoundTripper) Option {
+	return func(c *Client) error {
+		config := api.DefaultConfig()
+		if config.Error != nil {
+			return errors.Wrap(config.Error, "failed to create vault config")
+		}
+		config.Address = c.client.Address()
+		config.HttpClient = &http.Client{
+			Transport: rt,
+		}
+		clone, err := api.NewClient(config)
+		if err != nil {
+			return errors.Wrap(err, "failed to create vault client")
+		}
+		copySettings(c.client, clone)
+		c.client = clone
+		return nil
+	}
+}
+
+// copySettings copies the token, the headers (including the namespace) and the wrapping lookup
+// function from the Vault client src to dst
+func copySettings(src, dst *api.Client) {
+	dst.SetToken(src.Token())
+	dst.SetHeaders(src.Headers())
+	dst.SetWrappingLookupFunc(src.CurrentWrappingLookupFunc())
+}
+
+// Headers for Server Side Consistent Tokens of Vault Enterprise
+const (
+	IndexHeader        = "X-Vault-Index"
+	InconsistentHeader = "X-Vault-Inconsistent"
+)
+
+// WithConsistency captures the X-Vault-Index header of the responses and sends the last index
+// with the following requests, so a performance standby of Vault Enterprise only answers
+// a read after it has caught up with the preceding write
+// If forward is true, a performance standby that has not caught up forwards the request to
+// the active node instead of failing
+func WithConsistency(forward bool) Option {
+	return func(c *Client) error {
+		c.consistency = &consistencyState{forward: forward}
+		return nil
+	}
+}
+
+// consistencyState holds the last X-Vault-Index returned by Vault
+type consistencyState struct {
+	mu      sync.Mutex
+	index   string
+	forward bool
+}
+
+// apply the consistency headers to the request headers h
+func (cs *consistencyState) apply(h http.Header) {
+	cs.mu.Lock()
+	defer cs.mu.Unlock()
+	if cs.index == "" {
+		return
+	}
+	h.Set(IndexHeader, cs.index)
+	if cs.forward {
+		h.Set(InconsistentHeader, "forward-active-node")
+	}
+}
+
+// record the X-Vault-Index of the response headers h
+func (cs *consistencyState) record(h http.Header) {
+	index := h.Get(IndexHeader)
+	if index == "" {
+		return
+	}
+	cs.mu.Lock()
+	defer cs.mu.Unlock()
+	cs.index = index
+}
+
+// context returns the context for a request without a context supplied by the caller
+func (c *Client) context() (context.Context, context.CancelFunc) {
+	if c.timeout > 0 {
+		return context.WithTimeout(context.Background(), c.timeout)
+	}
+	return context.WithCancel(context.Background())
+}
+
+// request sends a request to Vault with the default context
+func (c *Client) request(method, p string, params url.Values, body interface{}) (*api.Secret, error) {
+	ctx, cancel := c.context()
+	defer cancel()
+	return c.requestWithContext(ctx, method, p, params, body)
+}
+
+// RequestInfo describes a request of a kv.Client to Vault
+type RequestInfo struct {
+	Method string
+	Path   string
+	// RequestID is the request ID of Vault to find the request in the audit log, it is empty if the
+	// response contains no body
+	RequestID string
+	Duration  time.Duration
+	Err       error
+}
+
+// RequestHook is called after every request to Vault
+type RequestHook func(RequestInfo)
+
+// WithRequestHook calls fn after every request to Vault with the request ID and the duration
+func WithRequestHook(fn RequestHook) Option {
+	return func(c *Client) error {
+		c.hooks = append(c.hooks, fn)
+		return nil
+	}
+}
+
+// requestWithContext sends a request to Vault and returns the parsed response
+// like api.Logical does, a 404 response without data returns nil
+func (c *Client) requestWithContext(ctx context.Context, method, p string, params url.Values, body interface{}) (*api.Secret, error) {
+	return c.decodeWithContext(ctx, method, p, params, body, nil)
+}
+
+// decodeWithContext is requestWithContext decoding the response into out instead of a secret if out
+// is not nil, e.g. for sys/health which does not respond with a secret
+func (c *Client) decodeWithContext(ctx context.Context, method, p string, params url.Values, body, out interface{}) (*api.Secret, error) {
+	if len(c.hooks) == 0 {
+		return c.send(ctx, method, p, params, body, out)
+	}
+	start := time.Now()
+	s, err := c.send(ctx, method, p, params, body, out)
+	info := RequestInfo{
+		Method:   method,
+		Path:     p,
+		Duration: time.Since(start),
+		Err:      err,
+	}
+	if s != nil {
+		info.RequestID = s.RequestID
+	}
+	for _, fn := range c.hooks {
+		fn(info)
+	}
+	return s, err
+}
+
+// send a request to Vault, the response is decoded into out if it is not nil
+func (c *Client) send(ctx context.Context, method, p string, params url.Values, body, out interface{}) (*api.Secret, error) {
+	if c.logical != nil && out == nil {
+		return c.logicalRequest(method, p, params, body)
+	}
+	r := c.client.NewRequest(method, "/v1/"+p)
+	if c.tokens != nil {
+		token, err := c.token()
+		if err != nil {
+			return nil, err
+		}
+		r.ClientToken = token
+	}
+	for k, v := range params {
+		r.Params[k] = v
+	}
+	if body != nil {
+		if err := r.SetJSONBody(body); err != nil {
+			return nil, err
+		}
+	}
+	if c.consistency != nil {
+		// the headers of the request are shared with the Vault client
+		h := http.Header{}
+		for k, v := range r.Headers {
+			h[k] = v
+		}
+		c.consistency.apply(h)
+		r.Headers = h
+	}
+	resp, err := c.client.RawRequestWithContext(ctx, r)
+	if resp != nil {
+		defer resp.Body.Close()
+		if c.consistency != nil {
+			c.consistency.record(resp.Header)
+		}
+	}
+	if resp != nil && resp.StatusCode == http.StatusNotFound {
+		return notFound(method, resp.Body, err)
+	}
+	if err != nil {
+		return nil, err
+	}
+	if out != nil {
+		return nil, resp.DecodeJSON(out)
+	}
+	return api.ParseSecret(resp.Body)
+}
+
+// notFound handles a 404 response like the logical backend of the Vault client: a read or list
+// without data returns no secret, any other request only if the response has no body
+func notFound(method string, body io.Reader, err error) (*api.Secret, error) {
+	s, parseErr := api.ParseSecret(body)
+	switch parseErr {
+	case nil:
+	case io.EOF:
+		return nil, nil
+	default:
+		return nil, err
+	}
+	if s != nil && (len(s.Warnings) > 0 || len(s.Data) > 0) {
+		return s, nil
+	}
+	if s == nil || method == http.MethodGet || method == "LIST" {
+		return nil, nil
+	}
+	return nil, err
+}
+
+// listMounts returns the mounted secret engines
+func (c *Client) listMounts() (map[string]*api.MountOutput, error) {
+	s, err := c.request(http.MethodGet, "sys/mounts", nil, nil)
+	if err != nil {
+		return nil, err
+	}
+	mounts := map[string]*api.MountOutput{}
+	if s == nil {
+		return mounts, nil
+	}
+	b, err := json.Marshal(s.Data)
+	if err != nil {
+		return nil, err
+	}
+	if err := json.Unmarshal(b, &mounts); err != nil {
+		return nil, err
+	}
+	return mounts, nil
+}
+
+// capabilitiesSelf returns the capabilities of the token on the path p
+func (c *Client) capabilitiesSelf(p string) ([]string, error) {
+	s, err := c.request(http.MethodPost, "sys/capabilities-self", nil, map[string]interface{}{
+		"paths": []string{p},
+	})
+	if err != nil {
+		return nil, err
+	}
+	if s == nil {
+		return nil, nil
+	}
+	caps, _ := s.Data["capabilities"].([]interface{})
+	result := make([]string, 0, len(caps))
+	for _, v := range caps {
+		if c, ok := v.(string); ok {
+			result = append(result, c)
+		}
+	}
+	return result, nil
+}
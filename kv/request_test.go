@@ -0,0 +1,51 @@
+package kv
+
+import (
+	"errors"
+	"net/http"
+	"strings"
+	"testing"
+
+	"github.com/hashicorp/vault/api"
+	"github.com/stretchr/testify/assert"
+)
+
+func TestNotFound(t *testing.T) {
+	errNotFound := errors.New("Code: 404")
+	var tt = []struct {
+		name    string
+		method  string
+		body    string
+		data    bool
+		wantErr bool
+	}{
+		{"read without data", http.MethodGet, `{"errors":[]}`, false, false},
+		{"list without data", "LIST", `{"errors":[]}`, false, false},
+		{"read with data", http.MethodGet, `{"data":{"keys":["a"]}}`, true, false},
+		{"write without body", http.MethodPut, ``, false, false},
+		{"write with errors", http.MethodPut, `{"errors":["no handler for route"]}`, false, true},
+		{"delete with errors", http.MethodDelete, `{"errors":[]}`, false, true},
+	}
+	for _, tc := range tt {
+		tc := tc
+		t.Run(tc.name, func(t *testing.T) {
+			s, err := notFound(tc.method, strings.NewReader(tc.body), errNotFound)
+			if tc.wantErr {
+				assert.Equal(t, errNotFound, err)
+				assert.Nil(t, s)
+				return
+			}
+			assert.NoError(t, err)
+			assert.Equal(t, tc.data, s != nil)
+		})
+	}
+}
+
+func TestIsForbidden(t *testing.T) {
+	denied := &api.ResponseError{StatusCode: http.StatusForbidden}
+	assert.True(t, isForbidden(denied))
+	assert.True(t, isForbidden(&Error{Op: opList, Path: "secret/team", Err: denied}))
+	assert.False(t, isForbidden(&api.ResponseError{StatusCode: http.StatusNotFound}))
+	assert.False(t, isForbidden(errors.New("Code: 403. Errors: permission denied")))
+	assert.False(t, isForbidden(nil))
+}
@@ -0,0 +1,115 @@
+package kv
+
+import (
+	"fmt"
+	"net/http"
+	"time"
+)
+
+// Keys of the rotation metadata in the custom_metadata of a secret
+const (
+	LastRotatedKey = "last_rotated"
+	RotateAfterKey = "rotate_after"
+)
+
+// Rotation is the rotation metadata of a secret
+type Rotation struct {
+	// LastRotated is the time of the last rotation
+	LastRotated time.Time
+	// RotateAfter is the rotation window, the secret is due for rotation after LastRotated + RotateAfter
+	RotateAfter time.Duration
+}
+
+// Due returns true if the rotation window has passed at time now
+func (r Rotation) Due(now time.Time) bool {
+	return r.RotateAfter > 0 && !now.Before(r.LastRotated.Add(r.RotateAfter))
+}
+
+// SetRotation stores the rotation metadata r in the custom_metadata of the secret p (version 2 only),
+// other custom metadata of the secret is kept
+func (c *Client) SetRotation(p string, r Rotation) error {
+	if err := c.init(); err != nil {
+		return c.wrap(opRotation, p, err)
+	}
+	if c.Version != 2 {
+		return c.wrap(opRotation, p, fmt.Errorf("custom metadata is not supported by K/V version %d", c.Version))
+	}
+	m, err := c.ReadMetadata(p)
+	if err != nil {
+		return err
+	}
+	custom := map[string]string{}
+	if m != nil {
+		custom = m.CustomMetadata
+	}
+	custom[LastRotatedKey] = r.LastRotated.UTC().Format(time.RFC3339)
+	custom[RotateAfterKey] = r.RotateAfter.String()
+	_, err = c.request(http.MethodPut, c.fixPath(p, MetadataPrefix), nil, map[string]interface{}{
+		"custom_metadata": custom,
+	})
+	return c.wrap(opRotation, p, err)
+}
+
+// MarkRotated sets the last rotation of the secret p to now and keeps its rotation window
+func (c *Client) MarkRotated(p string) error {
+	r, err := c.ReadRotation(p)
+	if err != nil {
+		return err
+	}
+	if r == nil {
+		return c.wrap(opRotation, p, fmt.Errorf("secret %s has no rotation metadata", p))
+	}
+	r.LastRotated = time.Now()
+	return c.SetRotation(p, *r)
+}
+
+// ReadRotation reads the rotation metadata of the secret p, it returns nil if the secret does not
+// exist or has no rotation metadata
+func (c *Client) ReadRotation(p string) (*Rotation, error) {
+	m, err := c.ReadMetadata(p)
+	if err != nil || m == nil {
+		return nil, err
+	}
+	r, err := parseRotation(m.CustomMetadata)
+	return r, c.wrap(opRotation, p, err)
+}
+
+// DueForRotation returns the paths of all secrets below the folder prefix which are past their rotation window,
+// secrets without rotation metadata are ignored
+func (c *Client) DueForRotation(prefix string) ([]string, error) {
+	paths, err := c.walk(prefix, WalkOptions{})
+	if err != nil {
+		return nil, err
+	}
+	now := time.Now()
+	due := []string{}
+	for _, p := range paths {
+		r, err := c.ReadRotation(p)
+		if err != nil {
+			return nil, err
+		}
+		if r != nil && r.Due(now) {
+			due = append(due, p)
+		}
+	}
+	return due, nil
+}
+
+// parseRotation returns the rotation metadata of custom, nil if it is not set
+func parseRotation(custom map[string]string) (*Rotation, error) {
+	last, ok := custom[LastRotatedKey]
+	if !ok {
+		return nil, nil
+	}
+	r := &Rotation{}
+	var err error
+	if r.LastRotated, err = time.Parse(time.RFC3339, last); err != nil {
+		return nil, fmt.Errorf("invalid %s %q: %s", LastRotatedKey, last, err)
+	}
+	if after, ok := custom[RotateAfterKey]; ok {
+		if r.RotateAfter, err = time.ParseDuration(after); err != nil {
+			return nil, fmt.Errorf("invalid %s %q: %s", RotateAfterKey, after, err)
+		}
+	}
+	return r, nil
+}
@@ -0,0 +1,170 @@
+package kv
+
+import (
+	"archive/tar"
+	"encoding/json"
+	"fmt"
+	"io"
+	"path"
+	"strings"
+	"time"
+)
+
+// snapshotManifest is the first entry of a snapshot archive
+type snapshotManifest struct {
+	Prefix  string    `json:"prefix"`
+	Version int       `json:"version"`
+	Created time.Time `json:"created"`
+}
+
+// snapshotSecret is an entry of a snapshot archive with all retained versions of a secret
+type snapshotSecret struct {
+	Path     string            `json:"path"`
+	Versions []snapshotVersion `json:"versions"`
+}
+
+// snapshotVersion is a version of a secret, deleted and destroyed versions have no data
+type snapshotVersion struct {
+	Version      int                    `json:"version"`
+	CreatedTime  time.Time              `json:"created_time"`
+	DeletionTime time.Time              `json:"deletion_time"`
+	Destroyed    bool                   `json:"destroyed"`
+	Data         map[string]interface{} `json:"data,omitempty"`
+}
+
+// Snapshot writes a tar archive with all secrets below the folder prefix to w
+// Every secret is stored as JSON with its path relative to prefix, on K/V version 2 all retained
+// versions and their metadata are included, deleted and destroyed versions are stored without data
+func (c *Client) Snapshot(prefix string, w io.Writer) error {
+	return c.wrap(opSnapshot, prefix, c.snapshot(prefix, w))
+}
+
+// snapshot writes the tar archive of the secrets below prefix to w
+func (c *Client) snapshot(prefix string, w io.Writer) error {
+	if err := c.init(); err != nil {
+		return err
+	}
+	paths, err := c.walk(prefix, WalkOptions{})
+	if err != nil {
+		return err
+	}
+	tw := tar.NewWriter(w)
+	now := time.Now()
+	if err := writeTarJSON(tw, "manifest.json", now, snapshotManifest{Prefix: prefix, Version: c.Version, Created: now}); err != nil {
+		return err
+	}
+	dir := strings.TrimSuffix(prefix, "/") + "/"
+	for i, p := range paths {
+		secret, err := c.snapshotSecret(p)
+		if err != nil {
+			return err
+		}
+		secret.Path = strings.TrimPrefix(p, dir)
+		if err := writeTarJSON(tw, fmt.Sprintf("secrets/%06d.json", i), now, secret); err != nil {
+			return err
+		}
+	}
+	return tw.Close()
+}
+
+// snapshotSecret reads all retained versions of the secret p
+func (c *Client) snapshotSecret(p string) (*snapshotSecret, error) {
+	secret := &snapshotSecret{}
+	if c.Version != 2 {
+		data, _, err := c.read(p)
+		if err != nil {
+			return nil, c.wrap(opRead, p, err)
+		}
+		secret.Versions = append(secret.Versions, snapshotVersion{Data: data})
+		return secret, nil
+	}
+	m, err := c.ReadMetadata(p)
+	if err != nil {
+		return nil, err
+	}
+	if m == nil {
+		return secret, nil
+	}
+	for _, v := range m.SortedVersions() {
+		meta := m.Versions[v]
+		version := snapshotVersion{
+			Version:      v,
+			CreatedTime:  meta.CreatedTime,
+			DeletionTime: meta.DeletionTime,
+			Destroyed:    meta.Destroyed,
+		}
+		if !meta.Deleted() {
+			data, _, err := c.readVersion(p, v)
+			if err != nil && !IsDeleted(err) {
+				return nil, c.wrap(opRead, p, err)
+			}
+			version.Data = data
+		}
+		secret.Versions = append(secret.Versions, version)
+	}
+	return secret, nil
+}
+
+// Restore writes the secrets of a snapshot archive created by Snapshot below the folder prefix
+// The versions with data of every secret are written in ascending order, so the secrets get a
+// new version history with the same content, timestamps and deleted versions are not restored
+func (c *Client) Restore(r io.Reader, prefix string) error {
+	return c.wrap(opRestore, prefix, c.restore(r, prefix))
+}
+
+// restore writes the secrets of the snapshot archive r below prefix
+func (c *Client) restore(r io.Reader, prefix string) error {
+	if err := c.init(); err != nil {
+		return err
+	}
+	tr := tar.NewReader(r)
+	dir := strings.TrimSuffix(prefix, "/") + "/"
+	for {
+		hdr, err := tr.Next()
+		if err == io.EOF {
+			return nil
+		}
+		if err != nil {
+			return err
+		}
+		if !strings.HasPrefix(hdr.Name, "secrets/") {
+			continue
+		}
+		secret := snapshotSecret{}
+		dec := json.NewDecoder(tr)
+		dec.UseNumber()
+		if err := dec.Decode(&secret); err != nil {
+			return fmt.Errorf("invalid snapshot entry %s: %s", hdr.Name, err)
+		}
+		p := path.Join(dir, secret.Path)
+		if secret.Path == "" || !strings.HasPrefix(p, dir) {
+			return fmt.Errorf("invalid path %q in snapshot entry %s", secret.Path, hdr.Name)
+		}
+		for _, v := range secret.Versions {
+			if v.Data == nil {
+				continue
+			}
+			if err := c.Write(p, v.Data); err != nil {
+				return err
+			}
+		}
+	}
+}
+
+// writeTarJSON writes v as JSON entry name to tw
+func writeTarJSON(tw *tar.Writer, name string, modTime time.Time, v interface{}) error {
+	b, err := json.Marshal(v)
+	if err != nil {
+		return err
+	}
+	if err := tw.WriteHeader(&tar.Header{
+		Name:    name,
+		Mode:    0600,
+		Size:    int64(len(b)),
+		ModTime: modTime,
+	}); err != nil {
+		return err
+	}
+	_, err = tw.Write(b)
+	return err
+}
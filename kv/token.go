@@ -0,0 +1,42 @@
+package kv
+
+import "github.com/pkg/errors"
+
+// TokenSource returns the Vault token for a request
+type TokenSource interface {
+	Token() (string, error)
+}
+
+// TokenSourceFunc is a function implementing TokenSource
+// e.g. kv.TokenSourceFunc(v.GetToken) with a k8s.Vault v
+type TokenSourceFunc func() (string, error)
+
+// Token calls fn
+func (fn TokenSourceFunc) Token() (string, error) {
+	return fn()
+}
+
+// WithTokenSource consults ts before every request to Vault and sends the returned token,
+// so long-running processes keep working across token rotation
+// The token of the Vault client and SetToken are ignored for the requests of the kv.Client
+func WithTokenSource(ts TokenSource) Option {
+	return func(c *Client) error {
+		if ts == nil {
+			return errors.New("missing token source")
+		}
+		c.tokens = ts
+		return nil
+	}
+}
+
+// token returns the token of the TokenSource, an empty token is not allowed
+func (c *Client) token() (string, error) {
+	token, err := c.tokens.Token()
+	if err != nil {
+		return "", errors.Wrap(err, "failed to get token from token source")
+	}
+	if token == "" {
+		return "", errors.New("token source returned an empty token")
+	}
+	return token, nil
+}
@@ -0,0 +1,58 @@
+package kv
+
+import (
+	"fmt"
+	"sync"
+)
+
+// VersionedSecret is a version of a secret read by ReadLastVersions
+type VersionedSecret struct {
+	Version int
+	// Data is nil if the version is deleted or destroyed
+	Data map[string]interface{}
+	Meta *SecretMeta
+}
+
+// ReadLastVersions reads the latest n retained versions of the secret p from a K/V version 2 concurrently
+// The versions are returned newest first, it returns nil if the secret does not exist
+func (c *Client) ReadLastVersions(p string, n int) ([]VersionedSecret, error) {
+	if n < 1 {
+		return nil, c.wrap(opRead, p, fmt.Errorf("invalid number of versions %d", n))
+	}
+	m, err := c.ReadMetadata(p)
+	if err != nil || m == nil {
+		return nil, err
+	}
+	versions := m.SortedVersions()
+	if len(versions) > n {
+		versions = versions[len(versions)-n:]
+	}
+	result := make([]VersionedSecret, len(versions))
+	errs := make([]error, len(versions))
+	var wg sync.WaitGroup
+	for i, v := range versions {
+		// newest first
+		i = len(versions) - 1 - i
+		result[i] = VersionedSecret{Version: v, Meta: m.Versions[v]}
+		if m.Versions[v].Deleted() {
+			continue
+		}
+		wg.Add(1)
+		go func(i, v int) {
+			defer wg.Done()
+			data, _, err := c.readVersion(p, v)
+			if err != nil && !IsDeleted(err) {
+				errs[i] = err
+				return
+			}
+			result[i].Data = data
+		}(i, v)
+	}
+	wg.Wait()
+	for _, err := range errs {
+		if err != nil {
+			return nil, c.wrap(opRead, p, err)
+		}
+	}
+	return result, nil
+}
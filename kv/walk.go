@@ -0,0 +1,90 @@
+package kv
+
+import (
+	"sort"
+	"strings"
+	"sync"
+)
+
+// WalkFunc is called by Walk for every secret path
+type WalkFunc func(p string) error
+
+// WalkOptions for Walk
+type WalkOptions struct {
+	// Concurrency is the maximum number of concurrent list requests, defaults to 1
+	Concurrency int
+	// SkipForbidden skips folders the token is not allowed to list instead of returning an error
+	SkipForbidden bool
+	// OnSkip is called with the folder and the error for every folder skipped
+	OnSkip SkipFunc
+}
+
+// Walk lists all secrets below the folder p recursively and calls fn for every secret path
+// The folders are listed by up to opts.Concurrency workers, fn is called sequentially in
+// lexical order of the paths once the listing has completed, so the order is deterministic
+// regardless of the concurrency
+func (c *Client) Walk(p string, opts WalkOptions, fn WalkFunc) error {
+	paths, err := c.walk(p, opts)
+	if err != nil {
+		return err
+	}
+	for _, s := range paths {
+		if err := fn(s); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// walk returns all secret paths below the folder p in lexical order
+func (c *Client) walk(p string, opts WalkOptions) ([]string, error) {
+	n := opts.Concurrency
+	if n < 1 {
+		n = 1
+	}
+	var (
+		mu       sync.Mutex
+		wg       sync.WaitGroup
+		paths    []string
+		firstErr error
+	)
+	sem := make(chan struct{}, n)
+	var list func(dir string)
+	list = func(dir string) {
+		defer wg.Done()
+		sem <- struct{}{}
+		keys, err := c.List(dir)
+		<-sem
+		mu.Lock()
+		defer mu.Unlock()
+		if firstErr != nil {
+			return
+		}
+		if err != nil && opts.SkipForbidden && isForbidden(err) {
+			if opts.OnSkip != nil {
+				opts.OnSkip(dir, err)
+			}
+			return
+		}
+		if err != nil {
+			firstErr = err
+			return
+		}
+		for _, k := range keys {
+			if strings.HasSuffix(k, "/") {
+				wg.Add(1)
+				go list(dir + k)
+				continue
+			}
+			paths = append(paths, dir+k)
+		}
+	}
+	wg.Add(1)
+	go list(strings.TrimSuffix(p, "/") + "/")
+	wg.Wait()
+	if firstErr != nil {
+		return nil, firstErr
+	}
+	sort.Strings(paths)
+	return paths, nil
+}